@@ -0,0 +1,152 @@
+package main
+
+// Problem analytics
+//
+// GET /sections/{section}/analytics aggregates, for every problem of the
+// section's assignments, the work of its students: how many started and
+// finished it, the median number of saves and time from first save to
+// completion, and how long the finished proofs are next to the reference
+// solution. Instructors can see which problems are too hard before the due
+// date. Saves and times come from the recorded saves (see
+// datastore.GetProblemAttempts), so they leave out work saved before
+// saves were recorded.
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"datastore"
+)
+
+type sectionAnalytics struct {
+	Section  string             `json:"section"`
+	Students int                `json:"students"` // on the roster
+	Problems []problemAnalytics `json:"problems"` // in assignment order, then the order of each assignment
+}
+
+type problemAnalytics struct {
+	Assignment           string             `json:"assignment"`
+	ProblemId            string             `json:"problemId"`
+	Name                 string             `json:"name"`
+	Started              int                `json:"started"`                        // students who saved a proof of it
+	Finished             int                `json:"finished"`                       // students who completed it
+	CompletionRate       float64            `json:"completionRate"`                 // finished of started; 0 when none started
+	MedianSaves          *float64           `json:"medianSaves,omitempty"`          // of students with recorded saves
+	MedianSecondsToSolve *float64           `json:"medianSecondsToSolve,omitempty"` // first save to the first completing one
+	ReferenceLines       int                `json:"referenceLines"`                 // 0 without a reference solution
+	MedianLines          *float64           `json:"medianLines,omitempty"`          // of finished proofs
+	ProofLengths         []proofLengthCount `json:"proofLengths"`                   // finished proofs by length
+}
+
+type proofLengthCount struct {
+	Lines       int `json:"lines"`
+	Proofs      int `json:"proofs"`
+	VsReference int `json:"vsReference"` // lines more than the reference solution; 0 without one
+}
+
+// the median of values, nil for none
+func median(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Float64s(values)
+	m := values[len(values)/2]
+	if len(values)%2 == 0 {
+		m = (values[len(values)/2-1] + m) / 2
+	}
+	return &m
+}
+
+func analyzeProblem(attempts []datastore.ProblemAttempt, referenceLines int) problemAnalytics {
+	analytics := problemAnalytics{Started: len(attempts), ReferenceLines: referenceLines, ProofLengths: []proofLengthCount{}}
+	var saves, seconds, lines []float64
+	lengths := map[int]int{}
+	for _, attempt := range attempts {
+		if attempt.Saves > 0 {
+			saves = append(saves, float64(attempt.Saves))
+		}
+		if !attempt.Completed {
+			continue
+		}
+		analytics.Finished++
+		lines = append(lines, float64(attempt.Lines))
+		lengths[attempt.Lines]++
+		first, err1 := time.Parse(datastore.TimeFormat, attempt.FirstSaved)
+		completed, err2 := time.Parse(datastore.TimeFormat, attempt.CompletedAt)
+		if err1 == nil && err2 == nil {
+			seconds = append(seconds, completed.Sub(first).Seconds())
+		}
+	}
+	if analytics.Started > 0 {
+		analytics.CompletionRate = float64(analytics.Finished) / float64(analytics.Started)
+	}
+	analytics.MedianSaves, analytics.MedianSecondsToSolve, analytics.MedianLines = median(saves), median(seconds), median(lines)
+
+	for length, proofs := range lengths {
+		count := proofLengthCount{Lines: length, Proofs: proofs}
+		if referenceLines > 0 {
+			count.VsReference = length - referenceLines
+		}
+		analytics.ProofLengths = append(analytics.ProofLengths, count)
+	}
+	sort.Slice(analytics.ProofLengths, func(i, j int) bool { return analytics.ProofLengths[i].Lines < analytics.ProofLengths[j].Lines })
+	return analytics
+}
+
+func (env *Env) apiSectionAnalytics(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	assignmentName := req.URL.Query().Get("assignment")
+
+	assignments, err := env.ds.GetAssignmentsBySection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	roster, err := env.ds.GetRoster(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	result := sectionAnalytics{Section: params["section"], Problems: []problemAnalytics{}}
+	for _, member := range roster {
+		if member.Role == "student" {
+			result.Students++
+		}
+	}
+
+	found := false
+	for _, assignment := range assignments {
+		if assignmentName != "" && assignment.Name != assignmentName {
+			continue
+		}
+		found = true
+		problems, err := env.ds.GetAssignmentProofs(assignment)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		for _, problem := range problems {
+			attempts, err := env.ds.GetProblemAttempts(params["section"], problem.ProofName)
+			if err != nil {
+				writeDatastoreError(w, err)
+				return
+			}
+			referenceLines, err := env.ds.GetReferenceLines(problem)
+			if err != nil {
+				writeDatastoreError(w, err)
+				return
+			}
+			analytics := analyzeProblem(attempts, referenceLines)
+			analytics.Assignment, analytics.ProblemId, analytics.Name = assignment.Name, problem.Id, problem.ProofName
+			result.Problems = append(result.Problems, analytics)
+		}
+	}
+	if assignmentName != "" && !found {
+		writeAPIError(w, 404, errCodeNotFound, "no such assignment")
+		return
+	}
+	writeAPIJSON(w, 200, result)
+}
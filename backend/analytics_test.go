@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"datastore"
+)
+
+func TestAnalyzeProblem(t *testing.T) {
+	attempts := []datastore.ProblemAttempt{
+		{Student: "a", Saves: 2, FirstSaved: "2026-10-01 10:00:00", Completed: true, CompletedAt: "2026-10-01 10:05:00", Lines: 3},
+		{Student: "b", Saves: 6, FirstSaved: "2026-10-01 10:00:00", Completed: true, CompletedAt: "2026-10-01 10:15:00", Lines: 5},
+		{Student: "c", Saves: 4, FirstSaved: "2026-10-02 09:00:00", Lines: 7},
+		{Student: "d", Completed: true, Lines: 3}, // saved before saves were recorded
+	}
+	got := analyzeProblem(attempts, 3)
+	if got.Started != 4 || got.Finished != 3 || got.CompletionRate != 0.75 {
+		t.Errorf("counts: %+v", got)
+	}
+	if *got.MedianSaves != 4 || *got.MedianSecondsToSolve != 600 || *got.MedianLines != 3 {
+		t.Errorf("medians: %v %v %v", *got.MedianSaves, *got.MedianSecondsToSolve, *got.MedianLines)
+	}
+	want := []proofLengthCount{{Lines: 3, Proofs: 2, VsReference: 0}, {Lines: 5, Proofs: 1, VsReference: 2}}
+	if !reflect.DeepEqual(got.ProofLengths, want) {
+		t.Errorf("lengths: %+v", got.ProofLengths)
+	}
+
+	if got := analyzeProblem(nil, 0); got.CompletionRate != 0 || got.MedianSaves != nil || got.MedianLines != nil {
+		t.Errorf("no attempts: %+v", got)
+	}
+}
+
+func TestAPISectionAnalytics(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu","idle@csumb.edu"]}`), 200, "")
+	problem := datastore.Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - MP", ProofType: "prop",
+		Premise: []string{"P → Q", "P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "Q", RepoProblem: "true"}
+	if err := env.ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW","proofIds":[1],"visibility":"true"}`), 201, "")
+	attempt := problem
+	attempt.EntryType, attempt.UserSubmitted, attempt.ProofCompleted = "proof", student, "true"
+	attempt.Logic = []string{`[{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"P","jstr":"Pr"},{"wffstr":"Q","jstr":"1, 2 →E"}]`}
+	if err := env.ds.Store(attempt); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/sections/Logic/analytics", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/analytics?assignment=HW%202", ""), 404, errCodeNotFound)
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/analytics?assignment=HW", "")
+	expectAPIStatus(t, rr, 200, "")
+	var got sectionAnalytics
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if got.Students != 2 || len(got.Problems) != 1 {
+		t.Fatalf("analytics: %s", rr.Body.String())
+	}
+	p := got.Problems[0]
+	if p.Assignment != "HW" || p.ProblemId != "1" || p.Started != 1 || p.Finished != 1 || *p.MedianSaves != 1 ||
+		*p.MedianSecondsToSolve != 0 || len(p.ProofLengths) != 1 || p.ProofLengths[0].Lines != 3 {
+		t.Errorf("problem: %s", rr.Body.String())
+	}
+}
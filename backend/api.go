@@ -0,0 +1,1149 @@
+package main
+
+// Versioned REST API
+//
+// Routes under /api/v1 use resource paths and HTTP verbs. Every error is
+// returned as a JSON envelope with a machine-readable code:
+//
+//	{"error": {"code": "not_found", "message": "section does not exist"}}
+//
+// The flat routes registered in main stay as a compatibility shim while the
+// frontend migrates.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"datastore"
+	"logging"
+	"proofcheck"
+)
+
+const apiV1Prefix = "/api/v1"
+
+// Machine-readable error codes used in the error envelope
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeInvalidJSON      = "invalid_json"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeForbidden        = "forbidden"
+	errCodeNotFound         = "not_found"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeConflict         = "conflict"
+	errCodeInternal         = "internal_error"
+	errCodeNotImplemented   = "not_implemented"
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	output, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("writeAPIJSON: json marshal error", "error", err)
+		writeAPIError(w, 500, errCodeInternal, "json marshal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(output)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code string, message string) {
+	output, _ := json.Marshal(apiErrorEnvelope{Error: apiError{Code: code, Message: message}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(output)
+}
+
+// translate a datastore error into the matching API error
+func writeDatastoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNotExists):
+		writeAPIError(w, 404, errCodeNotFound, err.Error())
+	case errors.Is(err, datastore.ErrImportNotAllowed):
+		writeAPIError(w, 403, errCodeForbidden, err.Error())
+	case errors.Is(err, datastore.ErrDuplicate), errors.Is(err, datastore.ErrSectionFull),
+		errors.Is(err, datastore.ErrSectionArchived):
+		writeAPIError(w, 409, errCodeConflict, err.Error())
+	case errors.Is(err, datastore.ErrInvalidCursor),
+		errors.Is(err, datastore.ErrArchiveVersion),
+		errors.Is(err, datastore.ErrInvalidArchive),
+		errors.Is(err, datastore.ErrJoinCodeInvalid),
+		errors.Is(err, datastore.ErrJoinCodeDisabled),
+		errors.Is(err, datastore.ErrJoinCodeExpired):
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+	default:
+		logger.Error("writeDatastoreError: db access error", "error", err)
+		writeAPIError(w, 500, errCodeInternal, "db access error")
+	}
+}
+
+// answer a request rejected by the token middleware
+func rejectAPIToken(w http.ResponseWriter, req *http.Request, msg string) {
+	writeAPIError(w, 401, errCodeUnauthorized, msg)
+}
+
+// decode a JSON request body into v, answering 400 on failure
+func decodeAPIBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if req.Body == nil {
+		writeAPIError(w, 400, errCodeInvalidJSON, "request body required")
+		return false
+	}
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		writeAPIError(w, 400, errCodeInvalidJSON, "Unable to decode request body.")
+		return false
+	}
+	return true
+}
+
+// ===== Router =====
+
+// path parameters captured from {name} segments of a route pattern
+type apiParams map[string]string
+
+type apiHandler func(w http.ResponseWriter, req *http.Request, params apiParams)
+
+type apiRoute struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  apiHandler
+	doc      routeDoc
+}
+
+// A minimal method + path router: patterns are '/'-separated segments where
+// {name} matches any single (unescaped) segment
+type apiRouter struct {
+	routes []apiRoute
+}
+
+// register a route; doc describes it in the OpenAPI document (see openapi.go)
+func (r *apiRouter) handle(method string, pattern string, handler apiHandler, doc routeDoc) {
+	r.routes = append(r.routes, apiRoute{
+		method:   method,
+		pattern:  pattern,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler:  handler,
+		doc:      doc,
+	})
+}
+
+func (route apiRoute) match(segments []string) (apiParams, bool) {
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+	params := apiParams{}
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (r *apiRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// split the escaped path so that an encoded '/' stays inside its segment
+	path := strings.Trim(strings.TrimPrefix(req.URL.EscapedPath(), apiV1Prefix), "/")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeAPIError(w, 400, errCodeBadRequest, "malformed path")
+			return
+		}
+		segments[i] = unescaped
+	}
+
+	var allowed []string
+	for _, route := range r.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.method == req.Method {
+			setRoutePattern(req, apiV1Prefix+route.pattern)
+			route.handler(w, req, params)
+			return
+		}
+		allowed = append(allowed, route.method)
+	}
+
+	if len(allowed) != 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, 405, errCodeMethodNotAllowed, fmt.Sprintf("method %s not allowed", req.Method))
+		return
+	}
+	writeAPIError(w, 404, errCodeNotFound, "no such route")
+}
+
+// build the /api/v1 router; callers wrap it with token validation
+func (env *Env) apiV1() *apiRouter {
+	r := &apiRouter{}
+
+	r.handle("GET", "/admins", env.apiGetAdmins, routeDoc{
+		Summary: "List admin users", Access: "any user",
+		Response: apiAdminsResponse{}})
+
+	r.handle("POST", "/impersonations", env.apiStartImpersonation, routeDoc{
+		Summary: "Start a read-only session viewing the site as a student on a section's roster; send its id as X-Impersonate", Access: "admins",
+		Request: apiImpersonationRequest{}, Response: impersonationSession{}, Status: 201})
+	r.handle("DELETE", "/impersonations/{session}", env.apiEndImpersonation, routeDoc{
+		Summary: "End an impersonation session", Access: "the admin who started it",
+		Status: 204})
+
+	r.handle("GET", "/audit", env.apiQueryAudit, routeDoc{
+		Summary: "List audit log entries of administrative changes, newest first, one page at a time", Access: "admins",
+		Query:    auditQueryParams,
+		Response: datastore.AuditPage{}})
+
+	r.handle("GET", "/sections", env.apiListSections, routeDoc{
+		Summary: "List the sections the current user is on the roster of; archived ones only when asked for", Access: "any user",
+		Query:    []queryParam{{Name: "archived", Enum: []string{"exclude", "include", "only"}, Description: "exclude by default"}},
+		Response: []datastore.Section{}})
+	r.handle("POST", "/sections", env.apiCreateSection, routeDoc{
+		Summary: "Create a section owned by the current user", Access: "any user; the caller becomes its instructor",
+		Request: apiCreateSectionRequest{}, Response: datastore.Section{}, Status: 201})
+	r.handle("GET", "/sections/{section}", env.apiGetSection, routeDoc{
+		Summary: "Get one section", Access: "roster members",
+		Response: datastore.Section{}})
+	r.handle("PATCH", "/sections/{section}", env.apiUpdateSection, routeDoc{
+		Summary: "Change the term of a section, or archive or unarchive it", Access: "instructor",
+		Request: apiUpdateSectionRequest{}, Response: datastore.Section{}})
+	r.handle("POST", "/sections/{section}/clone", env.apiCloneSection, routeDoc{
+		Summary: "Create a section with the assignments of this one, but no roster or student work", Access: "instructor; the caller becomes the new section's instructor",
+		Request: apiCreateSectionRequest{}, Response: datastore.Section{}, Status: 201})
+	r.handle("DELETE", "/sections/{section}", env.apiDeleteSection, routeDoc{
+		Summary: "Delete a section with its roster and assignments; it can be restored until it is purged", Access: "instructor",
+		Status: 204})
+	r.handle("POST", "/sections/{section}/restore", env.apiRestoreSection, routeDoc{
+		Summary: "Restore a deleted section with the roster and assignments deleted with it", Access: "instructor of the deleted section",
+		Response: datastore.Section{}})
+	r.handle("GET", "/deleted", env.apiListDeleted, routeDoc{
+		Summary: "List the caller's deleted sections, and the deleted assignments and roster entries of their sections, until they are purged", Access: "any user",
+		Response: datastore.DeletedItems{}})
+
+	r.handle("GET", "/sections/{section}/archive", env.apiExportSection, routeDoc{
+		Summary: "Export a section with its roster, assignments, problems and student proofs", Access: "instructor",
+		Response: datastore.SectionArchive{}})
+	r.handle("POST", "/section-archives", env.apiImportSection, routeDoc{
+		Summary: "Import an exported section; its proofs get new ids", Access: "admins, or the instructor of the archived section",
+		Query:   []queryParam{{Name: "name", Description: "name of the imported section; the archived name if empty"}},
+		Request: datastore.SectionArchive{}, Response: datastore.ImportSummary{}, Status: 201})
+
+	r.handle("GET", "/sections/{section}/roster", env.apiGetRoster, routeDoc{
+		Summary: "List the students and TAs of a section", Access: "instructor, ta",
+		Response: []datastore.Roster{}})
+	r.handle("POST", "/sections/{section}/roster", env.apiAddRoster, routeDoc{
+		Summary: "Add students and TAs to a section", Access: "instructor",
+		Request: apiAddRosterRequest{}, Response: apiAddRosterResponse{}})
+	r.handle("DELETE", "/sections/{section}/roster/{email}", env.apiRemoveFromRoster, routeDoc{
+		Summary: "Remove a user from a section; the entry, and proofs archived with it, can be restored until it is purged", Access: "instructor",
+		Status: 204})
+	r.handle("POST", "/sections/{section}/roster/{email}/restore", env.apiRestoreRosterEntry, routeDoc{
+		Summary: "Restore a removed roster entry", Access: "instructor",
+		Response: datastore.Roster{}})
+
+	r.handle("GET", "/sections/{section}/join-code", env.apiGetJoinCode, routeDoc{
+		Summary: "Get the self-enrollment code of a section", Access: "instructor",
+		Response: datastore.JoinCode{}})
+	r.handle("PUT", "/sections/{section}/join-code", env.apiRegenerateJoinCode, routeDoc{
+		Summary: "Replace the self-enrollment code of a section", Access: "instructor",
+		Request: apiJoinCodeRequest{}, Response: datastore.JoinCode{}})
+	r.handle("DELETE", "/sections/{section}/join-code", env.apiDisableJoinCode, routeDoc{
+		Summary: "Stop the self-enrollment code of a section from accepting students", Access: "instructor",
+		Status: 204})
+	r.handle("POST", "/enrollments", env.apiCreateEnrollment, routeDoc{
+		Summary: "Join a section as a student using its join code", Access: "any user",
+		Request: apiEnrollmentRequest{}, Response: datastore.Roster{}, Status: 201})
+
+	r.handle("GET", "/sections/{section}/assignments", env.apiListAssignments, routeDoc{
+		Summary: "List the assignments of a section with their proofs", Access: "instructor, ta",
+		Response: []assignmentWithProofs{}})
+	r.handle("POST", "/sections/{section}/assignments", env.apiCreateAssignment, routeDoc{
+		Summary: "Create an assignment", Access: "instructor",
+		Request: apiAssignmentRequest{}, Response: datastore.Assignment{}, Status: 201})
+	r.handle("PUT", "/sections/{section}/assignments/{assignment}", env.apiUpdateAssignment, routeDoc{
+		Summary: "Replace an assignment; an empty name keeps the current one", Access: "instructor",
+		Request: apiAssignmentRequest{}, Response: datastore.Assignment{}})
+	r.handle("DELETE", "/sections/{section}/assignments/{assignment}", env.apiDeleteAssignment, routeDoc{
+		Summary: "Delete an assignment; it can be restored until it is purged", Access: "instructor",
+		Status: 204})
+	r.handle("POST", "/sections/{section}/assignments/{assignment}/restore", env.apiRestoreAssignment, routeDoc{
+		Summary: "Restore a deleted assignment", Access: "instructor",
+		Response: datastore.Assignment{}})
+
+	r.handle("GET", "/sections/{section}/proofs", env.apiSectionProofs, routeDoc{
+		Summary: "List proofs of the students of a section, one page at a time", Access: "instructor, ta",
+		Query:    append(append([]queryParam{}, proofFilterParams...), proofPageParams...),
+		Response: apiProofPage{}})
+	r.handle("GET", "/sections/{section}/events", env.apiSectionEvents, routeDoc{
+		Summary: "Stream an event whenever a student of the section saves a proof", Access: "instructor, ta",
+		Response: datastore.ProofEvent{}, EventStream: true})
+	r.handle("GET", "/sections/{section}/completed-proofs", env.apiSectionCompletedProofs, routeDoc{
+		Summary: "List completed repository proofs of the students of a section, one page at a time", Access: "instructor, ta",
+		Query:    proofPageParams,
+		Response: apiProofPage{}})
+	r.handle("GET", "/sections/{section}/assignments/{assignment}/completed-proofs", env.apiAssignmentCompletedProofs, routeDoc{
+		Summary: "List completed proofs of the students of a section for one assignment", Access: "instructor, ta",
+		Response: []datastore.Proof{}})
+	r.handle("GET", "/sections/{section}/analytics", env.apiSectionAnalytics, routeDoc{
+		Summary: "Report, for each problem of a section's assignments, how many students started and finished it, their saves, time to solve and proof lengths", Access: "instructor, ta",
+		Query:    []queryParam{{Name: "assignment", Description: "report only this assignment"}},
+		Response: sectionAnalytics{}})
+	r.handle("GET", "/sections/{section}/mistakes", env.apiSectionMistakes, routeDoc{
+		Summary: "Report the most widespread mistakes in the failed proofs of a section's students, per problem and per rule", Access: "instructor, ta",
+		Query: []queryParam{{Name: "student", Description: "report only this student"},
+			{Name: "limit", Description: fmt.Sprintf("mistakes per problem and per rule, default %d, at most %d", defaultMistakeLimit, maxMistakeLimit)}},
+		Response: sectionMistakes{}})
+	r.handle("GET", "/sections/{section}/similarity", env.apiSectionSimilarity, routeDoc{
+		Summary: "Rank pairs of students' proofs of the same problem that look copied: identical, sharing mistakes, or close by line edit distance", Access: "instructor, ta",
+		Query: []queryParam{{Name: "assignment", Description: "compare only this assignment's problems"},
+			{Name: "minLines", Description: fmt.Sprintf("leave out proofs with fewer lines besides premises, default %d", defaultSimilarityMinLines)},
+			{Name: "minSimilarity", Description: fmt.Sprintf("similarity from 0 to 1 that makes a pair suspicious, default %g", defaultMinSimilarity)},
+			{Name: "limit", Description: fmt.Sprintf("pairs, default %d, at most %d", defaultSimilarityLimit, maxSimilarityLimit)}},
+		Response: similarityReport{}})
+	r.handle("GET", "/sections/{section}/similarity/compare", env.apiCompareProofs, routeDoc{
+		Summary: "Show two proofs of the same problem by students of a section side by side, normalized and aligned", Access: "instructor, ta",
+		Query:    []queryParam{{Name: "a", Required: true, Description: "proof id"}, {Name: "b", Required: true, Description: "proof id"}},
+		Response: sideBySide{}})
+	r.handle("GET", "/sections/{section}/at-risk", env.apiSectionAtRisk, routeDoc{
+		Summary: "Flag the students of a section who are falling behind: inactive, nothing completed in the last two assignments due, or repeated failed saves", Access: "instructor, ta",
+		Query: []queryParam{{Name: "format", Enum: atRiskFormats, Description: "json by default"},
+			{Name: "inactiveDays", Description: fmt.Sprintf("days without a save that flag a student, default %d", defaultInactiveDays)},
+			{Name: "failedAttempts", Description: fmt.Sprintf("saves with issues of one problem that flag a student, default %d", defaultFailedAttempts)}},
+		Response: atRiskReport{}, MediaTypes: []string{"text/csv"}})
+	r.handle("POST", "/sections/{section}/at-risk/notify", env.apiNotifyAtRisk, routeDoc{
+		Summary: "Send the at-risk report of a section to its instructor, if any student is flagged", Access: "instructor",
+		Query: []queryParam{{Name: "inactiveDays"}, {Name: "failedAttempts"}},
+		Response: atRiskNotification{}})
+
+	r.handle("GET", "/proofs", env.apiListProofs, routeDoc{
+		Summary: "List proofs of the current user; every selection but repo is paginated", Access: "any user; downloadrepo is for admins only",
+		Query: append([]queryParam{{Name: "selection", Required: true, Enum: proofSelections},
+			{Name: "student", Description: "downloadrepo only"}}, proofPageParams...),
+		Response: oneOf{apiProofPage{}, []datastore.SectionProofs{}}})
+	r.handle("POST", "/proofs", env.apiSaveProof, routeDoc{
+		Summary: "Add or update a proof of the current user", Access: "any user",
+		Request: datastore.Proof{}, Status: 204})
+	r.handle("GET", "/proofs/{proof}/render", env.apiRenderProof, routeDoc{
+		Summary: "Render a stored proof as Unicode text, fitch.sty or lplfitch LaTeX, or a PDF made with pdflatex", Access: "its owner, admins, and the instructors and TAs of its owner's sections",
+		Query: []queryParam{{Name: "format", Required: true, Enum: proofRenderFormats},
+			{Name: "layout", Enum: proofRenderLayouts, Description: "LaTeX package for latex and pdf; fitch by default"}},
+		MediaTypes: []string{"text/plain", "text/x-tex", "application/pdf"}})
+	r.handle("GET", "/rule-sets", env.apiListRuleSets, routeDoc{
+		Summary: "List the rule set presets assignments can allow", Access: "any user",
+		Response: []proofcheck.RuleSet{}})
+	r.handle("GET", "/arguments", env.apiListArguments, routeDoc{
+		Summary: "List the arguments (repository problems) authored by the current user", Access: "any user",
+		Response: []datastore.Proof{}})
+
+	r.handle("GET", "/problems", env.apiSearchProblems, routeDoc{
+		Summary: "Search the problem bank, one page at a time", Access: "any user; sees their own problems, shared ones and, for staff, department ones",
+		Query:    problemSearchParams,
+		Response: datastore.ProblemPage{}})
+	r.handle("POST", "/problems", env.apiCreateProblem, routeDoc{
+		Summary: "Add a problem to the bank, or update the caller's argument of the same name", Access: "any user; only staff can share beyond themselves",
+		Request: datastore.Problem{}, Response: datastore.Problem{}, Status: 201})
+	r.handle("GET", "/problems/{problem}", env.apiGetProblem, routeDoc{
+		Summary: "Get one bank problem", Access: "users it is visible to",
+		Response: datastore.Problem{}})
+	r.handle("PUT", "/problems/{problem}", env.apiUpdateProblem, routeDoc{
+		Summary: "Replace a bank problem", Access: "its owner; only staff can share beyond themselves",
+		Request: datastore.Problem{}, Response: datastore.Problem{}})
+	r.handle("POST", "/problem-sets", env.apiImportProblemSet, routeDoc{
+		Summary: "Add a text, Carnap or JSON problem set to the bank, and with a section to the assignments it names", Access: "any user; the section's instructor with section",
+		Query: []queryParam{{Name: "format", Required: true, Enum: problemSetFormats},
+			{Name: "section", Description: "section to add the set's assignments to"},
+			{Name: "assignment", Description: "assignment for problems that do not name one"}},
+		Request: problemSet{}, Response: apiProblemSetImport{}, Status: 201, MediaTypes: []string{"text/plain", "text/markdown"}})
+	r.handle("GET", "/sections/{section}/problem-set", env.apiExportProblemSet, routeDoc{
+		Summary: "Export the problems of a section's assignments as a text, Carnap or JSON problem set", Access: "instructor, ta",
+		Query: []queryParam{{Name: "format", Required: true, Enum: problemSetFormats},
+			{Name: "assignment", Description: "export only this assignment"}},
+		Response: problemSet{}, MediaTypes: []string{"text/plain", "text/markdown"}})
+
+	return r
+}
+
+// ===== Authorization helpers =====
+
+// allow the section's instructor, and its TAs when allowTA is set; answers 403 otherwise
+func (env *Env) apiAuthorize(w http.ResponseWriter, req *http.Request, sectionName string, allowTA bool) bool {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var ok bool
+	var err error
+	if allowTA {
+		ok, err = env.isSectionStaff(user, sectionName)
+	} else {
+		ok, err = env.isSectionInstructor(user, sectionName)
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return false
+	}
+
+	if !ok {
+		writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+	}
+	return ok
+}
+
+// ===== Handlers =====
+
+type apiAdminsResponse struct {
+	Admins []string `json:"admins"`
+}
+
+func (env *Env) apiGetAdmins(w http.ResponseWriter, req *http.Request, params apiParams) {
+	writeAPIJSON(w, 200, apiAdminsResponse{Admins: env.ds.GetAdmins()})
+}
+
+// sections the current user is on the roster of, in any role
+func (env *Env) apiListSections(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var sections, archived []datastore.Section
+	var err error
+	switch req.URL.Query().Get("archived") {
+	case "", "exclude":
+		sections, err = env.ds.GetSections(user.GetEmail())
+	case "include":
+		sections, err = env.ds.GetSections(user.GetEmail())
+		if err == nil {
+			archived, err = env.ds.GetArchivedSections(user.GetEmail())
+			sections = append(sections, archived...)
+		}
+	case "only":
+		sections, err = env.ds.GetArchivedSections(user.GetEmail())
+	default:
+		writeAPIError(w, 400, errCodeBadRequest, "archived must be exclude, include or only")
+		return
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if sections == nil {
+		sections = []datastore.Section{}
+	}
+	writeAPIJSON(w, 200, sections)
+}
+
+// body of both section create and clone
+type apiCreateSectionRequest struct {
+	Name string `json:"name"`
+	Term string `json:"term"` // e.g. "Fall 2026", optional
+}
+
+// create a section owned by the current user
+func (env *Env) apiCreateSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var requestData apiCreateSectionRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	if requestData.Name == "" {
+		writeAPIError(w, 400, errCodeBadRequest, "section name required")
+		return
+	}
+
+	if _, err := env.ds.GetSection(requestData.Name); err == nil {
+		writeAPIError(w, 409, errCodeConflict, "section already exists")
+		return
+	}
+
+	section := datastore.Section{InstructorEmail: user.GetEmail(), Name: requestData.Name, Term: requestData.Term}
+	if err := env.ds.InsertSection(section); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	err := env.ds.InsertRoster(datastore.Roster{SectionName: section.Name, UserEmail: user.GetEmail(), Role: "instructor"})
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.create", section.Name, section.Name, nil, section)
+
+	writeAPIJSON(w, 201, section)
+}
+
+// a single section: any member of its roster
+func (env *Env) apiGetSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	_, err := env.ds.GetRole(params["section"], user.GetEmail())
+	if errors.Is(err, datastore.ErrNotExists) {
+		writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+		return
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+
+	section, err := env.ds.GetSection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, section)
+}
+
+// fields left out of the request are not changed
+type apiUpdateSectionRequest struct {
+	Term     *string `json:"term"`
+	Archived *bool   `json:"archived"`
+}
+
+func (env *Env) apiUpdateSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	var requestData apiUpdateSectionRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	before, err := env.ds.GetSection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if requestData.Term != nil {
+		if err := env.ds.SetSectionTerm(params["section"], *requestData.Term); err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+	}
+	if requestData.Archived != nil {
+		if err := env.ds.SetSectionArchived(params["section"], *requestData.Archived); err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		user := req.Context().Value("tok").(userWithEmail)
+		logger.InfoContext(req.Context(), "apiUpdateSection: archived changed", logging.Email("instructor", user.GetEmail()),
+			"section", params["section"], "archived", *requestData.Archived)
+	}
+
+	section, err := env.ds.GetSection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.update", section.Name, section.Name, before, section)
+	writeAPIJSON(w, 200, section)
+}
+
+// start a new term: a section with the same assignments, owned by the caller
+func (env *Env) apiCloneSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var requestData apiCreateSectionRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	if requestData.Name == "" {
+		writeAPIError(w, 400, errCodeBadRequest, "section name required")
+		return
+	}
+
+	section, err := env.ds.CloneSection(params["section"],
+		datastore.Section{InstructorEmail: user.GetEmail(), Name: requestData.Name, Term: requestData.Term})
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.clone", section.Name, section.Name, nil,
+		map[string]interface{}{"section": section, "clonedFrom": params["section"]})
+	writeAPIJSON(w, 201, section)
+}
+
+func (env *Env) apiDeleteSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	before := env.currentSection(params["section"])
+	if err := env.ds.RemoveSection(params["section"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.delete", params["section"], params["section"], before, nil)
+	w.WriteHeader(204)
+}
+
+func (env *Env) apiGetRoster(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+
+	roster, err := env.ds.GetRoster(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if roster == nil {
+		roster = []datastore.Roster{}
+	}
+	writeAPIJSON(w, 200, roster)
+}
+
+type apiAddRosterRequest struct {
+	StudentEmails []string `json:"studentEmails"`
+	TaEmails      []string `json:"taEmails"`
+}
+
+type apiAddRosterResponse struct {
+	Failed []insertionErr `json:"failed"`
+}
+
+// add students and TAs to a section; emails that could not be added are listed in "failed"
+func (env *Env) apiAddRoster(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	var requestData apiAddRosterRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+
+	response := apiAddRosterResponse{Failed: []insertionErr{}}
+	add := func(emails []string, role string, admin int) {
+		for _, email := range emails {
+			env.ds.InsertUser(datastore.User{Email: email, FirstName: "", LastName: "", Admin: admin})
+			rosterRow := datastore.Roster{SectionName: params["section"], UserEmail: email, Role: role}
+			err := env.ds.InsertRoster(rosterRow)
+			if err != nil {
+				response.Failed = append(response.Failed, insertionErr{Email: email, Msg: err.Error()})
+			} else {
+				env.audit(req, "roster.add", params["section"], email, nil, rosterRow)
+			}
+		}
+	}
+	add(requestData.StudentEmails, "student", 0)
+	add(requestData.TaEmails, "ta", 1)
+
+	writeAPIJSON(w, 200, response)
+}
+
+func (env *Env) apiRemoveFromRoster(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	role, err := env.ds.GetRole(params["section"], params["email"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if err := env.ds.RemoveFromRoster(params["section"], params["email"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "roster.remove", params["section"], params["email"],
+		datastore.Roster{SectionName: params["section"], UserEmail: params["email"], Role: role}, nil)
+	w.WriteHeader(204)
+}
+
+func (env *Env) apiGetJoinCode(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	joinCode, err := env.ds.GetJoinCode(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, joinCode)
+}
+
+type apiJoinCodeRequest struct {
+	ExpiresAt string `json:"expiresAt"` // RFC 3339, empty for no expiry
+	SeatLimit int    `json:"seatLimit"` // 0 for no limit
+}
+
+// replace the section's join code, optionally with an expiry (RFC 3339) and a seat limit
+func (env *Env) apiRegenerateJoinCode(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	var requestData apiJoinCodeRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	expiresAt, err := joinCodeExpiry(requestData.ExpiresAt, requestData.SeatLimit)
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	before, _ := env.ds.GetJoinCode(params["section"])
+	joinCode, err := env.ds.RegenerateJoinCode(params["section"], expiresAt, requestData.SeatLimit)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "joincode.regenerate", params["section"], params["section"], before, joinCode)
+	writeAPIJSON(w, 200, joinCode)
+}
+
+func (env *Env) apiDisableJoinCode(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	before, _ := env.ds.GetJoinCode(params["section"])
+	if err := env.ds.DisableJoinCode(params["section"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	after, _ := env.ds.GetJoinCode(params["section"])
+	env.audit(req, "joincode.disable", params["section"], params["section"], before, after)
+	w.WriteHeader(204)
+}
+
+type apiEnrollmentRequest struct {
+	JoinCode string `json:"joinCode"`
+}
+
+// enroll the current user as a student using a section join code
+func (env *Env) apiCreateEnrollment(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var requestData apiEnrollmentRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	if requestData.JoinCode == "" {
+		writeAPIError(w, 400, errCodeBadRequest, "join code required")
+		return
+	}
+
+	sectionName, err := env.ds.EnrollWithJoinCode(requestData.JoinCode, user.GetEmail())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+
+	rosterRow := datastore.Roster{SectionName: sectionName, UserEmail: user.GetEmail(), Role: "student"}
+	env.audit(req, "roster.join", sectionName, user.GetEmail(), nil, rosterRow)
+	writeAPIJSON(w, 201, rosterRow)
+}
+
+func (env *Env) apiListAssignments(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+
+	assignmentDetails, err := env.ds.GetAssignmentsBySection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+
+	assignments := []assignmentWithProofs{}
+	for _, v := range assignmentDetails {
+		proofs, err := env.ds.GetAssignmentProofs(v)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		assignments = append(assignments, assignmentWithProofs{Name: v.Name, ProofList: proofs, Visibility: v.Visibility, RuleSet: v.RuleSet, DueDate: v.DueDate})
+	}
+	writeAPIJSON(w, 200, assignments)
+}
+
+// body of both assignment create and update
+type apiAssignmentRequest struct {
+	Name       string  `json:"name"`
+	ProofIds   []int   `json:"proofIds"`
+	Visibility string  `json:"visibility"` // 'true' or 'false'
+	RuleSet    *string `json:"ruleSet"`    // a preset, comma-separated rules or "" for every rule; left out, unchanged
+	DueDate    *string `json:"dueDate"`    // "2006-01-02", "2006-01-02 15:04:05" (UTC) or "" for none; left out, unchanged
+}
+
+func (env *Env) apiCreateAssignment(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	var requestData apiAssignmentRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	if requestData.Name == "" {
+		writeAPIError(w, 400, errCodeBadRequest, "assignment name required")
+		return
+	}
+
+	if !env.apiAuthorizeProblems(w, req, requestData.ProofIds) {
+		return
+	}
+	ruleSet := ""
+	if requestData.RuleSet != nil {
+		ruleSet = *requestData.RuleSet
+	}
+	if _, err := proofcheck.AllowedRules(ruleSet); err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	var dueDate string
+	if requestData.DueDate != nil {
+		var err error
+		if dueDate, err = parseDueDate(*requestData.DueDate); err != nil {
+			writeAPIError(w, 400, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	assignment := datastore.Assignment{
+		SectionName: params["section"],
+		Name:        requestData.Name,
+		ProofIds:    fmt.Sprint(requestData.ProofIds),
+		Visibility:  requestData.Visibility,
+		RuleSet:     strings.TrimSpace(ruleSet),
+		DueDate:     dueDate,
+	}
+	if err := env.ds.InsertAssignment(assignment); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "assignment.create", assignment.SectionName, assignment.Name, nil, assignment)
+	writeAPIJSON(w, 201, assignment)
+}
+
+// replace an assignment's name, proofs and visibility; an empty name keeps the current one
+func (env *Env) apiUpdateAssignment(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	var requestData apiAssignmentRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	if requestData.Name == "" {
+		requestData.Name = params["assignment"]
+	}
+
+	if !env.apiAuthorizeProblems(w, req, requestData.ProofIds) {
+		return
+	}
+	ruleSet, err := env.assignmentRuleSet(params["section"], params["assignment"], requestData.RuleSet)
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	dueDate, err := env.assignmentDueDate(params["section"], params["assignment"], requestData.DueDate)
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	assignment := datastore.Assignment{
+		SectionName: params["section"],
+		Name:        requestData.Name,
+		ProofIds:    fmt.Sprint(requestData.ProofIds),
+		Visibility:  requestData.Visibility,
+		RuleSet:     ruleSet,
+		DueDate:     dueDate,
+	}
+	before := env.currentAssignment(params["section"], params["assignment"])
+	if err := env.ds.UpdateAssignment(params["assignment"], assignment); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "assignment.update", params["section"], params["assignment"], before, assignment)
+	writeAPIJSON(w, 200, assignment)
+}
+
+func (env *Env) apiDeleteAssignment(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	before := env.currentAssignment(params["section"], params["assignment"])
+	if err := env.ds.RemoveAssignment(params["section"], params["assignment"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "assignment.delete", params["section"], params["assignment"], before, nil)
+	w.WriteHeader(204)
+}
+
+// ===== Proof listings =====
+
+const (
+	defaultProofPageSize = 100
+	maxProofPageSize     = 1000
+)
+
+// one page of a proof listing; pass nextCursor as ?cursor= to get the next page
+type apiProofPage struct {
+	Proofs     []datastore.Proof `json:"proofs"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// filters of the section proof listing
+var proofFilterParams = []queryParam{
+	{Name: "student", Description: "email of one student"},
+	{Name: "state", Description: "comma-separated completion states: true, false, error"},
+}
+
+// paging, sorting and the filters shared by every paginated proof listing
+var proofPageParams = []queryParam{
+	{Name: "problem", Description: "proof name"},
+	{Name: "proofType", Enum: []string{"prop", "fol"}},
+	{Name: "after", Description: "RFC 3339 time; proofs submitted at or after it"},
+	{Name: "before", Description: "RFC 3339 time; proofs submitted before it"},
+	{Name: "sort", Enum: []string{"id", "time", "student", "problem"}},
+	{Name: "order", Enum: []string{"asc", "desc"}},
+	{Name: "limit", Description: fmt.Sprintf("page size, default %d, at most %d", defaultProofPageSize, maxProofPageSize)},
+	{Name: "cursor", Description: "nextCursor of the previous page"},
+}
+
+// apply the proofPageParams of a request to q
+func parseProofPage(values url.Values, q *datastore.ProofQuery) error {
+	if problem := values.Get("problem"); problem != "" {
+		q.ProofName = problem
+	}
+	switch proofType := values.Get("proofType"); proofType {
+	case "":
+	case "prop", "fol":
+		q.ProofType = proofType
+	default:
+		return fmt.Errorf("invalid proofType %q", proofType)
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest *string
+	}{{"after", &q.SubmittedAfter}, {"before", &q.SubmittedBefore}} {
+		value := values.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 time", bound.name)
+		}
+		*bound.dest = t.UTC().Format(datastore.TimeFormat)
+	}
+
+	switch sort := values.Get("sort"); sort {
+	case "":
+	case "id", "time", "student", "problem":
+		q.Sort = sort
+	default:
+		return fmt.Errorf("invalid sort %q", sort)
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return fmt.Errorf("invalid order %q", order)
+	}
+
+	q.Limit = defaultProofPageSize
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxProofPageSize {
+			return fmt.Errorf("limit must be between 1 and %d", maxProofPageSize)
+		}
+		q.Limit = n
+	}
+	q.Cursor = values.Get("cursor")
+	return nil
+}
+
+// run q and write the page, answering 400 for a bad cursor
+func (env *Env) writeProofPage(w http.ResponseWriter, q datastore.ProofQuery) {
+	page, err := env.ds.QueryProofs(q)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if page.Proofs == nil {
+		page.Proofs = []datastore.Proof{}
+	}
+	writeAPIJSON(w, 200, apiProofPage{Proofs: page.Proofs, NextCursor: page.NextCursor})
+}
+
+// proofs of the students of a section, filtered by student, problem, state, type and time
+func (env *Env) apiSectionProofs(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+
+	values := req.URL.Query()
+	q := datastore.ProofQuery{SectionName: params["section"], UserSubmitted: values.Get("student")}
+	if state := values.Get("state"); state != "" {
+		for _, s := range strings.Split(state, ",") {
+			if s != "true" && s != "false" && s != "error" {
+				writeAPIError(w, 400, errCodeBadRequest, fmt.Sprintf("invalid state %q", s))
+				return
+			}
+			q.ProofCompleted = append(q.ProofCompleted, s)
+		}
+	}
+	if err := parseProofPage(values, &q); err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	env.writeProofPage(w, q)
+}
+
+func (env *Env) apiSectionCompletedProofs(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+
+	q := datastore.CompletedProofsQuery(params["section"])
+	if err := parseProofPage(req.URL.Query(), &q); err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	env.writeProofPage(w, q)
+}
+
+func (env *Env) apiAssignmentCompletedProofs(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+
+	proofs, err := env.ds.GetCompletedProofsByAssignment(params["section"], params["assignment"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if proofs == nil {
+		proofs = []datastore.Proof{}
+	}
+	writeAPIJSON(w, 200, proofs)
+}
+
+// list proofs for the current user; ?selection= is one of user, repo, completedrepo or downloadrepo
+func (env *Env) apiListProofs(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	values := req.URL.Query()
+
+	var q datastore.ProofQuery
+	switch selection := values.Get("selection"); selection {
+	case "user":
+		q = datastore.UserProofsQuery(user.GetEmail())
+
+	case "repo":
+		// repository problems are grouped by section and not paginated
+		err, sectionProofs := env.ds.GetRepoProofs(user)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		if sectionProofs == nil {
+			sectionProofs = []datastore.SectionProofs{}
+		}
+		withAllowedRules(sectionProofs)
+		writeAPIJSON(w, 200, sectionProofs)
+		return
+
+	case "completedrepo":
+		q = datastore.UserCompletedProofsQuery(user.GetEmail())
+
+	case "downloadrepo":
+		if !admin_users[user.GetEmail()] {
+			writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+			return
+		}
+		q = datastore.AttemptedRepoProofsQuery()
+		q.UserSubmitted = values.Get("student")
+
+	case "":
+		writeAPIError(w, 400, errCodeBadRequest, "selection required")
+		return
+
+	default:
+		writeAPIError(w, 400, errCodeBadRequest, fmt.Sprintf("invalid selection %q", selection))
+		return
+	}
+
+	if err := parseProofPage(values, &q); err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	env.writeProofPage(w, q)
+}
+
+// add or update a proof of the current user
+func (env *Env) apiSaveProof(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var submittedProof datastore.Proof
+	if !decodeAPIBody(w, req, &submittedProof) {
+		return
+	}
+	if len(submittedProof.ProofName) == 0 {
+		writeAPIError(w, 400, errCodeBadRequest, "Proof name is empty")
+		return
+	}
+
+	// Replace submitted email (if any) with the email from the token
+	submittedProof.UserSubmitted = user.GetEmail()
+
+	issues, err := env.disallowedRules(submittedProof)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if len(issues) != 0 {
+		writeAPIError(w, 400, errCodeBadRequest, strings.Join(issues, " "))
+		return
+	}
+
+	if err := env.ds.Store(submittedProof); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.recordMistakes(req.Context(), submittedProof)
+	w.WriteHeader(204)
+}
+
+// arguments (repository problems) authored by the current user
+func (env *Env) apiListArguments(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	arguments, err := env.ds.GetUserArguments(user)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if arguments == nil {
+		arguments = []datastore.Proof{}
+	}
+	writeAPIJSON(w, 200, arguments)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+// open an Env on a fresh in-memory database named after the running test
+func newTestEnv(t *testing.T) *Env {
+	t.Helper()
+	ds, err := datastore.InitDB("file:" + t.Name() + "?mode=memory&cache=shared&_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ds.Close() })
+	return &Env{ds}
+}
+
+// send a request to the /api/v1 router as the given user
+func apiRequest(t *testing.T, handler http.Handler, email string, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), "tok", MockUserWithEmail{email})
+	req, err := http.NewRequestWithContext(ctx, method, apiV1Prefix+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, req)
+	return responseRecorder
+}
+
+// check the status code and, for errors, the code inside the JSON error envelope
+func expectAPIStatus(t *testing.T, rr *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rr.Code != status {
+		t.Fatalf("got status %v want %v, body: %s", rr.Code, status, rr.Body.String())
+	}
+	if code == "" {
+		return
+	}
+	var envelope apiErrorEnvelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("error response is not a JSON envelope: %s", rr.Body.String())
+	}
+	if envelope.Error.Code != code {
+		t.Errorf("got error code %q want %q", envelope.Error.Code, code)
+	}
+}
+
+func TestAPIRouting(t *testing.T) {
+	api := newTestEnv(t).apiV1()
+
+	expectAPIStatus(t, apiRequest(t, api, "user@csumb.edu", "GET", "/no-such-thing", ""), 404, errCodeNotFound)
+
+	rr := apiRequest(t, api, "user@csumb.edu", "PATCH", "/sections", "")
+	expectAPIStatus(t, rr, 405, errCodeMethodNotAllowed)
+	if allow := rr.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("got Allow %q want %q", allow, "GET, POST")
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, "user@csumb.edu", "POST", "/sections", "{"), 400, errCodeInvalidJSON)
+	expectAPIStatus(t, apiRequest(t, api, "user@csumb.edu", "GET", "/proofs?selection=everything", ""), 400, errCodeBadRequest)
+}
+
+func TestAPISectionLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor, Admin: 1})
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"CST 329/01"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"CST 329/01"}`), 409, errCodeConflict)
+
+	// section names are single, escaped path segments
+	section := "/sections/CST%20329%2F01"
+
+	expectAPIStatus(t, apiRequest(t, api, "student@csumb.edu", "GET", section+"/roster", ""), 403, errCodeForbidden)
+
+	rr := apiRequest(t, api, instructor, "POST", section+"/roster", `{"studentEmails":["student@csumb.edu"],"taEmails":["ta@csumb.edu"]}`)
+	expectAPIStatus(t, rr, 200, "")
+	if rr.Body.String() != `{"failed":[]}` {
+		t.Errorf("unexpected add roster body: %s", rr.Body.String())
+	}
+
+	// TAs can read the roster but not change it
+	expectAPIStatus(t, apiRequest(t, api, "ta@csumb.edu", "GET", section+"/roster", ""), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, "ta@csumb.edu", "DELETE", section+"/roster/student@csumb.edu", ""), 403, errCodeForbidden)
+
+	expectAPIStatus(t, apiRequest(t, api, "student@csumb.edu", "GET", section, ""), 200, "")
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", section+"/assignments", `{"name":"HW 1","proofIds":[1],"visibility":"false"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PUT", section+"/assignments/HW%201", `{"name":"Homework 1","proofIds":[],"visibility":"true"}`), 200, "")
+
+	assignments, err := env.ds.GetAssignmentsBySection("CST 329/01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0].Name != "Homework 1" || assignments[0].Visibility != "true" {
+		t.Errorf("unexpected assignments after update: %+v", assignments)
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", section+"/assignments/Homework%201", ""), 204, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", section+"/roster/nobody@csumb.edu", ""), 404, errCodeNotFound)
+
+	rr = apiRequest(t, api, instructor, "GET", "/sections", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), `"Name":"CST 329/01"`) {
+		t.Errorf("unexpected sections: %s", rr.Body.String())
+	}
+}
+
+func TestAPIProofs(t *testing.T) {
+	api := newTestEnv(t).apiV1()
+	student := "student@csumb.edu"
+
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/proofs", `{"ProofName":""}`), 400, errCodeBadRequest)
+	// GetUserProofs hides proof names containing Test, Quiz or Final
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/proofs", `{"ProofName":"Practice 1","EntryType":"proof","ProofCompleted":"false"}`), 204, "")
+
+	rr := apiRequest(t, api, student, "GET", "/proofs?selection=user", "")
+	expectAPIStatus(t, rr, 200, "")
+
+	var page apiProofPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Proofs) != 1 || page.Proofs[0].ProofName != "Practice 1" || page.Proofs[0].UserSubmitted != student {
+		t.Errorf("unexpected proofs: %+v", page.Proofs)
+	}
+}
+
+func TestAPISectionProofs(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor, Admin: 1})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster",
+		`{"studentEmails":["a@csumb.edu","b@csumb.edu"]}`), 200, "")
+
+	for _, student := range []string{"a@csumb.edu", "b@csumb.edu"} {
+		for _, name := range []string{"Repository - One", "Repository - Two", "Repository - Three"} {
+			err := env.ds.Store(datastore.Proof{EntryType: "proof", UserSubmitted: student, ProofName: name, ProofType: "prop",
+				Premise: []string{}, Logic: []string{}, Rules: []string{}, EverCompleted: "true", ProofCompleted: "true", RepoProblem: "true"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// walk every page of b's proofs, newest id first
+	var names []string
+	path := "/sections/Logic/proofs?student=b@csumb.edu&state=true&order=desc&limit=2"
+	for cursor, pages := "", 0; pages == 0 || cursor != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("pagination did not terminate")
+		}
+		rr := apiRequest(t, api, instructor, "GET", path+"&cursor="+cursor, "")
+		expectAPIStatus(t, rr, 200, "")
+		var page apiProofPage
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, proof := range page.Proofs {
+			if proof.UserSubmitted != "b@csumb.edu" {
+				t.Errorf("proof of %s returned for student filter", proof.UserSubmitted)
+			}
+			names = append(names, proof.ProofName)
+		}
+		cursor = page.NextCursor
+	}
+	if strings.Join(names, ",") != "Repository - Three,Repository - Two,Repository - One" {
+		t.Errorf("unexpected page order: %v", names)
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, "a@csumb.edu", "GET", "/sections/Logic/proofs", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/proofs?state=done", ""), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/proofs?limit=5000", ""), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/proofs?after=yesterday", ""), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/proofs?cursor=bogus", ""), 400, errCodeBadRequest)
+
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/completed-proofs?problem=Repository%20-%20Two", "")
+	expectAPIStatus(t, rr, 200, "")
+	var page apiProofPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Proofs) != 2 || page.Proofs[0].UserSubmitted != "a@csumb.edu" || page.NextCursor != "" {
+		t.Errorf("unexpected completed proofs: %+v", page)
+	}
+}
+
+func TestAPISectionTerms(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic","term":"Fall 2026"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW 1","proofIds":[],"visibility":"true"}`), 201, "")
+
+	expectAPIStatus(t, apiRequest(t, api, student, "PATCH", "/sections/Logic", `{"archived":true}`), 403, errCodeForbidden)
+	rr := apiRequest(t, api, instructor, "PATCH", "/sections/Logic", `{"archived":true}`)
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), `"Term":"Fall 2026","Archived":true`) {
+		t.Errorf("unexpected section: %s", rr.Body.String())
+	}
+
+	for query, want := range map[string]string{"": `[]`, "?archived=only": `"Name":"Logic"`, "?archived=include": `"Name":"Logic"`} {
+		rr = apiRequest(t, api, student, "GET", "/sections"+query, "")
+		expectAPIStatus(t, rr, 200, "")
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("sections%s: %s", query, rr.Body.String())
+		}
+	}
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/sections?archived=all", ""), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW 2","proofIds":[],"visibility":"true"}`), 409, errCodeConflict)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/completed-proofs", ""), 200, "")
+
+	rr = apiRequest(t, api, instructor, "POST", "/sections/Logic/clone", `{"name":"Logic 2","term":"Spring 2027"}`)
+	expectAPIStatus(t, rr, 201, "")
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic%202/assignments", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), `"HW 1"`) {
+		t.Errorf("clone assignments: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/clone", `{"name":"Logic 2"}`), 409, errCodeConflict)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PATCH", "/sections/Logic", `{"archived":false}`), 200, "")
+}
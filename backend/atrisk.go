@@ -0,0 +1,296 @@
+package main
+
+// At-risk students
+//
+// GET /sections/{section}/at-risk flags the students of a section who are
+// falling behind, as JSON or as a CSV download:
+//   - inactive: no proof saved in inactiveDays days, or never
+//   - missed-assignments: nothing completed in the last two assignments
+//     whose due date has passed
+//   - failed-attempts: failedAttempts or more saves with issues of a problem
+//     they have not completed
+//
+// POST /sections/{section}/at-risk/notify sends the report to the
+// section's instructor through the notifier (see notify.go).
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"datastore"
+)
+
+const (
+	defaultInactiveDays   = 7
+	defaultFailedAttempts = 5
+)
+
+type atRiskReport struct {
+	Section        string          `json:"section"`
+	GeneratedAt    string          `json:"generatedAt"` // datastore.TimeFormat, UTC
+	InactiveDays   int             `json:"inactiveDays"`
+	FailedAttempts int             `json:"failedAttempts"`
+	Students       []atRiskStudent `json:"students"` // flagged students only, in student order
+}
+
+type atRiskStudent struct {
+	Student   string         `json:"student"`
+	LastSaved string         `json:"lastSaved"` // "" if they never saved a proof
+	Reasons   []atRiskReason `json:"reasons"`
+}
+
+type atRiskReason struct {
+	Kind   string `json:"kind"` // inactive, missed-assignments or failed-attempts
+	Detail string `json:"detail"`
+}
+
+type atRiskNotification struct {
+	Notified []string `json:"notified"` // who was sent the report; no one when no student is flagged
+	Students int      `json:"students"` // flagged
+}
+
+// a due date as stored: "" or datastore.TimeFormat; a date alone is due at
+// the end of the day
+func parseDueDate(dueDate string) (string, error) {
+	dueDate = strings.TrimSpace(dueDate)
+	if dueDate == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.DateOnly, dueDate); err == nil {
+		return t.Add(24*time.Hour - time.Second).Format(datastore.TimeFormat), nil
+	}
+	if _, err := time.Parse(datastore.TimeFormat, dueDate); err != nil {
+		return "", fmt.Errorf("due date %q is neither YYYY-MM-DD nor YYYY-MM-DD HH:MM:SS", dueDate)
+	}
+	return dueDate, nil
+}
+
+// the due date an assignment is saved with; nil keeps current
+func (env *Env) assignmentDueDate(sectionName string, assignmentName string, dueDate *string) (string, error) {
+	if dueDate != nil {
+		return parseDueDate(*dueDate)
+	}
+	assignments, err := env.ds.GetAssignmentsBySection(sectionName)
+	if err != nil {
+		return "", err
+	}
+	for _, assignment := range assignments {
+		if assignment.Name == assignmentName {
+			return assignment.DueDate, nil
+		}
+	}
+	return "", nil
+}
+
+// the thresholds of a report request, from inactiveDays and failedAttempts
+func atRiskThresholds(values url.Values) (inactiveDays int, failedAttempts int, err error) {
+	inactiveDays, failedAttempts = defaultInactiveDays, defaultFailedAttempts
+	for name, n := range map[string]*int{"inactiveDays": &inactiveDays, "failedAttempts": &failedAttempts} {
+		if value := values.Get(name); value != "" {
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 1 {
+				return 0, 0, fmt.Errorf("%s must be a positive number", name)
+			}
+			*n = v
+		}
+	}
+	return inactiveDays, failedAttempts, nil
+}
+
+// the problems of the last two visible assignments due by now, latest first
+func (env *Env) lastDueAssignments(sectionName string, now time.Time) ([]string, [][]string, error) {
+	assignments, err := env.ds.GetAssignmentsBySection(sectionName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var due []datastore.Assignment
+	for _, assignment := range assignments {
+		if assignment.Visibility == "true" && assignment.DueDate != "" && assignment.DueDate <= now.Format(datastore.TimeFormat) {
+			due = append(due, assignment)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].DueDate > due[j].DueDate })
+	if len(due) > 2 {
+		due = due[:2]
+	}
+	var names []string
+	var problems [][]string
+	for _, assignment := range due {
+		proofs, err := env.ds.GetAssignmentProofs(assignment)
+		if err != nil {
+			return nil, nil, err
+		}
+		var proofNames []string
+		for _, proof := range proofs {
+			proofNames = append(proofNames, proof.ProofName)
+		}
+		names, problems = append(names, assignment.Name), append(problems, proofNames)
+	}
+	return names, problems, nil
+}
+
+func (env *Env) atRiskReport(sectionName string, inactiveDays int, failedAttempts int, now time.Time) (*atRiskReport, error) {
+	report := &atRiskReport{Section: sectionName, GeneratedAt: now.UTC().Format(datastore.TimeFormat),
+		InactiveDays: inactiveDays, FailedAttempts: failedAttempts, Students: []atRiskStudent{}}
+	activity, err := env.ds.GetStudentActivity(sectionName)
+	if err != nil {
+		return nil, err
+	}
+	assignments, problems, err := env.lastDueAssignments(sectionName, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	inactiveSince := now.UTC().Add(-time.Duration(inactiveDays) * 24 * time.Hour).Format(datastore.TimeFormat)
+	for _, student := range activity {
+		flagged := atRiskStudent{Student: student.Student, LastSaved: student.LastSaved}
+		completed := map[string]bool{}
+		for _, proofName := range student.Completed {
+			completed[proofName] = true
+		}
+
+		if student.LastSaved == "" {
+			flagged.Reasons = append(flagged.Reasons, atRiskReason{"inactive", "has never saved a proof"})
+		} else if student.LastSaved < inactiveSince {
+			flagged.Reasons = append(flagged.Reasons, atRiskReason{"inactive", fmt.Sprintf("no proof saved in %d days", inactiveDays)})
+		}
+
+		missed := len(assignments) > 0
+		for _, proofNames := range problems {
+			for _, proofName := range proofNames {
+				if completed[proofName] {
+					missed = false
+				}
+			}
+		}
+		if missed {
+			flagged.Reasons = append(flagged.Reasons, atRiskReason{"missed-assignments", "completed nothing in " + strings.Join(assignments, ", ")})
+		}
+
+		var struggling []string
+		for proofName, saves := range student.FailedSaves {
+			if saves >= failedAttempts {
+				struggling = append(struggling, proofName)
+			}
+		}
+		sort.Strings(struggling)
+		for _, proofName := range struggling {
+			flagged.Reasons = append(flagged.Reasons, atRiskReason{"failed-attempts",
+				fmt.Sprintf("%d saves with issues of %s, not completed", student.FailedSaves[proofName], proofName)})
+		}
+
+		if len(flagged.Reasons) != 0 {
+			report.Students = append(report.Students, flagged)
+		}
+	}
+	return report, nil
+}
+
+// the report as CSV, one row per reason
+func writeAtRiskCSV(w *csv.Writer, report *atRiskReport) error {
+	w.Write([]string{"student", "lastSaved", "kind", "detail"})
+	for _, student := range report.Students {
+		for _, reason := range student.Reasons {
+			w.Write([]string{student.Student, student.LastSaved, reason.Kind, reason.Detail})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// the report as the text of a message
+func atRiskText(report *atRiskReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d students of %s may be falling behind (as of %s UTC):\n", len(report.Students), report.Section, report.GeneratedAt)
+	for _, student := range report.Students {
+		fmt.Fprintf(&b, "\n%s\n", student.Student)
+		for _, reason := range student.Reasons {
+			fmt.Fprintf(&b, "  - %s\n", reason.Detail)
+		}
+	}
+	return b.String()
+}
+
+var atRiskFormats = []string{"json", "csv"}
+
+func (env *Env) apiSectionAtRisk(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	values := req.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if !slices.Contains(atRiskFormats, format) {
+		writeAPIError(w, 400, errCodeBadRequest, "format must be json or csv")
+		return
+	}
+	inactiveDays, failedAttempts, err := atRiskThresholds(values)
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	report, err := env.atRiskReport(params["section"], inactiveDays, failedAttempts, time.Now())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": params["section"] + "-at-risk." + format}))
+	if format == "json" {
+		writeAPIJSON(w, 200, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	if err := writeAtRiskCSV(csv.NewWriter(w), report); err != nil {
+		logger.ErrorContext(req.Context(), "apiSectionAtRisk: writing CSV failed", "error", err)
+	}
+}
+
+func (env *Env) apiNotifyAtRisk(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+	if reportNotifier == nil {
+		writeAPIError(w, 501, errCodeNotImplemented, "notifications are not set up on this server (see -notify)")
+		return
+	}
+	inactiveDays, failedAttempts, err := atRiskThresholds(req.URL.Query())
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	report, err := env.atRiskReport(params["section"], inactiveDays, failedAttempts, time.Now())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	result := atRiskNotification{Notified: []string{}, Students: len(report.Students)}
+	if len(report.Students) == 0 {
+		writeAPIJSON(w, 200, result)
+		return
+	}
+	section, err := env.ds.GetSection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	result.Notified = append(result.Notified, section.InstructorEmail)
+	subject := fmt.Sprintf("%s: %d students may be falling behind", params["section"], len(report.Students))
+	if err := reportNotifier.Notify(req.Context(), result.Notified, subject, atRiskText(report)); err != nil {
+		logger.ErrorContext(req.Context(), "apiNotifyAtRisk: notification failed", "error", err)
+		writeAPIError(w, 500, errCodeInternal, "sending the report failed")
+		return
+	}
+	writeAPIJSON(w, 200, result)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+func TestParseDueDate(t *testing.T) {
+	for dueDate, want := range map[string]string{
+		"":                    "",
+		"2026-10-01":          "2026-10-01 23:59:59",
+		"2026-10-01 12:00:00": "2026-10-01 12:00:00",
+		"10/01/2026":          "error",
+	} {
+		got, err := parseDueDate(dueDate)
+		if err != nil {
+			got = "error"
+		}
+		if got != want {
+			t.Errorf("%q: got %q, want %q", dueDate, got, want)
+		}
+	}
+}
+
+func TestAPISectionAtRisk(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster",
+		`{"studentEmails":["a@csumb.edu","b@csumb.edu","c@csumb.edu"]}`), 200, "")
+	problem := datastore.Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - MP", ProofType: "prop",
+		Premise: []string{"P → Q", "P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "Q", RepoProblem: "true"}
+	if err := env.ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments",
+		`{"name":"HW","proofIds":[1],"visibility":"true","dueDate":"someday"}`), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments",
+		`{"name":"HW","proofIds":[1],"visibility":"true","dueDate":"2026-01-05"}`), 201, "")
+	// left out of an update, the due date is kept
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PUT", "/sections/Logic/assignments/HW",
+		`{"proofIds":[1],"visibility":"true"}`), 200, "")
+	save := func(student string, completed string) {
+		t.Helper()
+		attempt := problem
+		attempt.EntryType, attempt.UserSubmitted, attempt.ProofCompleted = "proof", student, completed
+		attempt.Logic = []string{`[{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"P","jstr":"Pr"}]`}
+		if err := env.ds.Store(attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("a@csumb.edu", "true")
+	save("c@csumb.edu", "error")
+	save("c@csumb.edu", "error")
+
+	expectAPIStatus(t, apiRequest(t, api, "a@csumb.edu", "GET", "/sections/Logic/at-risk", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/at-risk?failedAttempts=0", ""), 400, errCodeBadRequest)
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/at-risk?failedAttempts=2", "")
+	expectAPIStatus(t, rr, 200, "")
+	var report atRiskReport
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	var got []string
+	for _, student := range report.Students {
+		for _, reason := range student.Reasons {
+			got = append(got, student.Student+" "+reason.Kind)
+		}
+	}
+	want := "[b@csumb.edu inactive b@csumb.edu missed-assignments c@csumb.edu missed-assignments c@csumb.edu failed-attempts]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/at-risk?format=csv", "")
+	expectAPIStatus(t, rr, 200, "")
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 4 || lines[0] != "student,lastSaved,kind,detail" ||
+		!strings.HasPrefix(lines[1], "b@csumb.edu,,inactive,") {
+		t.Errorf("csv: %s", rr.Body.String())
+	}
+
+	defer func(n notifier) { reportNotifier = n }(reportNotifier)
+	reportNotifier = nil
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/at-risk/notify", ""), 501, errCodeNotImplemented)
+	dir := t.TempDir()
+	reportNotifier = fileNotifier{dir}
+	rr = apiRequest(t, api, instructor, "POST", "/sections/Logic/at-risk/notify", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), `"notified":["instructor@csumb.edu"]`) {
+		t.Errorf("notification: %s", rr.Body.String())
+	}
+	messages, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(messages) != 1 {
+		t.Fatalf("messages: %v", messages)
+	}
+	message, _ := os.ReadFile(messages[0])
+	if !strings.Contains(string(message), "To: instructor@csumb.edu\r\n") || !strings.Contains(string(message), "  - has never saved a proof") {
+		t.Errorf("message: %s", message)
+	}
+}
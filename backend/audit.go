@@ -0,0 +1,157 @@
+package main
+
+// Audit log
+//
+// Every handler that changes sections, rosters, assignments, join codes,
+// bank problems or impersonation sessions records who did it, to what,
+// and the state before and after, in the append-only audit log (see
+// datastore/audit.go); so do -cleardb, the restore and import-section
+// subcommands and, in the datastore, MaintainAdmins. Students' proof saves
+// are not audited: every save is already kept in the proofSave table.
+// GET /audit lets admins query the log by section, actor, action and time.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/user"
+	"strconv"
+	"time"
+
+	"datastore"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// filters and paging of the audit query
+var auditQueryParams = []queryParam{
+	{Name: "section"},
+	{Name: "actor", Description: "email of the user, or e.g. os:root for subcommands and admin_users for admin changes"},
+	{Name: "action", Description: "e.g. section.delete, roster.remove, assignment.update"},
+	{Name: "after", Description: "RFC 3339 time; entries at or after it"},
+	{Name: "before", Description: "RFC 3339 time; entries before it"},
+	{Name: "limit", Description: fmt.Sprintf("page size, default %d, at most %d", defaultAuditPageSize, maxAuditPageSize)},
+	{Name: "cursor", Description: "nextCursor of the previous page"},
+}
+
+// a section with its roster and assignments, as recorded when it is deleted
+type auditedSection struct {
+	Section     *datastore.Section     `json:"section"`
+	Roster      []datastore.Roster     `json:"roster"`
+	Assignments []datastore.Assignment `json:"assignments"`
+}
+
+// an audit entry; before and after are encoded as JSON, nil leaves them out
+func newAuditEntry(actor string, action string, section string, target string, before interface{}, after interface{}) datastore.AuditEntry {
+	entry := datastore.AuditEntry{Actor: actor, Action: action, Section: section, Target: target}
+	if before != nil {
+		entry.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		entry.After, _ = json.Marshal(after)
+	}
+	return entry
+}
+
+// record a change made by the current user; failing to is logged and does
+// not fail the request, whose change is already made
+func (env *Env) audit(req *http.Request, action string, section string, target string, before interface{}, after interface{}) {
+	actor := req.Context().Value("tok").(userWithEmail).GetEmail()
+	recordAudit(req.Context(), env.ds, newAuditEntry(actor, action, section, target, before, after))
+}
+
+func recordAudit(ctx context.Context, ds datastore.IProofStore, entry datastore.AuditEntry) {
+	if err := ds.RecordAudit(entry); err != nil {
+		logger.ErrorContext(ctx, "audit: recording failed", "action", entry.Action, "target", entry.Target, "error", err)
+	}
+}
+
+// the actor of changes made from the command line: the operating system user
+func osActor() string {
+	if current, err := user.Current(); err == nil {
+		return "os:" + current.Username
+	}
+	return "os:unknown"
+}
+
+// the assignment of a section with the given name, or nil
+func (env *Env) currentAssignment(sectionName string, name string) *datastore.Assignment {
+	assignments, err := env.ds.GetAssignmentsBySection(sectionName)
+	if err != nil {
+		return nil
+	}
+	for _, assignment := range assignments {
+		if assignment.Name == name {
+			return &assignment
+		}
+	}
+	return nil
+}
+
+// a section with its roster and assignments, or nil if it does not exist
+func (env *Env) currentSection(sectionName string) *auditedSection {
+	section, err := env.ds.GetSection(sectionName)
+	if err != nil {
+		return nil
+	}
+	state := &auditedSection{Section: section}
+	state.Roster, _ = env.ds.GetRoster(sectionName)
+	state.Assignments, _ = env.ds.GetAssignmentsBySection(sectionName)
+	return state
+}
+
+// a roster entry, or nil if the user is not on the section's roster
+func (env *Env) currentRosterEntry(sectionName string, email string) *datastore.Roster {
+	role, err := env.ds.GetRole(sectionName, email)
+	if err != nil {
+		return nil
+	}
+	return &datastore.Roster{SectionName: sectionName, UserEmail: email, Role: role}
+}
+
+// the audit log, newest first, one page at a time: admins only
+func (env *Env) apiQueryAudit(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	if !admin_users[user.GetEmail()] {
+		writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+		return
+	}
+
+	values := req.URL.Query()
+	q := datastore.AuditQuery{Section: values.Get("section"), Actor: values.Get("actor"), Action: values.Get("action"),
+		Cursor: values.Get("cursor"), Limit: defaultAuditPageSize}
+	for _, bound := range []struct {
+		name string
+		dest *string
+	}{{"after", &q.After}, {"before", &q.Before}} {
+		value := values.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeAPIError(w, 400, errCodeBadRequest, bound.name+" must be an RFC 3339 time")
+			return
+		}
+		*bound.dest = t.UTC().Format(datastore.TimeFormat)
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			writeAPIError(w, 400, errCodeBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize))
+			return
+		}
+		q.Limit = n
+	}
+
+	page, err := env.ds.QueryAudit(q)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, page)
+}
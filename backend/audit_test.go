@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+func TestAPIAudit(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	admin, instructor := "cohunter@csumb.edu", "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW 1","proofIds":[],"visibility":"false"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PUT", "/sections/Logic/assignments/HW%201", `{"proofIds":[],"visibility":"true"}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PATCH", "/sections/Logic", `{"term":"Fall 2026"}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic/assignments/HW%201", ""), 204, "")
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/audit", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, admin, "GET", "/audit?after=yesterday", ""), 400, errCodeBadRequest)
+
+	rr := apiRequest(t, api, admin, "GET", "/audit?section=Logic", "")
+	expectAPIStatus(t, rr, 200, "")
+	var page datastore.AuditPage
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	var actions []string
+	for _, entry := range page.Entries {
+		if entry.Actor != instructor {
+			t.Errorf("entry by %q", entry.Actor)
+		}
+		actions = append(actions, entry.Action)
+	}
+	if strings.Join(actions, " ") != "assignment.delete section.update assignment.update assignment.create roster.add section.create" {
+		t.Fatalf("audited actions: %v", actions)
+	}
+	deleted := page.Entries[0]
+	if deleted.After != nil || deleted.Target != "HW 1" || !strings.Contains(string(deleted.Before), `"ProofIds":"[]"`) {
+		t.Errorf("assignment.delete entry: %+v", deleted)
+	}
+	updated := page.Entries[2]
+	if !strings.Contains(string(updated.Before), `"Visibility":"false"`) || !strings.Contains(string(updated.After), `"Visibility":"true"`) {
+		t.Errorf("assignment.update entry: before %s after %s", updated.Before, updated.After)
+	}
+
+	rr = apiRequest(t, api, admin, "GET", "/audit?actor=instructor@csumb.edu&action=roster.add&limit=1", "")
+	expectAPIStatus(t, rr, 200, "")
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Entries) != 1 || page.Entries[0].Target != "student@csumb.edu" || page.NextCursor != "" {
+		t.Errorf("roster additions: %s", rr.Body.String())
+	}
+}
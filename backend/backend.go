@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"datastore"
 	tokenauth "google-token-auth"
+	"logging"
+	"proofcheck"
 )
 
+var logger = logging.New("backend")
+
 var (
 	// Set allowed domains here.
 	// Test Comment 1
@@ -52,11 +62,30 @@ type FailedRoster struct {
 	errorMsg string
 }
 
+// shape of the `{"success": "true"}` bodies written by the POST handlers
+type successResponse struct {
+	Success string `json:"success"`
+}
+
+// shape of the addRoster response; errors is only present when success is "false"
+type addRosterResponse struct {
+	Success string         `json:"success"`
+	Errors  []insertionErr `json:"errors,omitempty"`
+}
+
+// shape of the joinSection response
+type joinSectionResponse struct {
+	Success     string `json:"success"`
+	SectionName string `json:"sectionName"`
+}
+
+// response of getAdmins
+type adminUsers struct {
+	Admins []string
+}
+
 // return a list of current admin emails
 func (env *Env) getAdmins(w http.ResponseWriter, req *http.Request) {
-	type adminUsers struct {
-		Admins []string
-	}
 	var admins adminUsers
 	// for adminEmail := range admin_users {
 	// 	admins.Admins = append(admins.Admins, adminEmail)
@@ -84,13 +113,11 @@ func (env *Env) saveProof(w http.ResponseWriter, req *http.Request) {
 
 	// read the JSON-encoded value from the HTTP request and store it in submittedProof
 	if err := json.NewDecoder(req.Body).Decode(&submittedProof); err != nil {
-		log.Println(err)
+		logger.InfoContext(req.Context(), "saveProof: undecodable request body", "error", err)
 		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	log.Printf("%+v", submittedProof)
-
 	if len(submittedProof.ProofName) == 0 {
 		http.Error(w, "Proof name is empty", 400)
 		return
@@ -99,29 +126,51 @@ func (env *Env) saveProof(w http.ResponseWriter, req *http.Request) {
 	// Replace submitted email (if any) with the email from the token
 	submittedProof.UserSubmitted = user.GetEmail()
 
-	if err := env.ds.Store(submittedProof); err != nil {
+	issues, err := env.disallowedRules(submittedProof)
+	if err != nil {
+		logger.ErrorContext(req.Context(), "saveProof: reading allowed rules failed", "error", err)
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	if len(issues) != 0 {
+		http.Error(w, strings.Join(issues, "\n"), 400)
+		return
+	}
+
+	err = env.ds.Store(submittedProof)
+	if errors.Is(err, datastore.ErrSectionArchived) {
+		http.Error(w, "This problem belongs to an archived section and can no longer be saved.", 409)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(req.Context(), "saveProof: store failed", "error", err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	logger.InfoContext(req.Context(), "proof saved", logging.Email("user", user.GetEmail()),
+		"problem", submittedProof.ProofName, "proofCompleted", submittedProof.ProofCompleted)
+	env.recordMistakes(req.Context(), submittedProof)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// selection keywords accepted by getProofs
+var proofSelections = []string{"user", "repo", "completedrepo", "downloadrepo"}
+
+// accepted JSON fields of getProofs
+type getProofRequest struct {
+	Selection string `json:"selection" enum:"user,repo,completedrepo,downloadrepo"`
+}
+
 func (env *Env) getProofs(w http.ResponseWriter, req *http.Request) {
 	user := req.Context().Value("tok").(userWithEmail)
-	log.Println("backend.go: getProofs(): 'tok': " + user.GetEmail())
 
 	if req.Method != "POST" || req.Body == nil {
 		http.Error(w, "Request not accepted.", 400)
 		return
 	}
 
-	// Accepted JSON fields must be defined here
-	type getProofRequest struct {
-		Selection string `json:"selection"`
-	}
-
 	var requestData getProofRequest
 
 	decoder := json.NewDecoder(req.Body)
@@ -131,35 +180,28 @@ func (env *Env) getProofs(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	log.Printf("%+v", requestData)
-
 	if len(requestData.Selection) == 0 {
 		http.Error(w, "Selection required", 400)
 		return
 	}
 
-	log.Printf("USER: %q", user)
-
 	var err error
 	var proofs []datastore.Proof
 	var sectionProofs []datastore.SectionProofs
 
 	switch requestData.Selection {
 	case "user":
-		log.Println("user selection")
 		err, proofs = env.ds.GetUserProofs(user)
 
 	case "repo":
-		log.Println("repo selection")
 		// get repo problems associated with the sections that the user is in
 		err, sectionProofs = env.ds.GetRepoProofs(user)
+		withAllowedRules(sectionProofs)
 
 	case "completedrepo":
-		log.Println("completedrepo selection")
 		err, proofs = env.ds.GetUserCompletedProofs(user)
 
 	case "downloadrepo":
-		log.Println("downloadrepo selection")
 		if !admin_users[user.GetEmail()] {
 			http.Error(w, "Insufficient privileges", 403)
 			return
@@ -172,12 +214,12 @@ func (env *Env) getProofs(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if err != nil {
-		log.Println("error: backend.go: getProofs(): " + err.Error())
+		logger.ErrorContext(req.Context(), "getProofs: query error", "selection", requestData.Selection, "error", err)
 		http.Error(w, "Query error", 500)
 		return
 	}
 
-	log.Printf("%+v", proofs)
+	logger.DebugContext(req.Context(), "getProofs", "selection", requestData.Selection, "proofs", len(proofs), "sections", len(sectionProofs))
 	var userProofsJSON []byte
 	if proofs != nil {
 		userProofsJSON, err = json.Marshal(proofs)
@@ -187,14 +229,11 @@ func (env *Env) getProofs(w http.ResponseWriter, req *http.Request) {
 
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Print(err)
+		logger.ErrorContext(req.Context(), "getProofs: json marshal error", "error", err)
 		return
 	}
 
 	io.WriteString(w, string(userProofsJSON))
-
-	log.Printf("%q", user)
-	log.Printf("%+v", req.URL.Query())
 }
 
 // get proof entries for current user where entryType is argument
@@ -208,16 +247,15 @@ func (env *Env) getUserArguments(w http.ResponseWriter, req *http.Request) {
 
 	arguments, err := env.ds.GetUserArguments(user)
 	if err != nil {
-		log.Println("error: backend.go: getUserArguments(): " + err.Error())
+		logger.ErrorContext(req.Context(), "getUserArguments: query error", "error", err)
 		http.Error(w, "Query error", 500)
 		return
 	}
-	log.Printf("%+v", arguments)
 
 	userProofsJSON, err := json.Marshal(arguments)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Print(err)
+		logger.ErrorContext(req.Context(), "getUserArguments: json marshal error", "error", err)
 		return
 	}
 
@@ -226,7 +264,6 @@ func (env *Env) getUserArguments(w http.ResponseWriter, req *http.Request) {
 
 // return section entries given a user's email
 func (env *Env) getSections(w http.ResponseWriter, req *http.Request) {
-	log.Println("inside backend.go: getSections")
 	userEmail := req.URL.Query().Get("user")
 
 	if req.Method != "GET" || userEmail == "" {
@@ -234,82 +271,31 @@ func (env *Env) getSections(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	log.Printf("for section: %q\n", userEmail)
-
 	sections, err := env.ds.GetSections(userEmail)
+	if err == nil && req.URL.Query().Get("archived") == "include" {
+		var archived []datastore.Section
+		archived, err = env.ds.GetArchivedSections(userEmail)
+		sections = append(sections, archived...)
+	}
 	if err != nil {
 		http.Error(w, "db access error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getSections: db access error", "error", err)
 		return
 	}
-	log.Printf("all sections: %+v\n\n", sections)
 
 	sectionsJSON, err := json.Marshal(sections)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getSections: json marshal error", "error", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, string(sectionsJSON))
-
-	/*
-		if req.Method != "GET" || req.Body == nil {
-			http.Error(w, "Request not accepted.", 400)
-			return
-		}
-
-		// Accepted JSON fields must be defined here
-		type getSectionsRequest struct {
-			User string `json:"user"`
-		}
-
-		var requestData getSectionsRequest
-
-		decoder := json.NewDecoder(req.Body)
-
-		if err := decoder.Decode(&requestData); err != nil {
-			http.Error(w, "Unable to decode request body.", 400)
-			return
-		}
-
-		log.Printf("%+v", requestData)
-
-		if requestData.User == "" {
-			http.Error(w, "user required", 400)
-			return
-		}
-
-		var err error
-
-		var sections []datastore.Section
-		sections, err = env.ds.GetSections(requestData.User)
-		if err != nil {
-			http.Error(w, "db access error", 500)
-			log.Println(err)
-			return
-		}
-
-		log.Printf("All Sections: %+v\n\n", sections)
-
-		sectionsJSON, err := json.Marshal(sections)
-		if err != nil {
-			http.Error(w, "json marshal error", 500)
-			log.Println(err)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		io.WriteString(w, string(sectionsJSON))
-		// fmt.Printf("All Sections JSON: %+v\n", sectionsJSON)\
-	*/
 }
 
 // return student and ta roster entries given a sectionName
 func (env *Env) getRoster(w http.ResponseWriter, req *http.Request) {
-	log.Println("inside backend.go: getRoster")
-
 	sectionName := req.URL.Query().Get("sectionName")
 
 	if req.Method != "GET" || sectionName == "" {
@@ -317,20 +303,17 @@ func (env *Env) getRoster(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	log.Printf("for section: %q\n", sectionName)
-
 	roster, err := env.ds.GetRoster(sectionName)
 	if err != nil {
 		http.Error(w, "db access error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getRoster: db access error", "error", err)
 		return
 	}
-	log.Printf("full roster: %+v\n\n", roster)
 
 	rosterJSON, err := json.Marshal(roster)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getRoster: json marshal error", "error", err)
 		return
 	}
 
@@ -391,7 +374,6 @@ func (env *Env) getRoster(w http.ResponseWriter, req *http.Request) {
 
 // return proof entries completed by students associated with a given section
 func (env *Env) getCompletedProofsBySection(w http.ResponseWriter, req *http.Request) {
-	log.Println("inside backend.go: getCompletedProofsBySection")
 	sectionName := req.URL.Query().Get("sectionName")
 
 	if req.Method != "GET" || sectionName == "" {
@@ -399,19 +381,17 @@ func (env *Env) getCompletedProofsBySection(w http.ResponseWriter, req *http.Req
 		return
 	}
 
-	log.Printf("for section: %q\n", sectionName)
-
 	proofs, err := env.ds.GetCompletedProofsBySection(sectionName)
 	if err != nil {
 		http.Error(w, "db access error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getCompletedProofsBySection: db access error", "error", err)
 		return
 	}
 
 	proofsJSON, err := json.Marshal(proofs)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getCompletedProofsBySection: json marshal error", "error", err)
 		return
 	}
 
@@ -470,6 +450,15 @@ func (env *Env) getCompletedProofsBySection(w http.ResponseWriter, req *http.Req
 
 }
 
+// an assignment with its proofs(arguments) expanded
+type assignmentWithProofs struct {
+	Name       string            `json:"name"`
+	ProofList  []datastore.Proof `json:"proofList"`
+	Visibility string            `json:"visibility"`
+	RuleSet    string            `json:"ruleSet"`
+	DueDate    string            `json:"dueDate,omitempty"`
+}
+
 // get all assignments associated with a specific section
 func (env *Env) getAssignmentsBySection(w http.ResponseWriter, req *http.Request) {
 	/*
@@ -509,7 +498,6 @@ func (env *Env) getAssignmentsBySection(w http.ResponseWriter, req *http.Request
 			return
 		}
 	*/
-	log.Println("inside backend.go: getAssignmentBySection")
 	sectionName := req.URL.Query().Get("sectionName")
 
 	if req.Method != "GET" || sectionName == "" {
@@ -520,35 +508,30 @@ func (env *Env) getAssignmentsBySection(w http.ResponseWriter, req *http.Request
 	assignmentDetails, err := env.ds.GetAssignmentsBySection(sectionName)
 	if err != nil {
 		http.Error(w, "db access error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getAssignmentsBySection: db access error", "error", err)
 		return
 	}
 
-	type assignmentWithProofs struct {
-		Name       string            `json:"name"`
-		ProofList  []datastore.Proof `json:"proofList"`
-		Visibility string            `json:"visibility"`
-	}
-
 	var assignments []assignmentWithProofs
 	for _, v := range assignmentDetails {
 		var singleAssign assignmentWithProofs
 		singleAssign.Name = v.Name
 		singleAssign.Visibility = v.Visibility
+		singleAssign.RuleSet = v.RuleSet
+		singleAssign.DueDate = v.DueDate
 		singleAssign.ProofList, err = env.ds.GetAssignmentProofs(v)
 		if err != nil {
 			http.Error(w, "db access error", 500)
-			log.Println(err)
+			logger.ErrorContext(req.Context(), "getAssignmentsBySection: db access error", "error", err)
 			return
 		}
 		assignments = append(assignments, singleAssign)
 	}
-	log.Printf("assignments array: %+v", assignments)
 
 	assignmentsJSON, err := json.Marshal(assignments)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getAssignmentsBySection: json marshal error", "error", err)
 		return
 	}
 
@@ -594,7 +577,6 @@ func (env *Env) getCompletedProofsByAssignment(w http.ResponseWriter, req *http.
 		var completedProofs []datastore.Proof
 		completedProofs, err = env.ds.GetCompletedProofsByAssignment(requestData.SectionName, requestData.AssignmentName)
 	*/
-	log.Println("inside backend.go: getCompletedProofByAssignment")
 	sectionName := req.URL.Query().Get("sectionName")
 	assignmentName := req.URL.Query().Get("assignmentName")
 
@@ -605,11 +587,14 @@ func (env *Env) getCompletedProofsByAssignment(w http.ResponseWriter, req *http.
 
 	var completedProofs []datastore.Proof
 	completedProofs, err := env.ds.GetCompletedProofsByAssignment(sectionName, assignmentName)
+	if err != nil {
+		logger.ErrorContext(req.Context(), "getCompletedProofsByAssignment: db access error", "error", err)
+	}
 
 	completedProofsJSON, err := json.Marshal(completedProofs)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "getCompletedProofsByAssignment: json marshal error", "error", err)
 		return
 	}
 
@@ -617,9 +602,13 @@ func (env *Env) getCompletedProofsByAssignment(w http.ResponseWriter, req *http.
 	io.WriteString(w, string(completedProofsJSON))
 }
 
+// accepted JSON fields of addSection
+type addSectionRequest struct {
+	SectionName string `json:"sectionName"`
+}
+
 // add a section based on current admin user and given sectionName
 func (env *Env) addSection(w http.ResponseWriter, req *http.Request) {
-	log.Println("inside backend.go: addSection")
 	user := req.Context().Value("tok").(userWithEmail)
 
 	if req.Method != "POST" || req.Body == nil {
@@ -627,12 +616,7 @@ func (env *Env) addSection(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Accepted JSON fields must be defined here
-	type reqBody struct {
-		SectionName string `json:"sectionName"`
-	}
-
-	var requestData reqBody
+	var requestData addSectionRequest
 
 	decoder := json.NewDecoder(req.Body)
 
@@ -640,42 +624,48 @@ func (env *Env) addSection(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "Unable to decode request body.", 400)
 		return
 	}
-	log.Printf("user: [%q], requestData: %+v", user.GetEmail(), requestData)
+	logger.InfoContext(req.Context(), "addSection", logging.Email("instructor", user.GetEmail()), "section", requestData.SectionName)
 
-	err := env.ds.InsertSection(datastore.Section{InstructorEmail: user.GetEmail(), Name: requestData.SectionName})
+	section := datastore.Section{InstructorEmail: user.GetEmail(), Name: requestData.SectionName}
+	err := env.ds.InsertSection(section)
 	if err != nil {
 		http.Error(w, "db section insertion error: "+err.Error(), 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "addSection: db section insertion error", "error", err)
 		return
 	}
 	err = env.ds.InsertRoster(datastore.Roster{SectionName: requestData.SectionName, UserEmail: user.GetEmail(), Role: "instructor"})
 	if err != nil {
 		http.Error(w, "db roster insertion error: "+err.Error(), 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "addSection: db roster insertion error", "error", err)
 		return
 	}
+	env.audit(req, "section.create", section.Name, section.Name, nil, section)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of addRoster
+type addRosterRequest struct {
+	SectionName   string   `json:"sectionName"`
+	StudentEmails []string `json:"studentEmails"`
+	TaEmails      []string `json:"taEmails"`
+}
+
+// an email that could not be added to a roster, and why
+type insertionErr struct {
+	Email string `json:"email"`
+	Msg   string `json:"msg"`
+}
+
 // add a roster entry: requires sectionName, studentEmails, and taEmails
 func (env *Env) addRoster(w http.ResponseWriter, req *http.Request) {
-	log.Println("inside backend.go: addRoster")
-
 	if req.Method != "POST" || req.Body == nil {
 		http.Error(w, "Request not accepted.", 400)
 		return
 	}
 
-	// Accepted JSON fields must be defined here
-	type reqBody struct {
-		SectionName   string   `json:"sectionName"`
-		StudentEmails []string `json:"studentEmails"`
-		TaEmails      []string `json:"taEmails"`
-	}
-
-	var requestData reqBody
+	var requestData addRosterRequest
 
 	decoder := json.NewDecoder(req.Body)
 
@@ -684,32 +674,34 @@ func (env *Env) addRoster(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	type insertionErr struct {
-		Email string `json:"email"`
-		Msg   string `json:"msg"`
-	}
 	var insertionErrList []insertionErr
 	for _, email := range requestData.StudentEmails {
 		// working here! adjust for InsertRoster - need to grab sectionName, email, and role
 		err := env.ds.InsertUser(datastore.User{Email: email, FirstName: "", LastName: "", Admin: 0})
-		err = env.ds.InsertRoster(datastore.Roster{SectionName: requestData.SectionName, UserEmail: email, Role: "student"})
+		rosterRow := datastore.Roster{SectionName: requestData.SectionName, UserEmail: email, Role: "student"}
+		err = env.ds.InsertRoster(rosterRow)
 		if err != nil {
 			insertionErrList = append(insertionErrList, insertionErr{Email: email, Msg: err.Error()})
+		} else {
+			env.audit(req, "roster.add", rosterRow.SectionName, email, nil, rosterRow)
 		}
 	}
 	for _, email := range requestData.TaEmails {
 		// working here! adjust for InsertRoster - need to grab sectionName, email, and role
 		err := env.ds.InsertUser(datastore.User{Email: email, FirstName: "", LastName: "", Admin: 1})
-		err = env.ds.InsertRoster(datastore.Roster{SectionName: requestData.SectionName, UserEmail: email, Role: "ta"})
+		rosterRow := datastore.Roster{SectionName: requestData.SectionName, UserEmail: email, Role: "ta"}
+		err = env.ds.InsertRoster(rosterRow)
 		if err != nil {
 			insertionErrList = append(insertionErrList, insertionErr{Email: email, Msg: err.Error()})
+		} else {
+			env.audit(req, "roster.add", rosterRow.SectionName, email, nil, rosterRow)
 		}
 	}
 
 	insertionErrJSON, err := json.Marshal(insertionErrList)
 	if err != nil {
 		http.Error(w, "json marshal error", 500)
-		log.Print(err)
+		logger.ErrorContext(req.Context(), "addRoster: json marshal error", "error", err)
 		return
 	}
 
@@ -723,20 +715,23 @@ func (env *Env) addRoster(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of addAssignment
+type addAssignmentRequest struct {
+	SectionName string `json:"sectionName"`
+	Name        string `json:"name"`
+	ProofIds    []int  `json:"proofIds"`
+	Visibility  string `json:"visibility"`
+	RuleSet     string `json:"ruleSet"`
+	DueDate     string `json:"dueDate"`
+}
+
 func (env *Env) addAssignment(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" || req.Body == nil {
 		http.Error(w, "Request not accepted.", 400)
 		return
 	}
 
-	type reqBody struct {
-		SectionName string `json:"sectionName"`
-		Name        string `json:"name"`
-		ProofIds    []int  `json:"proofIds"`
-		Visibility  string `json:"visibility"`
-	}
-
-	var requestData reqBody
+	var requestData addAssignmentRequest
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(&requestData); err != nil {
 		http.Error(w, "Unable to decode request body.", 400)
@@ -748,33 +743,48 @@ func (env *Env) addAssignment(w http.ResponseWriter, req *http.Request) {
 	assignment.Name = requestData.Name
 	assignment.ProofIds = fmt.Sprint(requestData.ProofIds)
 	assignment.Visibility = requestData.Visibility
+	assignment.RuleSet = strings.TrimSpace(requestData.RuleSet)
+	if _, err := proofcheck.AllowedRules(assignment.RuleSet); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	dueDate, err := parseDueDate(requestData.DueDate)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	assignment.DueDate = dueDate
 
-	err := env.ds.InsertAssignment(assignment)
+	err = env.ds.InsertAssignment(assignment)
 	if err != nil {
 		http.Error(w, "db assignment insertion error: "+err.Error(), 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "addAssignment: db assignment insertion error", "error", err)
 		return
 	}
+	env.audit(req, "assignment.create", assignment.SectionName, assignment.Name, nil, assignment)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of updateAssignment
+type updateAssignmentRequest struct {
+	SectionName       string `json:"sectionName"`
+	CurrentName       string `json:"currentName"`
+	UpdatedName       string `json:"updatedName"`
+	UpdatedProofIds   []int  `json:"updatedProofIds"`
+	UpdatedVisibility string  `json:"updatedVisibility"`
+	UpdatedRuleSet    *string `json:"updatedRuleSet"` // left out, unchanged
+	UpdatedDueDate    *string `json:"updatedDueDate"` // likewise
+}
+
 func (env *Env) updateAssignment(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" || req.Body == nil {
 		http.Error(w, "Request not accepted.", 400)
 		return
 	}
 
-	type reqBody struct {
-		SectionName       string `json:"sectionName"`
-		CurrentName       string `json:"currentName"`
-		UpdatedName       string `json:"updatedName"`
-		UpdatedProofIds   []int  `json:"updatedProofIds"`
-		UpdatedVisibility string `json:"updatedVisibility`
-	}
-
-	var requestData reqBody
+	var requestData updateAssignmentRequest
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(&requestData); err != nil {
 		http.Error(w, "Unable to decode request body.", 400)
@@ -786,18 +796,41 @@ func (env *Env) updateAssignment(w http.ResponseWriter, req *http.Request) {
 	UpdatedAssignment.Name = requestData.UpdatedName
 	UpdatedAssignment.ProofIds = fmt.Sprint(requestData.UpdatedProofIds)
 	UpdatedAssignment.Visibility = requestData.UpdatedVisibility
+	ruleSet, err := env.assignmentRuleSet(requestData.SectionName, requestData.CurrentName, requestData.UpdatedRuleSet)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	UpdatedAssignment.RuleSet = ruleSet
+	UpdatedAssignment.DueDate, err = env.assignmentDueDate(requestData.SectionName, requestData.CurrentName, requestData.UpdatedDueDate)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
-	err := env.ds.UpdateAssignment(requestData.CurrentName, UpdatedAssignment)
+	before := env.currentAssignment(requestData.SectionName, requestData.CurrentName)
+	err = env.ds.UpdateAssignment(requestData.CurrentName, UpdatedAssignment)
+	if errors.Is(err, datastore.ErrNotExists) {
+		http.Error(w, "assignment not found", 404)
+		return
+	}
 	if err != nil {
 		http.Error(w, "db assignment update error: "+err.Error(), 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "updateAssignment: db assignment update error: ", "error", err)
 		return
 	}
+	env.audit(req, "assignment.update", requestData.SectionName, requestData.CurrentName, before, UpdatedAssignment)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of removeFromRoster
+type removeFromRosterRequest struct {
+	SectionName string `json:"sectionName"`
+	UserEmail   string `json:"userEmail"`
+}
+
 // remove 1 roster entry, based on user email and section name
 func (env *Env) removeFromRoster(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" || req.Body == nil {
@@ -805,12 +838,7 @@ func (env *Env) removeFromRoster(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	type reqBody struct {
-		SectionName string `json:"sectionName"`
-		UserEmail   string `json:"userEmail"`
-	}
-
-	var requestData reqBody
+	var requestData removeFromRosterRequest
 
 	decoder := json.NewDecoder(req.Body)
 
@@ -819,29 +847,33 @@ func (env *Env) removeFromRoster(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	before := env.currentRosterEntry(requestData.SectionName, requestData.UserEmail)
 	err := env.ds.RemoveFromRoster(requestData.SectionName, requestData.UserEmail)
 	if err != nil {
 		http.Error(w, "db roster deletion error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "removeFromRoster: db roster deletion error", "error", err)
 		return
 	}
+	env.audit(req, "roster.remove", requestData.SectionName, requestData.UserEmail, before, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
-// remove section entry and associated roster entries, given a section name
+// accepted JSON fields of removeSection
+type removeSectionRequest struct {
+	SectionName string `json:"sectionName"`
+}
+
+// delete a section and its roster and assignments, given a section name;
+// the deletion can be undone until it is purged, see softdelete.go
 func (env *Env) removeSection(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" || req.Body == nil {
 		http.Error(w, "Request not accepted.", 400)
 		return
 	}
 
-	type reqBody struct {
-		SectionName string `json:"sectionName"`
-	}
-
-	var requestData reqBody
+	var requestData removeSectionRequest
 
 	decoder := json.NewDecoder(req.Body)
 
@@ -850,17 +882,29 @@ func (env *Env) removeSection(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	before := env.currentSection(requestData.SectionName)
 	err := env.ds.RemoveSection(requestData.SectionName)
+	if errors.Is(err, datastore.ErrNotExists) {
+		http.Error(w, "section not found", 404)
+		return
+	}
 	if err != nil {
 		http.Error(w, "db section deletion error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "removeSection: db section deletion error", "error", err)
 		return
 	}
+	env.audit(req, "section.delete", requestData.SectionName, requestData.SectionName, before, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of removeAssignment
+type removeAssignmentRequest struct {
+	SectionName string `json:"sectionName"`
+	Name        string `json:"name"`
+}
+
 // remove 1 assignment entry, based on section name and name of assignment
 func (env *Env) removeAssignment(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" || req.Body == nil {
@@ -868,12 +912,7 @@ func (env *Env) removeAssignment(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	type reqBody struct {
-		SectionName string `json:"sectionName"`
-		Name        string `json:"name"`
-	}
-
-	var requestData reqBody
+	var requestData removeAssignmentRequest
 
 	decoder := json.NewDecoder(req.Body)
 
@@ -882,31 +921,294 @@ func (env *Env) removeAssignment(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	before := env.currentAssignment(requestData.SectionName, requestData.Name)
 	err := env.ds.RemoveAssignment(requestData.SectionName, requestData.Name)
+	if errors.Is(err, datastore.ErrNotExists) {
+		http.Error(w, "assignment not found", 404)
+		return
+	}
 	if err != nil {
 		http.Error(w, "db assignment deletion error", 500)
-		log.Println(err)
+		logger.ErrorContext(req.Context(), "removeAssignment: db assignment deletion error", "error", err)
+		return
+	}
+	env.audit(req, "assignment.delete", requestData.SectionName, requestData.Name, before, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"success": "true"}`)
+}
+
+// report whether user is the instructor who owns the given section
+func (env *Env) isSectionInstructor(user userWithEmail, sectionName string) (bool, error) {
+	section, err := env.ds.GetSection(sectionName)
+	if errors.Is(err, datastore.ErrNotExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return section.InstructorEmail == user.GetEmail(), nil
+}
+
+// report whether user is the instructor or a TA of the given section
+func (env *Env) isSectionStaff(user userWithEmail, sectionName string) (bool, error) {
+	ok, err := env.isSectionInstructor(user, sectionName)
+	if err != nil || ok {
+		return ok, err
+	}
+	role, err := env.ds.GetRole(sectionName, user.GetEmail())
+	if errors.Is(err, datastore.ErrNotExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == "ta", nil
+}
+
+// return the current join code of a section: instructor of the section only
+func (env *Env) getJoinCode(w http.ResponseWriter, req *http.Request) {
+	user := req.Context().Value("tok").(userWithEmail)
+	sectionName := req.URL.Query().Get("sectionName")
+
+	if req.Method != "GET" || sectionName == "" {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	if ok, err := env.isSectionInstructor(user, sectionName); err != nil {
+		http.Error(w, "db access error", 500)
+		logger.ErrorContext(req.Context(), "getJoinCode: db access error", "error", err)
+		return
+	} else if !ok {
+		http.Error(w, "Insufficient privileges", 403)
+		return
+	}
+
+	joinCode, err := env.ds.GetJoinCode(sectionName)
+	if errors.Is(err, datastore.ErrNotExists) {
+		http.Error(w, "section has no join code", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db access error", 500)
+		logger.ErrorContext(req.Context(), "getJoinCode: db access error", "error", err)
+		return
+	}
+
+	joinCodeJSON, err := json.Marshal(joinCode)
+	if err != nil {
+		http.Error(w, "json marshal error", 500)
+		logger.ErrorContext(req.Context(), "getJoinCode: json marshal error", "error", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, string(joinCodeJSON))
+}
+
+// accepted JSON fields of regenerateJoinCode
+type regenerateJoinCodeRequest struct {
+	SectionName string `json:"sectionName"`
+	ExpiresAt   string `json:"expiresAt"`
+	SeatLimit   int    `json:"seatLimit"`
+}
+
+// check the seat limit of a new join code and convert its RFC 3339 expiry,
+// "" for none, to the stored form: sqlite compares datetime('now') against
+// UTC text timestamps
+func joinCodeExpiry(expiresAt string, seatLimit int) (string, error) {
+	if seatLimit < 0 {
+		return "", errors.New("seat limit must not be negative")
+	}
+	if expiresAt == "" {
+		return "", nil
+	}
+	expires, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return "", errors.New("expiresAt must be an RFC 3339 timestamp")
+	}
+	return expires.UTC().Format(datastore.TimeFormat), nil
+}
+
+// replace the join code of a section, optionally with an expiry (RFC 3339) and a seat limit
+func (env *Env) regenerateJoinCode(w http.ResponseWriter, req *http.Request) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	if req.Method != "POST" || req.Body == nil {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	var requestData regenerateJoinCodeRequest
+	decoder := json.NewDecoder(req.Body)
+	if err := decoder.Decode(&requestData); err != nil {
+		http.Error(w, "Unable to decode request body.", 400)
+		return
+	}
+
+	if requestData.SectionName == "" {
+		http.Error(w, "section name required", 400)
+		return
+	}
+	expiresAt, err := joinCodeExpiry(requestData.ExpiresAt, requestData.SeatLimit)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if ok, err := env.isSectionInstructor(user, requestData.SectionName); err != nil {
+		http.Error(w, "db access error", 500)
+		logger.ErrorContext(req.Context(), "regenerateJoinCode: db access error", "error", err)
+		return
+	} else if !ok {
+		http.Error(w, "Insufficient privileges", 403)
+		return
+	}
+
+	before, _ := env.ds.GetJoinCode(requestData.SectionName)
+	joinCode, err := env.ds.RegenerateJoinCode(requestData.SectionName, expiresAt, requestData.SeatLimit)
+	if err != nil {
+		http.Error(w, "db join code update error: "+err.Error(), 500)
+		logger.ErrorContext(req.Context(), "regenerateJoinCode: db join code update error: ", "error", err)
+		return
+	}
+	env.audit(req, "joincode.regenerate", requestData.SectionName, requestData.SectionName, before, joinCode)
+
+	joinCodeJSON, err := json.Marshal(joinCode)
+	if err != nil {
+		http.Error(w, "json marshal error", 500)
+		logger.ErrorContext(req.Context(), "regenerateJoinCode: json marshal error", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, string(joinCodeJSON))
+}
+
+// accepted JSON fields of disableJoinCode
+type disableJoinCodeRequest struct {
+	SectionName string `json:"sectionName"`
+}
+
+// stop the join code of a section from accepting new students
+func (env *Env) disableJoinCode(w http.ResponseWriter, req *http.Request) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	if req.Method != "POST" || req.Body == nil {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	var requestData disableJoinCodeRequest
+	decoder := json.NewDecoder(req.Body)
+	if err := decoder.Decode(&requestData); err != nil {
+		http.Error(w, "Unable to decode request body.", 400)
+		return
+	}
+
+	if ok, err := env.isSectionInstructor(user, requestData.SectionName); err != nil {
+		http.Error(w, "db access error", 500)
+		logger.ErrorContext(req.Context(), "disableJoinCode: db access error", "error", err)
+		return
+	} else if !ok {
+		http.Error(w, "Insufficient privileges", 403)
+		return
+	}
+
+	before, _ := env.ds.GetJoinCode(requestData.SectionName)
+	err := env.ds.DisableJoinCode(requestData.SectionName)
+	if errors.Is(err, datastore.ErrNotExists) {
+		http.Error(w, "section has no join code", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db join code update error", 500)
+		logger.ErrorContext(req.Context(), "disableJoinCode: db join code update error", "error", err)
+		return
+	}
+	after, _ := env.ds.GetJoinCode(requestData.SectionName)
+	env.audit(req, "joincode.disable", requestData.SectionName, requestData.SectionName, before, after)
+
 	w.Header().Set("Content-Type", "application/json")
 	io.WriteString(w, `{"success": "true"}`)
 }
 
+// accepted JSON fields of joinSection
+type joinSectionRequest struct {
+	JoinCode string `json:"joinCode"`
+}
+
+// enroll the current user as a student in the section owning the given join code
+func (env *Env) joinSection(w http.ResponseWriter, req *http.Request) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	if req.Method != "POST" || req.Body == nil {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	var requestData joinSectionRequest
+	decoder := json.NewDecoder(req.Body)
+	if err := decoder.Decode(&requestData); err != nil {
+		http.Error(w, "Unable to decode request body.", 400)
+		return
+	}
+
+	if requestData.JoinCode == "" {
+		http.Error(w, "join code required", 400)
+		return
+	}
+
+	sectionName, err := env.ds.EnrollWithJoinCode(requestData.JoinCode, user.GetEmail())
+	switch {
+	case errors.Is(err, datastore.ErrJoinCodeInvalid),
+		errors.Is(err, datastore.ErrJoinCodeDisabled),
+		errors.Is(err, datastore.ErrJoinCodeExpired):
+		http.Error(w, err.Error(), 400)
+		return
+	case errors.Is(err, datastore.ErrDuplicate):
+		http.Error(w, "already enrolled in this section", 409)
+		return
+	case errors.Is(err, datastore.ErrSectionFull):
+		http.Error(w, err.Error(), 409)
+		return
+	case err != nil:
+		http.Error(w, "db roster insertion error", 500)
+		logger.ErrorContext(req.Context(), "joinSection: db roster insertion error", "error", err)
+		return
+	}
+	env.audit(req, "roster.join", sectionName, user.GetEmail(), nil,
+		datastore.Roster{SectionName: sectionName, UserEmail: user.GetEmail(), Role: "student"})
+
+	sectionNameJSON, err := json.Marshal(sectionName)
+	if err != nil {
+		http.Error(w, "json marshal error", 500)
+		logger.ErrorContext(req.Context(), "joinSection: json marshal error", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, fmt.Sprintf(`{"success": "true", "sectionName": %s}`, sectionNameJSON))
+}
+
 // This will delete all roster, assignment, section, and non-argument proof rows, but does not reset the auto_increment id
-func (env *Env) clearDatabase() {
+// snapshot is the snapshot taken first, recorded in the audit log
+func (env *Env) clearDatabase(snapshot string) {
 	if err := env.ds.EmptyRosterTable(); err != nil {
-		log.Fatal(err)
+		fatal("clearDatabase: roster", err)
 	}
 	if err := env.ds.EmptyAssignmentTable(); err != nil {
-		log.Fatal(err)
+		fatal("clearDatabase: assignment", err)
 	}
 	if err := env.ds.EmptySectionTable(); err != nil {
-		log.Fatal(err)
+		fatal("clearDatabase: section", err)
 	}
 	if err := env.ds.EmptyProofTable(); err != nil {
-		log.Fatal(err)
+		fatal("clearDatabase: proof", err)
 	}
+	recordAudit(context.Background(), env.ds, newAuditEntry(osActor(), "database.clear", "", "db.sqlite3",
+		map[string]string{"snapshot": snapshot}, nil))
 }
 
 func (env *Env) populateTestProofRow() {
@@ -926,8 +1228,7 @@ func (env *Env) populateTestProofRow() {
 	})
 
 	if err != nil {
-		log.Println("error from Store(elarson argument)")
-		log.Fatal(err)
+		fatal("populateTestProofRow: Store(elarson argument)", err)
 	}
 
 	err = env.ds.Store(datastore.Proof{
@@ -946,8 +1247,7 @@ func (env *Env) populateTestProofRow() {
 	})
 
 	if err != nil {
-		log.Println("error: populateTestProofRow() from Store(student-proof1f)")
-		log.Fatal(err)
+		fatal("populateTestProofRow: Store(student-proof1f)", err)
 	}
 
 	err = env.ds.Store(datastore.Proof{
@@ -1011,65 +1311,281 @@ func (env *Env) populateTestProofRow() {
 	})
 }
 
+type legacyRoute struct {
+	path    string
+	handler http.HandlerFunc
+	method  string   // the only method the handler accepts
+	doc     routeDoc // see openapi.go
+}
+
+// flat routes used by the current frontend, registered in main
+func (env *Env) legacyRoutes() []legacyRoute {
+	sectionQuery := []queryParam{{Name: "sectionName", Required: true}}
+
+	return []legacyRoute{
+		// Get admin users -- this is a public endpoint, no token required
+		// Can be changed to require token, but would reduce cacheability
+		{"/admins", env.getAdmins, "GET", routeDoc{
+			Summary: "List admin users", Access: "public", Public: true,
+			Response: adminUsers{}}},
+
+		// method saveproof : POST : JSON <- id_token, proof
+		{"/saveproof", env.saveProof, "POST", routeDoc{
+			Summary: "Add or update a proof of the current user", Access: "any user",
+			Request: datastore.Proof{}, Response: successResponse{}}},
+
+		// method user : POST : JSON -> [proof, proof, ...]
+		{"/proofs", env.getProofs, "POST", routeDoc{
+			Summary: "List proofs of the current user; repo returns proofs grouped by section", Access: "any user; downloadrepo is for admins only",
+			Request: getProofRequest{}, Response: oneOf{[]datastore.Proof{}, []datastore.SectionProofs{}}}},
+
+		// spr2022 GETs : use query string for arguments
+		{"/sections", env.getSections, "GET", routeDoc{
+			Summary: "List the sections a user is on the roster of; archived ones only when asked for", Access: "any user",
+			Query: []queryParam{{Name: "user", Required: true}, {Name: "archived", Enum: []string{"include"}}},
+			Response: []datastore.Section{}}},
+		{"/roster", env.getRoster, "GET", routeDoc{
+			Summary: "List the students and TAs of a section", Access: "any user",
+			Query: sectionQuery, Response: []datastore.Roster{}}},
+		{"/completed-proofs-by-section", env.getCompletedProofsBySection, "GET", routeDoc{
+			Summary: "List completed repository proofs of the students of a section", Access: "any user",
+			Query: sectionQuery, Response: []datastore.Proof{}}},
+		{"/completed-proofs-by-assignment", env.getCompletedProofsByAssignment, "GET", routeDoc{
+			Summary: "List completed proofs of the students of a section for one assignment", Access: "any user",
+			Query: []queryParam{{Name: "sectionName", Required: true}, {Name: "assignmentName", Required: true}}, Response: []datastore.Proof{}}},
+		{"/assignments-by-section", env.getAssignmentsBySection, "GET", routeDoc{
+			Summary: "List the assignments of a section with their proofs", Access: "any user",
+			Query: sectionQuery, Response: []assignmentWithProofs{}}},
+		{"/arguments-by-user", env.getUserArguments, "GET", routeDoc{
+			Summary: "List the arguments (repository problems) authored by the current user", Access: "any user",
+			Response: []datastore.Proof{}}},
+
+		// spr2022 POST (delete has also been treated as POST) : use JSON req.body for arguments
+		{"/add-section", env.addSection, "POST", routeDoc{
+			Summary: "Create a section owned by the current user", Access: "any user; the caller becomes its instructor",
+			Request: addSectionRequest{}, Response: successResponse{}}},
+		{"/add-roster", env.addRoster, "POST", routeDoc{
+			Summary: "Add students and TAs to a section", Access: "any user",
+			Request: addRosterRequest{}, Response: addRosterResponse{}}},
+		{"/add-assignment", env.addAssignment, "POST", routeDoc{
+			Summary: "Create an assignment", Access: "any user",
+			Request: addAssignmentRequest{}, Response: successResponse{}}},
+		{"/update-assignment", env.updateAssignment, "POST", routeDoc{
+			Summary: "Replace an assignment", Access: "any user",
+			Request: updateAssignmentRequest{}, Response: successResponse{}}},
+		{"/remove-from-roster", env.removeFromRoster, "POST", routeDoc{
+			Summary: "Remove a user from a section", Access: "any user",
+			Request: removeFromRosterRequest{}, Response: successResponse{}}},
+		{"/remove-section", env.removeSection, "POST", routeDoc{
+			Summary: "Delete a section with its roster and assignments", Access: "any user",
+			Request: removeSectionRequest{}, Response: successResponse{}}},
+		{"/remove-assignment", env.removeAssignment, "POST", routeDoc{
+			Summary: "Delete an assignment", Access: "any user",
+			Request: removeAssignmentRequest{}, Response: successResponse{}}},
+
+		// section join codes: instructors manage the code, students POST it to enroll themselves
+		{"/join-code", env.getJoinCode, "GET", routeDoc{
+			Summary: "Get the self-enrollment code of a section", Access: "instructor",
+			Query: sectionQuery, Response: datastore.JoinCode{}}},
+		{"/regenerate-join-code", env.regenerateJoinCode, "POST", routeDoc{
+			Summary: "Replace the self-enrollment code of a section", Access: "instructor",
+			Request: regenerateJoinCodeRequest{}, Response: datastore.JoinCode{}}},
+		{"/disable-join-code", env.disableJoinCode, "POST", routeDoc{
+			Summary: "Stop the self-enrollment code of a section from accepting students", Access: "instructor",
+			Request: disableJoinCodeRequest{}, Response: successResponse{}}},
+		{"/join-section", env.joinSection, "POST", routeDoc{
+			Summary: "Join a section as a student using its join code", Access: "any user",
+			Request: joinSectionRequest{}, Response: joinSectionResponse{}}},
+
+		// proof checking for the frontend, compatible with checkproof.php, see checkproof.go
+		{"/checkproof.php", env.checkProof, "POST", routeDoc{
+			Summary: "Check a proof; the answer is empty if a required field is missing or proofData is not a proof", Access: "public", Public: true,
+			Request: proofcheck.CheckRequest{}, Form: true, Response: proofcheck.CheckResult{}}},
+
+		// live dashboard: Server-Sent Events stream, see events.go
+		{"/section-events", env.sectionEvents, "GET", routeDoc{
+			Summary: "Stream an event whenever a student of a section saves a proof", Access: "instructor, ta",
+			Query: sectionQuery, Response: datastore.ProofEvent{}, EventStream: true}},
+	}
+}
+
 func main() {
-	log.Println("Server initializing")
+	// Subcommands, see backup.go
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fatal(os.Args[1], err)
+			}
+			return
+		}
+	}
+
+	doClearDatabase := flag.Bool("cleardb", false, "Remove all proofs from the database, after taking a snapshot")
+	doPopulateDatabase := flag.Bool("populate", false, "Add sample data to the public repository.")
+	portPtr := flag.String("port", "8080", "Port to listen on")
+	logLevels := flag.String("log-level", "info", "Log levels, e.g. info,datastore=debug,tokenauth=warn")
+	logEmails := flag.String("log-emails", "hash", "How user emails appear in the log: hash or redact")
+	adminAddr := flag.String("admin-addr", "127.0.0.1:9090", "Address of the admin listener serving /metrics; empty to disable")
+	frontendSource := flag.String("frontend", "", "Also serve the site: \"embed\" for the copy built in, or a frontend directory")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "Time given to requests in flight on SIGINT/SIGTERM")
+	doCompareChecker := flag.Bool("compare-checker", false, "Re-check the stored proofs with the Go checker, report differences from PHP, and exit")
+	phpFrontend := flag.String("php-frontend", "", "With -compare-checker, also run checkproof.php of this frontend directory with the php command")
+	backupDir := flag.String("backup-dir", "backups", "Directory for database snapshots")
+	backupInterval := flag.Duration("backup-interval", 24*time.Hour, "Time between scheduled database snapshots; 0 to disable")
+	backupKeep := flag.Int("backup-keep", 14, "Snapshots to keep in -backup-dir; 0 keeps all")
+	purgeAfter := flag.Duration("purge-after", 30*24*time.Hour, "Time deleted sections, assignments and roster entries can be restored before they are purged; 0 keeps them")
+	proofRetention := flag.String("proof-retention", "keep", "Repository proofs of a dropped student or deleted section: keep, archive (hidden until restored) or purge (deleted when the removal is purged)")
+	flag.StringVar(&pdflatexCommand, "pdflatex", pdflatexCommand, "TeX command that renders proofs as PDF; empty to disable")
+	notify := flag.String("notify", "", "Where reports are emailed: file:DIR writes each message to DIR, smtp://[user:password@]host:port sends it; empty to disable")
+	flag.StringVar(&notifyFrom, "notify-from", notifyFrom, "From address of emailed reports")
+
+	flag.Parse() // Check for command-line arguments
+
+	// Structured logging; LOG_EMAIL_KEY keeps email hashes stable across restarts
+	if err := logging.SetLevels(*logLevels); err != nil {
+		fatal("invalid -log-level", err)
+	}
+	if err := logging.SetEmailMode(*logEmails); err != nil {
+		fatal("invalid -log-emails", err)
+	}
+	if key := os.Getenv("LOG_EMAIL_KEY"); key != "" {
+		logging.SetEmailKey(key)
+	}
+
+	notifier, err := newNotifier(*notify)
+	if err != nil {
+		fatal("invalid -notify", err)
+	}
+	reportNotifier = notifier
+	retention, err := datastore.ParseProofRetention(*proofRetention)
+	if err != nil {
+		fatal("invalid -proof-retention", err)
+	}
+
+	logger.Info("Server initializing")
 
 	ds, err := datastore.InitDB(database_uri)
 	if err != nil {
-		log.Fatal(err)
+		fatal("opening database", err)
 	}
-	defer ds.Close()
+
+	ds.SetProofRetention(retention)
 
 	// Add the admin users to the database for use in queries
 	ds.MaintainAdmins(admin_users)
 
-	Env := &Env{ds} // Put the instance into a struct to share between threads
+	Env := &Env{&metricsStore{ds}} // Put the instance into a struct to share between threads
 	// Env.ds.PopulateTestUsersSectionsRosters()
 	// Env.populateTestProofRow()
 
-	doClearDatabase := flag.Bool("cleardb", false, "Remove all proofs from the database")
-	doPopulateDatabase := flag.Bool("populate", false, "Add sample data to the public repository.")
-	portPtr := flag.String("port", "8080", "Port to listen on")
-
-	flag.Parse() // Check for command-line arguments
 	if *doClearDatabase {
-		Env.clearDatabase()
+		path, err := takeSnapshot(context.Background(), ds, *backupDir, "cleardb")
+		if err != nil {
+			fatal("snapshot before -cleardb", err)
+		}
+		logger.Info("Database snapshot taken", "path", path)
+		Env.clearDatabase(path)
 	}
 	if *doPopulateDatabase {
 		Env.populateTestProofRow()
 	}
+	if *doCompareChecker {
+		comparison, err := Env.compareChecker(context.Background(), *phpFrontend)
+		if err != nil {
+			fatal("comparing proof checkers", err)
+		}
+		logger.Info("Proof checkers compared", "checked", comparison.Checked, "verdictMismatches", comparison.VerdictMismatch,
+			"phpMismatches", comparison.PHPMismatch, "phpFailures", comparison.PHPFailed)
+		ds.Close()
+		if comparison.VerdictMismatch+comparison.PHPMismatch+comparison.PHPFailed != 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize token auth/cache
 	tokenauth.SetAuthorizedDomains(authorized_domains)
 	tokenauth.SetAuthorizedClientIds(authorized_client_ids)
 
-	// method saveproof : POST : JSON <- id_token, proof
-	http.Handle("/saveproof", tokenauth.WithValidToken(http.HandlerFunc(Env.saveProof)))
-
-	// method user : POST : JSON -> [proof, proof, ...]
-	http.Handle("/proofs", tokenauth.WithValidToken(http.HandlerFunc(Env.getProofs)))
-
-	// spr2022 GETs : use JSON req.body for arguments
-	http.Handle("/sections", tokenauth.WithValidToken(http.HandlerFunc(Env.getSections)))
-	http.Handle("/roster", tokenauth.WithValidToken(http.HandlerFunc(Env.getRoster)))
-	http.Handle("/completed-proofs-by-section", tokenauth.WithValidToken(http.HandlerFunc(Env.getCompletedProofsBySection)))
-	http.Handle("/completed-proofs-by-assignment", tokenauth.WithValidToken(http.HandlerFunc(Env.getCompletedProofsByAssignment)))
-	http.Handle("/assignments-by-section", tokenauth.WithValidToken(http.HandlerFunc(Env.getAssignmentsBySection)))
-	http.Handle("/arguments-by-user", tokenauth.WithValidToken(http.HandlerFunc(Env.getUserArguments)))
-
-	// spr2022 POST (delete has also been treated as POST) : use JSON req.body for arguments
-	http.Handle("/add-section", tokenauth.WithValidToken(http.HandlerFunc(Env.addSection)))
-	http.Handle("/add-roster", tokenauth.WithValidToken(http.HandlerFunc(Env.addRoster)))
-	http.Handle("/add-assignment", tokenauth.WithValidToken(http.HandlerFunc(Env.addAssignment)))
-	http.Handle("/update-assignment", tokenauth.WithValidToken(http.HandlerFunc(Env.updateAssignment)))
-	http.Handle("/remove-from-roster", tokenauth.WithValidToken(http.HandlerFunc(Env.removeFromRoster)))
-	http.Handle("/remove-section", tokenauth.WithValidToken(http.HandlerFunc(Env.removeSection)))
-	http.Handle("/remove-assignment", tokenauth.WithValidToken(http.HandlerFunc(Env.removeAssignment)))
-
-	// Get admin users -- this is a public endpoint, no token required
-	// Can be changed to require token, but would reduce cacheability
-	http.Handle("/admins", http.HandlerFunc(Env.getAdmins))
-
-	log.Println("Server started")
-	log.Fatal(http.ListenAndServe("127.0.0.1:"+(*portPtr), nil))
+	// Versioned REST API, see api.go
+	http.Handle(apiV1Prefix+"/", tokenauth.WithValidTokenOr(Env.withImpersonation(Env.apiV1()), rejectAPIToken))
+
+	// OpenAPI description of every route, see openapi.go
+	http.Handle("/openapi.json", http.HandlerFunc(Env.getOpenAPI))
+
+	// Liveness and readiness probes, see health.go
+	http.Handle("/healthz", http.HandlerFunc(healthz))
+	http.Handle("/readyz", http.HandlerFunc(Env.readyz))
+
+	// Legacy routes are kept as a compatibility shim until the frontend uses /api/v1
+	for _, route := range Env.legacyRoutes() {
+		if route.doc.Public {
+			http.Handle(route.path, route.handler)
+		} else {
+			http.Handle(route.path, tokenauth.WithValidToken(Env.withImpersonation(route.handler)))
+		}
+	}
+
+	// Without nginx, the backend can serve the site itself, see frontend.go
+	var handler http.Handler = http.DefaultServeMux
+	if *frontendSource != "" {
+		files, immutable, err := frontendFiles(*frontendSource)
+		if err != nil {
+			fatal("invalid -frontend", err)
+		}
+		handler = siteMux(Env.newFrontendHandler(files, immutable), http.DefaultServeMux)
+		logger.Info("Serving the frontend", "source", *frontendSource)
+	}
+
+	server := &http.Server{
+		Addr:    "127.0.0.1:" + (*portPtr),
+		Handler: withRequestLog(withMetrics(handler)),
+	}
+	servers := []*http.Server{server}
+
+	// Prometheus metrics on a listener nginx does not proxy, see metrics.go
+	if *adminAddr != "" {
+		admin := &http.Server{Addr: *adminAddr, Handler: Env.adminMux()}
+		servers = append(servers, admin)
+		go serve(admin, "Admin listener")
+	}
+	go serve(server, "Server")
+
+	// Scheduled snapshots and purges stop before the datastore closes
+	snapshotsCtx, stopSnapshots := context.WithCancel(context.Background())
+	snapshotsDone := make(chan struct{})
+	if *backupInterval > 0 {
+		go scheduleSnapshots(snapshotsCtx, ds, *backupDir, *backupInterval, *backupKeep, snapshotsDone)
+	} else {
+		close(snapshotsDone)
+	}
+	purgeDone := make(chan struct{})
+	if *purgeAfter > 0 {
+		go schedulePurge(snapshotsCtx, Env.ds, *purgeAfter, purgeDone)
+	} else {
+		close(purgeDone)
+	}
+
+	// Drain requests in flight, then close the datastore to flush the WAL
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	received := <-stop
+	logger.Info("Server shutting down", "signal", received.String(), "timeout", shutdownTimeout.String())
+
+	shutdownServers(*shutdownTimeout, servers...)
+	stopSnapshots()
+	<-snapshotsDone
+	<-purgeDone
+	if err := ds.Close(); err != nil {
+		fatal("closing database", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// listen until the server is shut down
+func serve(server *http.Server, name string) {
+	logger.Info(name+" started", "addr", server.Addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		fatal(name+" stopped", err)
+	}
 }
@@ -7,13 +7,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
-	datastore "./datastore"
+	"datastore"
 )
 
 const (
 	// Use an in-memory database for running tests
 	// Must specify cache=shared to prevent multiple connections from getting different DBs
-	test_dsn = "file::memory:?cache=shared"
+	test_dsn = "file::memory:?cache=shared&_foreign_keys=on"
 )
 
 type MockUserWithEmail struct {
@@ -35,7 +35,17 @@ func TestGetAdmins(t *testing.T) {
 	}
 
 	responseRecorder := httptest.NewRecorder()
-	handler := http.HandlerFunc(getAdmins)
+
+	ds, err := datastore.InitDB(test_dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	ds.MaintainAdmins(admin_users)
+
+	Env := &Env{ds}
+
+	handler := http.HandlerFunc(Env.getAdmins)
 
 	handler.ServeHTTP(responseRecorder, req)
 
@@ -43,7 +53,7 @@ func TestGetAdmins(t *testing.T) {
 		t.Errorf("getAdmins received bad status code: got %v want %v", responseRecorder.Code, http.StatusOK)
 	}
 
-	expected := `{"Admins":["gbruns@csumb.edu","cohunter@csumb.edu"]}`
+	expected := `{"Admins":["abiblarz@csumb.edu","cohunter@csumb.edu","gbruns@csumb.edu","sislam@csumb.edu"]}`
 	if responseRecorder.Body.String() != expected {
 		t.Errorf("getAdmins returned unexpected body: got %v want %v", responseRecorder.Body.String(), expected)
 	}
@@ -58,7 +68,7 @@ func TestSaveProof(t *testing.T) {
 
 	responseRecorder := httptest.NewRecorder()
 
-	ds, err := datastore.New(test_dsn)
+	ds, err := datastore.InitDB(test_dsn)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,4 +87,52 @@ func TestSaveProof(t *testing.T) {
 	if responseRecorder.Body.String() != expected {
 		t.Errorf("SaveProof returned unexpected body: got %v want %v", responseRecorder.Body.String(), expected)
 	}
-}
\ No newline at end of file
+}
+
+func TestJoinSection(t *testing.T) {
+	ds, err := datastore.InitDB(test_dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	Env := &Env{ds}
+
+	instructor := MockUserWithEmail{"instructor@csumb.edu"}
+	ds.InsertUser(datastore.User{Email: instructor.Email, Admin: 1})
+	if err := ds.InsertSection(datastore.Section{InstructorEmail: instructor.Email, Name: "TestJoinSection"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// students may not read the join code
+	ctx := context.WithValue(context.Background(), "tok", MockUserWithEmail{"student@csumb.edu"})
+	req, err := http.NewRequestWithContext(ctx, "GET", "/join-code?sectionName=TestJoinSection", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(Env.getJoinCode).ServeHTTP(responseRecorder, req)
+	if status := responseRecorder.Code; status != http.StatusForbidden {
+		t.Errorf("getJoinCode as student received bad status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	joinCode, err := ds.GetJoinCode("TestJoinSection")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "POST", "/join-section", strings.NewReader(`{"joinCode":"`+joinCode.Code+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(Env.joinSection).ServeHTTP(responseRecorder, req)
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Errorf("joinSection received bad status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"success": "true", "sectionName": "TestJoinSection"}`
+	if responseRecorder.Body.String() != expected {
+		t.Errorf("joinSection returned unexpected body: got %v want %v", responseRecorder.Body.String(), expected)
+	}
+}
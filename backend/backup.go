@@ -0,0 +1,159 @@
+package main
+
+// Snapshots of db.sqlite3
+//
+// The server takes a snapshot every -backup-interval and keeps the newest
+// -backup-keep of them; -cleardb takes one before it deletes anything.
+// `backend backup` and `backend restore` do the same by hand, the latter
+// while the server is stopped.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"datastore"
+)
+
+// subcommands of the backend binary, run in place of the server
+var commands = map[string]func(args []string) error{
+	"backup":         backupCommand,
+	"restore":        restoreCommand,
+	"export-section": exportSectionCommand,
+	"import-section": importSectionCommand,
+}
+
+// snapshot files are named db-<UTC time>-<reason>.sqlite3 so they sort by age
+const snapshotTimeFormat = "20060102T150405Z"
+
+func snapshotName(t time.Time, reason string) string {
+	return "db-" + t.UTC().Format(snapshotTimeFormat) + "-" + reason + ".sqlite3"
+}
+
+// write a snapshot of the database into dir, creating it if need be
+func takeSnapshot(ctx context.Context, ds *datastore.ProofStore, dir string, reason string) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, snapshotName(time.Now(), reason))
+	if err := ds.Backup(ctx, path); err != nil {
+		return "", err
+	}
+	lastSnapshot.SetToCurrentTime()
+	return path, nil
+}
+
+// remove all but the newest keep snapshots in dir; keep <= 0 keeps them all
+func pruneSnapshots(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	snapshots, err := filepath.Glob(filepath.Join(dir, "db-*.sqlite3"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(snapshots)
+	if len(snapshots) <= keep {
+		return nil, nil
+	}
+	removed := snapshots[:len(snapshots)-keep]
+	for _, path := range removed {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// take a snapshot every interval until ctx is done, then close done
+func scheduleSnapshots(ctx context.Context, ds *datastore.ProofStore, dir string, interval time.Duration, keep int, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		path, err := takeSnapshot(ctx, ds, dir, "scheduled")
+		if err != nil {
+			snapshotFailures.Inc()
+			logger.Error("scheduleSnapshots: snapshot failed", "error", err)
+			continue
+		}
+		removed, err := pruneSnapshots(dir, keep)
+		if err != nil {
+			logger.Error("scheduleSnapshots: pruning failed", "error", err)
+		}
+		logger.Info("Database snapshot taken", "path", path, "pruned", len(removed))
+	}
+}
+
+// `backend backup [-backup-dir dir] [-backup-keep n]`
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := flags.String("backup-dir", "backups", "Directory to write the snapshot to")
+	keep := flags.Int("backup-keep", 14, "Snapshots to keep in the directory; 0 keeps all")
+	flags.Parse(args)
+
+	ds, err := datastore.InitDB(database_uri)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	path, err := takeSnapshot(context.Background(), ds, *dir, "manual")
+	if err != nil {
+		return err
+	}
+	removed, err := pruneSnapshots(*dir, *keep)
+	if err != nil {
+		return err
+	}
+	logger.Info("Database snapshot taken", "path", path, "pruned", len(removed))
+	return nil
+}
+
+// `backend restore [-backup-dir dir] file`; the database is snapshotted
+// first, so a restore can itself be undone
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dir := flags.String("backup-dir", "backups", "Directory for the snapshot taken before restoring")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backend restore [-backup-dir dir] file")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("restore takes one backup file")
+	}
+	backup := flags.Arg(0)
+	if err := datastore.CheckBackup(backup); err != nil {
+		return err
+	}
+
+	ds, err := datastore.InitDB(database_uri)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	ctx := context.Background()
+	path, err := takeSnapshot(ctx, ds, *dir, "pre-restore")
+	if err != nil {
+		return err
+	}
+	logger.Info("Database snapshot taken", "path", path)
+	if err := ds.Restore(ctx, backup); err != nil {
+		return err
+	}
+	// recorded in the restored database; the replaced log is in the snapshot
+	recordAudit(ctx, ds, newAuditEntry(osActor(), "database.restore", "", "db.sqlite3",
+		map[string]string{"snapshot": path}, map[string]string{"backup": backup}))
+	return nil
+}
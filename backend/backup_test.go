@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"datastore"
+)
+
+func TestSnapshotName(t *testing.T) {
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("PST", -8*60*60))
+	if got := snapshotName(at, "cleardb"); got != "db-20260304T130607Z-cleardb.sqlite3" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTakeAndPruneSnapshots(t *testing.T) {
+	ds := newTestEnv(t).ds.(*datastore.ProofStore)
+	dir := filepath.Join(t.TempDir(), "backups")
+	path, err := takeSnapshot(context.Background(), ds, dir, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.CheckBackup(path); err != nil {
+		t.Errorf("snapshot does not restore: %v", err)
+	}
+
+	old := []string{"db-20200101T000000Z-scheduled.sqlite3", "db-20200102T000000Z-cleardb.sqlite3"}
+	for _, name := range append(old, "notes.txt") {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := pruneSnapshots(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != old[0] {
+		t.Errorf("pruned %v, want only the oldest", removed)
+	}
+	for _, name := range []string{old[1], filepath.Base(path), "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was pruned: %v", name, err)
+		}
+	}
+	if removed, _ := pruneSnapshots(dir, 0); len(removed) != 0 {
+		t.Errorf("keep 0 pruned %v", removed)
+	}
+}
+
+func TestScheduleSnapshots(t *testing.T) {
+	ds := newTestEnv(t).ds.(*datastore.ProofStore)
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go scheduleSnapshots(ctx, ds, dir, 10*time.Millisecond, 1, done)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snapshots, _ := filepath.Glob(filepath.Join(dir, "db-*-scheduled.sqlite3"))
+		if len(snapshots) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("found %v snapshots", snapshots)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,175 @@
+package main
+
+// Checking proofs
+//
+// POST /checkproof.php answers the frontend's check requests with the Go
+// checker (see proofcheck/) exactly as frontend/checkproof.php does: the
+// same form fields, the same JSON answer, and an empty answer when a field
+// is missing or the proof data is not a proof. nginx sends /checkproof.php
+// to PHP until it is pointed here; with -frontend the backend answers it
+// itself.
+//
+// -compare-checker re-checks every stored proof with the Go checker before
+// switching over: the verdict is compared with the one saved when PHP
+// checked the proof and, with -php-frontend, the whole answer with what
+// checkproof.php answers now. Mismatches are logged and the backend exits.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"datastore"
+	"proofcheck"
+)
+
+// largest check request accepted; proofs are a few KB
+const maxCheckProofBytes = 1 << 20
+
+// time allowed to checkproof.php for one proof when comparing
+const phpCheckTimeout = 10 * time.Second
+
+// check a proof for the frontend -- this is a public endpoint, no token required
+func (env *Env) checkProof(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxCheckProofBytes)
+	if err := req.ParseMultipartForm(maxCheckProofBytes); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	// like checkproof.php, answer nothing without the required fields
+	for _, field := range []string{"proofData", "numPrems", "wantedConc"} {
+		if _, ok := req.PostForm[field]; !ok {
+			return
+		}
+	}
+	result, ok := proofcheck.CheckRequest{
+		ProofData:         req.PostFormValue("proofData"),
+		NumPrems:          req.PostFormValue("numPrems"),
+		WantedConc:        req.PostFormValue("wantedConc"),
+		PredicateSettings: req.PostFormValue("predicateSettings"),
+		AllowedRules:      req.PostFormValue("allowedRules"),
+	}.Check()
+	if !ok {
+		return
+	}
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "json marshal error", 500)
+		logger.ErrorContext(req.Context(), "checkProof: json marshal error", "error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(output)
+}
+
+// the check request the frontend sent for a stored proof, or false if the
+// proof has no body
+func storedCheckRequest(proof datastore.Proof) (proofcheck.CheckRequest, bool) {
+	if len(proof.Logic) == 0 {
+		return proofcheck.CheckRequest{}, false
+	}
+	entries, err := proofcheck.ParseProof([]byte(proof.Logic[0]))
+	if err != nil {
+		return proofcheck.CheckRequest{}, false
+	}
+
+	// the frontend counts the premises when it loads a proof, and sends
+	// justifications with its own rule names changed back
+	numPrems := 0
+	for _, entry := range entries {
+		if !entry.IsSubproof && entry.JStr == "Pr" {
+			numPrems++
+		}
+	}
+	proofData, err := json.Marshal(proofcheck.UnchangeAllRuleNames(entries))
+	if err != nil {
+		return proofcheck.CheckRequest{}, false
+	}
+
+	predicate := "false"
+	if proof.ProofType == "fol" {
+		predicate = "true"
+	}
+	return proofcheck.CheckRequest{
+		ProofData:         string(proofData),
+		NumPrems:          strconv.Itoa(numPrems),
+		WantedConc:        proof.Conclusion,
+		PredicateSettings: predicate,
+	}, true
+}
+
+// the proofCompleted value the frontend saves for a check result
+func proofVerdict(result proofcheck.CheckResult) string {
+	switch {
+	case len(result.Issues) != 0:
+		return "error"
+	case result.ConcReached:
+		return "true"
+	default:
+		return "false"
+	}
+}
+
+type checkerComparison struct {
+	Checked         int // stored proofs with a body
+	VerdictMismatch int // Go verdict differs from the stored one
+	PHPMismatch     int // Go answer differs from checkproof.php's
+	PHPFailed       int // checkproof.php gave no answer
+}
+
+// compare the Go checker with the verdicts stored by PHP and, if
+// phpFrontend is set, with the answers of phpFrontend/checkproof.php
+func (env *Env) compareChecker(ctx context.Context, phpFrontend string) (checkerComparison, error) {
+	var comparison checkerComparison
+	query := datastore.ProofQuery{Limit: 500}
+	for {
+		page, err := env.ds.QueryProofs(query)
+		if err != nil {
+			return comparison, err
+		}
+		for _, proof := range page.Proofs {
+			request, ok := storedCheckRequest(proof)
+			if !ok {
+				continue
+			}
+			comparison.Checked++
+			result, _ := request.Check()
+
+			if verdict := proofVerdict(result); verdict != proof.ProofCompleted {
+				comparison.VerdictMismatch++
+				logger.Warn("compareChecker: verdict differs from the stored one", "proof", proof.Id,
+					"stored", proof.ProofCompleted, "go", verdict, "issues", result.Issues)
+			}
+
+			if phpFrontend == "" {
+				continue
+			}
+			phpCtx, cancel := context.WithTimeout(ctx, phpCheckTimeout)
+			phpResult, err := proofcheck.CheckWithPHP(phpCtx, phpFrontend, request)
+			cancel()
+			if err != nil {
+				comparison.PHPFailed++
+				logger.Warn("compareChecker: checkproof.php failed", "proof", proof.Id, "error", err)
+			} else if !reflect.DeepEqual(result, phpResult) {
+				comparison.PHPMismatch++
+				logger.Warn("compareChecker: answer differs from checkproof.php", "proof", proof.Id,
+					"php", phpResult, "go", result)
+			}
+		}
+		if page.NextCursor == "" {
+			return comparison, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
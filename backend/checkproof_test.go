@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+func TestCheckProof(t *testing.T) {
+	env := newTestEnv(t)
+	proofData := `[{"wffstr":"P→Q","jstr":"Pr"},{"wffstr":"P","jstr":"Pr"},{"wffstr":"Q","jstr":"1, 2 →E"}]`
+
+	// the frontend posts FormData
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, field := range [][2]string{{"predicateSettings", "false"}, {"proofData", proofData}, {"wantedConc", "Q"}, {"numPrems", "2"}} {
+		form.WriteField(field[0], field[1])
+	}
+	form.Close()
+	req := httptest.NewRequest("POST", "/checkproof.php", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	env.checkProof(rr, req)
+	if rr.Code != 200 || rr.Body.String() != `{"issues":[],"concReached":true}` {
+		t.Errorf("got %v %s", rr.Code, rr.Body.String())
+	}
+
+	post := func(values url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/checkproof.php", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		env.checkProof(rr, req)
+		return rr
+	}
+	rr = post(url.Values{"proofData": {proofData}, "wantedConc": {"R"}, "numPrems": {"1"}})
+	if rr.Code != 200 || rr.Body.String() != `{"issues":["Line 2: Is not a proper application of the rule Pr (for the line(s) cited)."],"concReached":false}` {
+		t.Errorf("got %v %s", rr.Code, rr.Body.String())
+	}
+
+	// checkproof.php answers nothing to these
+	for _, values := range []url.Values{
+		{"proofData": {proofData}, "wantedConc": {"Q"}},
+		{"proofData": {"[{"}, "wantedConc": {"Q"}, "numPrems": {"2"}},
+	} {
+		if rr := post(values); rr.Code != 200 || rr.Body.Len() != 0 {
+			t.Errorf("got %v %q for %v", rr.Code, rr.Body.String(), values)
+		}
+	}
+}
+
+func TestCompareChecker(t *testing.T) {
+	env := newTestEnv(t)
+	store := func(name, logic, completed string) {
+		t.Helper()
+		err := env.ds.Store(datastore.Proof{EntryType: "proof", UserSubmitted: "student@csumb.edu", ProofName: name, ProofType: "prop",
+			Premise: []string{"P", "P → Q"}, Logic: []string{logic}, Rules: []string{}, ProofCompleted: completed, Conclusion: "Q"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// saved with the frontend's rule names
+	store("done", `[{"wffstr":"P","jstr":"Pr"},{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"Q","jstr":"1, 2 Modus Ponens"}]`, "true")
+	store("started", `[{"wffstr":"P","jstr":"Pr"},{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"","jstr":""}]`, "error")
+	store("stale", `[{"wffstr":"P","jstr":"Pr"},{"wffstr":"P → Q","jstr":"Pr"}]`, "true")
+
+	comparison, err := env.compareChecker(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison != (checkerComparison{Checked: 3, VerdictMismatch: 1}) {
+		t.Errorf("got %+v", comparison)
+	}
+}
@@ -0,0 +1,127 @@
+package datastore
+
+// Problem analytics: how the students of a section are getting on with each
+// problem. The proof table keeps only the latest state of a proof, so Store
+// also records every save in the proofSave table; saves from before schema
+// version 5 are not there, and attempts made then have no saves or times.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// ProblemAttempt is one student's work on one problem.
+type ProblemAttempt struct {
+	Student     string `json:"student"`
+	Saves       int    `json:"saves"`       // recorded saves
+	FirstSaved  string `json:"firstSaved"`  // TimeFormat; "" with no recorded saves
+	Completed   bool   `json:"completed"`   // ever completed
+	CompletedAt string `json:"completedAt"` // first recorded save that completed it, TimeFormat; "" if none
+	Lines       int    `json:"lines"`       // lines of the completed proof, or of the latest one
+}
+
+// the lines of a proof body, subproofs included
+func countProofLines(logic []string) int {
+	if len(logic) == 0 {
+		return 0
+	}
+	var body interface{}
+	if err := json.Unmarshal([]byte(logic[0]), &body); err != nil {
+		return 0
+	}
+	var count func(v interface{}) int
+	count = func(v interface{}) int {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			return 1
+		case []interface{}:
+			n := 0
+			for _, entry := range v {
+				n += count(entry)
+			}
+			return n
+		}
+		return 0
+	}
+	return count(body)
+}
+
+// record a save of a proof; arguments are not proofs and are not recorded
+func recordSave(tx *sql.Tx, proof Proof) error {
+	if proof.EntryType != "proof" {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO proofSave (userSubmitted, proofName, proofCompleted, lines, timeSaved)
+	                   VALUES (?, ?, ?, ?, datetime('now'));`,
+		proof.UserSubmitted, proof.ProofName, proof.ProofCompleted, countProofLines(proof.Logic))
+	return err
+}
+
+// GetProblemAttempts returns the attempts of the students of a section at
+// the problem named proofName, in student order; students who have not
+// saved a proof of it are left out.
+func (p *ProofStore) GetProblemAttempts(sectionName string, proofName string) ([]ProblemAttempt, error) {
+	rows, err := p.db.Query(`SELECT proof.userSubmitted, proof.Logic, proof.proofCompleted, proof.everCompleted FROM proof
+	                         JOIN roster ON roster.userEmail = proof.userSubmitted
+	                         WHERE roster.sectionName = ? AND roster.role = 'student' AND roster.deletedAt IS NULL
+	                         AND proof.entryType = 'proof' AND proof.proofName = ?
+	                         ORDER BY proof.userSubmitted, proof.timeSubmitted;`, sectionName, proofName)
+	if err != nil {
+		return nil, err
+	}
+	var attempts []ProblemAttempt
+	for rows.Next() {
+		var student, logicJSON, completed, everCompleted string
+		if err := rows.Scan(&student, &logicJSON, &completed, &everCompleted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var logic []string
+		json.Unmarshal([]byte(logicJSON), &logic)
+		if len(attempts) == 0 || attempts[len(attempts)-1].Student != student {
+			attempts = append(attempts, ProblemAttempt{Student: student})
+		}
+		attempt := &attempts[len(attempts)-1]
+		// the completed row gives the length; otherwise the latest
+		if completed == "true" || !attempt.Completed {
+			attempt.Lines = countProofLines(logic)
+		}
+		attempt.Completed = attempt.Completed || completed == "true" || everCompleted == "true"
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range attempts {
+		attempt := &attempts[i]
+		var firstSaved, completedAt sql.NullString
+		err := p.db.QueryRow(`SELECT COUNT(*), MIN(timeSaved), MIN(CASE WHEN proofCompleted = 'true' THEN timeSaved END)
+		                      FROM proofSave WHERE proofName = ? AND userSubmitted = ?;`, proofName, attempt.Student).
+			Scan(&attempt.Saves, &firstSaved, &completedAt)
+		if err != nil {
+			return nil, err
+		}
+		attempt.FirstSaved, attempt.CompletedAt = firstSaved.String, completedAt.String
+	}
+	return attempts, nil
+}
+
+// GetReferenceLines returns the length of the reference solution of a
+// problem: its owner's completed proof of it, or the argument's own body;
+// 0 when it has neither.
+func (p *ProofStore) GetReferenceLines(problem Proof) (int, error) {
+	var logicJSON string
+	err := p.db.QueryRow(`SELECT Logic FROM proof WHERE entryType = 'proof' AND userSubmitted = ?
+	                      AND proofName = ? AND proofCompleted = 'true';`, problem.UserSubmitted, problem.ProofName).Scan(&logicJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return countProofLines(problem.Logic), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var logic []string
+	json.Unmarshal([]byte(logicJSON), &logic)
+	return countProofLines(logic), nil
+}
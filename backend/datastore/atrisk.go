@@ -0,0 +1,85 @@
+package datastore
+
+// Student activity, for the at-risk report: when each student of a section
+// last saved a proof, what they have completed, and how often they saved
+// failing proofs of problems they have not completed.
+
+import (
+	"slices"
+)
+
+// StudentActivity is what a student of a section has done.
+type StudentActivity struct {
+	Student     string         `json:"student"`
+	LastSaved   string         `json:"lastSaved"`   // TimeFormat; "" if they never saved a proof
+	Completed   []string       `json:"completed"`   // names of the problems they completed
+	FailedSaves map[string]int `json:"failedSaves"` // recorded saves with issues, by problem, of problems not completed
+}
+
+// GetStudentActivity returns the activity of the students on the roster of
+// a section, in student order.
+func (p *ProofStore) GetStudentActivity(sectionName string) ([]StudentActivity, error) {
+	rows, err := p.db.Query(`SELECT roster.userEmail, COALESCE(MAX(proof.timeSubmitted), '') FROM roster
+	                         LEFT JOIN proof ON proof.userSubmitted = roster.userEmail AND proof.entryType = 'proof'
+	                         WHERE roster.sectionName = ? AND roster.role = 'student' AND roster.deletedAt IS NULL
+	                         GROUP BY roster.userEmail ORDER BY roster.userEmail;`, sectionName)
+	if err != nil {
+		return nil, err
+	}
+	var activity []StudentActivity
+	for rows.Next() {
+		student := StudentActivity{Completed: []string{}, FailedSaves: map[string]int{}}
+		if err := rows.Scan(&student.Student, &student.LastSaved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		activity = append(activity, student)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range activity {
+		student := &activity[i]
+		rows, err := p.db.Query(`SELECT DISTINCT proofName FROM proof WHERE userSubmitted = ? AND entryType = 'proof'
+		                         AND (proofCompleted = 'true' OR everCompleted = 'true') ORDER BY proofName;`, student.Student)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var proofName string
+			if err := rows.Scan(&proofName); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			student.Completed = append(student.Completed, proofName)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		rows, err = p.db.Query(`SELECT proofName, COUNT(*) FROM proofSave WHERE userSubmitted = ? AND proofCompleted = 'error'
+		                        GROUP BY proofName;`, student.Student)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var proofName string
+			var saves int
+			if err := rows.Scan(&proofName, &saves); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !slices.Contains(student.Completed, proofName) {
+				student.FailedSaves[proofName] = saves
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return activity, nil
+}
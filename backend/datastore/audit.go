@@ -0,0 +1,153 @@
+package datastore
+
+// Audit log: who changed or deleted course data, and what it looked like
+// before and after. The auditLog table is append-only; triggers refuse to
+// update or delete its rows. The backend records an entry for every
+// administrative change it makes; MaintainAdmins records its own.
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// AuditActorAdminUsers is the actor of admin changes made by
+// MaintainAdmins, from the admin_users list of the backend
+const AuditActorAdminUsers = "admin_users"
+
+// AuditEntry is one recorded change.
+type AuditEntry struct {
+	Id      string          `json:"id"`
+	Time    string          `json:"time"`  // TimeFormat, UTC; set by RecordAudit
+	Actor   string          `json:"actor"` // email of the user, or who acted outside a request, e.g. "os:root"
+	Action  string          `json:"action"`
+	Section string          `json:"section,omitempty"` // the section the change belongs to, if any
+	Target  string          `json:"target"`
+	Before  json.RawMessage `json:"before,omitempty"` // left out when the change created the target
+	After   json.RawMessage `json:"after,omitempty"`  // left out when it deleted the target
+}
+
+// AuditQuery selects audit entries, newest first; empty fields do not filter
+type AuditQuery struct {
+	Section string
+	Actor   string
+	Action  string
+	After   string // Time >= this TimeFormat value
+	Before  string // Time < this TimeFormat value
+	Limit   int    // 0 returns every match
+	Cursor  string // NextCursor of the previous page
+}
+
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// RecordAudit appends an entry to the audit log; its Id and Time are set here
+func (p *ProofStore) RecordAudit(entry AuditEntry) error {
+	_, err := p.db.Exec(`INSERT INTO auditLog (time, actor, action, sectionName, target, before, after)
+	                     VALUES (datetime('now'), ?, ?, ?, ?, ?, ?);`,
+		entry.Actor, entry.Action, entry.Section, entry.Target, nullJSON(entry.Before), nullJSON(entry.After))
+	return err
+}
+
+// a JSON column value; NULL for an empty or null document
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return string(raw)
+}
+
+// QueryAudit returns the audit entries matching q, newest first, a page at
+// a time when q.Limit is set
+func (p *ProofStore) QueryAudit(q AuditQuery) (*AuditPage, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	for _, filter := range []struct{ condition, value string }{
+		{"sectionName = ?", q.Section},
+		{"actor = ?", q.Actor},
+		{"action = ?", q.Action},
+		{"time >= ?", q.After},
+		{"time < ?", q.Before},
+	} {
+		if filter.value != "" {
+			conditions = append(conditions, filter.condition)
+			args = append(args, filter.value)
+		}
+	}
+	if q.Cursor != "" {
+		before, err := strconv.ParseInt(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		conditions = append(conditions, "id < ?")
+		args = append(args, before)
+	}
+
+	query := `SELECT id, time, actor, action, sectionName, target, before, after FROM auditLog
+	          WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		// fetch one extra row to learn whether there is a next page
+		query += ` LIMIT ` + strconv.Itoa(q.Limit+1)
+	}
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &AuditPage{Entries: []AuditEntry{}}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after *string
+		if err := rows.Scan(&entry.Id, &entry.Time, &entry.Actor, &entry.Action, &entry.Section, &entry.Target, &before, &after); err != nil {
+			return nil, err
+		}
+		if before != nil {
+			entry.Before = json.RawMessage(*before)
+		}
+		if after != nil {
+			entry.After = json.RawMessage(*after)
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(page.Entries) > q.Limit {
+		page.Entries = page.Entries[:q.Limit]
+		page.NextCursor = page.Entries[q.Limit-1].Id
+	}
+	return page, nil
+}
+
+// record the admin flags MaintainAdmins changed, given the admins before and after
+func (p *ProofStore) auditAdmins(before []string, after []string) {
+	was := map[string]bool{}
+	for _, email := range before {
+		was[email] = true
+	}
+	is := map[string]bool{}
+	for _, email := range after {
+		is[email] = true
+	}
+	record := func(email string, action string, before int, after int) {
+		err := p.RecordAudit(AuditEntry{Actor: AuditActorAdminUsers, Action: action, Target: email,
+			Before: json.RawMessage(`{"admin":` + strconv.Itoa(before) + `}`), After: json.RawMessage(`{"admin":` + strconv.Itoa(after) + `}`)})
+		if err != nil {
+			logger.Error("MaintainAdmins: recording audit entry", "error", err)
+		}
+	}
+	for _, email := range after {
+		if !was[email] {
+			record(email, "admin.grant", 0, 1)
+		}
+	}
+	for _, email := range before {
+		if !is[email] {
+			record(email, "admin.revoke", 1, 0)
+		}
+	}
+}
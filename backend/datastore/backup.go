@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// copy every page of the main database of src into dest with the SQLite
+// online backup API; writers on src wait until the copy is done
+func copyDatabase(ctx context.Context, dest *sql.DB, src *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(d any) error {
+		return srcConn.Raw(func(s any) error {
+			backup, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Backup writes a consistent copy of the database to path while it stays
+// in use. The copy is a single file in rollback journal mode, written
+// beside path first so that path is never left half-written.
+func (p *ProofStore) Backup(ctx context.Context, path string) error {
+	partial := path + ".partial"
+	os.Remove(partial)
+	dest, err := sql.Open("sqlite3", "file:"+partial+"?mode=rwc")
+	if err != nil {
+		return err
+	}
+	err = copyDatabase(ctx, dest, p.db)
+	if err == nil {
+		_, err = dest.Exec(`PRAGMA journal_mode = DELETE`)
+	}
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// CheckBackup opens the backup at path read-only and checks its integrity,
+// and that it is not from a build with a newer SchemaVersion.
+func CheckBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&integrity); err != nil {
+		return err
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("backup %s failed its integrity check: %s", path, integrity)
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: backup %s has version %d, this build has %d", ErrSchemaVersion, path, version, SchemaVersion)
+	}
+	return nil
+}
+
+// Restore replaces the whole database with the backup at path, once
+// CheckBackup accepts it, and migrates a backup of an older version. Stop
+// the server first; its cached reads would otherwise outlive the restore.
+func (p *ProofStore) Restore(ctx context.Context, path string) error {
+	if err := CheckBackup(path); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := copyDatabase(ctx, p.db, src); err != nil {
+		return err
+	}
+	if err := migrate(p.db); err != nil {
+		return err
+	}
+	logger.Info("database restored", "backup", path)
+	return nil
+}
@@ -1,14 +1,19 @@
 package datastore
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
    "fmt"
-	"log"
-   "strconv"
+   "os"
+   "time"
+
+   "logging"
 )
 
+var logger = logging.New("datastore")
+
 var (
    ErrDuplicate    = errors.New("record already exists")
    ErrNotExists    = errors.New("row does not exist")
@@ -30,6 +35,8 @@ type Proof struct {
 	Conclusion     string   // conclusion of the proof
 	RepoProblem    string   // 'true' if problem started from a repo problem, else 'false'
 	TimeSubmitted  string
+	RuleSet        string   `json:",omitempty"` // GetRepoProofs only: the rule set of the assignment listing the problem
+	AllowedRules   []string `json:",omitempty"` // and the rules it allows, filled in by the backend
 }
 
 type SectionProofs struct {
@@ -47,6 +54,7 @@ type UserWithEmail interface {
 
 type IProofStore interface {
 	Close() error
+   Ping(ctx context.Context) error
 	// Empty() error
 	EmptyProofTable() error
 	EmptyUserTable() error
@@ -65,23 +73,57 @@ type IProofStore interface {
    GetUserArguments(user UserWithEmail) ([]Proof, error)
 	GetUserCompletedProofs(user UserWithEmail) (error, []Proof)
    GetSections(userEmail string) ([]Section, error)
+   GetArchivedSections(userEmail string) ([]Section, error)
+   GetSection(name string) (*Section, error)
    GetRoster(sectionName string) ([]Roster, error)
+   GetRole(sectionName string, userEmail string) (string, error)
    GetAssignmentsBySection(sectionName string) ([]Assignment, error)
    GetAssignmentProofs(assignment Assignment) ([]Proof, error)
    GetCompletedProofsBySection(sectionName string) ([]Proof, error)
    GetCompletedProofsByAssignment(sectionName string, assignmentName string) ([]Proof, error)
+   GetProblemRuleSets(userEmail string, proofName string) ([]string, error)
+   GetProblemAttempts(sectionName string, proofName string) ([]ProblemAttempt, error)
+   GetReferenceLines(problem Proof) (int, error)
+   RecordMistakes(userEmail string, proofName string, mistakes []ProofMistake) error
+   GetMistakeCounts(sectionName string, student string, byProblem bool) ([]MistakeCount, error)
+   GetStudentActivity(sectionName string) ([]StudentActivity, error)
+   RecordAudit(entry AuditEntry) error
+   QueryAudit(q AuditQuery) (*AuditPage, error)
+   QueryProofs(q ProofQuery) (*ProofPage, error)
+   GetProof(id string) (*Proof, error)
+   SubscribeProofEvents(sectionName string) (<-chan ProofEvent, func())
 	PopulateTestUsersSectionsRosters()
 	RemoveFromRoster(sectionName string, userEmail string) error
 	RemoveSection(sectionName string) error
+   SetSectionTerm(sectionName string, term string) error
+   SetSectionArchived(sectionName string, archived bool) error
+   CloneSection(sourceName string, section Section) (*Section, error)
    RemoveAssignment(sectionName string, name string) error
-   removeOneStudentsProofs(userEmail string) (error)
-   removeAllStudentsProofs(sectionName string) (error)
+   GetDeleted(userEmail string) (*DeletedItems, error)
+   RestoreSection(sectionName string) error
+   RestoreAssignment(sectionName string, name string) error
+   RestoreRosterEntry(sectionName string, userEmail string) error
+   PurgeDeleted(before string) (*DeletedItems, error)
+   GetJoinCode(sectionName string) (*JoinCode, error)
+   RegenerateJoinCode(sectionName string, expiresAt string, seatLimit int) (*JoinCode, error)
+   DisableJoinCode(sectionName string) error
+   EnrollWithJoinCode(code string, userEmail string) (string, error)
+   ExportSection(sectionName string) (*SectionArchive, error)
+   ImportSection(archive *SectionArchive, sectionName string, importer string) (*ImportSummary, error)
+   SaveProblem(problem Problem) (*Problem, error)
+   SaveProblems(problems []Problem) ([]Problem, error)
+   GetProblem(id string, viewer string) (*Problem, error)
+   SearchProblems(q ProblemQuery) (*ProblemPage, error)
+   HiddenProblems(ids []int, viewer string) ([]int, error)
+   IsStaff(userEmail string) (bool, error)
 	Store(Proof) error
 	MaintainAdmins(admin_users map[string]bool)
 }
 
 type ProofStore struct {
-	db *sql.DB
+	db        *sql.DB
+	hub       *ProofHub      // live proof events for section dashboards
+	retention ProofRetention // what happens to dropped students' proofs, see retention.go
 }
 
 // deprecated, see EmptyProofTable()
@@ -120,36 +162,11 @@ func getProofsFromRows(rows *sql.Rows) (error, []Proof) {
 }
 
 func (p *ProofStore) GetAllAttemptedRepoProofs() (error, []Proof) {
-	// Create 'admin_repoproblems' view
-	_, err := p.db.Exec(`DROP VIEW IF EXISTS admin_repoproblems`)
-	if err != nil {
-		return err, nil
-	}
-
-	_, err = p.db.Exec(`CREATE VIEW admin_repoproblems (userSubmitted, Premise, Conclusion) 
-                        AS SELECT userSubmitted, Premise, Conclusion 
-                        FROM proof WHERE userSubmitted IN (SELECT email FROM user WHERE admin = 1)`)
+	page, err := p.QueryProofs(AttemptedRepoProofsQuery())
 	if err != nil {
 		return err, nil
 	}
-	stmt, err := p.db.Prepare(`SELECT id, entryType, proof.userSubmitted, proofName, proofType, proof.Premise, Logic, Rules, 
-                                    everCompleted, proofCompleted, timeSubmitted, proof.Conclusion, repoProblem
-								      FROM proof INNER JOIN admin_repoproblems 
-                                 ON proof.Premise = admin_repoproblems.Premise AND proof.Conclusion = admin_repoproblems.Conclusion
-                              WHERE entryType = 'proof'
-                              ORDER BY proof.userSubmitted, proofName, proofCompleted;`)
-	if err != nil {
-		return err, nil
-	}
-	defer stmt.Close()
-	
-	rows, err := stmt.Query()
-	if err != nil {
-		return err, nil
-	}
-	defer rows.Close()
-
-	return getProofsFromRows(rows)
+	return nil, page.Proofs
 }
 
 // return the visibile assignment proofs and the corresponding section for a given user
@@ -178,23 +195,20 @@ func (p *ProofStore) GetRepoProofs(user UserWithEmail) (error, []SectionProofs)
       assignmentProofs = []Proof{}
       sectionProofList.ProofList = []Proof{}
       sectionProofList.SectionName = section.Name
-      log.Println("-----")
-      log.Println("assignmentProofs at start of section: ", sectionProofList.SectionName)
-      log.Println("  ", len(assignmentProofs), "arguments held")
 
       sectionAssignments, err = p.GetAssignmentsBySection(section.Name)
       if err == nil { // if no errors occured
          for _,assignment := range sectionAssignments {
             if assignment.Visibility == "true" {
                assignmentProofs, err = p.GetAssignmentProofs(assignment)
-               log.Println("  ", len(assignmentProofs), " assignmentProofs for section: ", sectionProofList.SectionName)
+               for i := range assignmentProofs {
+                  assignmentProofs[i].RuleSet = assignment.RuleSet
+               }
                sectionProofList.ProofList = append(sectionProofList.ProofList, assignmentProofs...)
-               log.Println("  sectionProofList gen info:")
-               log.Println("    ", sectionProofList.SectionName,": ", len(sectionProofList.ProofList), " arguments")
             }
          }
          repoList = append(repoList, sectionProofList)
-         log.Println("  repoList has ", len(repoList), " section assignments list")
+         logger.Debug("GetRepoProofs: section arguments", "section", section.Name, "arguments", len(sectionProofList.ProofList))
       }
    }
 
@@ -202,20 +216,11 @@ func (p *ProofStore) GetRepoProofs(user UserWithEmail) (error, []SectionProofs)
 }
 
 func (p *ProofStore) GetUserProofs(user UserWithEmail) (error, []Proof) {
-	stmt, err := p.db.Prepare(`SELECT id, entryType, userSubmitted, proofName, proofType, Premise, Logic, Rules, everCompleted, proofCompleted, timeSubmitted, Conclusion, repoProblem 
-                              FROM proof WHERE userSubmitted = ? AND everCompleted = 'false' AND proofCompleted != 'true' AND proofName != 'n/a' AND proofName NOT LIKE '%Test%' AND proofName NOT LIKE '%Quiz%' AND proofName NOT LIKE '%Final%'`)
-	if err != nil {
-		return err, nil
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query(user.GetEmail())
+	page, err := p.QueryProofs(UserProofsQuery(user.GetEmail()))
 	if err != nil {
 		return err, nil
 	}
-	defer rows.Close()
-
-	return getProofsFromRows(rows)
+	return nil, page.Proofs
 }
 
 
@@ -242,23 +247,24 @@ func (p *ProofStore) GetUserArguments(user UserWithEmail) ([]Proof, error) {
 }
 
 func (p *ProofStore) GetUserCompletedProofs(user UserWithEmail) (error, []Proof) {
-	stmt, err := p.db.Prepare(`SELECT id, entryType, userSubmitted, proofName, proofType, Premise, Logic, Rules, everCompleted, proofCompleted, timeSubmitted, Conclusion, repoProblem 
-                              FROM proof WHERE userSubmitted = ? AND proofCompleted = 'true' AND proofName NOT LIKE '%Test%' AND proofName NOT LIKE '%Quiz%' AND proofName NOT LIKE '%Final%';`)
-	if err != nil {
-		return err, nil
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query(user.GetEmail())
+	page, err := p.QueryProofs(UserCompletedProofsQuery(user.GetEmail()))
 	if err != nil {
 		return err, nil
 	}
-	defer rows.Close()
-
-	return getProofsFromRows(rows)
+	return nil, page.Proofs
 }
 
 func (p *ProofStore) Store(proof Proof) error {
+	// problems assigned only in archived sections are read-only
+	if proof.EntryType == "proof" && proof.RepoProblem == "true" {
+		archived, err := p.isArchivedProblem(proof.UserSubmitted, proof.ProofName)
+		if err != nil {
+			return err
+		}
+		if archived {
+			return ErrSectionArchived
+		}
+	}
 	tx, err := p.db.Begin()
 	if err != nil {
 		return errors.New("Database transaction begin error")
@@ -314,7 +320,15 @@ func (p *ProofStore) Store(proof Proof) error {
 	if err != nil {
 		return errors.New("Statement exec error")
 	}
-	tx.Commit()
+   if err = recordSave(tx, proof); err != nil {
+      tx.Rollback()
+      return err
+   }
+	if err = tx.Commit(); err != nil {
+		return errors.New("Transaction commit error")
+	}
+
+	p.publishProof(proof)
 
 	return nil
 }
@@ -357,6 +371,8 @@ type User struct {
 type Section struct {
    InstructorEmail string
    Name string
+   Term string    // e.g. 'Fall 2026'; empty if not given
+   Archived bool  // archived sections are read-only and left out of GetSections
 }
 
 type Roster struct {
@@ -375,6 +391,8 @@ type Assignment struct {
    Name string
    ProofIds string
    Visibility string
+   RuleSet string // rules its problems allow: a preset name, a comma-separated list, or '' for every rule
+   DueDate string // TimeFormat, UTC; '' if it has none
 }
 
 type Display interface {
@@ -389,8 +407,10 @@ func (roster Roster) Display() (string) {
    return fmt.Sprintf("Roster: %s, %s, %s", roster.SectionName, roster.UserEmail, roster.Role)
 }
 
+// bring the admin flags of users in line with admins; every change is recorded in the audit log
 func (p *ProofStore) MaintainAdmins(admins map[string]bool) {
    currentAdmins := p.GetAdmins()
+   defer func() { p.auditAdmins(currentAdmins, p.GetAdmins()) }()
    newAdmin := true
    updateUserSQL1 := `UPDATE user SET admin = 1 WHERE email = ?;`
    updateUserSQL0 := `UPDATE user SET admin = 0 WHERE email = ?;`
@@ -407,7 +427,7 @@ func (p *ProofStore) MaintainAdmins(admins map[string]bool) {
             result, err := p.db.Exec(updateUserSQL1, email)
             numUpdated, _ :=result.RowsAffected()
             if (err != nil) || (numUpdated != 1) {
-               log.Printf("error during MaintainAdmins: '%s' for %s\n", err.Error(), email)
+               logger.Error("MaintainAdmins: promoting admin", "error", err, logging.Email("user", email))
             }
          } else {
             p.InsertUser(User{Email: email, FirstName: "", LastName: "", Admin:1})
@@ -418,7 +438,7 @@ func (p *ProofStore) MaintainAdmins(admins map[string]bool) {
             result, err := p.db.Exec(updateUserSQL0, email)
             numUpdated, _ :=result.RowsAffected()
             if (err != nil) || (numUpdated != 1) {
-               log.Printf("error during MaintainAdmins: '%s' for %s", err.Error(), email)
+               logger.Error("MaintainAdmins: demoting admin", "error", err, logging.Email("user", email))
             }
          }
          // log.Printf("guest: %s\n", email)
@@ -439,16 +459,14 @@ func (p *ProofStore) InsertUser(user User) (error){
    insertUserSQL := `INSERT INTO user(email, firstName, lastName, admin) VALUES (?, ?, ?, ?);`
    statement, err := p.db.Prepare(insertUserSQL)
    if err != nil {
-      log.Println("error: InsertUser: preparing insertUserSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertUser: preparing insertUserSQL statement", "error", err)
       return err
    }
    defer statement.Close()
 
    _, err = statement.Exec(user.Email, user.FirstName, user.LastName, user.Admin)
    if err != nil {
-      log.Println("error: InsertUser: executing insertUserSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertUser: executing insertUserSQL statement", "error", err)
       return err
    }
    return nil
@@ -461,177 +479,265 @@ func (p *ProofStore) InsertSection(section Section) (error) {
       return err
    }
 
-   insertSectionSQL := `INSERT INTO section(instructorEmail, name) VALUES (?, ?);`
-   statement, err := p.db.Prepare(insertSectionSQL)
+   tx, err := p.db.Begin()
    if err != nil {
-      log.Println("error: InsertSection: db.Prepare(insertSectionSQL)")
-      log.Println("-- ", err.Error())
+      return errors.New("Database transaction begin error")
+   }
+   defer tx.Rollback()
+
+   // a deleted section keeps its name until it is restored or purged
+   var deleted int
+   err = tx.QueryRow(`SELECT count(*) FROM section WHERE name = ? AND deletedAt IS NOT NULL;`, section.Name).Scan(&deleted)
+   if err != nil {
+      return err
+   }
+   if deleted != 0 {
+      return fmt.Errorf("%w: section %q is deleted; restore it or wait until it is purged", ErrDuplicate, section.Name)
+   }
+
+   insertSectionSQL := `INSERT INTO section(instructorEmail, name, term) VALUES (?, ?, ?);`
+   statement, err := tx.Prepare(insertSectionSQL)
+   if err != nil {
+      logger.Error("InsertSection: db.Prepare(insertSectionSQL)", "error", err)
       return err
    }
    defer statement.Close()
 
-   _, err = statement.Exec(section.InstructorEmail, section.Name)
+   _, err = statement.Exec(section.InstructorEmail, section.Name, section.Term)
    if err != nil {
-      log.Println("error: InsertSection: statement.Exec(instructorEmail, name)")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertSection: statement.Exec(instructorEmail, name, term)", "error", err)
       return err
    }
-   return nil
+
+   // every new section starts with an open join code: no expiry and no seat limit
+   _, err = setJoinCode(tx, JoinCode{SectionName: section.Name})
+   if err != nil {
+      logger.Error("InsertSection: setJoinCode", "error", err)
+      return err
+   }
+
+   return tx.Commit()
 }
 
 func (p *ProofStore) InsertRoster(rosterRow Roster) (error) {
+   if err := checkSectionWritable(p.db, rosterRow.SectionName); err != nil {
+      return err
+   }
+   tx, err := p.db.Begin()
+   if err != nil {
+      return errors.New("Database transaction begin error")
+   }
+   defer tx.Rollback()
+
+   // adding a removed user again replaces their deleted roster entry
+   if err := replaceDeletedRosterEntry(tx, rosterRow.SectionName, rosterRow.UserEmail); err != nil {
+      logger.Error("InsertRoster: replacing deleted roster entry", "error", err)
+      return err
+   }
    // log.Println("Inserting roster record. . .")
    insertRosterSQL := `INSERT INTO roster(sectionName, userEmail, role) VALUES (?, ?, ?);`
-   statement, err := p.db.Prepare(insertRosterSQL)
+   statement, err := tx.Prepare(insertRosterSQL)
    if err != nil {
-      log.Println("error: InsertRoster: preparation of insertRosterSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertRoster: preparation of insertRosterSQL statement", "error", err)
       return err
    }
    defer statement.Close()
 
    _, err = statement.Exec(rosterRow.SectionName, rosterRow.UserEmail, rosterRow.Role)
    if err != nil {
-      log.Println("error: InsertRoster: execution of insertRosterSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertRoster: execution of insertRosterSQL statement", "error", err)
       return err
    }
-   return nil
+   return tx.Commit()
 }
 
 func (p *ProofStore) InsertAssignment(assignment Assignment) (error){
-   insertAssignmentSQL := `INSERT INTO assignment(sectionName, name, proofIds, visibility) VALUES (?, ?, ?, ?);`
-   statement, err := p.db.Prepare(insertAssignmentSQL)
+   tx, err := p.db.Begin()
    if err != nil {
-      log.Println("error: InsertAssignment: preparation of insertAssignmentSQL statement")
-      log.Println("-- ", err.Error())
+      return err
+   }
+   defer tx.Rollback()
+
+   if err := checkSectionWritable(tx, assignment.SectionName); err != nil {
+      return err
+   }
+   // a new assignment replaces a deleted one of the same name
+   _, err = tx.Exec(`DELETE FROM assignment WHERE sectionName = ? AND name = ? AND deletedAt IS NOT NULL;`,
+                    assignment.SectionName, assignment.Name)
+   if err != nil {
+      logger.Error("InsertAssignment: replacing deleted assignment", "error", err)
+      return err
+   }
+   insertAssignmentSQL := `INSERT INTO assignment(sectionName, name, proofIds, visibility, ruleSet, dueDate) VALUES (?, ?, ?, ?, ?, ?);`
+   statement, err := tx.Prepare(insertAssignmentSQL)
+   if err != nil {
+      logger.Error("InsertAssignment: preparation of insertAssignmentSQL statement", "error", err)
       return err
    }
    defer statement.Close()
 
-   _, err = statement.Exec(assignment.SectionName, assignment.Name, assignment.ProofIds, assignment.Visibility)
+   _, err = statement.Exec(assignment.SectionName, assignment.Name, assignment.ProofIds, assignment.Visibility, assignment.RuleSet, assignment.DueDate)
    if err != nil {
-      log.Println("error: InsertAssignment: execution of insertAssignmentSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("InsertAssignment: execution of insertAssignmentSQL statement", "error", err)
       return err
    }
-   return nil
+   return tx.Commit()
 }
 
+// ErrNotExists if the section has no live assignment named currentName
 func (p *ProofStore) UpdateAssignment(currentName string, updatedAssignment Assignment) (error) {
-   updateAssignmentSQL := `UPDATE assignment SET name = ?, proofIds = ?, visibility = ?
-                           WHERE name = ? and sectionName = ?;`
-   statement, err := p.db.Prepare(updateAssignmentSQL)
+   tx, err := p.db.Begin()
    if err != nil {
-      log.Println("error: UpdateAssignment: preparation of updateAssignmentSQL statement")
-      log.Println("-- ", err.Error())
       return err
    }
-   defer statement.Close()
+   defer tx.Rollback()
 
-   _, err = statement.Exec(updatedAssignment.Name, updatedAssignment.ProofIds, updatedAssignment.Visibility,
-                           currentName, updatedAssignment.SectionName)
+   if err := checkSectionWritable(tx, updatedAssignment.SectionName); err != nil {
+      return err
+   }
+   // renaming an assignment replaces a deleted one of the new name
+   _, err = tx.Exec(`DELETE FROM assignment WHERE sectionName = ? AND name = ? AND deletedAt IS NOT NULL;`,
+                    updatedAssignment.SectionName, updatedAssignment.Name)
+   if err != nil {
+      logger.Error("UpdateAssignment: replacing deleted assignment", "error", err)
+      return err
+   }
+   updateAssignmentSQL := `UPDATE assignment SET name = ?, proofIds = ?, visibility = ?, ruleSet = ?, dueDate = ?
+                           WHERE name = ? and sectionName = ? AND deletedAt IS NULL;`
+   statement, err := tx.Prepare(updateAssignmentSQL)
    if err != nil {
-      log.Println("error: UpdateAssignment: execution of updateAssignmentSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("UpdateAssignment: preparation of updateAssignmentSQL statement", "error", err)
       return err
    }
+   defer statement.Close()
 
-   return nil
+   result, err := statement.Exec(updatedAssignment.Name, updatedAssignment.ProofIds, updatedAssignment.Visibility,
+                                 updatedAssignment.RuleSet, updatedAssignment.DueDate, currentName, updatedAssignment.SectionName)
+   if err != nil {
+      logger.Error("UpdateAssignment: execution of updateAssignmentSQL statement", "error", err)
+      return err
+   }
+   // the deleted assignment stays unless the update happened
+   if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+      return ErrNotExists
+   }
+   return tx.Commit()
 }
 
+// delete a section softly, with its roster and assignments; see RestoreSection.
+// Its students' proofs are kept, archived or purged as set by SetProofRetention.
 func (p *ProofStore) RemoveSection(sectionName string) (error) {
-   err := p.removeAllStudentsProofs(sectionName)
+   tx, err := p.db.Begin()
    if err != nil {
-      return err
+      return errors.New("Database transaction begin error")
    }
+   defer tx.Rollback()
+
    // log.Println("Deleting section record. . .")
-   RemoveSectionSQL := `DELETE From section where name = ?;`
-   statement, err := p.db.Prepare(RemoveSectionSQL)
+   deletedAt := time.Now().UTC().Format(TimeFormat)
+   result, err := tx.Exec(`UPDATE section SET deletedAt = ? WHERE name = ? AND deletedAt IS NULL;`, deletedAt, sectionName)
    if err != nil {
-      log.Println("error: RemoveSection: preparation of RemoveSectionSQL statement")
-      log.Fatalln("-- ", err.Error())
+      logger.Error("RemoveSection: deleting section", "error", err)
       return err
    }
-   defer statement.Close()
+   if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+      return ErrNotExists
+   }
 
-   _, err = statement.Exec(sectionName)
+   rows, err := tx.Query(`SELECT userEmail FROM roster WHERE sectionName = ? AND role = 'student' AND deletedAt IS NULL;`, sectionName)
    if err != nil {
-      log.Println("error: RemoveSection: execution of RemoveSectionSQL statement")
-      log.Println("-- ", err.Error())
       return err
    }
-   return nil
+   var students []string
+   for rows.Next() {
+      var student string
+      if err := rows.Scan(&student); err != nil {
+         rows.Close()
+         return err
+      }
+      students = append(students, student)
+   }
+   rows.Close()
+   for _, student := range students {
+      if err := p.archiveDroppedProofs(tx, sectionName, student, deletedAt); err != nil {
+         logger.Error("RemoveSection: archiving proofs", "error", err)
+         return err
+      }
+   }
+
+   // stamp the live roster entries and assignments with the section's time,
+   // so that restoring it brings back exactly these
+   for _, table := range []string{"roster", "assignment"} {
+      _, err = tx.Exec(`UPDATE `+table+` SET deletedAt = ? WHERE sectionName = ? AND deletedAt IS NULL;`, deletedAt, sectionName)
+      if err != nil {
+         logger.Error("RemoveSection: deleting "+table, "error", err)
+         return err
+      }
+   }
+   return tx.Commit()
 }
 
+// delete a roster entry softly; see RestoreRosterEntry. A student's proofs
+// are kept, archived or purged as set by SetProofRetention.
 func (p *ProofStore) RemoveFromRoster(sectionName string, userEmail string) (error) {
-   err := p.removeOneStudentsProofs(userEmail)
+   tx, err := p.db.Begin()
    if err != nil {
+      return errors.New("Database transaction begin error")
+   }
+   defer tx.Rollback()
+
+   if err := checkSectionWritable(tx, sectionName); err != nil {
       return err
    }
-   // log.Println("Deleting roster record. . .")
-   RemoveFromRosterSQL := `DELETE From roster where sectionName = ? and userEmail = ?;`
-   statement, err := p.db.Prepare(RemoveFromRosterSQL)
+   var role string
+   err = tx.QueryRow(`SELECT role FROM roster WHERE sectionName = ? AND userEmail = ? AND deletedAt IS NULL;`,
+                     sectionName, userEmail).Scan(&role)
+   if errors.Is(err, sql.ErrNoRows) {
+      return nil
+   }
    if err != nil {
-      log.Println("error: RemoveFromRoster: preparation of RemoveFromRosterSQL statement")
-      log.Println("-- ", err.Error())
       return err
    }
-   defer statement.Close()
 
-   _, err = statement.Exec(sectionName, userEmail)
+   // log.Println("Deleting roster record. . .")
+   deletedAt := time.Now().UTC().Format(TimeFormat)
+   RemoveFromRosterSQL := `UPDATE roster SET deletedAt = ? WHERE sectionName = ? and userEmail = ? AND deletedAt IS NULL;`
+   _, err = tx.Exec(RemoveFromRosterSQL, deletedAt, sectionName, userEmail)
    if err != nil {
-      log.Println("error: RemoveFromRoster: execution of RemoveFromRosterSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("RemoveFromRoster: execution of RemoveFromRosterSQL statement", "error", err)
       return err
    }
-   return nil
+   if role == "student" {
+      if err := p.archiveDroppedProofs(tx, sectionName, userEmail, deletedAt); err != nil {
+         logger.Error("RemoveFromRoster: archiving proofs", "error", err)
+         return err
+      }
+   }
+   return tx.Commit()
 }
 
+// delete an assignment softly; see RestoreAssignment. ErrNotExists if the
+// section has no live assignment of that name.
 func (p *ProofStore) RemoveAssignment(sectionName string, name string) (error) {
+   if err := checkSectionWritable(p.db, sectionName); err != nil {
+      return err
+   }
    // log.Println("Deleting assignment record. . .")
-   RemoveAssignmentSQL := `DELETE FROM assignment where sectionName = ? and name = ?;`
+   RemoveAssignmentSQL := `UPDATE assignment SET deletedAt = ? WHERE sectionName = ? and name = ? AND deletedAt IS NULL;`
    statement, err := p.db.Prepare(RemoveAssignmentSQL)
    if err != nil {
-      log.Println("error: RemoveAssignment: preparation of RemoveAssignmentSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("RemoveAssignment: preparation of RemoveAssignmentSQL statement", "error", err)
       return err
    }
    defer statement.Close()
 
-   _, err = statement.Exec(sectionName, name)
+   result, err := statement.Exec(time.Now().UTC().Format(TimeFormat), sectionName, name)
    if err != nil {
-      log.Println("error: RemoveAssignment: execution of RemoveAssignmentSQL statement")
-      log.Println("-- ", err.Error())
+      logger.Error("RemoveAssignment: execution of RemoveAssignmentSQL statement", "error", err)
       return err
    }
-   return nil
-}
-
-// remove all assignment proofs associated with a given userEmail
-func (p *ProofStore) removeOneStudentsProofs(userEmail string) (error) {
-   removeProofsSQL := `DELETE FROM proof WHERE userSubmitted = ? AND entryType = 'proof' AND repoProof = 'true';`
-   statement, err := p.db.Prepare(removeProofsSQL)
-   defer statement.Close()
-
-   _, err = statement.Exec(userEmail)
-   if err != nil {
-      log.Println("error: removeOneStudentsProofs: ", err.Error())
-      return err
-   }
-   return nil
-}
-
-// remove all assignment proofs associated with userEmails that are connected to a sectionName via roster
-func (p *ProofStore) removeAllStudentsProofs(sectionName string) (error) {
-   removeProofsSQL := `DELETE FROM proof WHERE userSubmitted IN (SELECT userEmail FROM roster WHERE sectionName = ? AND role != "instructor") AND repoProof = 'true';`
-   statement, err := p.db.Prepare(removeProofsSQL)
-   defer statement.Close()
-
-   _, err = statement.Exec(sectionName)
-   if err != nil {
-      log.Println("error: removeAllStudentsProofs: ", err.Error())
-      return err
+   if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+      return ErrNotExists
    }
    return nil
 }
@@ -639,7 +745,8 @@ func (p *ProofStore) removeAllStudentsProofs(sectionName string) (error) {
 func (p *ProofStore) GetUsers() ([]User) {
    row, err := p.db.Query("Select * FROM user ORDER BY admin DESC, lastName;")
    if err != nil {
-      log.Fatalln("error: GetUsers: ", err.Error())
+      logger.Error("GetUsers", "error", err)
+      os.Exit(1)
    }
    defer row.Close()
 
@@ -657,7 +764,8 @@ func (p *ProofStore) GetUsers() ([]User) {
 func (p *ProofStore) GetAdmins() ([]string) {
    row, err := p.db.Query(`SELECT email FROM user WHERE admin = 1 ORDER BY email;`)
    if err != nil {
-      log.Fatalln("error: GetAdmins: ", err.Error())
+      logger.Error("GetAdmins", "error", err)
+      os.Exit(1)
    }
    defer row.Close()
 
@@ -670,21 +778,24 @@ func (p *ProofStore) GetAdmins() ([]string) {
    return admins
 }
 
-// return array of current sections
+// return array of current sections; archived ones are left out, see GetArchivedSections
 func (p *ProofStore) GetSections(userEmail string) ([]Section, error){
-   statement, err := p.db.Prepare(`SELECT instructorEmail, name FROM section JOIN roster ON section.name = roster.sectionName 
-                                    WHERE roster.userEmail = ?`)
+   return p.getSections(userEmail, false)
+}
+
+func (p *ProofStore) getSections(userEmail string, archived bool) ([]Section, error){
+   statement, err := p.db.Prepare(`SELECT instructorEmail, name, term, archived FROM section JOIN roster ON section.name = roster.sectionName 
+                                    WHERE roster.userEmail = ? AND section.archived = ?
+                                    AND section.deletedAt IS NULL AND roster.deletedAt IS NULL`)
    if err != nil {
-      log.Printf(`error: GetSections: preparation of getSectionsSQL statement
-                  -- %s`, err.Error())
+      logger.Error("GetSections: preparation of getSectionsSQL statement", "error", err)
       return nil, err
    }
    defer statement.Close()
 
-   rows, err := statement.Query(userEmail)
+   rows, err := statement.Query(userEmail, archived)
    if err != nil {
-      log.Printf(`error: GetSections: Query of getSectionsSQL statement
-                  -- %s`, err.Error())
+      logger.Error("GetSections: Query of getSectionsSQL statement", "error", err)
       return nil, err
    }
    defer rows.Close()
@@ -692,8 +803,7 @@ func (p *ProofStore) GetSections(userEmail string) ([]Section, error){
    var sections []Section
    for rows.Next() { // Iterate and fetch the records from result cursor
       var section Section
-      rows.Scan(&section.InstructorEmail, &section.Name)
-      log.Printf("section scan check: %+v", section)
+      rows.Scan(&section.InstructorEmail, &section.Name, &section.Term, &section.Archived)
       sections = append(sections, section)
    }
    return sections, nil
@@ -701,19 +811,17 @@ func (p *ProofStore) GetSections(userEmail string) ([]Section, error){
 
 // get students and tas from roster for a given section name
 func (p *ProofStore) GetRoster(sectionName string) ([]Roster, error) {
-   selectRoserSql := `SELECT userEmail, role FROM roster WHERE sectionName = ? AND role != "instructor" ORDER BY role, userEmail`
+   selectRoserSql := `SELECT userEmail, role FROM roster WHERE sectionName = ? AND role != "instructor" AND deletedAt IS NULL ORDER BY role, userEmail`
    statement, err := p.db.Prepare(selectRoserSql)
    if err != nil {
-      log.Printf(`error: GetRoster: during preparation of selectRoserSql statement
-                  -- %s`, err.Error())
+      logger.Error("GetRoster: during preparation of selectRoserSql statement", "error", err)
       return nil, err
    }
    defer statement.Close()
 
    rows, err := statement.Query(sectionName)
    if err != nil {
-      log.Printf(`error: GetRoster: during execution of selectRoserSql statement
-                  -- %s`, err.Error())
+      logger.Error("GetRoster: during execution of selectRoserSql statement", "error", err)
       return nil, err
    }
    defer rows.Close()
@@ -729,15 +837,27 @@ func (p *ProofStore) GetRoster(sectionName string) ([]Roster, error) {
    return roster, nil
 }
 
+// get the role of one user in a section, or ErrNotExists if they are not on its roster
+func (p *ProofStore) GetRole(sectionName string, userEmail string) (string, error) {
+   var role string
+   err := p.db.QueryRow(`SELECT role FROM roster WHERE sectionName = ? AND userEmail = ? AND deletedAt IS NULL;`, sectionName, userEmail).Scan(&role)
+   if err != nil {
+      if errors.Is(err, sql.ErrNoRows) {
+         return "", ErrNotExists
+      }
+      return "", err
+   }
+   return role, nil
+}
+
 func (p *ProofStore) GetAssignmentsBySection(sectionName string) ([]Assignment, error) {
-   selectAssignmentsSQL := `SELECT * FROM assignment WHERE sectionName = ?;`
+   selectAssignmentsSQL := `SELECT sectionName, name, proofIds, visibility, ruleSet, dueDate FROM assignment WHERE sectionName = ? AND deletedAt IS NULL;`
    statement, err := p.db.Prepare(selectAssignmentsSQL)
    defer statement.Close()
 
    rows, err := statement.Query(sectionName)
    if err != nil {
-      log.Printf(`error: GetAssignmentsBySection: during execution of selectAssignmentsSQL statement
-                  -- %s`, err.Error())
+      logger.Error("GetAssignmentsBySection: during execution of selectAssignmentsSQL statement", "error", err)
       return nil, err
    }
    defer rows.Close()
@@ -745,8 +865,7 @@ func (p *ProofStore) GetAssignmentsBySection(sectionName string) ([]Assignment,
    var assignments []Assignment
    for rows.Next() { 
       var assign Assignment
-      rows.Scan(&assign.SectionName, &assign.Name, &assign.ProofIds, &assign.Visibility)
-      log.Println("assignment Scan check: %+v", assign)
+      rows.Scan(&assign.SectionName, &assign.Name, &assign.ProofIds, &assign.Visibility, &assign.RuleSet, &assign.DueDate)
       assignments = append(assignments, assign)
    }
    return assignments, nil
@@ -754,23 +873,18 @@ func (p *ProofStore) GetAssignmentsBySection(sectionName string) ([]Assignment,
 
 func (p *ProofStore) GetAssignmentProofs(assignment Assignment) ([]Proof, error) {
    // get proofs by ids in assignment.proofIds
-   log.Println("in datastore: GetAssignmentProofs")
-   log.Printf("assignment: %s > %s > %s", assignment.SectionName, assignment.Name, assignment.ProofIds)
-
-   var proofIdIntegers []int
-   for _,v := range assignment.ProofIds {
-      if string(v) != "[" && string(v) != "]" && string(v) != " " && string(v) != ","{
-         id,_:= strconv.Atoi(string(v))
-         proofIdIntegers = append(proofIdIntegers, id)
-      }
+   logger.Debug("GetAssignmentProofs", "section", assignment.SectionName, "assignment", assignment.Name, "proofIds", assignment.ProofIds)
+
+   proofIdIntegers, err := parseProofIds(assignment.ProofIds)
+   if err != nil {
+      logger.Error("GetAssignmentProofs: during proofIds parsing", "error", err)
+      return nil, err
    }
-   log.Println("proof ids for selectProofsSQL: ", proofIdIntegers)
 
    selectProofsSQL := `SELECT * FROM proof WHERE id = ?;`
    statement, err := p.db.Prepare(selectProofsSQL)
    if err != nil {
-      log.Printf(`error: GetAssignmentProofs: during selectProofSQL prep
-                  -- %s`, err.Error())
+      logger.Error("GetAssignmentProofs: during selectProofSQL prep", "error", err)
       return nil, err
    }
    defer statement.Close()
@@ -779,16 +893,14 @@ func (p *ProofStore) GetAssignmentProofs(assignment Assignment) ([]Proof, error)
    for _,v := range proofIdIntegers {
       rows, err := statement.Query(v)
       if err != nil {
-         log.Printf(`error: GetAssignmentProofs: during selectProofSQL execution
-                     -- %s`, err.Error())
+         logger.Error("GetAssignmentProofs: during selectProofSQL execution", "error", err)
          return nil, err
       }
       defer rows.Close()
 
       err, proof := getProofsFromRows(rows)
       if err != nil {
-         log.Printf(`error: GetAssignmentProofs: during rows conversion
-                     -- %s`, err.Error())
+         logger.Error("GetAssignmentProofs: during rows conversion", "error", err)
          return nil, err
       }
       proofs = append(proofs, proof[0])
@@ -799,65 +911,27 @@ func (p *ProofStore) GetAssignmentProofs(assignment Assignment) ([]Proof, error)
 }
 
 func (p *ProofStore) GetCompletedProofsBySection(sectionName string) ([]Proof, error) {
-   selectProofsSQL := `SELECT * FROM roster JOIN proof ON userEmail = userSubmitted
-                        WHERE sectionName = ? AND role = 'student' AND entryType = 'proof' AND everCompleted = 'true' AND proofCompleted = 'true' AND repoProblem = 'true'
-                        ORDER BY userEmail;`
-   statement, err := p.db.Prepare(selectProofsSQL)
-   if err != nil {
-      log.Printf(`error: GetCompletedProofsBySection: during preparation of selectProofsSQL statement
-                  -- %s`, err.Error())
-      return nil, err
-   }
-   defer statement.Close()
-
-   rows, err := statement.Query(sectionName)
+   page, err := p.QueryProofs(CompletedProofsQuery(sectionName))
    if err != nil {
-      log.Printf(`error: GetCompletedProofsBySection: during execution of selectProofsSQL statement
-                  -- %s`, err.Error())
+      logger.Error("GetCompletedProofsBySection: during query of completed proofs", "error", err)
       return nil, err
    }
-   defer rows.Close()
-
-   var completedProofs []Proof
-   for rows.Next() {
-      var row RosterAndProof // this is just to grab all values in returned row for ease. . .
-      var PremiseJSON string
-      var LogicJSON string
-      var RulesJSON string
-      rows.Scan(&row.RowRoster.SectionName, &row.RowRoster.UserEmail, &row.RowRoster.Role, &row.RowProof.Id, &row.RowProof.EntryType, 
-                  &row.RowProof.UserSubmitted, &row.RowProof.ProofName, &row.RowProof.ProofType, &PremiseJSON, &LogicJSON, &RulesJSON, 
-                  &row.RowProof.EverCompleted, &row.RowProof.ProofCompleted, &row.RowProof.TimeSubmitted, &row.RowProof.Conclusion, &row.RowProof.RepoProblem)
-
-      if err = json.Unmarshal([]byte(PremiseJSON), &row.RowProof.Premise); err != nil {
-         return nil, err
-      }
-      if err = json.Unmarshal([]byte(LogicJSON), &row.RowProof.Logic); err != nil {
-         return nil, err
-      }
-      if err = json.Unmarshal([]byte(RulesJSON), &row.RowProof.Rules); err != nil {
-         return nil, err
-      }
-
-      completedProofs = append(completedProofs, row.RowProof) // only keep the proof data
-   }
 
-   return completedProofs, nil
+   return page.Proofs, nil
 }
 
 func (p *ProofStore) GetCompletedProofsByAssignment(sectionName string, assignmentName string) ([]Proof, error) {
-   getProofIds := `SELECT proofIds FROM assignment WHERE sectionName = ? AND name = ?;`
+   getProofIds := `SELECT proofIds FROM assignment WHERE sectionName = ? AND name = ? AND deletedAt IS NULL;`
    statement, err := p.db.Prepare(getProofIds)
    if err != nil {
-      log.Printf(`error: GetCompletedProofsByAssignment: during preparation of getProofIds statement
-                  -- %s`, err.Error())
+      logger.Error("GetCompletedProofsByAssignment: during preparation of getProofIds statement", "error", err)
       return nil, err
    }
    defer statement.Close()
 
    rows, err := statement.Query(sectionName, assignmentName)
    if err != nil {
-      log.Printf(`error: GetCompletedProofsByAssignment: during execution of getProofIds statement
-                  -- %s`, err.Error())
+      logger.Error("GetCompletedProofsByAssignment: during execution of getProofIds statement", "error", err)
       return nil, err
    }
    defer rows.Close()
@@ -866,7 +940,6 @@ func (p *ProofStore) GetCompletedProofsByAssignment(sectionName string, assignme
    for rows.Next() {
       rows.Scan(&proofIdsString)
    }
-   log.Printf("GetCompletedProofsByAssignment: proofIdsString: %s", proofIdsString)
    // -----
    var assignmentDetails Assignment
    assignmentDetails.SectionName = sectionName
@@ -874,37 +947,18 @@ func (p *ProofStore) GetCompletedProofsByAssignment(sectionName string, assignme
    assignmentDetails.ProofIds = proofIdsString
 
    assignmentProofs, err := p.GetAssignmentProofs(assignmentDetails)
-   // -----
-   selectProofsSQL := `SELECT * FROM proof WHERE userSubmitted IN (SELECT userEmail FROM roster WHERE sectionName = ? and role = 'student')
-                        AND entryType = 'proof' AND everCompleted = 'true' AND proofCompleted = 'true' AND repoProblem = 'true'
-                        ORDER BY userSubmitted, proofName;`
-   statement, err = p.db.Prepare(selectProofsSQL)
-   if err != nil {
-      log.Printf(`error: GetCompletedProofsByAssignment: during preparation of selectProofsSQL statement
-                  -- %s`, err.Error())
-      return nil, err
-   }
-
-   rows, err = statement.Query(sectionName)
    if err != nil {
-      log.Printf(`error: GetCompletedProofsByAssignment: during execution of selectProofsSQL statement
-                  -- %s`, err.Error())
+      logger.Error("GetCompletedProofsByAssignment: during retrieval of assignmentProofs", "error", err)
       return nil, err
    }
-
-   err, allProofs := getProofsFromRows(rows)
+   // -----
+   page, err := p.QueryProofs(CompletedProofsQuery(sectionName))
    if err != nil {
-      log.Printf(`error: GetCompletedProofsByAssignment: during copnversion of rows for allProofs
-                  -- %s`, err.Error())
+      logger.Error("GetCompletedProofsByAssignment: during query of completed proofs", "error", err)
       return nil, err
    }
+   allProofs := page.Proofs
 
-   log.Println("-----")
-   log.Printf("assignmentProofs: %+v", assignmentProofs)
-   log.Println("-----")
-   log.Printf("allProofs: %+v", allProofs)
-   log.Println("-----")
-   
    var completedAssignedProofs []Proof
    for _,v1 := range allProofs {
       for _,v2 := range assignmentProofs {
@@ -914,8 +968,7 @@ func (p *ProofStore) GetCompletedProofsByAssignment(sectionName string, assignme
          }
       }
    }
-   log.Printf("completedAssignedProofs: %+v", allProofs)
-   log.Println("-----")
+   logger.Debug("GetCompletedProofsByAssignment", "assigned", len(completedAssignedProofs), "completed", len(allProofs))
    return completedAssignedProofs, nil
 }
 
@@ -937,11 +990,14 @@ func (p *ProofStore) getUser(email string) (*User, error) {
    return &user, nil
 }
 
-func (p *ProofStore) getSection(name string) (*Section, error) {
+// return a single section given its name, or ErrNotExists
+func (p *ProofStore) GetSection(name string) (*Section, error) {
    var section Section
-   err := p.db.QueryRow("Select * from section where name = ?;", name).Scan(
+   err := p.db.QueryRow("Select instructorEmail, name, term, archived from section where name = ? AND deletedAt IS NULL;", name).Scan(
       &section.InstructorEmail,
       &section.Name,
+      &section.Term,
+      &section.Archived,
    )
 
    if err != nil {
@@ -977,7 +1033,7 @@ func (p *ProofStore) PopulateTestUsersSectionsRosters() {
    for _,v := range userInfo {
 		err := p.InsertUser(v)
 		if err != nil {
-			log.Printf("error from populateTest: InsertUser: %s for %s", err.Error(), v.Email)
+			logger.Warn("populateTest: InsertUser", "error", err, logging.Email("user", v.Email))
 		}
 	}
 
@@ -1004,7 +1060,7 @@ func (p *ProofStore) PopulateTestUsersSectionsRosters() {
    for _,v := range sectionInfo {
 		err := p.InsertSection(v)
 		if err != nil {
-			log.Printf("error from populateTest: InsertSection: %s for %s", err.Error(), v.InstructorEmail)
+			logger.Warn("populateTest: InsertSection", "error", err, "section", v.Name)
 		}
 	}
 
@@ -1089,7 +1145,7 @@ func (p *ProofStore) PopulateTestUsersSectionsRosters() {
 	for _,v := range rosterInfo {
 		err := p.InsertRoster(v)
 		if err != nil {
-         log.Printf("error from populateTest: InsertRoster: %s for %s, %s", err.Error(), v.SectionName, v.UserEmail)
+         logger.Warn("populateTest: InsertRoster", "error", err, "section", v.SectionName, logging.Email("user", v.UserEmail))
       }
    }
 
@@ -1111,9 +1167,9 @@ func (p *ProofStore) PopulateTestUsersSectionsRosters() {
 	for _,v := range assignmentInfo {
 		err := p.InsertAssignment(v)
 		if err != nil {
-         log.Printf("error from populateTest: InsertAssignment: %s for %s", err.Error(), v.Name)
+         logger.Warn("populateTest: InsertAssignment", "error", err, "assignment", v.Name)
       }
    }
 
-   fmt.Println("\n========INSERTIONS COMPLETED========\n")
+   fmt.Println("\n========INSERTIONS COMPLETED========")
 } 
\ No newline at end of file
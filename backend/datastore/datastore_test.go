@@ -1,10 +1,1290 @@
 package datastore
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
+type testUser struct {
+	email string
+}
+
+func (u testUser) GetEmail() string {
+	return u.email
+}
+
 func TestEmpty(t *testing.T) {
 	//t.Errorf("%+v", "todo")
 	return
-}
\ No newline at end of file
+}
+
+// open a fresh in-memory database named after the running test
+// cache=shared keeps every connection in the pool on the same database
+func newTestStore(t *testing.T) *ProofStore {
+	t.Helper()
+	ds, err := InitDB("file:" + t.Name() + "?mode=memory&cache=shared&_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ds.Close() })
+	return ds
+}
+
+// insert an instructor and a section owned by them
+func newTestSection(t *testing.T, ds *ProofStore, instructor string, name string) {
+	t.Helper()
+	if err := ds.InsertUser(User{Email: instructor, Admin: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertSection(Section{InstructorEmail: instructor, Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: name, UserEmail: instructor, Role: "instructor"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertSectionCreatesJoinCode(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Section 1")
+
+	jc, err := ds.GetJoinCode("Section 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jc.Code) != joinCodeLength || !jc.Enabled || jc.ExpiresAt != "" || jc.SeatLimit != 0 {
+		t.Errorf("unexpected join code for new section: %+v", jc)
+	}
+}
+
+func TestEnrollWithJoinCode(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Section 1")
+
+	jc, err := ds.RegenerateJoinCode("Section 1", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sectionName, err := ds.EnrollWithJoinCode(" "+jc.Code+" ", "student1@csumb.edu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sectionName != "Section 1" {
+		t.Errorf("enrolled in %q, want %q", sectionName, "Section 1")
+	}
+
+	roster, err := ds.GetRoster("Section 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roster) != 1 || roster[0].UserEmail != "student1@csumb.edu" || roster[0].Role != "student" {
+		t.Errorf("unexpected roster after enrollment: %+v", roster)
+	}
+
+	if _, err := ds.EnrollWithJoinCode(jc.Code, "student1@csumb.edu"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("second enrollment: got %v want %v", err, ErrDuplicate)
+	}
+	if _, err := ds.EnrollWithJoinCode(jc.Code, "student2@csumb.edu"); !errors.Is(err, ErrSectionFull) {
+		t.Errorf("enrollment past seat limit: got %v want %v", err, ErrSectionFull)
+	}
+}
+
+func TestJoinCodeRejections(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Section 1")
+
+	old, err := ds.GetJoinCode("Section 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := ds.RegenerateJoinCode("Section 1", "2000-01-01 00:00:00", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.EnrollWithJoinCode(old.Code, "student@csumb.edu"); !errors.Is(err, ErrJoinCodeInvalid) {
+		t.Errorf("rotated code: got %v want %v", err, ErrJoinCodeInvalid)
+	}
+	if _, err := ds.EnrollWithJoinCode(expired.Code, "student@csumb.edu"); !errors.Is(err, ErrJoinCodeExpired) {
+		t.Errorf("expired code: got %v want %v", err, ErrJoinCodeExpired)
+	}
+
+	current, err := ds.RegenerateJoinCode("Section 1", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.DisableJoinCode("Section 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.EnrollWithJoinCode(current.Code, "student@csumb.edu"); !errors.Is(err, ErrJoinCodeDisabled) {
+		t.Errorf("disabled code: got %v want %v", err, ErrJoinCodeDisabled)
+	}
+
+	if _, err := ds.RegenerateJoinCode("No Such Section", "", 0); !errors.Is(err, ErrNotExists) {
+		t.Errorf("regenerate for missing section: got %v want %v", err, ErrNotExists)
+	}
+}
+
+func TestQueryProofsPagination(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Logic")
+
+	students := []string{"c@csumb.edu", "a@csumb.edu", "b@csumb.edu"}
+	for _, student := range students {
+		if err := ds.InsertUser(User{Email: student}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"Repository - One", "Repository - Two"} {
+			err := ds.Store(Proof{EntryType: "proof", UserSubmitted: student, ProofName: name, ProofType: "prop",
+				Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "true", Conclusion: "P", RepoProblem: "true"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// not on the roster
+	ds.Store(Proof{EntryType: "proof", UserSubmitted: "other@csumb.edu", ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "true", Conclusion: "P", RepoProblem: "true"})
+
+	q := ProofQuery{SectionName: "Logic", ProofCompleted: []string{"true"}, Sort: "student", Limit: 4}
+	var seen []string
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := ds.QueryProofs(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, proof := range page.Proofs {
+			seen = append(seen, proof.UserSubmitted+" "+proof.ProofName)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	want := []string{
+		"a@csumb.edu Repository - One", "a@csumb.edu Repository - Two",
+		"b@csumb.edu Repository - One", "b@csumb.edu Repository - Two",
+		"c@csumb.edu Repository - One", "c@csumb.edu Repository - Two",
+	}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got proofs\n%s\nwant\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a cursor only continues the sort it was issued for
+	q.Sort = "problem"
+	if _, err := ds.QueryProofs(q); err != ErrInvalidCursor {
+		t.Errorf("got %v want ErrInvalidCursor", err)
+	}
+	q.Cursor = "not a cursor"
+	if _, err := ds.QueryProofs(q); err != ErrInvalidCursor {
+		t.Errorf("got %v want ErrInvalidCursor", err)
+	}
+}
+
+func TestQueryProofsFilters(t *testing.T) {
+	ds := newTestStore(t)
+	student := "student@csumb.edu"
+	for _, proof := range []Proof{
+		{ProofName: "Practice", ProofType: "prop", ProofCompleted: "false"},
+		{ProofName: "Practice", ProofType: "prop", ProofCompleted: "error"},
+		{ProofName: "Quiz 1", ProofType: "fol", ProofCompleted: "true"},
+		{ProofName: "n/a", ProofType: "fol", ProofCompleted: "false"},
+		{ProofName: "Older", ProofType: "prop", ProofCompleted: ""},
+	} {
+		proof.EntryType = "proof"
+		proof.UserSubmitted = student
+		proof.Premise, proof.Logic, proof.Rules = []string{}, []string{}, []string{}
+		if err := ds.Store(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(q ProofQuery) int {
+		t.Helper()
+		page, err := ds.QueryProofs(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(page.Proofs)
+	}
+
+	if n := count(ProofQuery{UserSubmitted: student}); n != 5 {
+		t.Errorf("all proofs: got %d want 5", n)
+	}
+	if n := count(ProofQuery{ProofCompleted: []string{"false", "error"}}); n != 3 {
+		t.Errorf("unfinished proofs: got %d want 3", n)
+	}
+	if n := count(ProofQuery{ProofType: "fol", HideUnnamed: true}); n != 1 {
+		t.Errorf("named fol proofs: got %d want 1", n)
+	}
+	if n := count(ProofQuery{HideAssessments: true, HideUnnamed: true}); n != 3 {
+		t.Errorf("practice proofs: got %d want 3", n)
+	}
+	if n := count(ProofQuery{SubmittedAfter: "2999-01-01 00:00:00"}); n != 0 {
+		t.Errorf("future proofs: got %d want 0", n)
+	}
+	if n := count(ProofQuery{SubmittedBefore: "2999-01-01 00:00:00", Sort: "time", Descending: true}); n != 5 {
+		t.Errorf("past proofs: got %d want 5", n)
+	}
+
+	err, unfinished := ds.GetUserProofs(testUser{student})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like the query it replaced, anything not completed counts as unfinished
+	if len(unfinished) != 3 {
+		t.Errorf("GetUserProofs: got %d proofs want 3", len(unfinished))
+	}
+}
+
+func TestStorePublishesProofEvents(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Logic")
+	newTestSection(t, ds, "other@csumb.edu", "Other")
+	student := "student@csumb.edu"
+	if err := ds.InsertUser(User{Email: student}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := ds.SubscribeProofEvents("Logic")
+	defer cancel()
+	otherEvents, cancelOther := ds.SubscribeProofEvents("Other")
+	defer cancelOther()
+
+	body := `[{"wffstr":"P","jstr":"Pr"},[{"wffstr":"Q","jstr":"Hyp"},{"wffstr":"P","jstr":"R 1"}],{"wffstr":"Q → P","jstr":"→I 2-3"}]`
+	err := ds.Store(Proof{EntryType: "proof", UserSubmitted: student, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{body}, Rules: []string{}, ProofCompleted: "true", Conclusion: "Q → P"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		want := ProofEvent{SectionName: "Logic", Student: student, ProofName: "Repository - One", ProofCompleted: "true", LineCount: 4}
+		if event != want {
+			t.Errorf("got event %+v want %+v", event, want)
+		}
+	default:
+		t.Fatal("no event published for the student's section")
+	}
+	select {
+	case event := <-otherEvents:
+		t.Errorf("event published to a section the student is not in: %+v", event)
+	default:
+	}
+
+	// subscribers that stop reading are dropped instead of blocking Store
+	for i := 0; i <= proofEventBuffer; i++ {
+		ds.hub.Publish(ProofEvent{SectionName: "Logic"})
+	}
+	for range events {
+	}
+}
+
+func TestCloseCheckpointsWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite3")
+	ds, err := InitDB("file:" + path + "?_foreign_keys=on&mode=rwc&_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertUser(User{Email: "student@csumb.edu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() != 0 {
+		t.Errorf("WAL still holds %v bytes after Close", info.Size())
+	}
+	if err := ds.Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded on a closed database")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	ds, err := InitDB("file:" + filepath.Join(dir, "db.sqlite3") + "?_foreign_keys=on&mode=rwc&_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	newTestSection(t, ds, "instructor@csumb.edu", "Logic")
+
+	backup := filepath.Join(dir, "backup.sqlite3")
+	if err := ds.Backup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backup + "-wal"); err == nil {
+		t.Error("backup left a WAL file beside it")
+	}
+	if err := CheckBackup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.db.Exec(`DELETE FROM section`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Restore(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	if section, err := ds.GetSection("Logic"); err != nil || section == nil {
+		t.Errorf("section not restored: %v %v", section, err)
+	}
+}
+
+func TestRestoreChecksSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestStore(t)
+	backup := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := ds.Backup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	other, err := InitDB("file:" + backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.db.Exec(`PRAGMA user_version = 99`); err != nil {
+		t.Fatal(err)
+	}
+	other.db.Close()
+
+	if err := ds.Restore(ctx, backup); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("restoring a newer schema: got %v", err)
+	}
+	if _, err := InitDB("file:" + backup); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("opening a newer schema: got %v", err)
+	}
+	if err := CheckBackup(filepath.Join(t.TempDir(), "missing.sqlite3")); err == nil {
+		t.Error("a missing backup was accepted")
+	}
+}
+
+func TestSectionArchive(t *testing.T) {
+	ds := newTestStore(t)
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	if err := ds.InsertUser(User{Email: student, FirstName: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+		t.Fatal(err)
+	}
+	// ids past 9, so that assignment ids of more than one digit are read back whole
+	for i := 0; i < 10; i++ {
+		filler := Proof{EntryType: "argument", UserSubmitted: "other@csumb.edu", ProofName: fmt.Sprint("Filler ", i), ProofCompleted: "false"}
+		if err := ds.Store(filler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	problem := Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P ∨ Q", RepoProblem: "true"}
+	attempt := problem
+	attempt.EntryType, attempt.UserSubmitted, attempt.ProofCompleted, attempt.EverCompleted = "proof", student, "true", "true"
+	attempt.Logic = []string{`[{"wffstr":"P","jstr":"Pr"},{"wffstr":"P ∨ Q","jstr":"1 ∨I"}]`}
+	for _, proof := range []Proof{problem, attempt} {
+		if err := ds.Store(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.InsertAssignment(Assignment{SectionName: "Logic", Name: "HW 1", ProofIds: "[11]", Visibility: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if assigned, err := ds.GetAssignmentProofs(Assignment{ProofIds: "[11]"}); err != nil || len(assigned) != 1 || assigned[0].ProofName != problem.ProofName {
+		t.Fatalf("GetAssignmentProofs: %+v %v", assigned, err)
+	}
+
+	archive, err := ds.ExportSection("Logic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Roster) != 2 || len(archive.Problems) != 1 || len(archive.Proofs) != 1 || archive.Assignments[0].ProofIds[0] != 11 {
+		t.Fatalf("unexpected archive: %+v", archive)
+	}
+	encoded, err := json.Marshal(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// into another server, where the problem gets id 1; its instructor may
+	// import it, since the server has none of its students
+	other, err := InitDB("file:" + t.Name() + "-other?mode=memory&cache=shared&_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	var decoded SectionArchive
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := other.ImportSection(&decoded, "", instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Users != 2 || summary.Problems != 1 || summary.Proofs != 1 || summary.ProofIds[11] != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	assignments, err := other.GetAssignmentsBySection("Logic")
+	if err != nil || len(assignments) != 1 || assignments[0].ProofIds != "[1]" {
+		t.Fatalf("unexpected assignments: %+v %v", assignments, err)
+	}
+	if role, _ := other.GetRole("Logic", student); role != "student" {
+		t.Errorf("student imported as %q", role)
+	}
+	if proofs, _ := other.GetCompletedProofsByAssignment("Logic", "HW 1"); len(proofs) != 1 || proofs[0].Logic[0] != attempt.Logic[0] {
+		t.Errorf("unexpected completed proofs: %+v", proofs)
+	}
+	if _, err := other.ImportSection(&decoded, "", ""); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("importing over an existing section: %v", err)
+	}
+
+	// but not onto the server it came from, whose student already exists,
+	// nor with a problem of someone else's
+	if _, err := ds.ImportSection(archive, "Logic mine", instructor); !errors.Is(err, ErrImportNotAllowed) {
+		t.Errorf("instructor importing existing users: %v", err)
+	}
+	var forged SectionArchive
+	json.Unmarshal(encoded, &forged)
+	forged.Problems[0].UserSubmitted = "other@csumb.edu"
+	third, err := InitDB("file:" + t.Name() + "-third?mode=memory&cache=shared&_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if _, err := third.ImportSection(&forged, "", instructor); !errors.Is(err, ErrImportNotAllowed) {
+		t.Errorf("instructor importing another user's problem: %v", err)
+	}
+
+	// onto the server it came from, under a new name: problems and proofs are shared
+	summary, err = ds.ImportSection(archive, "Logic copy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Users != 0 || summary.Problems != 0 || summary.ProofsSkipped != 1 || summary.ProofIds[11] != 11 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	archive.Version = SectionArchiveVersion + 1
+	if _, err := ds.ImportSection(archive, "Logic v2", ""); !errors.Is(err, ErrArchiveVersion) {
+		t.Errorf("importing another version: %v", err)
+	}
+	archive.Version = SectionArchiveVersion
+	archive.Assignments[0].ProofIds = []int{12}
+	if _, err := ds.ImportSection(archive, "Logic broken", ""); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("importing an assignment of a missing problem: %v", err)
+	}
+	if _, err := ds.GetSection("Logic broken"); !errors.Is(err, ErrNotExists) {
+		t.Errorf("a failed import left its section behind: %v", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	if len(migrations) != SchemaVersion-1 {
+		t.Fatalf("%d migrations for schema version %d", len(migrations), SchemaVersion)
+	}
+
+	// a snapshot from before sections had terms restores into this build
+	ctx := context.Background()
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Logic")
+	backup := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := ds.Backup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	old, err := sql.Open("sqlite3", "file:"+backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{`DROP TABLE problemTag`, `DROP TABLE problem`, `ALTER TABLE section DROP COLUMN term`, `ALTER TABLE section DROP COLUMN archived`,
+		`ALTER TABLE assignment DROP COLUMN ruleSet`, `DROP TABLE proofSave`, `DROP TABLE proofMistake`,
+		`ALTER TABLE assignment DROP COLUMN dueDate`, `DROP TABLE auditLog`,
+		`ALTER TABLE section DROP COLUMN deletedAt`, `ALTER TABLE roster DROP COLUMN deletedAt`, `ALTER TABLE assignment DROP COLUMN deletedAt`,
+		`DROP TABLE archivedProof`, `DELETE FROM joinCode`, `PRAGMA user_version = 1`} {
+		if _, err := old.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	if err := ds.Restore(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetSectionTerm("Logic", "Fall 2026"); err != nil {
+		t.Fatal(err)
+	}
+	if section, err := ds.GetSection("Logic"); err != nil || section.Term != "Fall 2026" {
+		t.Errorf("after migrating: %+v %v", section, err)
+	}
+	// sections from before join codes get one
+	if jc, err := ds.GetJoinCode("Logic"); err != nil || len(jc.Code) != joinCodeLength || !jc.Enabled {
+		t.Errorf("join code after migrating: %+v %v", jc, err)
+	}}
+
+func TestBackfillJoinCodes(t *testing.T) {
+	ds := newTestStore(t)
+	for _, name := range []string{"Live", "Archived", "Deleted"} {
+		newTestSection(t, ds, "instructor@csumb.edu", name)
+	}
+	if err := ds.SetSectionArchived("Archived", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.RemoveSection("Deleted"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := ds.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM joinCode;`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backfillJoinCodes(tx); err != nil {
+		t.Fatal(err)
+	}
+	var sections []string
+	rows, err := tx.Query(`SELECT sectionName FROM joinCode;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		sections = append(sections, name)
+	}
+	rows.Close()
+	if len(sections) != 1 || sections[0] != "Live" {
+		t.Errorf("backfilled join codes of %v", sections)
+	}
+}
+
+func TestArchivedSection(t *testing.T) {
+	ds := newTestStore(t)
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	if err := ds.InsertUser(User{Email: student}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+		t.Fatal(err)
+	}
+	problem := Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P", RepoProblem: "true"}
+	if err := ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertAssignment(Assignment{SectionName: "Logic", Name: "HW 1", ProofIds: "[1]", Visibility: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	attempt := problem
+	attempt.EntryType, attempt.UserSubmitted = "proof", student
+	if err := ds.Store(attempt); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.SetSectionArchived("Logic", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetSectionArchived("Nothing", true); !errors.Is(err, ErrNotExists) {
+		t.Errorf("archiving a missing section: %v", err)
+	}
+	if sections, _ := ds.GetSections(student); len(sections) != 0 {
+		t.Errorf("archived section listed: %+v", sections)
+	}
+	if sections, _ := ds.GetArchivedSections(student); len(sections) != 1 || !sections[0].Archived {
+		t.Errorf("archived sections: %+v", sections)
+	}
+	if err, repo := ds.GetRepoProofs(testUser{student}); err != nil || len(repo) != 0 {
+		t.Errorf("archived problems in the repository dropdown: %+v %v", repo, err)
+	}
+
+	for name, err := range map[string]error{
+		"Store":            ds.Store(attempt),
+		"InsertRoster":     ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: instructor, Role: "ta"}),
+		"InsertAssignment": ds.InsertAssignment(Assignment{SectionName: "Logic", Name: "HW 2", ProofIds: "[]"}),
+		"UpdateAssignment": ds.UpdateAssignment("HW 1", Assignment{SectionName: "Logic", Name: "HW 1", ProofIds: "[]"}),
+		"RemoveAssignment": ds.RemoveAssignment("Logic", "HW 1"),
+		"RemoveFromRoster": ds.RemoveFromRoster("Logic", student),
+	} {
+		if !errors.Is(err, ErrSectionArchived) {
+			t.Errorf("%s on an archived section: %v", name, err)
+		}
+	}
+	if _, err := ds.RegenerateJoinCode("Logic", "", 0); !errors.Is(err, ErrSectionArchived) {
+		t.Errorf("RegenerateJoinCode on an archived section: %v", err)
+	}
+	// grades can still be read
+	if proofs, err := ds.GetCompletedProofsByAssignment("Logic", "HW 1"); err != nil {
+		t.Errorf("reading an archived section: %+v %v", proofs, err)
+	}
+
+	clone, err := ds.CloneSection("Logic", Section{InstructorEmail: instructor, Name: "Logic 2", Term: "Spring 2027"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Archived || clone.Term != "Spring 2027" {
+		t.Errorf("unexpected clone: %+v", clone)
+	}
+	if roster, _ := ds.GetRoster("Logic 2"); len(roster) != 0 {
+		t.Errorf("roster copied into the clone: %+v", roster)
+	}
+	if assignments, _ := ds.GetAssignmentsBySection("Logic 2"); len(assignments) != 1 || assignments[0].ProofIds != "[1]" {
+		t.Errorf("clone assignments: %+v", assignments)
+	}
+	if _, err := ds.CloneSection("Logic", Section{InstructorEmail: instructor, Name: "Logic 2"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("cloning onto an existing section: %v", err)
+	}
+
+	// the problem is assigned again in a section that is not archived
+	if err := ds.InsertRoster(Roster{SectionName: "Logic 2", UserEmail: student, Role: "student"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Store(attempt); err != nil {
+		t.Errorf("saving a problem of the new term: %v", err)
+	}
+}
+
+func TestProblemBank(t *testing.T) {
+	ds := newTestStore(t)
+	owner, colleague, student := "owner@csumb.edu", "colleague@csumb.edu", "student@csumb.edu"
+	newTestSection(t, ds, owner, "Logic")
+	if err := ds.InsertUser(User{Email: colleague}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertSection(Section{InstructorEmail: colleague, Name: "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Other", UserEmail: colleague, Role: "instructor"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertUser(User{Email: student}); err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(problem Problem) *Problem {
+		t.Helper()
+		saved, err := ds.SaveProblem(problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved
+	}
+	private := save(Problem{Owner: owner, Name: "Modus ponens", ProofType: "prop", Premise: []string{"P → Q", "P"},
+		Conclusion: "Q", Tags: []string{"MP", " conditionals ", "mp"}, Difficulty: 1, Chapter: "15"})
+	department := save(Problem{Owner: owner, Name: "Quantifier shift", ProofType: "fol", Premise: []string{"∃x∀yPxy"},
+		Conclusion: "∀y∃xPxy", Tags: []string{"quantifiers"}, Difficulty: 4, Author: "forall x", Scope: "department"})
+	public := save(Problem{Owner: owner, Name: "Reiteration", ProofType: "prop", Premise: []string{"P"},
+		Conclusion: "P", Difficulty: 1, Scope: "public"})
+	if strings.Join(private.Tags, ",") != "conditionals,mp" || private.Scope != "private" {
+		t.Errorf("normalized problem: %+v", private)
+	}
+
+	// saving by name updates the argument in place
+	again := save(Problem{Owner: owner, Name: "Modus ponens", ProofType: "prop", Premise: []string{"P → Q", "P"},
+		Conclusion: "Q", Tags: []string{"mp"}, Difficulty: 2})
+	if again.Id != private.Id {
+		t.Errorf("saved again as %s, first as %s", again.Id, private.Id)
+	}
+	if _, err := ds.SaveProblem(Problem{Id: private.Id, Owner: colleague, Name: "Stolen", ProofType: "prop", Conclusion: "Q"}); !errors.Is(err, ErrNotExists) {
+		t.Errorf("updating someone else's problem: %v", err)
+	}
+	if _, err := ds.SaveProblem(Problem{Owner: owner, Name: "Bad", ProofType: "prop", Conclusion: "Q", Difficulty: 9}); !errors.Is(err, ErrInvalidProblem) {
+		t.Errorf("difficulty 9: %v", err)
+	}
+
+	for _, tc := range []struct {
+		viewer string
+		want   []string
+	}{
+		{owner, []string{private.Id, department.Id, public.Id}},
+		{colleague, []string{department.Id, public.Id}},
+		{student, []string{public.Id}},
+	} {
+		page, err := ds.SearchProblems(ProblemQuery{Viewer: tc.viewer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, problem := range page.Problems {
+			got = append(got, problem.Id)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s sees %v, want %v", tc.viewer, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		q    ProblemQuery
+		want int
+	}{
+		{"tag", ProblemQuery{Tags: []string{"MP"}}, 1},
+		{"missing tag", ProblemQuery{Tags: []string{"mp", "quantifiers"}}, 0},
+		{"text in premise", ProblemQuery{Text: "∃x"}, 1},
+		{"text is not a pattern", ProblemQuery{Text: "%"}, 0},
+		{"difficulty", ProblemQuery{MinDifficulty: 2, MaxDifficulty: 4}, 2},
+		{"author", ProblemQuery{Author: "forall x"}, 1},
+		{"scope", ProblemQuery{Scope: "public"}, 1},
+		{"proof type", ProblemQuery{ProofType: "prop"}, 2},
+	} {
+		tc.q.Viewer = owner
+		page, err := ds.SearchProblems(tc.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Problems) != tc.want {
+			t.Errorf("%s: got %d problems, want %d", tc.name, len(page.Problems), tc.want)
+		}
+	}
+
+	page, err := ds.SearchProblems(ProblemQuery{Viewer: owner, Limit: 2})
+	if err != nil || len(page.Problems) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: %+v %v", page, err)
+	}
+	page, err = ds.SearchProblems(ProblemQuery{Viewer: owner, Limit: 2, Cursor: page.NextCursor})
+	if err != nil || len(page.Problems) != 1 || page.NextCursor != "" {
+		t.Errorf("last page: %+v %v", page, err)
+	}
+
+	if _, err := ds.GetProblem(private.Id, colleague); !errors.Is(err, ErrNotExists) {
+		t.Errorf("colleague got a private problem: %v", err)
+	}
+	id, _ := strconv.Atoi(private.Id)
+	publicId, _ := strconv.Atoi(public.Id)
+	hidden, err := ds.HiddenProblems([]int{id, publicId, 999}, colleague)
+	if err != nil || fmt.Sprint(hidden) != fmt.Sprint([]int{id}) {
+		t.Errorf("hidden from colleague: %v %v", hidden, err)
+	}
+	if staff, err := ds.IsStaff(student); err != nil || staff {
+		t.Errorf("student is staff: %v %v", staff, err)
+	}
+}
+
+func TestAssignmentRuleSets(t *testing.T) {
+	ds := newTestStore(t)
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	if err := ds.InsertUser(User{Email: student}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+		t.Fatal(err)
+	}
+	problem := Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P", RepoProblem: "true"}
+	if err := ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	for _, assignment := range []Assignment{
+		{SectionName: "Logic", Name: "HW 1", ProofIds: "[1]", Visibility: "true", RuleSet: "forall x basic"},
+		{SectionName: "Logic", Name: "Hidden", ProofIds: "[1]", Visibility: "false", RuleSet: "→E"},
+	} {
+		if err := ds.InsertAssignment(assignment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ruleSets, err := ds.GetProblemRuleSets(student, "Repository - One"); err != nil || fmt.Sprint(ruleSets) != "[forall x basic]" {
+		t.Errorf("rule sets: %v %v", ruleSets, err)
+	}
+	if ruleSets, err := ds.GetProblemRuleSets(student, "Repository - Two"); err != nil || len(ruleSets) != 0 {
+		t.Errorf("rule sets of an unassigned problem: %v %v", ruleSets, err)
+	}
+	if err, repo := ds.GetRepoProofs(testUser{student}); err != nil || len(repo) != 1 || repo[0].ProofList[0].RuleSet != "forall x basic" {
+		t.Errorf("repository dropdown: %+v %v", repo, err)
+	}
+
+	if err := ds.UpdateAssignment("HW 1", Assignment{SectionName: "Logic", Name: "HW 1", ProofIds: "[1]", Visibility: "true", RuleSet: "derived"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.CloneSection("Logic", Section{InstructorEmail: instructor, Name: "Logic 2"}); err != nil {
+		t.Fatal(err)
+	}
+	if assignments, err := ds.GetAssignmentsBySection("Logic 2"); err != nil || len(assignments) != 2 || assignments[0].RuleSet != "derived" {
+		t.Errorf("cloned assignments: %+v %v", assignments, err)
+	}
+}
+
+func TestProblemAttempts(t *testing.T) {
+	ds := newTestStore(t)
+	instructor := "instructor@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	for _, student := range []string{"a@csumb.edu", "b@csumb.edu", "c@csumb.edu"} {
+		if err := ds.InsertUser(User{Email: student}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	problem := Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - MP", ProofType: "prop",
+		Premise: []string{"P → Q", "P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "Q", RepoProblem: "true"}
+	if err := ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	save := func(student string, completed string, logic string) {
+		t.Helper()
+		proof := problem
+		proof.EntryType, proof.UserSubmitted, proof.ProofCompleted, proof.Logic = "proof", student, completed, []string{logic}
+		if err := ds.Store(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+	premises := `{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"P","jstr":"Pr"}`
+	save("a@csumb.edu", "false", "["+premises+"]")
+	save("a@csumb.edu", "true", "["+premises+`,{"wffstr":"Q","jstr":"1, 2 →E"}]`)
+	save("b@csumb.edu", "error", "["+premises+`,[{"wffstr":"R","jstr":"Hyp"}]]`)
+	// saves from before they were recorded
+	if _, err := ds.db.Exec(`DELETE FROM proofSave WHERE userSubmitted = 'b@csumb.edu';`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.db.Exec(`UPDATE proofSave SET timeSaved = datetime(timeSaved, '-90 seconds') WHERE proofCompleted = 'false';`); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, err := ds.GetProblemAttempts("Logic", "Repository - MP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("attempts: %+v", attempts)
+	}
+	a, b := attempts[0], attempts[1]
+	if a.Student != "a@csumb.edu" || a.Saves != 2 || !a.Completed || a.Lines != 3 || a.FirstSaved == "" || a.CompletedAt <= a.FirstSaved {
+		t.Errorf("finished attempt: %+v", a)
+	}
+	if b.Student != "b@csumb.edu" || b.Saves != 0 || b.Completed || b.Lines != 3 || b.FirstSaved != "" {
+		t.Errorf("unfinished attempt: %+v", b)
+	}
+
+	if lines, err := ds.GetReferenceLines(problem); err != nil || lines != 0 {
+		t.Errorf("no reference solution: %d %v", lines, err)
+	}
+	solution := problem
+	solution.EntryType, solution.ProofCompleted = "proof", "true"
+	solution.Logic = []string{"[" + premises + `,{"wffstr":"Q","jstr":"1, 2 →E"}]`}
+	if err := ds.Store(solution); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := ds.GetReferenceLines(problem); err != nil || lines != 3 {
+		t.Errorf("reference solution: %d %v", lines, err)
+	}
+}
+
+func TestMistakeCounts(t *testing.T) {
+	ds := newTestStore(t)
+	newTestSection(t, ds, "instructor@csumb.edu", "Logic")
+	for _, student := range []string{"a@csumb.edu", "b@csumb.edu"} {
+		if err := ds.InsertUser(User{Email: student}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record := func(student string, proofName string, mistakes ...ProofMistake) {
+		t.Helper()
+		if err := ds.RecordMistakes(student, proofName, mistakes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quantifier, mismatch := ProofMistake{"∀E", "quantifier-instantiation"}, ProofMistake{"∧E", "formula-mismatch"}
+	// the same mistake twice in one save counts once
+	record("a@csumb.edu", "Repository - UI", quantifier, quantifier)
+	record("a@csumb.edu", "Repository - UI", quantifier)
+	record("b@csumb.edu", "Repository - UI", quantifier, mismatch)
+	record("b@csumb.edu", "Repository - Simp", mismatch)
+	// not in the section
+	record("other@csumb.edu", "Repository - Simp", mismatch, mismatch)
+	record("other@csumb.edu", "Repository - Conj", mismatch)
+
+	counts, err := ds.GetMistakeCounts("Logic", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(counts); got != "[{ ∀E quantifier-instantiation 2 3} { ∧E formula-mismatch 1 2}]" {
+		t.Errorf("by rule: %s", got)
+	}
+	counts, err = ds.GetMistakeCounts("Logic", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(counts); got != "[{Repository - UI ∀E quantifier-instantiation 2 3} {Repository - Simp ∧E formula-mismatch 1 1} {Repository - UI ∧E formula-mismatch 1 1}]" {
+		t.Errorf("by problem: %s", got)
+	}
+	counts, err = ds.GetMistakeCounts("Logic", "a@csumb.edu", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(counts); got != "[{ ∀E quantifier-instantiation 1 2}]" {
+		t.Errorf("one student: %s", got)
+	}
+}
+
+func TestStudentActivity(t *testing.T) {
+	ds := newTestStore(t)
+	instructor := "instructor@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	for _, student := range []string{"a@csumb.edu", "b@csumb.edu"} {
+		if err := ds.InsertUser(User{Email: student}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.InsertAssignment(Assignment{SectionName: "Logic", Name: "HW", ProofIds: "[]", Visibility: "true", DueDate: "2026-10-01 23:59:59"}); err != nil {
+		t.Fatal(err)
+	}
+	if assignments, err := ds.GetAssignmentsBySection("Logic"); err != nil || len(assignments) != 1 || assignments[0].DueDate != "2026-10-01 23:59:59" {
+		t.Errorf("due date: %+v %v", assignments, err)
+	}
+
+	save := func(proofName string, completed string) {
+		t.Helper()
+		proof := Proof{EntryType: "proof", UserSubmitted: "a@csumb.edu", ProofName: proofName, ProofType: "prop",
+			Premise: []string{"P"}, Logic: []string{`[]`}, Rules: []string{}, ProofCompleted: completed, Conclusion: "P", RepoProblem: "true"}
+		if err := ds.Store(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("Repository - A", "error")
+	save("Repository - A", "error")
+	save("Repository - B", "error")
+	save("Repository - B", "true")
+
+	activity, err := ds.GetStudentActivity("Logic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity) != 2 {
+		t.Fatalf("activity: %+v", activity)
+	}
+	a, b := activity[0], activity[1]
+	if a.Student != "a@csumb.edu" || a.LastSaved == "" || fmt.Sprint(a.Completed) != "[Repository - B]" ||
+		fmt.Sprint(a.FailedSaves) != "map[Repository - A:2]" {
+		t.Errorf("active student: %+v", a)
+	}
+	if b.Student != "b@csumb.edu" || b.LastSaved != "" || len(b.Completed) != 0 || len(b.FailedSaves) != 0 {
+		t.Errorf("idle student: %+v", b)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ds := newTestStore(t)
+	for _, entry := range []AuditEntry{
+		{Actor: "instructor@csumb.edu", Action: "section.create", Section: "Logic", Target: "Logic", After: json.RawMessage(`{"Name":"Logic"}`)},
+		{Actor: "instructor@csumb.edu", Action: "roster.add", Section: "Logic", Target: "student@csumb.edu", After: json.RawMessage(`{"Role":"student"}`)},
+		{Actor: "other@csumb.edu", Action: "section.delete", Section: "Sets", Target: "Sets", Before: json.RawMessage(`{"Name":"Sets"}`), After: json.RawMessage(`null`)},
+	} {
+		if err := ds.RecordAudit(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := ds.QueryAudit(AuditQuery{Section: "Logic", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Action != "roster.add" || page.NextCursor == "" || page.Entries[0].Time == "" {
+		t.Fatalf("first page: %+v", page)
+	}
+	page, err = ds.QueryAudit(AuditQuery{Section: "Logic", Limit: 1, Cursor: page.NextCursor})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Action != "section.create" || page.NextCursor != "" {
+		t.Errorf("second page: %+v %v", page, err)
+	}
+	page, err = ds.QueryAudit(AuditQuery{Actor: "other@csumb.edu"})
+	if err != nil || len(page.Entries) != 1 || string(page.Entries[0].Before) != `{"Name":"Sets"}` || page.Entries[0].After != nil {
+		t.Errorf("by actor: %+v %v", page, err)
+	}
+	if page, _ := ds.QueryAudit(AuditQuery{After: "2999-01-01 00:00:00"}); len(page.Entries) != 0 {
+		t.Errorf("entries from the future: %+v", page)
+	}
+	if _, err := ds.QueryAudit(AuditQuery{Cursor: "x"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("bad cursor: %v", err)
+	}
+
+	// append-only
+	if _, err := ds.db.Exec(`UPDATE auditLog SET actor = 'nobody'`); err == nil {
+		t.Error("audit entries can be changed")
+	}
+	if _, err := ds.db.Exec(`DELETE FROM auditLog`); err == nil {
+		t.Error("audit entries can be deleted")
+	}
+
+	ds.MaintainAdmins(map[string]bool{"admin@csumb.edu": true})
+	ds.MaintainAdmins(map[string]bool{"admin@csumb.edu": true})
+	ds.MaintainAdmins(map[string]bool{"admin@csumb.edu": false})
+	page, _ = ds.QueryAudit(AuditQuery{Actor: AuditActorAdminUsers})
+	if len(page.Entries) != 2 || page.Entries[0].Action != "admin.revoke" || page.Entries[1].Action != "admin.grant" ||
+		page.Entries[1].Target != "admin@csumb.edu" {
+		t.Errorf("admin changes: %+v", page.Entries)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	ds := newTestStore(t)
+	instructor, student, dropped := "instructor@csumb.edu", "student@csumb.edu", "dropped@csumb.edu"
+	newTestSection(t, ds, instructor, "Logic")
+	for _, email := range []string{student, dropped} {
+		if err := ds.InsertUser(User{Email: email}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: email, Role: "student"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"HW 1", "HW 2"} {
+		if err := ds.InsertAssignment(Assignment{SectionName: "Logic", Name: name, ProofIds: "[]", Visibility: "true"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proof := Proof{EntryType: "proof", UserSubmitted: student, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, EverCompleted: "true", ProofCompleted: "true", Conclusion: "P", RepoProblem: "true"}
+	if err := ds.Store(proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// a dropped student and a deleted assignment are hidden and can come back
+	if err := ds.RemoveFromRoster("Logic", student); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.GetRole("Logic", student); !errors.Is(err, ErrNotExists) {
+		t.Errorf("role of a removed student: %v", err)
+	}
+	if err := ds.RemoveAssignment("Logic", "HW 1"); err != nil {
+		t.Fatal(err)
+	}
+	if assignments, _ := ds.GetAssignmentsBySection("Logic"); len(assignments) != 1 || assignments[0].Name != "HW 2" {
+		t.Errorf("assignments after deleting one: %+v", assignments)
+	}
+	if err := ds.RemoveAssignment("Logic", "HW 1"); !errors.Is(err, ErrNotExists) {
+		t.Errorf("deleting a deleted assignment: %v", err)
+	}
+	deleted, err := ds.GetDeleted(instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.Sections) != 0 || len(deleted.Assignments) != 1 || deleted.Assignments[0].Name != "HW 1" ||
+		len(deleted.Roster) != 1 || deleted.Roster[0].UserEmail != student || deleted.Roster[0].DeletedAt == "" {
+		t.Errorf("deleted items: %+v", deleted)
+	}
+	if err := ds.RestoreRosterEntry("Logic", student); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.RestoreRosterEntry("Logic", student); !errors.Is(err, ErrNotExists) {
+		t.Errorf("restoring a live roster entry: %v", err)
+	}
+	if proofs, err := ds.GetCompletedProofsBySection("Logic"); err != nil || len(proofs) != 1 {
+		t.Errorf("proofs of a restored student: %+v %v", proofs, err)
+	}
+	// a rename that fails keeps the deleted assignment it would replace
+	if err := ds.UpdateAssignment("HW 9", Assignment{SectionName: "Logic", Name: "HW 1", ProofIds: "[]"}); !errors.Is(err, ErrNotExists) {
+		t.Errorf("renaming a missing assignment: %v", err)
+	}
+	if err := ds.RestoreAssignment("Logic", "HW 1"); err != nil {
+		t.Fatal(err)
+	}
+	if assignments, _ := ds.GetAssignmentsBySection("Logic"); len(assignments) != 2 {
+		t.Errorf("assignments after restoring: %+v", assignments)
+	}
+
+	// adding a removed student again replaces their deleted entry
+	if err := ds.RemoveFromRoster("Logic", dropped); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: dropped, Role: "ta"}); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := ds.GetRole("Logic", dropped); err != nil || role != "ta" {
+		t.Errorf("role of a re-added student: %q %v", role, err)
+	}
+	if err := ds.RemoveFromRoster("Logic", dropped); err != nil {
+		t.Fatal(err)
+	}
+	// dropped before the section is deleted: not restored with it
+	if _, err := ds.db.Exec(`UPDATE roster SET deletedAt = '2000-01-01 00:00:00' WHERE userEmail = ?`, dropped); err != nil {
+		t.Fatal(err)
+	}
+
+	// a deleted section hides its roster and assignments, and keeps its name
+	if err := ds.RemoveSection("Logic"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.GetSection("Logic"); !errors.Is(err, ErrNotExists) {
+		t.Errorf("GetSection of a deleted section: %v", err)
+	}
+	if sections, _ := ds.GetSections(student); len(sections) != 0 {
+		t.Errorf("sections of a student of a deleted section: %+v", sections)
+	}
+	if err := ds.InsertSection(Section{InstructorEmail: instructor, Name: "Logic"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("reusing a deleted section's name: %v", err)
+	}
+	if err := ds.InsertAssignment(Assignment{SectionName: "Logic", Name: "HW 3", ProofIds: "[]"}); !errors.Is(err, ErrNotExists) {
+		t.Errorf("adding to a deleted section: %v", err)
+	}
+	if deleted, _ := ds.GetDeleted(instructor); len(deleted.Sections) != 1 || len(deleted.Assignments) != 0 || len(deleted.Roster) != 0 {
+		t.Errorf("deleted items: %+v", deleted)
+	}
+	if err := ds.RestoreSection("Logic"); err != nil {
+		t.Fatal(err)
+	}
+	if roster, _ := ds.GetRoster("Logic"); len(roster) != 1 || roster[0].UserEmail != student {
+		t.Errorf("restored roster: %+v", roster)
+	}
+	if assignments, _ := ds.GetAssignmentsBySection("Logic"); len(assignments) != 2 {
+		t.Errorf("restored assignments: %+v", assignments)
+	}
+	if sections, _ := ds.GetSections(student); len(sections) != 1 {
+		t.Errorf("sections of a student of a restored section: %+v", sections)
+	}
+
+	// purging removes only what was deleted before the cutoff; proofs stay
+	purged, err := ds.PurgeDeleted("2001-01-01 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged.Sections) != 0 || len(purged.Roster) != 1 || purged.Roster[0].UserEmail != dropped {
+		t.Errorf("purged: %+v", purged)
+	}
+	if err := ds.RestoreRosterEntry("Logic", dropped); !errors.Is(err, ErrNotExists) {
+		t.Errorf("restoring a purged roster entry: %v", err)
+	}
+	if err := ds.RemoveSection("Logic"); err != nil {
+		t.Fatal(err)
+	}
+	purged, err = ds.PurgeDeleted("2999-01-01 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged.Sections) != 1 || len(purged.Assignments) != 0 || len(purged.Roster) != 0 {
+		t.Errorf("purged: %+v", purged)
+	}
+	var rows int
+	ds.db.QueryRow(`SELECT (SELECT count(*) FROM section) + (SELECT count(*) FROM roster) + (SELECT count(*) FROM assignment)
+	                + (SELECT count(*) FROM joinCode)`).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("%d rows left after purging", rows)
+	}
+	if page, err := ds.QueryProofs(ProofQuery{UserSubmitted: student}); err != nil || len(page.Proofs) != 1 {
+		t.Errorf("proofs after purging: %+v %v", page, err)
+	}
+	if err := ds.InsertSection(Section{InstructorEmail: instructor, Name: "Logic"}); err != nil {
+		t.Errorf("reusing a purged section's name: %v", err)
+	}
+}
+
+func TestProofRetention(t *testing.T) {
+	if _, err := ParseProofRetention("delete"); !errors.Is(err, ErrInvalidRetention) {
+		t.Errorf("parsing an unknown retention: %v", err)
+	}
+	for _, retention := range []ProofRetention{RetentionKeep, RetentionArchive, RetentionPurge} {
+		t.Run(string(retention), func(t *testing.T) {
+			ds := newTestStore(t)
+			ds.SetProofRetention(retention)
+			instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+			newTestSection(t, ds, instructor, "Logic")
+			newTestSection(t, ds, instructor, "Sets")
+			if err := ds.InsertUser(User{Email: student}); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"Repository - One", "Repository - Both"} {
+				problem := Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: name, ProofType: "prop",
+					Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P", RepoProblem: "true"}
+				if err := ds.Store(problem); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, assignment := range []Assignment{{SectionName: "Logic", Name: "HW", ProofIds: "[1,2]"}, {SectionName: "Sets", Name: "HW", ProofIds: "[2]"}} {
+				if err := ds.InsertAssignment(assignment); err != nil {
+					t.Fatal(err)
+				}
+				if err := ds.InsertRoster(Roster{SectionName: assignment.SectionName, UserEmail: student, Role: "student"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, proof := range []Proof{{ProofName: "Repository - One", RepoProblem: "true"}, {ProofName: "Repository - Both", RepoProblem: "true"},
+				{ProofName: "Mine", RepoProblem: "false"}} {
+				proof.EntryType, proof.UserSubmitted, proof.ProofType, proof.Conclusion, proof.ProofCompleted = "proof", student, "prop", "P", "true"
+				proof.Premise, proof.Logic, proof.Rules = []string{"P"}, []string{}, []string{}
+				if err := ds.Store(proof); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the student's proofs as they see them, and how many are archived
+			proofs := func() string {
+				t.Helper()
+				page, err := ds.QueryProofs(ProofQuery{UserSubmitted: student, EntryType: "proof", Sort: "problem"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var names []string
+				for _, proof := range page.Proofs {
+					names = append(names, proof.ProofName)
+				}
+				var archived int
+				ds.db.QueryRow(`SELECT count(*) FROM archivedProof`).Scan(&archived)
+				return strings.Join(names, ", ") + fmt.Sprintf(" (%d archived)", archived)
+			}
+			all := "Mine, Repository - Both, Repository - One (0 archived)"
+			dropped := "Mine, Repository - Both (1 archived)"
+			if retention == RetentionKeep {
+				dropped = all
+			}
+			for _, step := range []struct {
+				name   string
+				change func() error
+				want   string
+			}{
+				{"dropped", func() error { return ds.RemoveFromRoster("Logic", student) }, dropped},
+				{"restored", func() error { return ds.RestoreRosterEntry("Logic", student) }, all},
+				{"dropped again", func() error { return ds.RemoveFromRoster("Logic", student) }, dropped},
+				{"added again", func() error {
+					return ds.InsertRoster(Roster{SectionName: "Logic", UserEmail: student, Role: "student"})
+				}, all},
+				{"section deleted", func() error { return ds.RemoveSection("Logic") }, dropped},
+				{"section restored", func() error { return ds.RestoreSection("Logic") }, all},
+				{"dropped for good", func() error {
+					if err := ds.RemoveFromRoster("Logic", student); err != nil {
+						return err
+					}
+					_, err := ds.PurgeDeleted("2999-01-01 00:00:00")
+					return err
+				}, map[ProofRetention]string{RetentionKeep: all, RetentionArchive: dropped,
+					RetentionPurge: "Mine, Repository - Both (0 archived)"}[retention]},
+			} {
+				if err := step.change(); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if got := proofs(); got != step.want {
+					t.Errorf("%s: proofs %s, want %s", step.name, got, step.want)
+				}
+			}
+		})
+	}
+}
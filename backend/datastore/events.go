@@ -0,0 +1,141 @@
+package datastore
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// events buffered per subscriber before it is dropped as too slow
+const proofEventBuffer = 64
+
+// ProofEvent is published after Store saves a proof of a student on a section's roster
+type ProofEvent struct {
+	SectionName    string `json:"sectionName"`
+	Student        string `json:"student"`
+	ProofName      string `json:"problem"`
+	ProofCompleted string `json:"proofCompleted"` // 'true', 'false', or 'error'
+	LineCount      int    `json:"lineCount"`
+}
+
+// ProofHub fans proof events out to the subscribers of each section
+type ProofHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan ProofEvent]bool // section name -> subscriber channels
+}
+
+func NewProofHub() *ProofHub {
+	return &ProofHub{subscribers: map[string]map[chan ProofEvent]bool{}}
+}
+
+// receive the events of a section until cancel is called; the channel is
+// closed by cancel, or by the hub when the subscriber falls too far behind
+func (h *ProofHub) Subscribe(sectionName string) (<-chan ProofEvent, func()) {
+	ch := make(chan ProofEvent, proofEventBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[sectionName] == nil {
+		h.subscribers[sectionName] = map[chan ProofEvent]bool{}
+	}
+	h.subscribers[sectionName][ch] = true
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(sectionName, ch)
+	}
+	return ch, cancel
+}
+
+// remove and close a subscriber channel; the caller holds h.mu
+func (h *ProofHub) remove(sectionName string, ch chan ProofEvent) {
+	if !h.subscribers[sectionName][ch] {
+		return // already removed
+	}
+	delete(h.subscribers[sectionName], ch)
+	if len(h.subscribers[sectionName]) == 0 {
+		delete(h.subscribers, sectionName)
+	}
+	close(ch)
+}
+
+// send event to the subscribers of its section without blocking the write path
+func (h *ProofHub) Publish(event ProofEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[event.SectionName] {
+		select {
+		case ch <- event:
+		default:
+			// a stalled client would otherwise miss events silently; closing the
+			// stream makes it reconnect and reload the full list instead
+			h.remove(event.SectionName, ch)
+		}
+	}
+}
+
+// number of lines in the body of a proof, subproof lines included
+func (proof Proof) LineCount() int {
+	// Logic holds a single JSON-encoded string of nested line arrays;
+	// older rows hold one line per element
+	if len(proof.Logic) != 1 {
+		return len(proof.Logic)
+	}
+	var body []interface{}
+	if err := json.Unmarshal([]byte(proof.Logic[0]), &body); err != nil {
+		return 1
+	}
+	return countLines(body)
+}
+
+func countLines(lines []interface{}) int {
+	count := 0
+	for _, line := range lines {
+		if subproof, ok := line.([]interface{}); ok {
+			count += countLines(subproof)
+		} else {
+			count++
+		}
+	}
+	return count
+}
+
+// publish a stored proof to the sections its author is a student in
+func (p *ProofStore) publishProof(proof Proof) {
+	if p.hub == nil || proof.EntryType != "proof" {
+		return
+	}
+
+	rows, err := p.db.Query(`SELECT sectionName FROM roster WHERE userEmail = ? AND role = 'student' AND deletedAt IS NULL`, proof.UserSubmitted)
+	if err != nil {
+		logger.Error("publishProof: during query of student sections", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	var sections []string
+	for rows.Next() {
+		var sectionName string
+		if err := rows.Scan(&sectionName); err != nil {
+			logger.Error("publishProof: during scan of student sections", "error", err)
+			return
+		}
+		sections = append(sections, sectionName)
+	}
+
+	for _, sectionName := range sections {
+		p.hub.Publish(ProofEvent{
+			SectionName:    sectionName,
+			Student:        proof.UserSubmitted,
+			ProofName:      proof.ProofName,
+			ProofCompleted: proof.ProofCompleted,
+			LineCount:      proof.LineCount(),
+		})
+	}
+}
+
+// receive an event for every proof stored by a student of the section
+func (p *ProofStore) SubscribeProofEvents(sectionName string) (<-chan ProofEvent, func()) {
+	return p.hub.Subscribe(sectionName)
+}
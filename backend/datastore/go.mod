@@ -1,5 +1,10 @@
 module datastore
 
-go 1.17
+go 1.21
 
-require github.com/mattn/go-sqlite3 v1.14.12
+replace logging => ../logging
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.12
+	logging v0.0.0-00010101000000-000000000000
+)
@@ -0,0 +1,237 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrJoinCodeInvalid  = errors.New("join code is not valid")
+	ErrJoinCodeDisabled = errors.New("join code has been disabled")
+	ErrJoinCodeExpired  = errors.New("join code has expired")
+	ErrSectionFull      = errors.New("section has no open seats")
+)
+
+// Characters that are easy to read aloud and copy from a projector (no 0/O or 1/I)
+const (
+	joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	joinCodeLength   = 8
+)
+
+type JoinCode struct {
+	SectionName string
+	Code        string
+	ExpiresAt   string // UTC 'YYYY-MM-DD HH:MM:SS', empty if the code never expires
+	SeatLimit   int    // maximum number of students on the roster, 0 for no limit
+	Enabled     bool
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// generate a random join code from joinCodeAlphabet
+func newJoinCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(joinCodeAlphabet)))
+	for i := 0; i < joinCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(joinCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// normalize a code typed in by a student
+func normalizeJoinCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// give a join code to every live section without one, such as those
+// created before join codes existed
+func backfillJoinCodes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT name FROM section
+	                       WHERE deletedAt IS NULL AND NOT archived AND name NOT IN (SELECT sectionName FROM joinCode);`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := setJoinCode(tx, JoinCode{SectionName: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create or replace the join code for jc.SectionName with a freshly generated, enabled code
+func setJoinCode(ex execer, jc JoinCode) (*JoinCode, error) {
+	code, err := newJoinCode()
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt sql.NullString
+	if jc.ExpiresAt != "" {
+		expiresAt = sql.NullString{String: jc.ExpiresAt, Valid: true}
+	}
+
+	_, err = ex.Exec(`INSERT INTO joinCode (sectionName, code, expiresAt, seatLimit, enabled) VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT (sectionName) DO UPDATE SET
+			code = excluded.code,
+			expiresAt = excluded.expiresAt,
+			seatLimit = excluded.seatLimit,
+			enabled = 1`,
+		jc.SectionName, code, expiresAt, jc.SeatLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	jc.Code = code
+	jc.Enabled = true
+	return &jc, nil
+}
+
+// return the join code for a section, or ErrNotExists if the section has none
+func (p *ProofStore) GetJoinCode(sectionName string) (*JoinCode, error) {
+	var jc JoinCode
+	var expiresAt sql.NullString
+	err := p.db.QueryRow(`SELECT sectionName, code, expiresAt, seatLimit, enabled FROM joinCode WHERE sectionName = ?;`,
+		sectionName).Scan(&jc.SectionName, &jc.Code, &expiresAt, &jc.SeatLimit, &jc.Enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotExists
+		}
+		return nil, err
+	}
+	jc.ExpiresAt = expiresAt.String
+	return &jc, nil
+}
+
+// replace a section's join code with a new one; the old code stops working immediately
+// expiresAt is a UTC 'YYYY-MM-DD HH:MM:SS' timestamp or empty, seatLimit is 0 for no limit
+func (p *ProofStore) RegenerateJoinCode(sectionName string, expiresAt string, seatLimit int) (*JoinCode, error) {
+	if seatLimit < 0 {
+		return nil, errors.New("seat limit must not be negative")
+	}
+	section, err := p.GetSection(sectionName)
+	if err != nil {
+		return nil, err
+	}
+	if section.Archived {
+		return nil, ErrSectionArchived
+	}
+
+	jc, err := setJoinCode(p.db, JoinCode{SectionName: sectionName, ExpiresAt: expiresAt, SeatLimit: seatLimit})
+	if err != nil {
+		logger.Error("RegenerateJoinCode: setJoinCode", "error", err)
+		return nil, err
+	}
+	return jc, nil
+}
+
+// stop a section's join code from accepting new students
+func (p *ProofStore) DisableJoinCode(sectionName string) error {
+	result, err := p.db.Exec(`UPDATE joinCode SET enabled = 0 WHERE sectionName = ?;`, sectionName)
+	if err != nil {
+		logger.Error("DisableJoinCode", "error", err)
+		return err
+	}
+	if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+		return ErrNotExists
+	}
+	return nil
+}
+
+// add userEmail to the roster of the section owning code as a student
+// returns the name of the joined section
+func (p *ProofStore) EnrollWithJoinCode(code string, userEmail string) (string, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return "", errors.New("Database transaction begin error")
+	}
+	defer tx.Rollback()
+
+	var sectionName string
+	var seatLimit int
+	var enabled, expired bool
+	err = tx.QueryRow(`SELECT sectionName, seatLimit, enabled, (expiresAt IS NOT NULL AND expiresAt <= datetime('now'))
+		FROM joinCode WHERE code = ?;`, normalizeJoinCode(code)).Scan(&sectionName, &seatLimit, &enabled, &expired)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrJoinCodeInvalid
+		}
+		return "", err
+	}
+	if !enabled {
+		return "", ErrJoinCodeDisabled
+	}
+	if expired {
+		return "", ErrJoinCodeExpired
+	}
+	if err := checkSectionWritable(tx, sectionName); err != nil {
+		if errors.Is(err, ErrNotExists) {
+			return "", ErrJoinCodeInvalid // the section is deleted
+		}
+		return "", err
+	}
+
+	var enrolled int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM roster WHERE sectionName = ? AND userEmail = ? AND deletedAt IS NULL;`, sectionName, userEmail).Scan(&enrolled)
+	if err != nil {
+		return "", err
+	}
+	if enrolled != 0 {
+		return "", ErrDuplicate
+	}
+
+	if seatLimit > 0 {
+		var students int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM roster WHERE sectionName = ? AND role = 'student' AND deletedAt IS NULL;`, sectionName).Scan(&students)
+		if err != nil {
+			return "", err
+		}
+		if students >= seatLimit {
+			return "", ErrSectionFull
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO user (email, firstName, lastName, admin) VALUES (?, '', '', 0)
+		ON CONFLICT (email) DO NOTHING;`, userEmail)
+	if err != nil {
+		logger.Error("EnrollWithJoinCode: inserting user", "error", err)
+		return "", err
+	}
+
+	// joining again replaces a deleted roster entry
+	if err := replaceDeletedRosterEntry(tx, sectionName, userEmail); err != nil {
+		logger.Error("EnrollWithJoinCode: replacing deleted roster row", "error", err)
+		return "", err
+	}
+	_, err = tx.Exec(`INSERT INTO roster (sectionName, userEmail, role) VALUES (?, ?, 'student');`, sectionName, userEmail)
+	if err != nil {
+		logger.Error("EnrollWithJoinCode: inserting roster row", "error", err)
+		return "", err
+	}
+
+	return sectionName, tx.Commit()
+}
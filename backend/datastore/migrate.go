@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is stored in the database as PRAGMA user_version. Version 1
+// is the schema createTables makes; each later version has a migration.
+const SchemaVersion = 11
+
+var ErrSchemaVersion = errors.New("schema version mismatch")
+
+// migrations[i] upgrades a database from version i+1 to version i+2
+var migrations = []func(tx *sql.Tx) error{
+	// 2: sections have a term and can be archived
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE section ADD COLUMN term TEXT NOT NULL DEFAULT ''`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`ALTER TABLE section ADD COLUMN archived INTEGER NOT NULL DEFAULT 0
+			CHECK (archived in (0, 1))`)
+		return err
+	},
+	// 3: the problem bank
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE problem (
+			proofId INTEGER NOT NULL PRIMARY KEY,
+			difficulty INTEGER NOT NULL DEFAULT 0
+				CHECK (difficulty BETWEEN 0 AND 5),
+			chapter TEXT NOT NULL DEFAULT '',
+			author TEXT NOT NULL DEFAULT '',
+			scope TEXT NOT NULL DEFAULT 'private'
+				CHECK (scope in ('private', 'department', 'public')),
+			FOREIGN KEY (proofId) REFERENCES proof (id)
+				ON DELETE CASCADE
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE TABLE problemTag (
+			proofId INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (proofId, tag),
+			FOREIGN KEY (proofId) REFERENCES problem (proofId)
+				ON DELETE CASCADE
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX index_problemTag_tag ON problemTag (tag)`)
+		return err
+	},
+	// 4: assignments allow a rule set
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE assignment ADD COLUMN ruleSet TEXT NOT NULL DEFAULT ''`)
+		return err
+	},
+	// 5: every save of a proof, for problem analytics
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE proofSave (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			userSubmitted TEXT NOT NULL,
+			proofName TEXT NOT NULL,
+			proofCompleted TEXT NOT NULL,
+			lines INTEGER NOT NULL,
+			timeSaved DATETIME NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX index_proofSave_proofName ON proofSave (proofName, userSubmitted)`)
+		return err
+	},
+	// 6: mistakes found in saved proofs, for common-mistake reports
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE proofMistake (
+			userSubmitted TEXT NOT NULL,
+			proofName TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			occurrences INTEGER NOT NULL DEFAULT 1,
+			firstSeen DATETIME NOT NULL,
+			lastSeen DATETIME NOT NULL,
+			PRIMARY KEY (userSubmitted, proofName, rule, kind)
+		)`)
+		return err
+	},
+	// 7: assignments have a due date
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE assignment ADD COLUMN dueDate TEXT NOT NULL DEFAULT ''`)
+		return err
+	},
+	// 8: the append-only audit log of administrative changes
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE auditLog (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			sectionName TEXT NOT NULL DEFAULT '',
+			target TEXT NOT NULL,
+			before TEXT,
+			after TEXT
+		)`)
+		if err != nil {
+			return err
+		}
+		for _, statement := range []string{
+			`CREATE INDEX index_auditLog_sectionName ON auditLog (sectionName)`,
+			`CREATE INDEX index_auditLog_actor ON auditLog (actor)`,
+			`CREATE TRIGGER auditLog_no_update BEFORE UPDATE ON auditLog
+				BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END`,
+			`CREATE TRIGGER auditLog_no_delete BEFORE DELETE ON auditLog
+				BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END`,
+		} {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 9: sections, roster entries and assignments are deleted softly
+	func(tx *sql.Tx) error {
+		for _, table := range []string{"section", "roster", "assignment"} {
+			if _, err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN deletedAt TEXT`); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 10: proofs of dropped students archived by the proof retention
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE archivedProof (
+			sectionName TEXT NOT NULL,
+			archivedAt TEXT NOT NULL,
+			id INTEGER NOT NULL PRIMARY KEY,
+			entryType TEXT,
+			userSubmitted TEXT,
+			proofName TEXT,
+			proofType TEXT,
+			Premise TEXT,
+			Logic TEXT,
+			Rules TEXT,
+			everCompleted TEXT,
+			proofCompleted TEXT,
+			timeSubmitted DATETIME,
+			Conclusion TEXT,
+			repoProblem TEXT
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX index_archivedProof_sectionName ON archivedProof (sectionName, archivedAt)`)
+		return err
+	},
+	// 11: sections created before join codes get one
+	backfillJoinCodes,
+}
+
+// bring the database up to SchemaVersion, one transaction per version, and
+// refuse one written by a newer build. Databases from before versioning
+// (user_version 0) have the version 1 schema.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: database has version %d, this build has %d", ErrSchemaVersion, version, SchemaVersion)
+	}
+	if version == 0 {
+		version = 1
+	}
+
+	for ; version < SchemaVersion; version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[version-1](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating to schema version %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		logger.Info("database migrated", "version", version+1)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package datastore
+
+// Common mistakes: the backend classifies the issues of every failed proof
+// of a repository problem (see proofcheck.Diagnose) and records them here,
+// once per save, so instructors can see which rules trip up a section.
+
+import (
+	"fmt"
+)
+
+// ProofMistake is a kind of mistake made with a rule.
+type ProofMistake struct {
+	Rule string `json:"rule"` // "" when the line cites none
+	Kind string `json:"kind"`
+}
+
+// MistakeCount is how often a kind of mistake was made.
+type MistakeCount struct {
+	ProofName   string `json:"problem,omitempty"` // set when counted by problem
+	Rule        string `json:"rule"`
+	Kind        string `json:"kind"`
+	Students    int    `json:"students"`    // who made it
+	Occurrences int    `json:"occurrences"` // saves it was made in
+}
+
+// RecordMistakes records the mistakes found in one save of a proof; each
+// distinct rule and kind counts once.
+func (p *ProofStore) RecordMistakes(userEmail string, proofName string, mistakes []ProofMistake) error {
+	if len(mistakes) == 0 {
+		return nil
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	seen := map[ProofMistake]bool{}
+	for _, mistake := range mistakes {
+		if seen[mistake] {
+			continue
+		}
+		seen[mistake] = true
+		_, err := tx.Exec(`INSERT INTO proofMistake (userSubmitted, proofName, rule, kind, firstSeen, lastSeen)
+		                   VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
+		                   ON CONFLICT (userSubmitted, proofName, rule, kind)
+		                   DO UPDATE SET occurrences = occurrences + 1, lastSeen = excluded.lastSeen;`,
+			userEmail, proofName, mistake.Rule, mistake.Kind)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMistakeCounts counts the mistakes of the students of a section, or of
+// one student when student is not "", by rule and kind and, with byProblem,
+// by problem too; the most widespread come first.
+func (p *ProofStore) GetMistakeCounts(sectionName string, student string, byProblem bool) ([]MistakeCount, error) {
+	group := "proofMistake.rule, proofMistake.kind"
+	if byProblem {
+		group = "proofMistake.proofName, " + group
+	}
+	rows, err := p.db.Query(fmt.Sprintf(`SELECT %s, COUNT(DISTINCT proofMistake.userSubmitted) AS students,
+	                                     SUM(proofMistake.occurrences) AS occurrences
+	                                     FROM proofMistake
+	                                     JOIN roster ON roster.userEmail = proofMistake.userSubmitted
+	                                     WHERE roster.sectionName = ? AND roster.role = 'student' AND roster.deletedAt IS NULL
+	                                     AND (? = '' OR proofMistake.userSubmitted = ?)
+	                                     GROUP BY %s
+	                                     ORDER BY students DESC, occurrences DESC, %s;`,
+		group, group, group), sectionName, student, student)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []MistakeCount{}
+	for rows.Next() {
+		var count MistakeCount
+		dest := []interface{}{&count.Rule, &count.Kind, &count.Students, &count.Occurrences}
+		if byProblem {
+			dest = append([]interface{}{&count.ProofName}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,379 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Bank problems are argument rows in the proof table with a row in the
+// problem table describing them. A problem's Id is its proof id, so it is
+// independent of any section and is what assignments list in ProofIds.
+//
+// Scope decides who can find and assign a problem: private problems are
+// seen only by their owner, department problems by every instructor, TA
+// and admin, and public problems by everyone.
+var ProblemScopes = []string{"private", "department", "public"}
+
+const MaxProblemDifficulty = 5
+
+var ErrInvalidProblem = errors.New("invalid problem")
+
+type Problem struct {
+	Id         string   `json:"id"`
+	Owner      string   `json:"owner"` // the user who stored it; ignored on input
+	Name       string   `json:"name"`
+	ProofType  string   `json:"proofType"` // 'prop' or 'fol'
+	Premise    []string `json:"premise"`
+	Conclusion string   `json:"conclusion"`
+	Tags       []string `json:"tags"`
+	Difficulty int      `json:"difficulty"` // 1 to MaxProblemDifficulty, 0 when unrated
+	Chapter    string   `json:"chapter"`
+	Author     string   `json:"author"` // who wrote it, e.g. a textbook; not always the owner
+	Scope      string   `json:"scope"`
+}
+
+// ProblemQuery selects the bank problems Viewer can see. Empty fields do
+// not filter; a problem must carry every one of Tags.
+type ProblemQuery struct {
+	Viewer        string
+	Text          string // matched against name, premises, conclusion, chapter and author
+	Tags          []string
+	MinDifficulty int
+	MaxDifficulty int
+	Chapter       string
+	Author        string
+	Owner         string
+	Scope         string
+	ProofType     string
+	Limit         int    // 0 returns every match
+	Cursor        string // NextCursor of the previous page
+}
+
+type ProblemPage struct {
+	Problems   []Problem `json:"problems"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// lowercase, trim, drop empty and repeated tags, and sort
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func validateProblem(problem *Problem) error {
+	problem.Name = strings.TrimSpace(problem.Name)
+	if problem.Name == "" || problem.Conclusion == "" {
+		return fmt.Errorf("%w: a name and a conclusion are required", ErrInvalidProblem)
+	}
+	if problem.ProofType != "prop" && problem.ProofType != "fol" {
+		return fmt.Errorf("%w: proofType must be prop or fol", ErrInvalidProblem)
+	}
+	if problem.Difficulty < 0 || problem.Difficulty > MaxProblemDifficulty {
+		return fmt.Errorf("%w: difficulty must be between 0 and %d", ErrInvalidProblem, MaxProblemDifficulty)
+	}
+	if problem.Scope == "" {
+		problem.Scope = "private"
+	}
+	if !validScope(problem.Scope) {
+		return fmt.Errorf("%w: scope must be private, department or public", ErrInvalidProblem)
+	}
+	if problem.Premise == nil {
+		problem.Premise = []string{}
+	}
+	problem.Tags = normalizeTags(problem.Tags)
+	return nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range ProblemScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SQL condition that a problem is visible to the user bound to the three
+// placeholders
+const problemVisibleSQL = `(proof.userSubmitted = ? OR problem.scope = 'public'
+	OR (problem.scope = 'department' AND EXISTS (SELECT 1 FROM user WHERE email = ? AND admin = 1))
+	OR (problem.scope = 'department' AND EXISTS (SELECT 1 FROM roster WHERE userEmail = ? AND role IN ('instructor', 'ta') AND deletedAt IS NULL)))`
+
+const problemColumns = `proof.id, proof.userSubmitted, proof.proofName, proof.proofType,
+	proof.Premise, proof.Conclusion, problem.difficulty, problem.chapter, problem.author,
+	problem.scope, IFNULL((SELECT group_concat(tag, char(10)) FROM
+		(SELECT tag FROM problemTag WHERE problemTag.proofId = proof.id ORDER BY tag)), '')`
+
+func scanProblem(row interface{ Scan(...interface{}) error }) (Problem, error) {
+	var problem Problem
+	var id int64
+	var premise, conclusion, tags sql.NullString
+	err := row.Scan(&id, &problem.Owner, &problem.Name, &problem.ProofType, &premise, &conclusion,
+		&problem.Difficulty, &problem.Chapter, &problem.Author, &problem.Scope, &tags)
+	if err != nil {
+		return problem, err
+	}
+	problem.Id = strconv.FormatInt(id, 10)
+	problem.Conclusion = conclusion.String
+	problem.Premise = []string{}
+	if premise.String != "" {
+		if err := json.Unmarshal([]byte(premise.String), &problem.Premise); err != nil {
+			return problem, err
+		}
+	}
+	problem.Tags = []string{}
+	if tags.String != "" {
+		problem.Tags = strings.Split(tags.String, "\n")
+	}
+	return problem, nil
+}
+
+// SaveProblem stores problem as an argument owned by problem.Owner and
+// records its bank metadata. With an empty Id an argument of the same name
+// is updated rather than duplicated; with an Id the problem must belong to
+// problem.Owner.
+func (p *ProofStore) SaveProblem(problem Problem) (*Problem, error) {
+	saved, err := p.SaveProblems([]Problem{problem})
+	if err != nil {
+		return nil, err
+	}
+	return &saved[0], nil
+}
+
+// SaveProblems saves each of problems as SaveProblem does, all or none
+func (p *ProofStore) SaveProblems(problems []Problem) ([]Problem, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, errors.New("Database transaction begin error")
+	}
+	defer tx.Rollback()
+
+	saved := make([]Problem, len(problems))
+	for i, problem := range problems {
+		if err := saveProblem(tx, &problem); err != nil {
+			return nil, err
+		}
+		saved[i] = problem
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func saveProblem(tx *sql.Tx, problem *Problem) error {
+	if err := validateProblem(problem); err != nil {
+		return err
+	}
+	premise, err := json.Marshal(problem.Premise)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	if problem.Id == "" {
+		_, err = tx.Exec(`INSERT INTO proof (entryType, userSubmitted, proofName, proofType, Premise,
+		                      Logic, Rules, proofCompleted, timeSubmitted, Conclusion, repoProblem)
+		                  VALUES ('argument', ?, ?, ?, ?, '[]', '[]', 'false', datetime('now'), ?, 'true')
+		                  ON CONFLICT (userSubmitted, proofName, proofCompleted) DO UPDATE SET
+		                      proofType = excluded.proofType, Premise = excluded.Premise,
+		                      Conclusion = excluded.Conclusion, timeSubmitted = datetime('now')
+		                  WHERE entryType = 'argument';`,
+			problem.Owner, problem.Name, problem.ProofType, string(premise), problem.Conclusion)
+		if err != nil {
+			logger.Error("SaveProblem: storing argument", "error", err)
+			return err
+		}
+		err = tx.QueryRow(`SELECT id FROM proof WHERE entryType = 'argument' AND userSubmitted = ?
+		                   AND proofName = ? AND proofCompleted = 'false';`, problem.Owner, problem.Name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the name is taken by one of the owner's proofs
+			return ErrDuplicate
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		id, err = strconv.ParseInt(problem.Id, 10, 64)
+		if err != nil {
+			return ErrNotExists
+		}
+		result, err := tx.Exec(`UPDATE proof SET proofName = ?, proofType = ?, Premise = ?, Conclusion = ?,
+		                            timeSubmitted = datetime('now')
+		                        WHERE id = ? AND userSubmitted = ? AND entryType = 'argument';`,
+			problem.Name, problem.ProofType, string(premise), problem.Conclusion, id, problem.Owner)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				return ErrDuplicate
+			}
+			return err
+		}
+		if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+			return ErrNotExists
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO problem (proofId, difficulty, chapter, author, scope) VALUES (?, ?, ?, ?, ?)
+	                  ON CONFLICT (proofId) DO UPDATE SET difficulty = excluded.difficulty,
+	                      chapter = excluded.chapter, author = excluded.author, scope = excluded.scope;`,
+		id, problem.Difficulty, problem.Chapter, problem.Author, problem.Scope)
+	if err != nil {
+		logger.Error("SaveProblem: storing metadata", "error", err)
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM problemTag WHERE proofId = ?;`, id); err != nil {
+		return err
+	}
+	for _, tag := range problem.Tags {
+		if _, err := tx.Exec(`INSERT INTO problemTag (proofId, tag) VALUES (?, ?);`, id, tag); err != nil {
+			return err
+		}
+	}
+
+	problem.Id = strconv.FormatInt(id, 10)
+	return nil
+}
+
+// GetProblem returns the bank problem id if viewer can see it, and
+// ErrNotExists otherwise
+func (p *ProofStore) GetProblem(id string, viewer string) (*Problem, error) {
+	row := p.db.QueryRow(`SELECT `+problemColumns+` FROM proof JOIN problem ON problem.proofId = proof.id
+	                      WHERE proof.id = ? AND `+problemVisibleSQL+`;`, id, viewer, viewer, viewer)
+	problem, err := scanProblem(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &problem, nil
+}
+
+// HiddenProblems returns those of ids that are bank problems viewer cannot
+// see. Ids that are not bank problems are left to the caller.
+func (p *ProofStore) HiddenProblems(ids []int, viewer string) ([]int, error) {
+	hidden := []int{}
+	for _, id := range ids {
+		var visible bool
+		err := p.db.QueryRow(`SELECT `+problemVisibleSQL+` FROM proof JOIN problem ON problem.proofId = proof.id
+		                      WHERE proof.id = ?;`, viewer, viewer, viewer, id).Scan(&visible)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !visible {
+			hidden = append(hidden, id)
+		}
+	}
+	return hidden, nil
+}
+
+// SearchProblems returns the bank problems matching q in id order, a page
+// at a time when q.Limit is set
+func (p *ProofStore) SearchProblems(q ProblemQuery) (*ProblemPage, error) {
+	conditions := []string{problemVisibleSQL}
+	args := []interface{}{q.Viewer, q.Viewer, q.Viewer}
+
+	if q.Text != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Text) + "%"
+		var matches []string
+		for _, column := range []string{"proof.proofName", "proof.Premise", "proof.Conclusion", "problem.chapter", "problem.author"} {
+			matches = append(matches, column+` LIKE ? ESCAPE '\'`)
+			args = append(args, pattern)
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	if tags := normalizeTags(q.Tags); len(tags) != 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+		conditions = append(conditions, `(SELECT count(*) FROM problemTag WHERE problemTag.proofId = proof.id
+			AND tag IN (`+placeholders+`)) = ?`)
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(tags))
+	}
+	if q.MinDifficulty != 0 {
+		conditions = append(conditions, "problem.difficulty >= ?")
+		args = append(args, q.MinDifficulty)
+	}
+	if q.MaxDifficulty != 0 {
+		conditions = append(conditions, "problem.difficulty <= ?")
+		args = append(args, q.MaxDifficulty)
+	}
+	for _, filter := range []struct{ column, value string }{
+		{"problem.chapter", q.Chapter},
+		{"problem.author", q.Author},
+		{"proof.userSubmitted", q.Owner},
+		{"problem.scope", q.Scope},
+		{"proof.proofType", q.ProofType},
+	} {
+		if filter.value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if q.Cursor != "" {
+		after, err := strconv.ParseInt(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		conditions = append(conditions, "proof.id > ?")
+		args = append(args, after)
+	}
+
+	query := `SELECT ` + problemColumns + ` FROM proof JOIN problem ON problem.proofId = proof.id
+	          WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY proof.id`
+	if q.Limit > 0 {
+		// fetch one extra row to learn whether there is a next page
+		query += ` LIMIT ` + strconv.Itoa(q.Limit+1)
+	}
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &ProblemPage{Problems: []Problem{}}
+	for rows.Next() {
+		problem, err := scanProblem(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Problems = append(page.Problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(page.Problems) > q.Limit {
+		page.Problems = page.Problems[:q.Limit]
+		page.NextCursor = page.Problems[q.Limit-1].Id
+	}
+	return page, nil
+}
+
+// IsStaff reports whether the user is an admin, or an instructor or TA of
+// any section; staff see department problems
+func (p *ProofStore) IsStaff(userEmail string) (bool, error) {
+	var staff bool
+	err := p.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user WHERE email = ? AND admin = 1)
+	                      OR EXISTS (SELECT 1 FROM roster WHERE userEmail = ? AND role IN ('instructor', 'ta') AND deletedAt IS NULL);`,
+		userEmail, userEmail).Scan(&staff)
+	return staff, err
+}
@@ -0,0 +1,280 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// layout of timeSubmitted as written by datetime('now'), always UTC
+const TimeFormat = "2006-01-02 15:04:05"
+
+// columns scanned by getProofsFromRows, in order
+const proofColumns = `proof.id, proof.entryType, proof.userSubmitted, proof.proofName, proof.proofType, proof.Premise, proof.Logic, proof.Rules,
+	proof.everCompleted, proof.proofCompleted, proof.timeSubmitted, proof.Conclusion, proof.repoProblem`
+
+// Sort keys accepted by ProofQuery.Sort and the columns they order by.
+// Every sort is broken by id so that pages are stable.
+var proofSortColumns = map[string]string{
+	"id":      "proof.id",
+	"time":    "proof.timeSubmitted",
+	"student": "proof.userSubmitted",
+	"problem": "proof.proofName",
+}
+
+// ProofQuery selects, orders and pages proof rows; zero-valued fields do not filter
+type ProofQuery struct {
+	SectionName     string   // only proofs of students on this section's roster
+	UserSubmitted   string   // only proofs of this user
+	ProofName       string   // only this problem
+	EntryType       string   // 'proof' or 'argument'
+	ProofType       string   // 'prop' or 'fol'
+	ProofCompleted  []string // any of 'true', 'false', 'error'
+	HideCompleted   bool     // leave out proofs whose proofCompleted is 'true'
+	EverCompleted   string   // 'true' or 'false'
+	RepoProblem     string   // 'true' or 'false'
+	SubmittedAfter  string   // timeSubmitted >= this TimeFormat value
+	SubmittedBefore string   // timeSubmitted < this TimeFormat value
+	AdminProblems   bool     // only proofs whose premises and conclusion match a proof stored by an admin
+	HideAssessments bool     // leave out proof names containing Test, Quiz or Final
+	HideUnnamed     bool     // leave out proofs named 'n/a'
+
+	Sort       string // a key of proofSortColumns, "id" if empty
+	Descending bool
+	Cursor     string // NextCursor of the previous page, empty for the first page
+	Limit      int    // page size, 0 for all rows
+}
+
+// ProofPage is one page of QueryProofs results
+type ProofPage struct {
+	Proofs     []Proof
+	NextCursor string // empty on the last page
+}
+
+// position after the last row of a page; tied to the sort it was made for
+type proofCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	Id         int64  `json:"id"`
+}
+
+func encodeProofCursor(c proofCursor) string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeProofCursor(s string) (proofCursor, error) {
+	var c proofCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(decoded, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// value of the sort column of proof, as stored in the cursor
+func proofSortValue(sort string, proof Proof) string {
+	switch sort {
+	case "time":
+		// the driver reads DATETIME columns back as RFC 3339; compare in the stored format
+		if t, err := time.Parse(time.RFC3339Nano, proof.TimeSubmitted); err == nil {
+			return t.UTC().Format(TimeFormat)
+		}
+		return proof.TimeSubmitted
+	case "student":
+		return proof.UserSubmitted
+	case "problem":
+		return proof.ProofName
+	}
+	return proof.Id
+}
+
+// build the WHERE clause and arguments for the filters of q
+func (q ProofQuery) where() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	equal := func(column string, value string) {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	equal("proof.userSubmitted", q.UserSubmitted)
+	equal("proof.proofName", q.ProofName)
+	equal("proof.entryType", q.EntryType)
+	equal("proof.proofType", q.ProofType)
+	equal("proof.everCompleted", q.EverCompleted)
+	equal("proof.repoProblem", q.RepoProblem)
+
+	if len(q.ProofCompleted) != 0 {
+		conditions = append(conditions, "proof.proofCompleted IN (?"+strings.Repeat(", ?", len(q.ProofCompleted)-1)+")")
+		for _, state := range q.ProofCompleted {
+			args = append(args, state)
+		}
+	}
+	if q.SectionName != "" {
+		conditions = append(conditions, "proof.userSubmitted IN (SELECT userEmail FROM roster WHERE sectionName = ? AND role = 'student' AND deletedAt IS NULL)")
+		args = append(args, q.SectionName)
+	}
+	if q.SubmittedAfter != "" {
+		conditions = append(conditions, "proof.timeSubmitted >= ?")
+		args = append(args, q.SubmittedAfter)
+	}
+	if q.SubmittedBefore != "" {
+		conditions = append(conditions, "proof.timeSubmitted < ?")
+		args = append(args, q.SubmittedBefore)
+	}
+	if q.AdminProblems {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM proof AS adminProof JOIN user ON adminProof.userSubmitted = user.email
+			WHERE user.admin = 1 AND adminProof.Premise = proof.Premise AND adminProof.Conclusion = proof.Conclusion)`)
+	}
+	if q.HideAssessments {
+		conditions = append(conditions, "proof.proofName NOT LIKE '%Test%' AND proof.proofName NOT LIKE '%Quiz%' AND proof.proofName NOT LIKE '%Final%'")
+	}
+	if q.HideUnnamed {
+		conditions = append(conditions, "proof.proofName != 'n/a'")
+	}
+	if q.HideCompleted {
+		conditions = append(conditions, "proof.proofCompleted != 'true'")
+	}
+
+	return conditions, args
+}
+
+// unfinished practice proofs of a user, the "user" selection
+func UserProofsQuery(userEmail string) ProofQuery {
+	return ProofQuery{
+		UserSubmitted:   userEmail,
+		EverCompleted:   "false",
+		HideCompleted:   true,
+		HideAssessments: true,
+		HideUnnamed:     true,
+	}
+}
+
+// completed practice proofs of a user, the "completedrepo" selection
+func UserCompletedProofsQuery(userEmail string) ProofQuery {
+	return ProofQuery{UserSubmitted: userEmail, ProofCompleted: []string{"true"}, HideAssessments: true}
+}
+
+// every attempt at a problem an admin has stored, the "downloadrepo" selection
+func AttemptedRepoProofsQuery() ProofQuery {
+	return ProofQuery{EntryType: "proof", AdminProblems: true, Sort: "student"}
+}
+
+// completed repository proofs of the students on a section's roster
+func CompletedProofsQuery(sectionName string) ProofQuery {
+	return ProofQuery{
+		SectionName:    sectionName,
+		EntryType:      "proof",
+		EverCompleted:  "true",
+		ProofCompleted: []string{"true"},
+		RepoProblem:    "true",
+		Sort:           "student",
+	}
+}
+
+// return the proofs matching q, one page at a time
+func (p *ProofStore) QueryProofs(q ProofQuery) (*ProofPage, error) {
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	column, ok := proofSortColumns[q.Sort]
+	if !ok {
+		return nil, errors.New("unknown sort key: " + q.Sort)
+	}
+	if q.Limit < 0 {
+		return nil, errors.New("limit must not be negative")
+	}
+
+	conditions, args := q.where()
+
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeProofCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != q.Sort || cursor.Descending != q.Descending {
+			return nil, ErrInvalidCursor
+		}
+		if q.Sort == "id" {
+			conditions = append(conditions, "proof.id "+comparison+" ?")
+			args = append(args, cursor.Id)
+		} else {
+			conditions = append(conditions, "(IFNULL("+column+", '') "+comparison+" ? OR (IFNULL("+column+", '') = ? AND proof.id "+comparison+" ?))")
+			args = append(args, cursor.Value, cursor.Value, cursor.Id)
+		}
+	}
+
+	query := `SELECT ` + proofColumns + ` FROM proof`
+	if len(conditions) != 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	if q.Sort == "id" {
+		query += ` ORDER BY proof.id ` + direction
+	} else {
+		query += ` ORDER BY IFNULL(` + column + `, '') ` + direction + `, proof.id ` + direction
+	}
+	if q.Limit > 0 {
+		// fetch one extra row to learn whether there is a next page
+		query += ` LIMIT ` + strconv.Itoa(q.Limit+1)
+	}
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	err, proofs := getProofsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ProofPage{Proofs: proofs}
+	if q.Limit > 0 && len(proofs) > q.Limit {
+		page.Proofs = proofs[:q.Limit]
+		last := page.Proofs[q.Limit-1]
+		id, _ := strconv.ParseInt(last.Id, 10, 64)
+		page.NextCursor = encodeProofCursor(proofCursor{
+			Sort:       q.Sort,
+			Descending: q.Descending,
+			Value:      proofSortValue(q.Sort, last),
+			Id:         id,
+		})
+	}
+	return page, nil
+}
+
+// GetProof returns the proof or argument with this id
+func (p *ProofStore) GetProof(id string) (*Proof, error) {
+	rows, err := p.db.Query(`SELECT `+proofColumns+` FROM proof WHERE id = ?;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	err, proofs := getProofsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(proofs) == 0 {
+		return nil, ErrNotExists
+	}
+	return &proofs[0], nil
+}
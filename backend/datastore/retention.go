@@ -0,0 +1,147 @@
+package datastore
+
+// What happens to a student's proofs when they are dropped from a section,
+// or the section is deleted, is chosen per deployment by SetProofRetention.
+// Only their repository proofs of the problems the section's assignments
+// list are affected, and not those their other sections also assign;
+// arguments, other proofs and the proofs of TAs and instructors are kept.
+//   - keep: the proofs stay in the student's proof list
+//   - archive: the proofs move to the archivedProof table, out of every
+//     listing, in the transaction that drops the student. Restoring the
+//     roster entry or the section, or adding the student again, moves them
+//     back; purging the roster entry leaves them archived.
+//   - purge: archived in the same way, then deleted in the transaction that
+//     purges the roster entry or section (see PurgeDeleted)
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type ProofRetention string
+
+const (
+	RetentionKeep    ProofRetention = "keep"
+	RetentionArchive ProofRetention = "archive"
+	RetentionPurge   ProofRetention = "purge"
+)
+
+var ErrInvalidRetention = errors.New("proof retention must be keep, archive or purge")
+
+// ParseProofRetention checks the name of a proof retention policy
+func ParseProofRetention(name string) (ProofRetention, error) {
+	switch retention := ProofRetention(name); retention {
+	case RetentionKeep, RetentionArchive, RetentionPurge:
+		return retention, nil
+	}
+	return "", ErrInvalidRetention
+}
+
+// SetProofRetention chooses what happens to the proofs of dropped students;
+// they are kept until it is called
+func (p *ProofStore) SetProofRetention(retention ProofRetention) {
+	p.retention = retention
+}
+
+// the columns of proof, which archivedProof has too
+const archivedProofColumns = `id, entryType, userSubmitted, proofName, proofType, Premise, Logic, Rules,
+	everCompleted, proofCompleted, timeSubmitted, Conclusion, repoProblem`
+
+// the names of the problems listed by the assignments query selects the
+// proofIds of
+func problemNames(tx *sql.Tx, query string, args ...interface{}) (map[string]bool, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var proofIds string
+		if err := rows.Scan(&proofIds); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		parsed, err := parseProofIds(proofIds)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, parsed...)
+	}
+	rows.Close()
+	return proofNames(tx, ids)
+}
+
+// archive the repository proofs a student dropped from a section has of its
+// problems, unless the retention is keep; archivedAt is when their roster
+// entry was deleted
+func (p *ProofStore) archiveDroppedProofs(tx *sql.Tx, sectionName string, userEmail string, archivedAt string) error {
+	if p.retention != RetentionArchive && p.retention != RetentionPurge {
+		return nil
+	}
+	section, err := problemNames(tx, `SELECT proofIds FROM assignment WHERE sectionName = ? AND deletedAt IS NULL;`, sectionName)
+	if err != nil {
+		return err
+	}
+	others, err := problemNames(tx, `SELECT assignment.proofIds FROM roster
+	                                 JOIN assignment ON assignment.sectionName = roster.sectionName
+	                                 WHERE roster.userEmail = ? AND roster.sectionName != ?
+	                                 AND roster.deletedAt IS NULL AND assignment.deletedAt IS NULL;`, userEmail, sectionName)
+	if err != nil {
+		return err
+	}
+
+	for name := range section {
+		if others[name] {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO archivedProof (sectionName, archivedAt, `+archivedProofColumns+`)
+		                   SELECT ?, ?, `+proofColumns+` FROM proof
+		                   WHERE userSubmitted = ? AND proofName = ? AND entryType = 'proof' AND repoProblem = 'true';`,
+			sectionName, archivedAt, userEmail, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM proof WHERE userSubmitted = ? AND proofName = ? AND entryType = 'proof' AND repoProblem = 'true';`,
+			userEmail, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move back the proofs archived when the roster entry of userEmail, or of
+// every student when it is "", was deleted at archivedAt. A proof saved
+// again since then keeps the newer save.
+func unarchiveProofs(tx *sql.Tx, sectionName string, userEmail string, archivedAt string) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO proof (`+archivedProofColumns+`)
+	                   SELECT `+archivedProofColumns+` FROM archivedProof
+	                   WHERE sectionName = ? AND archivedAt = ? AND (? = '' OR userSubmitted = ?);`,
+		sectionName, archivedAt, userEmail, userEmail)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM archivedProof WHERE sectionName = ? AND archivedAt = ? AND (? = '' OR userSubmitted = ?);`,
+		sectionName, archivedAt, userEmail, userEmail)
+	return err
+}
+
+// remove the deleted roster entry of a user about to be added to the
+// section again, moving back the proofs archived with it
+func replaceDeletedRosterEntry(tx *sql.Tx, sectionName string, userEmail string) error {
+	var deletedAt string
+	err := tx.QueryRow(`SELECT deletedAt FROM roster WHERE sectionName = ? AND userEmail = ? AND deletedAt IS NOT NULL;`,
+		sectionName, userEmail).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := unarchiveProofs(tx, sectionName, userEmail, deletedAt); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM roster WHERE sectionName = ? AND userEmail = ?;`, sectionName, userEmail)
+	return err
+}
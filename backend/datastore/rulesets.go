@@ -0,0 +1,57 @@
+package datastore
+
+// Assignments carry a rule set, the rules their problems may be proved
+// with. The datastore only stores it; proofcheck knows the presets and
+// what a rule set allows.
+
+// GetProblemRuleSets returns the rule sets of the visible assignments, in
+// the unarchived sections the user is on the roster of, that list a
+// problem named proofName; none when no such assignment lists it.
+func (p *ProofStore) GetProblemRuleSets(userEmail string, proofName string) ([]string, error) {
+	rows, err := p.db.Query(`SELECT assignment.proofIds, assignment.ruleSet FROM roster
+	                         JOIN section ON section.name = roster.sectionName
+	                         JOIN assignment ON assignment.sectionName = section.name
+	                         WHERE roster.userEmail = ? AND section.archived = 0 AND assignment.visibility = 'true'
+	                         AND roster.deletedAt IS NULL AND assignment.deletedAt IS NULL;`, userEmail)
+	if err != nil {
+		return nil, err
+	}
+	type listed struct {
+		ids     []int
+		ruleSet string
+	}
+	var assignments []listed
+	for rows.Next() {
+		var proofIds, ruleSet string
+		if err := rows.Scan(&proofIds, &ruleSet); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids, err := parseProofIds(proofIds)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		assignments = append(assignments, listed{ids, ruleSet})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var ruleSets []string
+	for _, assignment := range assignments {
+		for _, id := range assignment.ids {
+			var count int
+			err := p.db.QueryRow(`SELECT COUNT(*) FROM proof WHERE id = ? AND proofName = ?;`, id, proofName).Scan(&count)
+			if err != nil {
+				return nil, err
+			}
+			if count != 0 {
+				ruleSets = append(ruleSets, assignment.ruleSet)
+				break
+			}
+		}
+	}
+	return ruleSets, nil
+}
@@ -0,0 +1,407 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SectionArchiveVersion is the format version ExportSection writes.
+// ImportSection reads only archives of this version.
+const SectionArchiveVersion = 1
+
+var (
+	ErrArchiveVersion   = errors.New("unsupported section archive version")
+	ErrInvalidArchive   = errors.New("invalid section archive")
+	ErrImportNotAllowed = errors.New("section archive names users only an admin may import")
+)
+
+// SectionArchive is one section with everything needed to recreate it on
+// another server. Proof ids are those of the exporting server; assignments
+// refer to the ids of Problems.
+type SectionArchive struct {
+	Version     int                  `json:"version"`
+	ExportedAt  string               `json:"exportedAt"` // UTC TimeFormat
+	Section     Section              `json:"section"`
+	Users       []User               `json:"users"`  // the instructor and everyone on the roster
+	Roster      []Roster             `json:"roster"` // every role, the instructor included
+	Assignments []ArchivedAssignment `json:"assignments"`
+	Problems    []Proof              `json:"problems"` // the proofs the assignments refer to
+	Proofs      []Proof              `json:"proofs"`   // every saved state of the students' proofs
+}
+
+type ArchivedAssignment struct {
+	Name       string `json:"name"`
+	ProofIds   []int  `json:"proofIds"`
+	Visibility string `json:"visibility"`
+	RuleSet    string `json:"ruleSet,omitempty"`
+	DueDate    string `json:"dueDate,omitempty"`
+}
+
+// ImportSummary reports what ImportSection added
+type ImportSummary struct {
+	Section       string      `json:"section"`
+	Users         int         `json:"users"`         // users that were not on this server yet
+	Problems      int         `json:"problems"`      // problems added; identical ones already here are reused
+	Proofs        int         `json:"proofs"`        // student proofs added
+	ProofsSkipped int         `json:"proofsSkipped"` // student proofs kept as this server already had them
+	ProofIds      map[int]int `json:"proofIds"`      // archive problem id to id on this server
+}
+
+// parse Assignment.ProofIds, written as fmt.Sprint of an []int: "[1 2 3]";
+// commas are accepted too
+func parseProofIds(proofIds string) ([]int, error) {
+	fields := strings.FieldsFunc(proofIds, func(r rune) bool {
+		return r == '[' || r == ']' || r == ',' || r == ' '
+	})
+	ids := make([]int, 0, len(fields))
+	for _, field := range fields {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("proof ids %q: %w", proofIds, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// read DATETIME values back into the stored format; the driver returns RFC 3339
+func storedTime(t string) string {
+	if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+		return parsed.UTC().Format(TimeFormat)
+	}
+	return t
+}
+
+func queryProofs(tx *sql.Tx, query string, args ...interface{}) ([]Proof, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	err, proofs := getProofsFromRows(rows)
+	return proofs, err
+}
+
+// ExportSection reads a section, its roster, assignments, problems and
+// student proofs into an archive, all as of one moment.
+func (p *ProofStore) ExportSection(sectionName string) (*SectionArchive, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	archive := &SectionArchive{
+		Version:     SectionArchiveVersion,
+		ExportedAt:  time.Now().UTC().Format(TimeFormat),
+		Users:       []User{},
+		Roster:      []Roster{},
+		Assignments: []ArchivedAssignment{},
+		Problems:    []Proof{},
+		Proofs:      []Proof{},
+	}
+	err = tx.QueryRow(`SELECT instructorEmail, name, term, archived FROM section WHERE name = ? AND deletedAt IS NULL;`, sectionName).Scan(
+		&archive.Section.InstructorEmail, &archive.Section.Name, &archive.Section.Term, &archive.Section.Archived)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT sectionName, userEmail, role FROM roster WHERE sectionName = ? AND deletedAt IS NULL ORDER BY role, userEmail;`, sectionName)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var rosterRow Roster
+		if err := rows.Scan(&rosterRow.SectionName, &rosterRow.UserEmail, &rosterRow.Role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		archive.Roster = append(archive.Roster, rosterRow)
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`SELECT email, firstName, lastName FROM user
+	                      WHERE email IN (SELECT userEmail FROM roster WHERE sectionName = ? AND deletedAt IS NULL)
+	                         OR email = ? ORDER BY email;`, sectionName, archive.Section.InstructorEmail)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var user User
+		var firstName, lastName sql.NullString
+		if err := rows.Scan(&user.Email, &firstName, &lastName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		user.FirstName, user.LastName = firstName.String, lastName.String
+		archive.Users = append(archive.Users, user)
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`SELECT name, proofIds, visibility, ruleSet, dueDate FROM assignment WHERE sectionName = ? AND deletedAt IS NULL ORDER BY name;`, sectionName)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []Assignment
+	for rows.Next() {
+		assignment := Assignment{SectionName: sectionName}
+		if err := rows.Scan(&assignment.Name, &assignment.ProofIds, &assignment.Visibility, &assignment.RuleSet, &assignment.DueDate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	rows.Close()
+
+	exported := map[int]bool{}
+	for _, assignment := range assignments {
+		ids, err := parseProofIds(assignment.ProofIds)
+		if err != nil {
+			return nil, err
+		}
+		archived := ArchivedAssignment{Name: assignment.Name, ProofIds: []int{}, Visibility: assignment.Visibility,
+			RuleSet: assignment.RuleSet, DueDate: assignment.DueDate}
+		for _, id := range ids {
+			if !exported[id] {
+				problems, err := queryProofs(tx, `SELECT `+proofColumns+` FROM proof WHERE id = ?;`, id)
+				if err != nil {
+					return nil, err
+				}
+				if len(problems) == 0 {
+					continue // deleted since it was assigned
+				}
+				archive.Problems = append(archive.Problems, problems[0])
+				exported[id] = true
+			}
+			archived.ProofIds = append(archived.ProofIds, id)
+		}
+		archive.Assignments = append(archive.Assignments, archived)
+	}
+
+	proofs, err := queryProofs(tx, `SELECT `+proofColumns+` FROM proof WHERE entryType = 'proof'
+	                                AND userSubmitted IN (SELECT userEmail FROM roster WHERE sectionName = ? AND role = 'student' AND deletedAt IS NULL)
+	                                ORDER BY proof.id;`, sectionName)
+	if err != nil {
+		return nil, err
+	}
+	archive.Proofs = append(archive.Proofs, proofs...)
+
+	return archive, nil
+}
+
+// add a proof of the archive, or find the row this server already has for
+// the same user, name and completion state; reports whether it was added
+func importProof(tx *sql.Tx, proof Proof) (id int, added bool, same bool, err error) {
+	existing, err := queryProofs(tx, `SELECT `+proofColumns+` FROM proof
+	                                  WHERE userSubmitted = ? AND proofName = ? AND proofCompleted = ?;`,
+		proof.UserSubmitted, proof.ProofName, proof.ProofCompleted)
+	if err != nil {
+		return 0, false, false, err
+	}
+	if len(existing) != 0 {
+		id, _ := strconv.Atoi(existing[0].Id)
+		same = existing[0].EntryType == proof.EntryType && existing[0].ProofType == proof.ProofType &&
+			existing[0].Conclusion == proof.Conclusion &&
+			reflect.DeepEqual(existing[0].Premise, proof.Premise) && reflect.DeepEqual(existing[0].Logic, proof.Logic)
+		return id, false, same, nil
+	}
+
+	premiseJSON, _ := json.Marshal(proof.Premise)
+	logicJSON, _ := json.Marshal(proof.Logic)
+	rules := proof.Rules
+	if rules == nil {
+		rules = []string{}
+	}
+	rulesJSON, _ := json.Marshal(rules)
+	if proof.EverCompleted == "" {
+		proof.EverCompleted = "false"
+	}
+	result, err := tx.Exec(`INSERT INTO proof (entryType, userSubmitted, proofName, proofType, Premise, Logic, Rules,
+	                        everCompleted, proofCompleted, timeSubmitted, Conclusion, repoProblem)
+	                        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		proof.EntryType, proof.UserSubmitted, proof.ProofName, proof.ProofType, premiseJSON, logicJSON, rulesJSON,
+		proof.EverCompleted, proof.ProofCompleted, storedTime(proof.TimeSubmitted), proof.Conclusion, proof.RepoProblem)
+	if err != nil {
+		return 0, false, false, err
+	}
+	newId, err := result.LastInsertId()
+	return int(newId), true, true, err
+}
+
+// ErrImportNotAllowed unless every problem of the archive is the importer's
+// and every other user on its roster is new to this server
+func checkImporter(tx *sql.Tx, archive *SectionArchive, roles map[string]string, importer string) error {
+	for _, problem := range archive.Problems {
+		if problem.UserSubmitted != importer {
+			return fmt.Errorf("%w: problem %q of %s", ErrImportNotAllowed, problem.ProofName, problem.UserSubmitted)
+		}
+	}
+	for email := range roles {
+		if email == importer {
+			continue
+		}
+		var exists int
+		if err := tx.QueryRow(`SELECT count(*) FROM user WHERE email = ?;`, email).Scan(&exists); err != nil {
+			return err
+		}
+		if exists != 0 {
+			return fmt.Errorf("%w: %s already has an account", ErrImportNotAllowed, email)
+		}
+	}
+	return nil
+}
+
+// ImportSection recreates an archived section, named sectionName or, if
+// that is empty, as in the archive. Users missing from this server are
+// added, TAs with the admin flag as the roster routes give them. Problems
+// and proofs get new ids; a problem or proof this server already has is
+// reused, so importing a section onto the server it came from shares them.
+// Nothing is imported unless everything is.
+//
+// importer is "" for an admin; anyone else may only import problems they
+// wrote, and a roster, with its proofs, of users this server does not have
+// yet (ErrImportNotAllowed), so that they cannot save work in other users'
+// names.
+func (p *ProofStore) ImportSection(archive *SectionArchive, sectionName string, importer string) (*ImportSummary, error) {
+	if archive.Version != SectionArchiveVersion {
+		return nil, fmt.Errorf("%w: %d", ErrArchiveVersion, archive.Version)
+	}
+	if sectionName == "" {
+		sectionName = archive.Section.Name
+	}
+	if sectionName == "" || archive.Section.InstructorEmail == "" {
+		return nil, fmt.Errorf("%w: section name and instructor required", ErrInvalidArchive)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT count(*) FROM section WHERE name = ?;`, sectionName).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists != 0 {
+		return nil, fmt.Errorf("%w: section %q", ErrDuplicate, sectionName)
+	}
+
+	summary := &ImportSummary{Section: sectionName, ProofIds: map[int]int{}}
+
+	// users first: the section and roster refer to them
+	roles := map[string]string{}
+	for _, rosterRow := range archive.Roster {
+		roles[rosterRow.UserEmail] = rosterRow.Role
+	}
+	if importer != "" {
+		if err := checkImporter(tx, archive, roles, importer); err != nil {
+			return nil, err
+		}
+	}
+	users := map[string]User{archive.Section.InstructorEmail: {Email: archive.Section.InstructorEmail}}
+	for email := range roles {
+		users[email] = User{Email: email}
+	}
+	for _, user := range archive.Users {
+		if _, ok := users[user.Email]; ok {
+			users[user.Email] = user
+		}
+	}
+	for email, user := range users {
+		admin := 0
+		if roles[email] == "ta" {
+			admin = 1
+		}
+		result, err := tx.Exec(`INSERT OR IGNORE INTO user(email, firstName, lastName, admin) VALUES (?, ?, ?, ?);`,
+			email, user.FirstName, user.LastName, admin)
+		if err != nil {
+			return nil, err
+		}
+		if added, _ := result.RowsAffected(); added != 0 {
+			summary.Users++
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO section(instructorEmail, name, term, archived) VALUES (?, ?, ?, ?);`,
+		archive.Section.InstructorEmail, sectionName, archive.Section.Term, archive.Section.Archived)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := setJoinCode(tx, JoinCode{SectionName: sectionName}); err != nil {
+		return nil, err
+	}
+	if _, ok := roles[archive.Section.InstructorEmail]; !ok {
+		roles[archive.Section.InstructorEmail] = "instructor"
+	}
+	for email, role := range roles {
+		if _, err := tx.Exec(`INSERT INTO roster(sectionName, userEmail, role) VALUES (?, ?, ?);`, sectionName, email, role); err != nil {
+			return nil, fmt.Errorf("%w: roster entry %s: %v", ErrInvalidArchive, email, err)
+		}
+	}
+
+	for _, problem := range archive.Problems {
+		oldId, err := strconv.Atoi(problem.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: problem id %q", ErrInvalidArchive, problem.Id)
+		}
+		id, added, same, err := importProof(tx, problem)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			return nil, fmt.Errorf("%w: %s already has a different problem named %q", ErrDuplicate, problem.UserSubmitted, problem.ProofName)
+		}
+		if added {
+			summary.Problems++
+		}
+		summary.ProofIds[oldId] = id
+	}
+
+	for _, assignment := range archive.Assignments {
+		ids := make([]int, 0, len(assignment.ProofIds))
+		for _, oldId := range assignment.ProofIds {
+			id, ok := summary.ProofIds[oldId]
+			if !ok {
+				return nil, fmt.Errorf("%w: assignment %q refers to problem %d, which is not in the archive", ErrInvalidArchive, assignment.Name, oldId)
+			}
+			ids = append(ids, id)
+		}
+		_, err := tx.Exec(`INSERT INTO assignment(sectionName, name, proofIds, visibility, ruleSet, dueDate) VALUES (?, ?, ?, ?, ?, ?);`,
+			sectionName, assignment.Name, fmt.Sprint(ids), assignment.Visibility, assignment.RuleSet, assignment.DueDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: assignment %q: %v", ErrInvalidArchive, assignment.Name, err)
+		}
+	}
+
+	for _, proof := range archive.Proofs {
+		if _, ok := roles[proof.UserSubmitted]; !ok {
+			return nil, fmt.Errorf("%w: proof %s of %s, who is not on the roster", ErrInvalidArchive, proof.Id, proof.UserSubmitted)
+		}
+		_, added, _, err := importProof(tx, proof)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			summary.Proofs++
+		} else {
+			summary.ProofsSkipped++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	logger.Info("section imported", "section", sectionName, "users", summary.Users, "problems", summary.Problems,
+		"proofs", summary.Proofs, "proofsSkipped", summary.ProofsSkipped)
+	return summary, nil
+}
@@ -0,0 +1,231 @@
+package datastore
+
+// Sections, assignments and roster entries are deleted softly: RemoveSection,
+// RemoveAssignment and RemoveFromRoster set their deletedAt column and every
+// read leaves such rows out, until RestoreSection, RestoreAssignment or
+// RestoreRosterEntry brings them back or PurgeDeleted removes them for good.
+// Deleting a section stamps its live roster entries and assignments with the
+// same time, so restoring it brings back exactly those. Students' proofs are
+// kept, or archived with their roster entry and brought back with it (see
+// retention.go). A deleted row keeps its name: a new section cannot take it,
+// while adding the user or assignment again replaces the deleted roster
+// entry or assignment.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type DeletedSection struct {
+	Section
+	DeletedAt string // TimeFormat, UTC
+}
+
+type DeletedAssignment struct {
+	Assignment
+	DeletedAt string
+}
+
+type DeletedRoster struct {
+	Roster
+	DeletedAt string
+}
+
+// DeletedItems are deleted sections, and the deleted assignments and roster
+// entries of sections that are not deleted themselves
+type DeletedItems struct {
+	Sections    []DeletedSection    `json:"sections"`
+	Assignments []DeletedAssignment `json:"assignments"`
+	Roster      []DeletedRoster     `json:"roster"`
+}
+
+// the deleted sections matching sectionCondition, and the deleted
+// assignments and roster entries matching rowCondition, which refers to
+// them as deleted and to their section as section
+func listDeleted(tx *sql.Tx, sectionCondition string, sectionArgs []interface{}, rowCondition string, rowArgs []interface{}) (*DeletedItems, error) {
+	items := &DeletedItems{Sections: []DeletedSection{}, Assignments: []DeletedAssignment{}, Roster: []DeletedRoster{}}
+
+	rows, err := tx.Query(`SELECT instructorEmail, name, term, archived, deletedAt FROM section
+	                       WHERE deletedAt IS NOT NULL AND `+sectionCondition+` ORDER BY deletedAt DESC, name;`, sectionArgs...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var section DeletedSection
+		if err := rows.Scan(&section.InstructorEmail, &section.Name, &section.Term, &section.Archived, &section.DeletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items.Sections = append(items.Sections, section)
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`SELECT deleted.sectionName, deleted.name, deleted.proofIds, deleted.visibility, deleted.ruleSet,
+	                      deleted.dueDate, deleted.deletedAt FROM assignment AS deleted
+	                      JOIN section ON section.name = deleted.sectionName
+	                      WHERE deleted.deletedAt IS NOT NULL AND `+rowCondition+`
+	                      ORDER BY deleted.deletedAt DESC, deleted.sectionName, deleted.name;`, rowArgs...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var assignment DeletedAssignment
+		if err := rows.Scan(&assignment.SectionName, &assignment.Name, &assignment.ProofIds, &assignment.Visibility,
+			&assignment.RuleSet, &assignment.DueDate, &assignment.DeletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items.Assignments = append(items.Assignments, assignment)
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`SELECT deleted.sectionName, deleted.userEmail, deleted.role, deleted.deletedAt FROM roster AS deleted
+	                      JOIN section ON section.name = deleted.sectionName
+	                      WHERE deleted.deletedAt IS NOT NULL AND deleted.role != 'instructor' AND `+rowCondition+`
+	                      ORDER BY deleted.deletedAt DESC, deleted.sectionName, deleted.userEmail;`, rowArgs...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var rosterRow DeletedRoster
+		if err := rows.Scan(&rosterRow.SectionName, &rosterRow.UserEmail, &rosterRow.Role, &rosterRow.DeletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items.Roster = append(items.Roster, rosterRow)
+	}
+	rows.Close()
+	return items, rows.Err()
+}
+
+// GetDeleted returns the deleted sections the user is the instructor of,
+// and the deleted assignments and roster entries of their other sections
+func (p *ProofStore) GetDeleted(userEmail string) (*DeletedItems, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return listDeleted(tx, `instructorEmail = ?`, []interface{}{userEmail},
+		`section.instructorEmail = ? AND section.deletedAt IS NULL`, []interface{}{userEmail})
+}
+
+// RestoreSection undoes RemoveSection, bringing back the roster entries,
+// assignments and archived proofs deleted with the section; ErrNotExists if
+// no deleted section has the name
+func (p *ProofStore) RestoreSection(sectionName string) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt string
+	err = tx.QueryRow(`SELECT deletedAt FROM section WHERE name = ? AND deletedAt IS NOT NULL;`, sectionName).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotExists
+	}
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"roster", "assignment"} {
+		_, err := tx.Exec(`UPDATE `+table+` SET deletedAt = NULL WHERE sectionName = ? AND deletedAt = ?;`, sectionName, deletedAt)
+		if err != nil {
+			logger.Error("RestoreSection: restoring "+table, "error", err)
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE section SET deletedAt = NULL WHERE name = ?;`, sectionName); err != nil {
+		logger.Error("RestoreSection: restoring section", "error", err)
+		return err
+	}
+	if err := unarchiveProofs(tx, sectionName, "", deletedAt); err != nil {
+		logger.Error("RestoreSection: restoring archived proofs", "error", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreAssignment undoes RemoveAssignment; ErrNotExists if the section has
+// no deleted assignment of that name
+func (p *ProofStore) RestoreAssignment(sectionName string, name string) error {
+	if err := checkSectionWritable(p.db, sectionName); err != nil {
+		return err
+	}
+	result, err := p.db.Exec(`UPDATE assignment SET deletedAt = NULL
+	                          WHERE sectionName = ? AND name = ? AND deletedAt IS NOT NULL;`, sectionName, name)
+	if err != nil {
+		logger.Error("RestoreAssignment", "error", err)
+		return err
+	}
+	if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+		return ErrNotExists
+	}
+	return nil
+}
+
+// RestoreRosterEntry undoes RemoveFromRoster, bringing back the proofs
+// archived with the entry; ErrNotExists if the user has no deleted roster
+// entry in the section
+func (p *ProofStore) RestoreRosterEntry(sectionName string, userEmail string) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkSectionWritable(tx, sectionName); err != nil {
+		return err
+	}
+	var deletedAt string
+	err = tx.QueryRow(`SELECT deletedAt FROM roster WHERE sectionName = ? AND userEmail = ? AND deletedAt IS NOT NULL;`,
+		sectionName, userEmail).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotExists
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE roster SET deletedAt = NULL WHERE sectionName = ? AND userEmail = ?;`, sectionName, userEmail)
+	if err != nil {
+		logger.Error("RestoreRosterEntry", "error", err)
+		return err
+	}
+	if err := unarchiveProofs(tx, sectionName, userEmail, deletedAt); err != nil {
+		logger.Error("RestoreRosterEntry: restoring archived proofs", "error", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeDeleted removes for good the sections, assignments and roster entries
+// deleted before the TimeFormat time before, and returns them; the roster
+// entries and assignments of a purged section go with it and are not listed
+// separately. With the purge retention, so do the proofs archived with them.
+func (p *ProofStore) PurgeDeleted(before string) (*DeletedItems, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	purged, err := listDeleted(tx, `deletedAt < ?`, []interface{}{before},
+		`deleted.deletedAt < ? AND (section.deletedAt IS NULL OR section.deletedAt >= ?)`, []interface{}{before, before})
+	if err != nil {
+		return nil, err
+	}
+	// a section takes its roster entries, assignments and join code with it
+	for _, table := range []string{"roster", "assignment", "section"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE deletedAt < ?;`, before); err != nil {
+			return nil, fmt.Errorf("purging deleted %s rows: %w", table, err)
+		}
+	}
+	if p.retention == RetentionPurge {
+		if _, err := tx.Exec(`DELETE FROM archivedProof WHERE archivedAt < ?;`, before); err != nil {
+			return nil, fmt.Errorf("purging archived proofs: %w", err)
+		}
+	}
+	return purged, tx.Commit()
+}
@@ -1,13 +1,13 @@
 package datastore
 
 import (
+	"context"
 	"database/sql"
-	"log"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func InitDB(dataSourceName string) (*ProofStore, error) {
-	log.Println("opening db.sqlite3...")
+	logger.Info("opening database")
 
 	sqliteDatabase, err := sql.Open("sqlite3", dataSourceName) // Open the created SQLite File
 	if err != nil {
@@ -19,10 +19,13 @@ func InitDB(dataSourceName string) (*ProofStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Println("db.sqlite3 opened")
+	if err = migrate(sqliteDatabase); err != nil {
+		return nil, err
+	}
+	logger.Info("database opened")
 
 	// if all went well, return the db and nil error
-	return &ProofStore{db: sqliteDatabase}, nil
+	return &ProofStore{db: sqliteDatabase, hub: NewProofHub()}, nil
 }
 
 // create tables for user, section, and roster within the referenced db
@@ -35,14 +38,14 @@ func createTables(db *sql.DB) (error) {
 			CHECK (admin in (0, 1))
 	);` // SQL statement for Create Table
 
-	log.Println("Creating user table. . .")
+	logger.Debug("Creating user table. . .")
 	statement, err := db.Prepare(createUserTableSQL) // Prepare SQL statement
 													 // Avoid SQL injection through prepared statements!
 	if err != nil { // if an error occurred during statement preparation, return
 		return err
 	} else {
 		statement.Exec() // execute the prepared SQL statement
-		log.Println("user table created")
+		logger.Debug("user table created")
 	}
 	defer statement.Close()
 
@@ -54,13 +57,13 @@ func createTables(db *sql.DB) (error) {
 			ON DELETE CASCADE
 	);`
 
-	log.Println("Creating section table. . .")
+	logger.Debug("Creating section table. . .")
 	statement, err = db.Prepare(createSectionTableSQL)
 	if err != nil {
 		return err
 	} else {
 		statement.Exec()
-		log.Println("section table created")
+		logger.Debug("section table created")
 	}
 	
 	createRosterRelationSQL := `CREATE TABLE IF NOT EXISTS roster(
@@ -77,17 +80,17 @@ func createTables(db *sql.DB) (error) {
 			ON DELETE CASCADE
 	);`
 
-	log.Println("Creating roster relation. . .")
+	logger.Debug("Creating roster relation. . .")
 	statement, err = db.Prepare(createRosterRelationSQL)
 	if err != nil {
 		return err
 	} else {
 		statement.Exec()
-		log.Println("roster relation created")
+		logger.Debug("roster relation created")
 	}
 	
 
-	log.Println("Creating proof table. . .")
+	logger.Debug("Creating proof table. . .")
 	// proofs : [Premise, Logic, Rules] are JSON fields
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS proof (
 		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
@@ -107,7 +110,7 @@ func createTables(db *sql.DB) (error) {
 	if err != nil {
 		return err
 	} else {
-		log.Println("proof table created")
+		logger.Debug("proof table created")
 	}
 
 	createAssignmentTableSQL := `CREATE TABLE IF NOT EXISTS assignment (
@@ -121,28 +124,60 @@ func createTables(db *sql.DB) (error) {
 			ON DELETE CASCADE
 	);`
 
-	log.Println("Creating assignment table. . .")
+	logger.Debug("Creating assignment table. . .")
 	statement, err = db.Prepare(createAssignmentTableSQL)
 	if err != nil {
 		return err
 	} else {
 		statement.Exec()
-		log.Println("assignment table created")
+		logger.Debug("assignment table created")
 	}
-	
+
+	// joinCode : one rotating self-enrollment code per section
+	// expiresAt is NULL when the code never expires, seatLimit is 0 when unlimited
+	createJoinCodeTableSQL := `CREATE TABLE IF NOT EXISTS joinCode (
+		sectionName TEXT NOT NULL PRIMARY KEY,
+		code TEXT NOT NULL UNIQUE,
+		expiresAt DATETIME,
+		seatLimit INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1
+			CHECK (enabled in (0, 1)),
+		FOREIGN KEY (sectionName) REFERENCES section (name)
+			ON UPDATE CASCADE
+			ON DELETE CASCADE
+	);`
+
+	logger.Debug("Creating joinCode table. . .")
+	_, err = db.Exec(createJoinCodeTableSQL)
+	if err != nil {
+		return err
+	} else {
+		logger.Debug("joinCode table created")
+	}
+
 	// proofs : Unique index on (userSubmitted, proofName, proofCompleted)
 	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS index_user_proof
 			ON proof (userSubmitted, proofName, proofCompleted)`)
 	if err != nil {
 		return err
 	} else {
-		log.Println("unique index for (userSubmitted, proofName, proofCompleted) created")
+		logger.Debug("unique index for (userSubmitted, proofName, proofCompleted) created")
 	}
 
 	return nil
 }
 
-// close the database, prevent new queries from running
+// check that the database file can be read; for the readiness probe
+func (p *ProofStore) Ping(ctx context.Context) error {
+	var tables int
+	return p.db.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master`).Scan(&tables)
+}
+
+// copy the write-ahead log into the database file and close it, so a
+// stopped server leaves a single self-contained db.sqlite3
 func (p *ProofStore) Close() error {
+	if _, err := p.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		logger.Error("Close: WAL checkpoint error", "error", err)
+	}
 	return p.db.Close()
 }
\ No newline at end of file
@@ -0,0 +1,200 @@
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Archived sections are read-only: their roster, assignments and join code
+// cannot change, and students cannot save proofs of problems assigned only
+// there. Their grades can still be read.
+var ErrSectionArchived = errors.New("section is archived")
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// the names of the proofs with the given ids, in one query; ids of no proof
+// are left out
+func proofNames(q querier, ids []int) (map[string]bool, error) {
+	names := map[string]bool{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+	seen := map[int]bool{}
+	var args []interface{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	rows, err := q.Query(`SELECT proofName FROM proof WHERE id IN (?`+strings.Repeat(", ?", len(args)-1)+`);`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// ErrSectionArchived if the section is archived and ErrNotExists if it is
+// deleted; a missing section is left for the caller to report
+func checkSectionWritable(q queryRower, sectionName string) error {
+	var archived, deleted bool
+	err := q.QueryRow(`SELECT archived, deletedAt IS NOT NULL FROM section WHERE name = ?;`, sectionName).Scan(&archived, &deleted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if deleted {
+		return ErrNotExists
+	}
+	if archived {
+		return ErrSectionArchived
+	}
+	return nil
+}
+
+// return the archived sections a user is on the roster of
+func (p *ProofStore) GetArchivedSections(userEmail string) ([]Section, error) {
+	return p.getSections(userEmail, true)
+}
+
+func (p *ProofStore) SetSectionTerm(sectionName string, term string) error {
+	result, err := p.db.Exec(`UPDATE section SET term = ? WHERE name = ? AND deletedAt IS NULL;`, term, sectionName)
+	if err != nil {
+		logger.Error("SetSectionTerm", "error", err)
+		return err
+	}
+	if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+		return ErrNotExists
+	}
+	return nil
+}
+
+// archive a section, or make an archived one writable again
+func (p *ProofStore) SetSectionArchived(sectionName string, archived bool) error {
+	result, err := p.db.Exec(`UPDATE section SET archived = ? WHERE name = ? AND deletedAt IS NULL;`, archived, sectionName)
+	if err != nil {
+		logger.Error("SetSectionArchived", "error", err)
+		return err
+	}
+	if numUpdated, _ := result.RowsAffected(); numUpdated != 1 {
+		return ErrNotExists
+	}
+	return nil
+}
+
+// report whether proofName is a problem assigned in an archived section
+// the user is on the roster of, and in none of their other sections
+func (p *ProofStore) isArchivedProblem(userEmail string, proofName string) (bool, error) {
+	rows, err := p.db.Query(`SELECT section.archived, assignment.proofIds FROM roster
+	                         JOIN section ON section.name = roster.sectionName
+	                         JOIN assignment ON assignment.sectionName = section.name
+	                         WHERE roster.userEmail = ? AND roster.deletedAt IS NULL AND assignment.deletedAt IS NULL;`, userEmail)
+	if err != nil {
+		return false, err
+	}
+	var archivedIds, activeIds []int
+	for rows.Next() {
+		var archived bool
+		var proofIds string
+		if err := rows.Scan(&archived, &proofIds); err != nil {
+			rows.Close()
+			return false, err
+		}
+		ids, err := parseProofIds(proofIds)
+		if err != nil {
+			rows.Close()
+			return false, err
+		}
+		if archived {
+			archivedIds = append(archivedIds, ids...)
+		} else {
+			activeIds = append(activeIds, ids...)
+		}
+	}
+	rows.Close()
+	if len(archivedIds) == 0 {
+		return false, nil
+	}
+
+	archivedNames, err := proofNames(p.db, archivedIds)
+	if err != nil || !archivedNames[proofName] {
+		return false, err
+	}
+	activeNames, err := proofNames(p.db, activeIds)
+	return !activeNames[proofName], err
+}
+
+// CloneSection creates section, with section.InstructorEmail as its only
+// roster entry, and copies the assignments of sourceName into it. The
+// assignments refer to the same problems and have no due dates, which
+// belong to the old term; no student work is copied.
+func (p *ProofStore) CloneSection(sourceName string, section Section) (*Section, error) {
+	if section.Name == "" {
+		return nil, errors.New("section insertion err: no name given")
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, errors.New("Database transaction begin error")
+	}
+	defer tx.Rollback()
+
+	var sources, existing int
+	if err := tx.QueryRow(`SELECT count(*) FROM section WHERE name = ? AND deletedAt IS NULL;`, sourceName).Scan(&sources); err != nil {
+		return nil, err
+	}
+	if sources == 0 {
+		return nil, ErrNotExists
+	}
+	if err := tx.QueryRow(`SELECT count(*) FROM section WHERE name = ?;`, section.Name).Scan(&existing); err != nil {
+		return nil, err
+	}
+	if existing != 0 {
+		return nil, ErrDuplicate
+	}
+
+	section.Archived = false
+	_, err = tx.Exec(`INSERT INTO section(instructorEmail, name, term) VALUES (?, ?, ?);`,
+		section.InstructorEmail, section.Name, section.Term)
+	if err != nil {
+		logger.Error("CloneSection: inserting section", "error", err)
+		return nil, err
+	}
+	if _, err := setJoinCode(tx, JoinCode{SectionName: section.Name}); err != nil {
+		logger.Error("CloneSection: setJoinCode", "error", err)
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO roster(sectionName, userEmail, role) VALUES (?, ?, 'instructor');`,
+		section.Name, section.InstructorEmail)
+	if err != nil {
+		logger.Error("CloneSection: inserting instructor", "error", err)
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO assignment(sectionName, name, proofIds, visibility, ruleSet)
+	                  SELECT ?, name, proofIds, visibility, ruleSet FROM assignment WHERE sectionName = ? AND deletedAt IS NULL;`,
+		section.Name, sourceName)
+	if err != nil {
+		logger.Error("CloneSection: copying assignments", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
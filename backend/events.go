@@ -0,0 +1,109 @@
+package main
+
+// Live section dashboard
+//
+// Instructors and TAs keep a Server-Sent Events stream open while students
+// work; every proof a student of the section saves arrives as
+//
+//	event: proof
+//	data: {"sectionName":"...","student":"...","problem":"...","proofCompleted":"true","lineCount":7}
+//
+// The stream needs the X-Auth-Token header like every other route, so
+// browsers read it with fetch() rather than EventSource, which cannot send
+// headers. When the stream ends (the client fell behind, or lost access to
+// the section) the client should reload the completed-proofs list and
+// reconnect.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// interval of keep-alive comments; authorization is checked again on each
+var sectionEventsHeartbeat = 25 * time.Second
+
+// stream the proof events of a section until the client disconnects or is no
+// longer instructor or TA of the section
+func (env *Env) streamSectionEvents(w http.ResponseWriter, req *http.Request, user userWithEmail, sectionName string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", 500)
+		return
+	}
+
+	events, cancel := env.ds.SubscribeProofEvents(sectionName)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise hold events back
+	w.WriteHeader(200)
+	io.WriteString(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sectionEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-shuttingDown:
+			return // the client reconnects to the restarted server
+
+		case event, open := <-events:
+			if !open {
+				return // dropped by the hub for falling behind
+			}
+			eventJSON, err := json.Marshal(event)
+			if err != nil {
+				logger.ErrorContext(req.Context(), "streamSectionEvents: json marshal error", "error", err)
+				return
+			}
+			fmt.Fprintf(w, "event: proof\ndata: %s\n\n", eventJSON)
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			// a TA removed from the roster loses an open stream too
+			if ok, err := env.isSectionStaff(user, sectionName); err != nil || !ok {
+				return
+			}
+			io.WriteString(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// legacy route: /section-events?sectionName=
+func (env *Env) sectionEvents(w http.ResponseWriter, req *http.Request) {
+	user := req.Context().Value("tok").(userWithEmail)
+	sectionName := req.URL.Query().Get("sectionName")
+
+	if req.Method != "GET" || sectionName == "" {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	if ok, err := env.isSectionStaff(user, sectionName); err != nil {
+		http.Error(w, "db access error", 500)
+		logger.ErrorContext(req.Context(), "sectionEvents: db access error", "error", err)
+		return
+	} else if !ok {
+		http.Error(w, "Insufficient privileges", 403)
+		return
+	}
+
+	env.streamSectionEvents(w, req, user, sectionName)
+}
+
+func (env *Env) apiSectionEvents(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	user := req.Context().Value("tok").(userWithEmail)
+	env.streamSectionEvents(w, req, user, params["section"])
+}
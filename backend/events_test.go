@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"datastore"
+)
+
+func TestSectionEventsStream(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	student := "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor, Admin: 1})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["`+student+`"]}`), 200, "")
+
+	// students cannot watch their classmates
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/sections/Logic/events", ""), 403, errCodeForbidden)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), "tok", MockUserWithEmail{instructor})
+		api.ServeHTTP(w, req.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+apiV1Prefix+"/sections/Logic/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", ct)
+	}
+
+	// the subscription exists once the first bytes have arrived
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("unexpected stream start %q, %v", line, err)
+	}
+
+	err = env.ds.Store(datastore.Proof{EntryType: "proof", UserSubmitted: student, ProofName: "Repository - One", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{`[{"wffstr":"P","jstr":"Pr"}]`}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the event: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event datastore.ProofEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatal(err)
+		}
+		want := datastore.ProofEvent{SectionName: "Logic", Student: student, ProofName: "Repository - One", ProofCompleted: "false", LineCount: 1}
+		if event != want {
+			t.Errorf("got event %+v want %+v", event, want)
+		}
+		return
+	}
+}
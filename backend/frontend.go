@@ -0,0 +1,220 @@
+package main
+
+// Serving the frontend
+//
+// In production nginx serves frontend/ and proxies /backend/ here. With
+// -frontend the backend serves the site itself, either the copy embedded
+// at build time (-frontend embed) or a directory read on every request
+// (-frontend ../frontend, for development), and answers its own routes under
+// /backend/ as well, so one binary runs the whole app.
+//
+// Text files are gzipped for clients that accept it. Files under assets/
+// (libraries and images) are cached for a day; pages and scripts carry an
+// ETag and are revalidated on every load, since their URLs are not
+// versioned. PHP endpoints are answered by their Go equivalents where one
+// exists and with 501 otherwise; PHP source is never served.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"frontend"
+)
+
+// extensions of the files that make up the site; anything else in the
+// frontend directory (PHP, composer files, backups) is not served
+var frontendTypes = map[string]bool{
+	".html": true, ".css": true, ".js": true, ".map": true,
+	".png": true, ".gif": true, ".jpg": true, ".svg": true, ".ico": true,
+}
+
+// content types worth compressing; the images are compressed already
+var compressibleTypes = map[string]bool{
+	".html": true, ".css": true, ".js": true, ".map": true, ".svg": true,
+}
+
+// a frontend file ready to serve
+type staticFile struct {
+	content []byte
+	gzipped []byte // nil if not worth compressing
+	etag    string // quoted hash of content
+}
+
+type frontendHandler struct {
+	files     fs.FS
+	immutable bool                    // embedded files never change, so prepared files are kept
+	php       map[string]http.Handler // PHP endpoints with a Go equivalent, by path
+	prepared  sync.Map                // path -> *staticFile, when immutable
+}
+
+// frontend files for the -frontend flag: "embed" or a directory
+func frontendFiles(source string) (fs.FS, bool, error) {
+	if source == "embed" {
+		return frontend.Files, true, nil
+	}
+	if info, err := os.Stat(source); err != nil {
+		return nil, false, err
+	} else if !info.IsDir() {
+		return nil, false, &fs.PathError{Op: "open", Path: source, Err: fs.ErrInvalid}
+	}
+	return os.DirFS(source), false, nil
+}
+
+// PHP endpoints of frontend/ that are answered by Go handlers
+func (env *Env) phpRoutes() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/checkproof.php": http.HandlerFunc(env.checkProof),
+	}
+}
+
+func (env *Env) newFrontendHandler(files fs.FS, immutable bool) *frontendHandler {
+	return &frontendHandler{files: files, immutable: immutable, php: env.phpRoutes()}
+}
+
+// commit the binary was built from, shown as the site version
+func siteVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "development"
+}
+
+// read a file and prepare its ETag and compressed form
+func (h *frontendHandler) open(name string) (*staticFile, error) {
+	if cached, ok := h.prepared.Load(name); ok {
+		return cached.(*staticFile), nil
+	}
+
+	content, err := fs.ReadFile(h.files, name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "index.html" {
+		// the deploy hook stamps the page the same way
+		content = bytes.ReplaceAll(content, []byte("GIT_VERSION_TAG"), []byte(siteVersion()))
+	}
+
+	hash := sha256.Sum256(content)
+	file := &staticFile{content: content, etag: `"` + hex.EncodeToString(hash[:8]) + `"`}
+	if compressibleTypes[path.Ext(name)] {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(content)
+		zw.Close()
+		if buf.Len() < len(content) {
+			file.gzipped = buf.Bytes()
+		}
+	}
+
+	if h.immutable {
+		h.prepared.Store(name, file)
+	}
+	return file, nil
+}
+
+func (h *frontendHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	urlPath := path.Clean("/" + req.URL.Path)
+	if handler, ok := h.php[urlPath]; ok {
+		handler.ServeHTTP(w, req)
+		return
+	}
+	if path.Ext(urlPath) == ".php" {
+		http.Error(w, "Not available when the backend serves the frontend.", 501)
+		return
+	}
+
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed.", 405)
+		return
+	}
+
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" || strings.HasSuffix(req.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	if !frontendTypes[path.Ext(name)] {
+		http.NotFound(w, req)
+		return
+	}
+	file, err := h.open(name)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	if strings.HasPrefix(name, "assets/") {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	content, etag := file.content, file.etag
+	if file.gzipped != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(req) {
+			w.Header().Set("Content-Encoding", "gzip")
+			content, etag = file.gzipped, strings.TrimSuffix(etag, `"`)+`-gz"`
+		}
+	}
+	w.Header().Set("ETag", etag)
+
+	// ServeContent answers If-None-Match and Range requests from the ETag
+	http.ServeContent(w, req, name, time.Time{}, bytes.NewReader(content))
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(encoding, "gzip") {
+			return strings.TrimSpace(params) != "q=0"
+		}
+	}
+	return false
+}
+
+// the whole app on one listener: the site at / and the backend routes under
+// /backend/, as nginx arranges them in production
+func siteMux(frontendHandler http.Handler, backend http.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/backend/", underPrefix("/backend", backend))
+	mux.Handle("/", frontendHandler)
+	return mux
+}
+
+// serve next under prefix the way nginx does: /backend/proofs reaches the
+// /proofs route, and is counted in the metrics as /proofs
+func underPrefix(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stripped := new(http.Request)
+		*stripped = *req
+		stripped.URL = new(url.URL)
+		*stripped.URL = *req.URL
+		stripped.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		stripped.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
+
+		next.ServeHTTP(w, stripped)
+		if label, ok := req.Context().Value(routeKey{}).(*routeLabel); ok && label.pattern == "" {
+			label.pattern = stripped.Pattern // unless a /api/v1 route set a finer one
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFrontendHandler(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<p>Site Version: GIT_VERSION_TAG</p>" + strings.Repeat("<p>proof</p>", 100))},
+		"assets/applogo.png":   {Data: []byte("\x89PNG")},
+		"checkproof.php":       {Data: []byte("<?php secret ?>")},
+		"other.php":            {Data: []byte("<?php secret ?>")},
+		"composer.json":        {Data: []byte("{}")},
+		"assets/lib/notes.txt": {Data: []byte("not part of the site")},
+	}
+	handler := newTestEnv(t).newFrontendHandler(files, true)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the page is gzipped, stamped with the version, and revalidated
+	rr := get("/", http.Header{"Accept-Encoding": {"br, gzip"}})
+	if rr.Code != 200 || rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("got %v %v", rr.Code, rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(zr)
+	if strings.Contains(string(page), "GIT_VERSION_TAG") || !strings.Contains(string(page), "Site Version: ") {
+		t.Errorf("version tag not replaced: %.60s", page)
+	}
+
+	// a matching ETag gets 304, per encoding
+	etag := rr.Header().Get("ETag")
+	if rr := get("/index.html", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {etag}}); rr.Code != 304 {
+		t.Errorf("got %v for a current ETag", rr.Code)
+	}
+	if rr := get("/index.html", http.Header{"If-None-Match": {etag}}); rr.Code != 200 || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("got %v %v for the gzip ETag without gzip", rr.Code, rr.Header())
+	}
+
+	// assets are cached and not compressed again
+	rr = get("/assets/applogo.png", http.Header{"Accept-Encoding": {"gzip"}})
+	if rr.Code != 200 || rr.Header().Get("Content-Encoding") != "" || !strings.Contains(rr.Header().Get("Cache-Control"), "max-age") {
+		t.Errorf("got %v %v for an asset", rr.Code, rr.Header())
+	}
+
+	// PHP with a Go equivalent, PHP without one, and files outside the site
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/checkproof.php", nil))
+	if rr.Code != 200 || strings.Contains(rr.Body.String(), "secret") {
+		t.Errorf("got %v %q for ported PHP", rr.Code, rr.Body.String())
+	}
+	if rr := get("/other.php", nil); rr.Code != 501 || strings.Contains(rr.Body.String(), "secret") {
+		t.Errorf("got %v %q for unported PHP", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/composer.json", "/assets/lib/notes.txt", "/missing.js", "/../index.html.bak"} {
+		if rr := get(path, nil); rr.Code != 404 {
+			t.Errorf("got %v for %s", rr.Code, path)
+		}
+	}
+}
+
+func TestSiteMux(t *testing.T) {
+	backend := http.NewServeMux()
+	backend.HandleFunc("/admins", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.URL.Path)
+	})
+	site := withMetrics(siteMux(http.NotFoundHandler(), backend))
+
+	rr := httptest.NewRecorder()
+	site.ServeHTTP(rr, httptest.NewRequest("GET", "/backend/admins", nil))
+	if rr.Body.String() != "/admins" {
+		t.Errorf("backend route saw path %q", rr.Body.String())
+	}
+	if metrics := scrapeMetrics(t, newTestEnv(t)); !strings.Contains(metrics, `route="/admins"`) {
+		t.Error("request under /backend/ not labelled with its route")
+	}
+}
+
+// the embedded site has what the page loads, and no PHP
+func TestEmbeddedFrontend(t *testing.T) {
+	files, _, err := frontendFiles("embed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "index.js", "proofs.js", "syntax.js", "assets/lib/jquery.min.js"} {
+		if _, err := fs.Stat(files, name); err != nil {
+			t.Errorf("embedded frontend is missing %s", name)
+		}
+	}
+	if _, err := fs.Stat(files, "checkproof.php"); err == nil {
+		t.Error("PHP source is embedded")
+	}
+}
@@ -1,15 +1,32 @@
 module backend
 
-go 1.17
+go 1.25.0
 
 replace (
 	datastore => ./datastore
+	frontend => ../frontend
 	google-token-auth => ./google-token-auth
+	logging => ./logging
+	proofcheck => ./proofcheck
 )
 
 require (
 	datastore v0.0.0-00010101000000-000000000000
+	frontend v0.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.24.1
 	google-token-auth v0.0.0-00010101000000-000000000000
+	logging v0.0.0-00010101000000-000000000000
+	proofcheck v0.0.0-00010101000000-000000000000
 )
 
-require github.com/mattn/go-sqlite3 v1.14.13 // indirect
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.13 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.70.1 // indirect
+	github.com/prometheus/procfs v0.21.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
@@ -1,3 +1,7 @@
 module google-token-auth
 
-go 1.14
+go 1.21
+
+replace logging => ../logging
+
+require logging v0.0.0-00010101000000-000000000000
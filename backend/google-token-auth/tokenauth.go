@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"logging"
 )
 
+var logger = logging.New("tokenauth")
+
 type TokenData struct {
 	Iss               string // "accounts.google.com"
 	Azp               string
@@ -57,8 +62,52 @@ var (
 		sync.RWMutex
 		val map[string]*cachedTokenData
 	}{val: make(map[string]*cachedTokenData)}
+
+	// counters behind Stats
+	cacheHits, cacheMisses            atomic.Uint64
+	tokeninfoCalls, tokeninfoFailures atomic.Uint64
+
+	// error of the last tokeninfo request if Google could not be reached; nil after a success
+	tokeninfoUnreachable atomic.Pointer[error]
 )
 
+// Stats counts token verifications since server start, for monitoring
+type Stats struct {
+	CacheHits         uint64
+	CacheMisses       uint64
+	CacheSize         int    // tokens currently cached
+	TokeninfoCalls    uint64 // requests sent to Google's tokeninfo endpoint
+	TokeninfoFailures uint64 // requests that failed or were answered with an error status
+}
+
+func CurrentStats() Stats {
+	token_cache.RLock()
+	size := len(token_cache.val)
+	token_cache.RUnlock()
+
+	return Stats{
+		CacheHits:         cacheHits.Load(),
+		CacheMisses:       cacheMisses.Load(),
+		CacheSize:         size,
+		TokeninfoCalls:    tokeninfoCalls.Load(),
+		TokeninfoFailures: tokeninfoFailures.Load(),
+	}
+}
+
+// Check reports whether tokens can currently be verified: the authorized
+// domains and client IDs are set and the last tokeninfo request reached
+// Google. It makes no request itself, so it is cheap enough for a
+// readiness probe.
+func Check() error {
+	if len(authorized_domains) == 0 || len(authorized_client_ids) == 0 {
+		return errors.New("authorized domains and client IDs not set")
+	}
+	if err := tokeninfoUnreachable.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
 // This should be called once, during server start.
 func SetAuthorizedDomains(domains []string) {
 	for _, domain := range domains {
@@ -84,7 +133,7 @@ func Verify(token string) (TokenData, bool) {
 
 	tok, err := decodeByApi(token)
 	if err != nil {
-		log.Println("token decode error", err)
+		logger.Warn("token decode error", "error", redactURL(err))
 		return tok, false
 	}
 
@@ -98,17 +147,23 @@ func Verify(token string) (TokenData, bool) {
 // Middleware to validate a Google-issued JWT before processing the request
 // Assumes the request is NOT cross-origin, and so does not send CORS headers
 func WithValidToken(next http.Handler) http.Handler {
+	return WithValidTokenOr(next, func(w http.ResponseWriter, req *http.Request, msg string) {
+		http.Error(w, msg, 401)
+	})
+}
+
+// Same as WithValidToken, but unauthorized requests are answered by reject
+// so callers can choose the format of the 401 response
+func WithValidTokenOr(next http.Handler, reject func(w http.ResponseWriter, req *http.Request, msg string)) http.Handler {
 	return http.HandlerFunc(func (w http.ResponseWriter, req *http.Request) {
 		if req.Method == "POST" && req.Body == nil {
-			http.Error(w, "Request not authorized.", 401);
+			reject(w, req, "Request not authorized.")
 			return
 		}
 
-		// log.Println(req.Header.Get("X-Auth-Token"))
-		
 		tok, valid := Verify(req.Header.Get("X-Auth-Token"))
 		if !valid {
-			http.Error(w, "Token not valid.", 401)
+			reject(w, req, "Token not valid.")
 			return
 		}
 
@@ -124,8 +179,10 @@ func getFromCache(token string) (*cachedTokenData, error) {
 
 	tok, found := token_cache.val[token]
 	if !found {
+		cacheMisses.Add(1)
 		return &cachedTokenData{}, errors.New("Not found")
 	}
+	cacheHits.Add(1)
 	return tok, nil
 }
 
@@ -150,18 +207,28 @@ func init() {
 
 // Remove expired tokens from the cache
 func pruneCache() {
-	log.Println("Cache prune started")
+	logger.Debug("cache prune started")
 	token_cache.Lock()
 	defer token_cache.Unlock()
 
+	removed := 0
 	for token, cached_token := range token_cache.val {
 		if time.Now().After(time.Unix(cached_token.data.Exp, 0)) {
-			log.Printf("Removing expired token: +%v", cached_token.data)
+			logger.Debug("removing expired token", logging.Email("user", cached_token.data.Email))
 			delete(token_cache.val, token)
-		} else {
-			log.Printf("Keeping unexpired token: %+v", cached_token.data)
+			removed++
 		}
 	}
+	logger.Info("cache pruned", "removed", removed, "kept", len(token_cache.val))
+}
+
+// the tokeninfo URL in a client error contains the token itself
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
 }
 
 // Use the Google OAUTH2 API to verify the token's signature and
@@ -170,13 +237,23 @@ func decodeByApi(token string) (TokenData, error) {
 	var data TokenData
 	var client = &http.Client{Timeout: 5 * time.Second}
 
+	tokeninfoCalls.Add(1)
 	response, err := client.Get("https://oauth2.googleapis.com/tokeninfo?id_token=" + token)
 	if err != nil {
+		tokeninfoFailures.Add(1)
+		err = redactURL(err)
+		tokeninfoUnreachable.Store(&err)
 		return data, err
 	}
 	defer response.Body.Close()
+	tokeninfoUnreachable.Store(nil)
 
+	// invalid tokens are answered with 400; their error body still decodes
+	if response.StatusCode != 200 {
+		tokeninfoFailures.Add(1)
+	}
 	if err = json.NewDecoder(response.Body).Decode(&data); err != nil {
+		tokeninfoFailures.Add(1)
 		return data, err
 	}
 
@@ -189,26 +266,26 @@ func decodeByApi(token string) (TokenData, error) {
 func isValid(td TokenData) bool {
 	// Validate domain
 	if !authorized_domains[td.Hd] {
-		log.Printf("Unauthorized domain: %#v", td.Hd)
+		logger.Info("token rejected: unauthorized domain", "domain", td.Hd)
 		return false
 	}
 
 	// Validate Aud(ience)
 	if !authorized_client_ids[td.Aud] {
-		log.Printf("Unauthorized client ID: %#v", td.Aud)
+		logger.Info("token rejected: unauthorized client ID", "aud", td.Aud)
 		return false
 	}
 
 	// Validate Iss(uer)
 	if !authorized_issuers[td.Iss] {
-		log.Printf("Unauthorized issuer: %#v", td.Iss)
+		logger.Info("token rejected: unauthorized issuer", "iss", td.Iss)
 		return false
 	}
 
 	// Validate Exp(iration)
 	expTime := time.Unix(td.Exp, 0)
 	if time.Now().After(expTime) {
-		log.Printf("Expired token")
+		logger.Info("token rejected: expired", logging.Email("user", td.Email))
 		return false
 	}
 
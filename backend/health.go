@@ -0,0 +1,111 @@
+package main
+
+// Health checks and shutdown
+//
+// /healthz answers 200 while the process serves requests at all; /readyz
+// answers 200 only when the database can be read and tokens can be
+// verified, and 503 otherwise, e.g. while the server is shutting down. Both
+// are public and served on the main and the admin listener.
+//
+// On SIGINT or SIGTERM the server stops accepting connections, ends open
+// event streams, waits up to -shutdown-timeout for the other requests in
+// flight, and then closes the datastore, which checkpoints the WAL.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"google-token-auth"
+)
+
+// time allowed to each readiness check
+const readinessTimeout = 2 * time.Second
+
+var (
+	// closed when shutdown begins; long-lived handlers return on it
+	shuttingDown     = make(chan struct{})
+	beginShutdownOne sync.Once
+)
+
+func beginShutdown() {
+	beginShutdownOne.Do(func() { close(shuttingDown) })
+}
+
+func isShuttingDown() bool {
+	select {
+	case <-shuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`           // "ok" or "unavailable"
+	Checks map[string]string `json:"checks,omitempty"` // check name -> "ok" or the error
+}
+
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// liveness: the process is up and serving
+func healthz(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, 200, healthResponse{Status: "ok"})
+}
+
+// readiness: the database answers and tokens can be verified
+func (env *Env) readyz(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]error{
+		"database": env.ds.Ping(ctx),
+		"tokens":   tokenauth.Check(),
+	}
+	if isShuttingDown() {
+		checks["server"] = errors.New("shutting down")
+	}
+
+	response := healthResponse{Status: "ok", Checks: map[string]string{}}
+	status := 200
+	for name, err := range checks {
+		if err != nil {
+			logger.WarnContext(req.Context(), "readyz: check failed", "check", name, "error", err)
+			response.Checks[name] = err.Error()
+			response.Status = "unavailable"
+			status = 503
+		} else {
+			response.Checks[name] = "ok"
+		}
+	}
+	writeHealth(w, status, response)
+}
+
+// stop the servers gracefully, giving requests in flight until timeout
+func shutdownServers(timeout time.Duration, servers ...*http.Server) {
+	beginShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				logger.Warn("shutdown: requests still in flight were cut off", "addr", server.Addr, "error", err)
+				server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+}
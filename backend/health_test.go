@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google-token-auth"
+)
+
+func getReadyz(t *testing.T, env *Env) (int, healthResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	env.readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	var response healthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("readyz answered %s", rr.Body.String())
+	}
+	return rr.Code, response
+}
+
+func TestReadyz(t *testing.T) {
+	env := newTestEnv(t)
+	tokenauth.SetAuthorizedDomains(authorized_domains)
+	tokenauth.SetAuthorizedClientIds(authorized_client_ids)
+
+	if status, response := getReadyz(t, env); status != 200 || response.Checks["database"] != "ok" || response.Checks["tokens"] != "ok" {
+		t.Errorf("got %v %+v want ready", status, response)
+	}
+
+	// no new work once shutdown has begun
+	beginShutdown()
+	t.Cleanup(func() {
+		shuttingDown = make(chan struct{})
+		beginShutdownOne = sync.Once{}
+	})
+	if status, response := getReadyz(t, env); status != 503 || response.Checks["server"] == "" {
+		t.Errorf("got %v %+v while shutting down", status, response)
+	}
+
+	env.ds.Close()
+	if status, response := getReadyz(t, env); status != 503 || response.Checks["database"] == "ok" {
+		t.Errorf("got %v %+v with the database closed", status, response)
+	}
+
+	rr := httptest.NewRecorder()
+	healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != 200 {
+		t.Errorf("healthz answered %v", rr.Code)
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	t.Cleanup(func() {
+		shuttingDown = make(chan struct{})
+		beginShutdownOne = sync.Once{}
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan bool)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	go server.Serve(listener)
+
+	result := make(chan error)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err == nil {
+			response.Body.Close()
+		}
+		result <- err
+	}()
+
+	<-started
+	shutdownServers(5*time.Second, server)
+	if err := <-result; err != nil {
+		t.Errorf("request in flight was cut off: %v", err)
+	}
+	if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
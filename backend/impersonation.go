@@ -0,0 +1,176 @@
+package main
+
+// Impersonation ("view as student")
+//
+// An admin helping a student who says a problem will not load can see
+// exactly what the student sees. POST /impersonations starts a session for
+// a student on the roster of a section; requests the admin sends with the
+// header X-Impersonate: <session id> are then handled as the student's, by
+// replacing the "tok" context value, and answered with X-Impersonating:
+// <student>. Sessions are read-only: only GET and HEAD, and the legacy
+// POST routes that read (impersonationReadPaths), are let through. They end
+// after impersonationTTL or with DELETE /impersonations/{session}. Starting
+// and ending a session, and every request made in one, are logged; starting
+// and ending it are also audited.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"datastore"
+	"logging"
+)
+
+const (
+	impersonateHeader   = "X-Impersonate"
+	impersonatingHeader = "X-Impersonating"
+	impersonationTTL    = 30 * time.Minute
+)
+
+// legacy routes that read with POST
+var impersonationReadPaths = map[string]bool{"/proofs": true, "/checkproof.php": true}
+
+type impersonationSession struct {
+	Id        string `json:"id"` // send as X-Impersonate
+	Admin     string `json:"admin"`
+	Student   string `json:"student"`
+	ExpiresAt string `json:"expiresAt"` // datastore.TimeFormat, UTC
+	expires   time.Time
+}
+
+type apiImpersonationRequest struct {
+	Student string `json:"student"`
+}
+
+// the student an impersonated request is handled as
+type impersonatedUser struct {
+	email string
+	admin string
+}
+
+func (u impersonatedUser) GetEmail() string { return u.email }
+
+// the open sessions, by id
+var impersonations = struct {
+	sync.Mutex
+	sessions map[string]*impersonationSession
+}{sessions: map[string]*impersonationSession{}}
+
+// the open session id of admin, or nil
+func impersonationFor(id string, admin string, now time.Time) *impersonationSession {
+	impersonations.Lock()
+	defer impersonations.Unlock()
+	for key, session := range impersonations.sessions {
+		if now.After(session.expires) {
+			delete(impersonations.sessions, key)
+		}
+	}
+	session := impersonations.sessions[id]
+	if session == nil || session.Admin != admin {
+		return nil
+	}
+	return session
+}
+
+// handle requests carrying X-Impersonate as the impersonated student
+func (env *Env) withImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(impersonateHeader)
+		if id == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		admin := req.Context().Value("tok").(userWithEmail).GetEmail()
+		session := impersonationFor(id, admin, time.Now())
+		if session == nil {
+			writeAPIError(w, 403, errCodeForbidden, "no such impersonation session")
+			return
+		}
+		if req.Method != "GET" && req.Method != "HEAD" && !impersonationReadPaths[req.URL.Path] {
+			writeAPIError(w, 403, errCodeForbidden, "impersonation sessions are read-only")
+			return
+		}
+		logger.InfoContext(req.Context(), "impersonated request", logging.Email("admin", admin), logging.Email("student", session.Student),
+			"method", req.Method, "path", req.URL.Path)
+		w.Header().Set(impersonatingHeader, session.Student)
+		ctx := context.WithValue(req.Context(), "tok", impersonatedUser{email: session.Student, admin: admin})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// whether email is a student on the roster of a current section
+func (env *Env) isRosteredStudent(email string) (bool, error) {
+	sections, err := env.ds.GetSections(email)
+	if err != nil {
+		return false, err
+	}
+	for _, section := range sections {
+		role, err := env.ds.GetRole(section.Name, email)
+		if err != nil {
+			return false, err
+		}
+		if role == "student" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (env *Env) apiStartImpersonation(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	if !admin_users[user.GetEmail()] {
+		writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+		return
+	}
+	var requestData apiImpersonationRequest
+	if !decodeAPIBody(w, req, &requestData) {
+		return
+	}
+	rostered, err := env.isRosteredStudent(requestData.Student)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if !rostered {
+		writeAPIError(w, 404, errCodeNotFound, "no such student on the roster of a section")
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		logger.ErrorContext(req.Context(), "apiStartImpersonation: generating a session id failed", "error", err)
+		writeAPIError(w, 500, errCodeInternal, "could not start an impersonation session")
+		return
+	}
+	expires := time.Now().Add(impersonationTTL).UTC()
+	session := &impersonationSession{Id: hex.EncodeToString(id), Admin: user.GetEmail(), Student: requestData.Student,
+		ExpiresAt: expires.Format(datastore.TimeFormat), expires: expires}
+	impersonations.Lock()
+	impersonations.sessions[session.Id] = session
+	impersonations.Unlock()
+
+	env.audit(req, "impersonation.start", "", session.Student, nil, map[string]string{"expiresAt": session.ExpiresAt})
+	logger.InfoContext(req.Context(), "impersonation started", logging.Email("admin", session.Admin), logging.Email("student", session.Student),
+		"expiresAt", session.ExpiresAt)
+	writeAPIJSON(w, 201, session)
+}
+
+func (env *Env) apiEndImpersonation(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	session := impersonationFor(params["session"], user.GetEmail(), time.Now())
+	if session == nil {
+		writeAPIError(w, 404, errCodeNotFound, "no such impersonation session")
+		return
+	}
+	impersonations.Lock()
+	delete(impersonations.sessions, session.Id)
+	impersonations.Unlock()
+
+	env.audit(req, "impersonation.end", "", session.Student, map[string]string{"expiresAt": session.ExpiresAt}, nil)
+	logger.InfoContext(req.Context(), "impersonation ended", logging.Email("admin", session.Admin), logging.Email("student", session.Student))
+	w.WriteHeader(204)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+// send a request in an impersonation session
+func impersonatedRequest(t *testing.T, handler http.Handler, email string, session string, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), "tok", MockUserWithEmail{email})
+	req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(impersonateHeader, session)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestImpersonation(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.withImpersonation(env.apiV1())
+	admin, instructor, student := "cohunter@csumb.edu", "instructor@csumb.edu", "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	proof := datastore.Proof{EntryType: "proof", UserSubmitted: student, ProofName: "Student proof", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P", RepoProblem: "false"}
+	if err := env.ds.Store(proof); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/impersonations", `{"student":"student@csumb.edu"}`), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, admin, "POST", "/impersonations", `{"student":"instructor@csumb.edu"}`), 404, errCodeNotFound)
+	rr := apiRequest(t, api, admin, "POST", "/impersonations", `{"student":"student@csumb.edu"}`)
+	expectAPIStatus(t, rr, 201, "")
+	var session impersonationSession
+	json.Unmarshal(rr.Body.Bytes(), &session)
+
+	rr = impersonatedRequest(t, api, admin, session.Id, "GET", apiV1Prefix+"/proofs?selection=user", "")
+	expectAPIStatus(t, rr, 200, "")
+	if rr.Header().Get(impersonatingHeader) != student || !strings.Contains(rr.Body.String(), "Student proof") {
+		t.Errorf("impersonated listing: %v %s", rr.Header(), rr.Body.String())
+	}
+	// the legacy route reads with POST
+	legacy := env.withImpersonation(http.HandlerFunc(env.getProofs))
+	rr = impersonatedRequest(t, legacy, admin, session.Id, "POST", "/proofs", `{"selection":"user"}`)
+	if rr.Code != 200 || !strings.Contains(rr.Body.String(), "Student proof") {
+		t.Errorf("impersonated legacy listing: %d %s", rr.Code, rr.Body.String())
+	}
+
+	expectAPIStatus(t, impersonatedRequest(t, api, admin, session.Id, "POST", apiV1Prefix+"/proofs", `{"ProofName":"x"}`), 403, errCodeForbidden)
+	expectAPIStatus(t, impersonatedRequest(t, api, "gbruns@csumb.edu", session.Id, "GET", apiV1Prefix+"/proofs?selection=user", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, impersonatedRequest(t, api, admin, "nonsense", "GET", apiV1Prefix+"/proofs?selection=user", ""), 403, errCodeForbidden)
+
+	expectAPIStatus(t, apiRequest(t, api, "gbruns@csumb.edu", "DELETE", "/impersonations/"+session.Id, ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, admin, "DELETE", "/impersonations/"+session.Id, ""), 204, "")
+	expectAPIStatus(t, impersonatedRequest(t, api, admin, session.Id, "GET", apiV1Prefix+"/proofs?selection=user", ""), 403, errCodeForbidden)
+}
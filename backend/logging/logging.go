@@ -0,0 +1,185 @@
+// Package logging writes leveled, structured log lines (one JSON object per
+// line) for the backend and its modules.
+//
+// Each package gets its own logger from New, and its minimum level can be
+// set separately, e.g. "info,datastore=debug,tokenauth=warn". Log records
+// written with a request context carry the request ID set by the backend's
+// middleware. User emails are logged only through Email, which hashes or
+// redacts them; proof bodies and token data must never be logged at info
+// level or above.
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	mu       sync.RWMutex
+	root     slog.Handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	defaults              = new(slog.LevelVar) // level of packages without their own
+	levels                = map[string]*slog.LevelVar{}
+
+	emailMode = "hash"
+	emailKey  = randomKey()
+)
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// send every package's log lines as JSON to w
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	root = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+// set the minimum level of one package; "" sets the default of all others
+func SetLevel(pkg string, level slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	if pkg == "" {
+		defaults.Set(level)
+		return
+	}
+	if levels[pkg] == nil {
+		levels[pkg] = new(slog.LevelVar)
+	}
+	levels[pkg].Set(level)
+}
+
+// apply a level list such as "info,datastore=debug,tokenauth=warn";
+// an entry without a package sets the default level
+func SetLevels(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, name := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			pkg, name = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("log level %q: %w", entry, err)
+		}
+		SetLevel(pkg, level)
+	}
+	return nil
+}
+
+func levelOf(pkg string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	if level, found := levels[pkg]; found {
+		return level.Level()
+	}
+	return defaults.Level()
+}
+
+// "hash" (default) logs a keyed hash of each email so lines about one user
+// can be correlated; "redact" leaves emails out entirely
+func SetEmailMode(mode string) error {
+	if mode != "hash" && mode != "redact" {
+		return fmt.Errorf("email log mode must be hash or redact, not %q", mode)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	emailMode = mode
+	return nil
+}
+
+// key for email hashes; without one a random key is used, so hashes only
+// match within one run of the server
+func SetEmailKey(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+	emailKey = []byte(key)
+}
+
+// attribute for a user email that is safe to log
+func Email(key string, email string) slog.Attr {
+	mu.RLock()
+	defer mu.RUnlock()
+	if email == "" {
+		return slog.String(key, "")
+	}
+	if emailMode == "redact" {
+		return slog.String(key, "[redacted]")
+	}
+	mac := hmac.New(sha256.New, emailKey)
+	io.WriteString(mac, strings.ToLower(email))
+	return slog.String(key, "u_"+hex.EncodeToString(mac.Sum(nil))[:12])
+}
+
+type requestIDKey struct{}
+
+// context carrying the ID of the request being served
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// ID of the request being served, "" outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logger for one package; records carry "pkg" and are filtered by its level
+func New(pkg string) *slog.Logger {
+	return slog.New(&pkgHandler{pkg: pkg})
+}
+
+// passes records of one package on to the current root handler
+type pkgHandler struct {
+	pkg    string
+	extend []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, in order
+}
+
+func (h *pkgHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= levelOf(h.pkg)
+}
+
+func (h *pkgHandler) Handle(ctx context.Context, record slog.Record) error {
+	mu.RLock()
+	next := root
+	mu.RUnlock()
+
+	next = next.WithAttrs([]slog.Attr{slog.String("pkg", h.pkg)})
+	for _, extend := range h.extend {
+		next = extend(next)
+	}
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+	}
+	return next.Handle(ctx, record)
+}
+
+func (h *pkgHandler) with(extend func(slog.Handler) slog.Handler) *pkgHandler {
+	return &pkgHandler{pkg: h.pkg, extend: append(h.extend[:len(h.extend):len(h.extend)], extend)}
+}
+
+func (h *pkgHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *pkgHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capture log lines of the test and restore the package state afterwards
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	t.Cleanup(func() {
+		SetOutput(os.Stderr)
+		mu.Lock()
+		levels = map[string]*slog.LevelVar{}
+		defaults.Set(slog.LevelInfo)
+		emailMode = "hash"
+		mu.Unlock()
+	})
+	return &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestPackageLevels(t *testing.T) {
+	buf := captureLogs(t)
+	if err := SetLevels("warn, datastore=debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	New("datastore").Debug("kept")
+	New("backend").Info("dropped")
+	New("backend").Warn("kept")
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 2 || lines[0]["pkg"] != "datastore" || lines[1]["pkg"] != "backend" {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+
+	if err := SetLevels("datastore=loud"); err == nil {
+		t.Error("bad level accepted")
+	}
+}
+
+func TestRequestIDAndEmail(t *testing.T) {
+	buf := captureLogs(t)
+	SetEmailKey("test key")
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	New("backend").With("route", "/proofs").InfoContext(ctx, "saved", Email("user", "Student@csumb.edu"))
+	New("backend").Info("saved", Email("user", "student@csumb.edu"))
+
+	lines := decodeLines(t, buf)
+	if lines[0]["request_id"] != "abc123" || lines[0]["route"] != "/proofs" {
+		t.Errorf("unexpected line: %v", lines[0])
+	}
+	if _, found := lines[1]["request_id"]; found {
+		t.Errorf("request_id without a request: %v", lines[1])
+	}
+	hash, _ := lines[0]["user"].(string)
+	if !strings.HasPrefix(hash, "u_") || strings.Contains(buf.String(), "csumb.edu") {
+		t.Errorf("email not hashed: %s", buf.String())
+	}
+	if lines[1]["user"] != hash {
+		t.Errorf("hashes of one email differ: %v %v", lines[1]["user"], hash)
+	}
+
+	SetEmailMode("redact")
+	if attr := Email("user", "student@csumb.edu"); attr.Value.String() != "[redacted]" {
+		t.Errorf("got %v", attr)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+// Prometheus metrics
+//
+// /metrics is served on a separate admin listener (-admin-addr, loopback by
+// default) that nginx does not proxy, so it is reachable only from the host.
+// Requests are labelled by route pattern rather than raw path, so emails and
+// section names in URLs never become label values.
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"datastore"
+	"google-token-auth"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "proofchecker"
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "http_requests_total",
+		Help: "HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	datastoreCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "datastore_call_duration_seconds",
+		Help:    "Latency of datastore calls by IProofStore method.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to ~4s
+	}, []string{"method"})
+
+	datastoreCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "datastore_call_errors_total",
+		Help: "Datastore calls that returned an error, by IProofStore method.",
+	}, []string{"method"})
+
+	proofsStored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "proofs_stored_total",
+		Help: "Proofs and arguments saved, by entry type.",
+	}, []string{"entry_type"})
+
+	proofsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "proofs_completed_total",
+		Help: "Proofs saved as completed.",
+	})
+
+	lastSnapshot = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Name: "last_snapshot_timestamp_seconds",
+		Help: "Unix time of the last database snapshot this process took.",
+	})
+
+	snapshotFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "snapshot_failures_total",
+		Help: "Scheduled database snapshots that failed.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpRequestDuration,
+		datastoreCallDuration, datastoreCallErrors,
+		proofsStored, proofsCompleted,
+		lastSnapshot, snapshotFailures,
+		tokenauthCollector{},
+	)
+}
+
+var (
+	tokenCacheHitsDesc = prometheus.NewDesc(metricsNamespace+"_token_cache_hits_total",
+		"Token verifications answered from the token cache.", nil, nil)
+	tokenCacheMissesDesc = prometheus.NewDesc(metricsNamespace+"_token_cache_misses_total",
+		"Token verifications not found in the token cache.", nil, nil)
+	tokenCacheSizeDesc = prometheus.NewDesc(metricsNamespace+"_token_cache_size",
+		"Tokens currently in the token cache.", nil, nil)
+	tokeninfoCallsDesc = prometheus.NewDesc(metricsNamespace+"_tokeninfo_requests_total",
+		"Requests sent to Google's tokeninfo endpoint.", nil, nil)
+	tokeninfoFailuresDesc = prometheus.NewDesc(metricsNamespace+"_tokeninfo_failures_total",
+		"tokeninfo requests that failed or were answered with an error status.", nil, nil)
+)
+
+// reads the counters tokenauth keeps, so that package needs no metrics dependency
+type tokenauthCollector struct{}
+
+func (tokenauthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenCacheHitsDesc
+	ch <- tokenCacheMissesDesc
+	ch <- tokenCacheSizeDesc
+	ch <- tokeninfoCallsDesc
+	ch <- tokeninfoFailuresDesc
+}
+
+func (tokenauthCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := tokenauth.CurrentStats()
+	ch <- prometheus.MustNewConstMetric(tokenCacheHitsDesc, prometheus.CounterValue, float64(stats.CacheHits))
+	ch <- prometheus.MustNewConstMetric(tokenCacheMissesDesc, prometheus.CounterValue, float64(stats.CacheMisses))
+	ch <- prometheus.MustNewConstMetric(tokenCacheSizeDesc, prometheus.GaugeValue, float64(stats.CacheSize))
+	ch <- prometheus.MustNewConstMetric(tokeninfoCallsDesc, prometheus.CounterValue, float64(stats.TokeninfoCalls))
+	ch <- prometheus.MustNewConstMetric(tokeninfoFailuresDesc, prometheus.CounterValue, float64(stats.TokeninfoFailures))
+}
+
+type routeKey struct{}
+
+// route pattern of a request, filled in by whichever router matches it
+type routeLabel struct {
+	pattern string
+}
+
+// label the request's metrics with a pattern finer than the ServeMux one,
+// e.g. a /api/v1 route
+func setRoutePattern(req *http.Request, pattern string) {
+	if label, ok := req.Context().Value(routeKey{}).(*routeLabel); ok {
+		label.pattern = pattern
+	}
+}
+
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// count and time every request by route pattern and status
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		label := &routeLabel{}
+		req = req.WithContext(context.WithValue(req.Context(), routeKey{}, label))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: 200}
+		start := time.Now()
+		next.ServeHTTP(recorder, req)
+
+		route := label.pattern
+		if route == "" {
+			route = req.Pattern // set by the ServeMux
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		method := req.Method
+		if !knownMethods[method] {
+			method = "other" // any token is a valid method; keep the label set bounded
+		}
+		status := strconv.Itoa(recorder.status)
+		httpRequests.WithLabelValues(route, method, status).Inc()
+		httpRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// count a proof after Store saved it
+func countStoredProof(proof datastore.Proof) {
+	// entryType comes from the client; keep the label set bounded
+	entryType := proof.EntryType
+	if entryType != "proof" && entryType != "argument" {
+		entryType = "other"
+	}
+	proofsStored.WithLabelValues(entryType).Inc()
+	if proof.EntryType == "proof" && proof.ProofCompleted == "true" {
+		proofsCompleted.Inc()
+	}
+}
+
+// routes of the admin listener
+func (env *Env) adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", http.HandlerFunc(healthz))
+	mux.Handle("/readyz", http.HandlerFunc(env.readyz))
+	return mux
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+// scrape the admin listener's /metrics
+func scrapeMetrics(t *testing.T, env *Env) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	env.adminMux().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != 200 {
+		t.Fatalf("got status %v from /metrics", rr.Code)
+	}
+	return rr.Body.String()
+}
+
+func TestRequestAndDatastoreMetrics(t *testing.T) {
+	env := newTestEnv(t)
+	env.ds = &metricsStore{env.ds}
+	instructor := "metrics-instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor, Admin: 1})
+
+	mux := http.NewServeMux()
+	mux.Handle(apiV1Prefix+"/", env.apiV1())
+	handler := withMetrics(mux)
+
+	for _, path := range []string{"/api/v1/sections", "/api/v1/sections/Logic%20101/roster", "/nowhere/" + instructor} {
+		ctx := context.WithValue(context.Background(), "tok", MockUserWithEmail{instructor})
+		req := httptest.NewRequest("GET", path, nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	env.ds.Store(datastore.Proof{EntryType: "proof", UserSubmitted: instructor, ProofName: "p1",
+		ProofCompleted: "true", Premise: []string{"P"}, Logic: []string{"[]"}, Rules: []string{""}})
+
+	metrics := scrapeMetrics(t, env)
+	for _, want := range []string{
+		`proofchecker_http_requests_total{method="GET",route="/api/v1/sections",status="200"} 1`,
+		`proofchecker_http_requests_total{method="GET",route="/api/v1/sections/{section}/roster",`,
+		`proofchecker_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`proofchecker_http_request_duration_seconds_count{method="GET",route="/api/v1/sections",status="200"} 1`,
+		`proofchecker_datastore_call_duration_seconds_count{method="GetSections"}`,
+		`proofchecker_datastore_call_duration_seconds_count{method="Store"}`,
+		`proofchecker_proofs_stored_total{entry_type="proof"}`,
+		`proofchecker_proofs_completed_total`,
+		`proofchecker_token_cache_size`,
+		`proofchecker_tokeninfo_failures_total`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+	if strings.Contains(metrics, "csumb.edu") || strings.Contains(metrics, "Logic 101") {
+		t.Error("metrics labels contain a raw path")
+	}
+}
+
+// metricsStore embeds IProofStore, so a method missing from metricsstore.go
+// would compile and silently skip the latency metrics
+func TestMetricsStoreDeclaresEveryMethod(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "metricsstore.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared := map[string]bool{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			declared[fn.Name.Name] = true
+		}
+	}
+
+	iface := reflect.TypeOf((*datastore.IProofStore)(nil)).Elem()
+	for i := 0; i < iface.NumMethod(); i++ {
+		if method := iface.Method(i); method.IsExported() && !declared[method.Name] {
+			t.Errorf("metricsStore does not declare %s", method.Name)
+		}
+	}
+}
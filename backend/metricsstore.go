@@ -0,0 +1,350 @@
+package main
+
+// Datastore latency metrics
+//
+// metricsStore wraps the datastore and times every IProofStore call. It
+// embeds the interface only because of its unexported methods; every
+// exported method is declared here, which TestMetricsStoreDeclaresEveryMethod
+// checks, so a new datastore method cannot go unmeasured.
+
+import (
+	"context"
+	"time"
+
+	"datastore"
+)
+
+type metricsStore struct {
+	datastore.IProofStore
+}
+
+// record the latency of a datastore call and whether it failed; err may be nil
+func observeDatastore(method string, start time.Time, err *error) {
+	datastoreCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		datastoreCallErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (s *metricsStore) Close() (err error) {
+	defer observeDatastore("Close", time.Now(), &err)
+	return s.IProofStore.Close()
+}
+
+func (s *metricsStore) Ping(ctx context.Context) (err error) {
+	defer observeDatastore("Ping", time.Now(), &err)
+	return s.IProofStore.Ping(ctx)
+}
+
+func (s *metricsStore) EmptyProofTable() (err error) {
+	defer observeDatastore("EmptyProofTable", time.Now(), &err)
+	return s.IProofStore.EmptyProofTable()
+}
+
+func (s *metricsStore) EmptyUserTable() (err error) {
+	defer observeDatastore("EmptyUserTable", time.Now(), &err)
+	return s.IProofStore.EmptyUserTable()
+}
+
+func (s *metricsStore) EmptySectionTable() (err error) {
+	defer observeDatastore("EmptySectionTable", time.Now(), &err)
+	return s.IProofStore.EmptySectionTable()
+}
+
+func (s *metricsStore) EmptyRosterTable() (err error) {
+	defer observeDatastore("EmptyRosterTable", time.Now(), &err)
+	return s.IProofStore.EmptyRosterTable()
+}
+
+func (s *metricsStore) EmptyAssignmentTable() (err error) {
+	defer observeDatastore("EmptyAssignmentTable", time.Now(), &err)
+	return s.IProofStore.EmptyAssignmentTable()
+}
+
+func (s *metricsStore) InsertUser(user datastore.User) (err error) {
+	defer observeDatastore("InsertUser", time.Now(), &err)
+	return s.IProofStore.InsertUser(user)
+}
+
+func (s *metricsStore) InsertSection(section datastore.Section) (err error) {
+	defer observeDatastore("InsertSection", time.Now(), &err)
+	return s.IProofStore.InsertSection(section)
+}
+
+func (s *metricsStore) InsertRoster(rosterRow datastore.Roster) (err error) {
+	defer observeDatastore("InsertRoster", time.Now(), &err)
+	return s.IProofStore.InsertRoster(rosterRow)
+}
+
+func (s *metricsStore) InsertAssignment(assignment datastore.Assignment) (err error) {
+	defer observeDatastore("InsertAssignment", time.Now(), &err)
+	return s.IProofStore.InsertAssignment(assignment)
+}
+
+func (s *metricsStore) UpdateAssignment(currentName string, updatedAssignment datastore.Assignment) (err error) {
+	defer observeDatastore("UpdateAssignment", time.Now(), &err)
+	return s.IProofStore.UpdateAssignment(currentName, updatedAssignment)
+}
+
+func (s *metricsStore) GetAdmins() []string {
+	defer observeDatastore("GetAdmins", time.Now(), nil)
+	return s.IProofStore.GetAdmins()
+}
+
+func (s *metricsStore) GetAllAttemptedRepoProofs() (err error, proofs []datastore.Proof) {
+	defer observeDatastore("GetAllAttemptedRepoProofs", time.Now(), &err)
+	return s.IProofStore.GetAllAttemptedRepoProofs()
+}
+
+func (s *metricsStore) GetRepoProofs(user datastore.UserWithEmail) (err error, sections []datastore.SectionProofs) {
+	defer observeDatastore("GetRepoProofs", time.Now(), &err)
+	return s.IProofStore.GetRepoProofs(user)
+}
+
+func (s *metricsStore) GetUserProofs(user datastore.UserWithEmail) (err error, proofs []datastore.Proof) {
+	defer observeDatastore("GetUserProofs", time.Now(), &err)
+	return s.IProofStore.GetUserProofs(user)
+}
+
+func (s *metricsStore) GetUserArguments(user datastore.UserWithEmail) (proofs []datastore.Proof, err error) {
+	defer observeDatastore("GetUserArguments", time.Now(), &err)
+	return s.IProofStore.GetUserArguments(user)
+}
+
+func (s *metricsStore) GetUserCompletedProofs(user datastore.UserWithEmail) (err error, proofs []datastore.Proof) {
+	defer observeDatastore("GetUserCompletedProofs", time.Now(), &err)
+	return s.IProofStore.GetUserCompletedProofs(user)
+}
+
+func (s *metricsStore) GetSections(userEmail string) (sections []datastore.Section, err error) {
+	defer observeDatastore("GetSections", time.Now(), &err)
+	return s.IProofStore.GetSections(userEmail)
+}
+
+func (s *metricsStore) GetArchivedSections(userEmail string) (sections []datastore.Section, err error) {
+	defer observeDatastore("GetArchivedSections", time.Now(), &err)
+	return s.IProofStore.GetArchivedSections(userEmail)
+}
+
+func (s *metricsStore) GetSection(name string) (section *datastore.Section, err error) {
+	defer observeDatastore("GetSection", time.Now(), &err)
+	return s.IProofStore.GetSection(name)
+}
+
+func (s *metricsStore) GetRoster(sectionName string) (roster []datastore.Roster, err error) {
+	defer observeDatastore("GetRoster", time.Now(), &err)
+	return s.IProofStore.GetRoster(sectionName)
+}
+
+func (s *metricsStore) GetRole(sectionName string, userEmail string) (role string, err error) {
+	defer observeDatastore("GetRole", time.Now(), &err)
+	return s.IProofStore.GetRole(sectionName, userEmail)
+}
+
+func (s *metricsStore) GetAssignmentsBySection(sectionName string) (assignments []datastore.Assignment, err error) {
+	defer observeDatastore("GetAssignmentsBySection", time.Now(), &err)
+	return s.IProofStore.GetAssignmentsBySection(sectionName)
+}
+
+func (s *metricsStore) GetAssignmentProofs(assignment datastore.Assignment) (proofs []datastore.Proof, err error) {
+	defer observeDatastore("GetAssignmentProofs", time.Now(), &err)
+	return s.IProofStore.GetAssignmentProofs(assignment)
+}
+
+func (s *metricsStore) GetCompletedProofsBySection(sectionName string) (proofs []datastore.Proof, err error) {
+	defer observeDatastore("GetCompletedProofsBySection", time.Now(), &err)
+	return s.IProofStore.GetCompletedProofsBySection(sectionName)
+}
+
+func (s *metricsStore) GetCompletedProofsByAssignment(sectionName string, assignmentName string) (proofs []datastore.Proof, err error) {
+	defer observeDatastore("GetCompletedProofsByAssignment", time.Now(), &err)
+	return s.IProofStore.GetCompletedProofsByAssignment(sectionName, assignmentName)
+}
+
+func (s *metricsStore) GetProof(id string) (proof *datastore.Proof, err error) {
+	defer observeDatastore("GetProof", time.Now(), &err)
+	return s.IProofStore.GetProof(id)
+}
+
+func (s *metricsStore) QueryProofs(q datastore.ProofQuery) (page *datastore.ProofPage, err error) {
+	defer observeDatastore("QueryProofs", time.Now(), &err)
+	return s.IProofStore.QueryProofs(q)
+}
+
+// not timed: subscribing does no query
+func (s *metricsStore) SubscribeProofEvents(sectionName string) (<-chan datastore.ProofEvent, func()) {
+	return s.IProofStore.SubscribeProofEvents(sectionName)
+}
+
+func (s *metricsStore) PopulateTestUsersSectionsRosters() {
+	defer observeDatastore("PopulateTestUsersSectionsRosters", time.Now(), nil)
+	s.IProofStore.PopulateTestUsersSectionsRosters()
+}
+
+func (s *metricsStore) RemoveFromRoster(sectionName string, userEmail string) (err error) {
+	defer observeDatastore("RemoveFromRoster", time.Now(), &err)
+	return s.IProofStore.RemoveFromRoster(sectionName, userEmail)
+}
+
+func (s *metricsStore) RemoveSection(sectionName string) (err error) {
+	defer observeDatastore("RemoveSection", time.Now(), &err)
+	return s.IProofStore.RemoveSection(sectionName)
+}
+
+func (s *metricsStore) SetSectionTerm(sectionName string, term string) (err error) {
+	defer observeDatastore("SetSectionTerm", time.Now(), &err)
+	return s.IProofStore.SetSectionTerm(sectionName, term)
+}
+
+func (s *metricsStore) SetSectionArchived(sectionName string, archived bool) (err error) {
+	defer observeDatastore("SetSectionArchived", time.Now(), &err)
+	return s.IProofStore.SetSectionArchived(sectionName, archived)
+}
+
+func (s *metricsStore) CloneSection(sourceName string, section datastore.Section) (clone *datastore.Section, err error) {
+	defer observeDatastore("CloneSection", time.Now(), &err)
+	return s.IProofStore.CloneSection(sourceName, section)
+}
+
+func (s *metricsStore) RemoveAssignment(sectionName string, name string) (err error) {
+	defer observeDatastore("RemoveAssignment", time.Now(), &err)
+	return s.IProofStore.RemoveAssignment(sectionName, name)
+}
+
+func (s *metricsStore) GetDeleted(userEmail string) (deleted *datastore.DeletedItems, err error) {
+	defer observeDatastore("GetDeleted", time.Now(), &err)
+	return s.IProofStore.GetDeleted(userEmail)
+}
+
+func (s *metricsStore) RestoreSection(sectionName string) (err error) {
+	defer observeDatastore("RestoreSection", time.Now(), &err)
+	return s.IProofStore.RestoreSection(sectionName)
+}
+
+func (s *metricsStore) RestoreAssignment(sectionName string, name string) (err error) {
+	defer observeDatastore("RestoreAssignment", time.Now(), &err)
+	return s.IProofStore.RestoreAssignment(sectionName, name)
+}
+
+func (s *metricsStore) RestoreRosterEntry(sectionName string, userEmail string) (err error) {
+	defer observeDatastore("RestoreRosterEntry", time.Now(), &err)
+	return s.IProofStore.RestoreRosterEntry(sectionName, userEmail)
+}
+
+func (s *metricsStore) PurgeDeleted(before string) (purged *datastore.DeletedItems, err error) {
+	defer observeDatastore("PurgeDeleted", time.Now(), &err)
+	return s.IProofStore.PurgeDeleted(before)
+}
+
+func (s *metricsStore) GetJoinCode(sectionName string) (joinCode *datastore.JoinCode, err error) {
+	defer observeDatastore("GetJoinCode", time.Now(), &err)
+	return s.IProofStore.GetJoinCode(sectionName)
+}
+
+func (s *metricsStore) RegenerateJoinCode(sectionName string, expiresAt string, seatLimit int) (joinCode *datastore.JoinCode, err error) {
+	defer observeDatastore("RegenerateJoinCode", time.Now(), &err)
+	return s.IProofStore.RegenerateJoinCode(sectionName, expiresAt, seatLimit)
+}
+
+func (s *metricsStore) DisableJoinCode(sectionName string) (err error) {
+	defer observeDatastore("DisableJoinCode", time.Now(), &err)
+	return s.IProofStore.DisableJoinCode(sectionName)
+}
+
+func (s *metricsStore) EnrollWithJoinCode(code string, userEmail string) (sectionName string, err error) {
+	defer observeDatastore("EnrollWithJoinCode", time.Now(), &err)
+	return s.IProofStore.EnrollWithJoinCode(code, userEmail)
+}
+
+func (s *metricsStore) ExportSection(sectionName string) (archive *datastore.SectionArchive, err error) {
+	defer observeDatastore("ExportSection", time.Now(), &err)
+	return s.IProofStore.ExportSection(sectionName)
+}
+
+func (s *metricsStore) ImportSection(archive *datastore.SectionArchive, sectionName string, importer string) (summary *datastore.ImportSummary, err error) {
+	defer observeDatastore("ImportSection", time.Now(), &err)
+	return s.IProofStore.ImportSection(archive, sectionName, importer)
+}
+
+func (s *metricsStore) SaveProblem(problem datastore.Problem) (saved *datastore.Problem, err error) {
+	defer observeDatastore("SaveProblem", time.Now(), &err)
+	return s.IProofStore.SaveProblem(problem)
+}
+
+func (s *metricsStore) SaveProblems(problems []datastore.Problem) (saved []datastore.Problem, err error) {
+	defer observeDatastore("SaveProblems", time.Now(), &err)
+	return s.IProofStore.SaveProblems(problems)
+}
+
+func (s *metricsStore) GetProblem(id string, viewer string) (problem *datastore.Problem, err error) {
+	defer observeDatastore("GetProblem", time.Now(), &err)
+	return s.IProofStore.GetProblem(id, viewer)
+}
+
+func (s *metricsStore) SearchProblems(q datastore.ProblemQuery) (page *datastore.ProblemPage, err error) {
+	defer observeDatastore("SearchProblems", time.Now(), &err)
+	return s.IProofStore.SearchProblems(q)
+}
+
+func (s *metricsStore) HiddenProblems(ids []int, viewer string) (hidden []int, err error) {
+	defer observeDatastore("HiddenProblems", time.Now(), &err)
+	return s.IProofStore.HiddenProblems(ids, viewer)
+}
+
+func (s *metricsStore) IsStaff(userEmail string) (staff bool, err error) {
+	defer observeDatastore("IsStaff", time.Now(), &err)
+	return s.IProofStore.IsStaff(userEmail)
+}
+
+func (s *metricsStore) Store(proof datastore.Proof) (err error) {
+	defer observeDatastore("Store", time.Now(), &err)
+	if err = s.IProofStore.Store(proof); err == nil {
+		countStoredProof(proof)
+	}
+	return err
+}
+
+func (s *metricsStore) MaintainAdmins(adminUsers map[string]bool) {
+	defer observeDatastore("MaintainAdmins", time.Now(), nil)
+	s.IProofStore.MaintainAdmins(adminUsers)
+}
+
+func (s *metricsStore) GetProblemRuleSets(userEmail string, proofName string) (ruleSets []string, err error) {
+	defer observeDatastore("GetProblemRuleSets", time.Now(), &err)
+	return s.IProofStore.GetProblemRuleSets(userEmail, proofName)
+}
+
+func (s *metricsStore) GetProblemAttempts(sectionName string, proofName string) (attempts []datastore.ProblemAttempt, err error) {
+	defer observeDatastore("GetProblemAttempts", time.Now(), &err)
+	return s.IProofStore.GetProblemAttempts(sectionName, proofName)
+}
+
+func (s *metricsStore) GetReferenceLines(problem datastore.Proof) (lines int, err error) {
+	defer observeDatastore("GetReferenceLines", time.Now(), &err)
+	return s.IProofStore.GetReferenceLines(problem)
+}
+
+func (s *metricsStore) RecordMistakes(userEmail string, proofName string, mistakes []datastore.ProofMistake) (err error) {
+	defer observeDatastore("RecordMistakes", time.Now(), &err)
+	return s.IProofStore.RecordMistakes(userEmail, proofName, mistakes)
+}
+
+func (s *metricsStore) GetMistakeCounts(sectionName string, student string, byProblem bool) (counts []datastore.MistakeCount, err error) {
+	defer observeDatastore("GetMistakeCounts", time.Now(), &err)
+	return s.IProofStore.GetMistakeCounts(sectionName, student, byProblem)
+}
+
+func (s *metricsStore) GetStudentActivity(sectionName string) (activity []datastore.StudentActivity, err error) {
+	defer observeDatastore("GetStudentActivity", time.Now(), &err)
+	return s.IProofStore.GetStudentActivity(sectionName)
+}
+
+func (s *metricsStore) RecordAudit(entry datastore.AuditEntry) (err error) {
+	defer observeDatastore("RecordAudit", time.Now(), &err)
+	return s.IProofStore.RecordAudit(entry)
+}
+
+func (s *metricsStore) QueryAudit(q datastore.AuditQuery) (page *datastore.AuditPage, err error) {
+	defer observeDatastore("QueryAudit", time.Now(), &err)
+	return s.IProofStore.QueryAudit(q)
+}
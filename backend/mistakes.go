@@ -0,0 +1,132 @@
+package main
+
+// Common mistakes
+//
+// Every save of a proof of a repository problem that does not check is
+// diagnosed (see proofcheck.Diagnose), and the rule and kind of each of its
+// mistakes are recorded for the student and problem. GET
+// /sections/{section}/mistakes reports the most widespread ones, per
+// problem and per rule, so instructors know what to reteach. Mistakes made
+// before they were recorded are not there.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"datastore"
+	"proofcheck"
+)
+
+const (
+	defaultMistakeLimit = 5
+	maxMistakeLimit     = 50
+)
+
+type sectionMistakes struct {
+	Section   string            `json:"section"`
+	Student   string            `json:"student,omitempty"`
+	ByProblem []problemMistakes `json:"byProblem"` // the problem with the most widespread mistake first
+	ByRule    []ruleMistakes    `json:"byRule"`    // likewise
+}
+
+type problemMistakes struct {
+	Problem  string                   `json:"problem"`
+	Mistakes []datastore.MistakeCount `json:"mistakes"` // the most widespread first, at most limit
+}
+
+type ruleMistakes struct {
+	Rule     string                   `json:"rule"` // "" for lines citing no rule
+	Mistakes []datastore.MistakeCount `json:"mistakes"`
+}
+
+// diagnose a stored proof as the frontend would check it; nil when it
+// checks or has no body
+func diagnoseStored(proof datastore.Proof) []proofcheck.Mistake {
+	request, ok := storedCheckRequest(proof)
+	if !ok {
+		return nil
+	}
+	entries, err := proofcheck.ParseProof([]byte(request.ProofData))
+	if err != nil {
+		return nil
+	}
+	_, mistakes := proofcheck.Diagnose(entries, proofcheck.Intval(request.NumPrems), request.WantedConc, request.PredicateSettings == "true", nil)
+	return mistakes
+}
+
+// the mistakes of a proof, nil when it checks or has no body
+func proofMistakes(proof datastore.Proof) []datastore.ProofMistake {
+	var mistakes []datastore.ProofMistake
+	for _, mistake := range diagnoseStored(proof) {
+		mistakes = append(mistakes, datastore.ProofMistake{Rule: mistake.Rule, Kind: mistake.Kind})
+	}
+	return mistakes
+}
+
+// record the mistakes of a saved proof of a repository problem; failing
+// to is logged and does not fail the save
+func (env *Env) recordMistakes(ctx context.Context, proof datastore.Proof) {
+	if proof.EntryType != "proof" || proof.RepoProblem != "true" {
+		return
+	}
+	if err := env.ds.RecordMistakes(proof.UserSubmitted, proof.ProofName, proofMistakes(proof)); err != nil {
+		logger.ErrorContext(ctx, "recordMistakes: recording failed", "proof", proof.ProofName, "error", err)
+	}
+}
+
+func (env *Env) apiSectionMistakes(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	limit := defaultMistakeLimit
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMistakeLimit {
+			writeAPIError(w, 400, errCodeBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxMistakeLimit))
+			return
+		}
+		limit = n
+	}
+	student := req.URL.Query().Get("student")
+	result := sectionMistakes{Section: params["section"], Student: student, ByProblem: []problemMistakes{}, ByRule: []ruleMistakes{}}
+
+	counts, err := env.ds.GetMistakeCounts(params["section"], student, true)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	problems := map[string]int{}
+	for _, count := range counts {
+		i, ok := problems[count.ProofName]
+		if !ok {
+			i = len(result.ByProblem)
+			problems[count.ProofName] = i
+			result.ByProblem = append(result.ByProblem, problemMistakes{Problem: count.ProofName})
+		}
+		if len(result.ByProblem[i].Mistakes) < limit {
+			count.ProofName = ""
+			result.ByProblem[i].Mistakes = append(result.ByProblem[i].Mistakes, count)
+		}
+	}
+
+	counts, err = env.ds.GetMistakeCounts(params["section"], student, false)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	rules := map[string]int{}
+	for _, count := range counts {
+		i, ok := rules[count.Rule]
+		if !ok {
+			i = len(result.ByRule)
+			rules[count.Rule] = i
+			result.ByRule = append(result.ByRule, ruleMistakes{Rule: count.Rule})
+		}
+		if len(result.ByRule[i].Mistakes) < limit {
+			result.ByRule[i].Mistakes = append(result.ByRule[i].Mistakes, count)
+		}
+	}
+	writeAPIJSON(w, 200, result)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"datastore"
+)
+
+func TestAPISectionMistakes(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["a@csumb.edu","b@csumb.edu"]}`), 200, "")
+	save := func(student string, logic string) {
+		t.Helper()
+		body, _ := json.Marshal(datastore.Proof{EntryType: "proof", ProofName: "Repository - MP", ProofType: "prop",
+			Premise: []string{"P → Q", "P"}, Conclusion: "Q", RepoProblem: "true", ProofCompleted: "error",
+			Rules: []string{}, Logic: []string{logic}})
+		expectAPIStatus(t, apiRequest(t, api, student, "POST", "/proofs", string(body)), 204, "")
+	}
+	premises := `{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"P","jstr":"Pr"}`
+	save("a@csumb.edu", "["+premises+`,{"wffstr":"Q","jstr":"1 →E"}]`)
+	save("a@csumb.edu", "["+premises+`,{"wffstr":"R","jstr":"1, 2 →E"}]`)
+	save("b@csumb.edu", "["+premises+`,{"wffstr":"R","jstr":"1, 2 →E"}]`)
+	// checks, so there is nothing to record
+	save("b@csumb.edu", "["+premises+`,{"wffstr":"Q","jstr":"1, 2 →E"}]`)
+
+	expectAPIStatus(t, apiRequest(t, api, "a@csumb.edu", "GET", "/sections/Logic/mistakes", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/mistakes?limit=0", ""), 400, errCodeBadRequest)
+
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/mistakes", "")
+	expectAPIStatus(t, rr, 200, "")
+	var got sectionMistakes
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if len(got.ByProblem) != 1 || got.ByProblem[0].Problem != "Repository - MP" ||
+		fmt.Sprint(got.ByProblem[0].Mistakes) != "[{ →E formula-mismatch 2 2} { →E citation-count 1 1}]" {
+		t.Errorf("by problem: %s", rr.Body.String())
+	}
+	if len(got.ByRule) != 1 || got.ByRule[0].Rule != "→E" || len(got.ByRule[0].Mistakes) != 2 {
+		t.Errorf("by rule: %s", rr.Body.String())
+	}
+
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/mistakes?student=b@csumb.edu&limit=1", "")
+	expectAPIStatus(t, rr, 200, "")
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if got.Student != "b@csumb.edu" || len(got.ByProblem) != 1 || fmt.Sprint(got.ByProblem[0].Mistakes) != "[{ →E formula-mismatch 1 1}]" {
+		t.Errorf("one student: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+// Notifications
+//
+// Reports such as the at-risk report can be emailed to a section's
+// instructors through a notifier, chosen with -notify: "file:DIR" writes
+// each message to DIR as an .eml file, for testing and for deployments
+// that deliver mail some other way, and "smtp://[user:password@]host:port"
+// sends it, e.g. to a local SMTP stand-in such as MailHog. Without -notify
+// nothing is sent.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// notifier sends a plain text message
+type notifier interface {
+	Notify(ctx context.Context, to []string, subject string, body string) error
+}
+
+// the notifier set with -notify; nil sends nothing
+var reportNotifier notifier
+
+// the From address of notifications, set with -notify-from
+var notifyFrom = "proofs@localhost"
+
+// the notifier for a -notify value; "" gives nil
+func newNotifier(spec string) (notifier, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if dir, ok := strings.CutPrefix(spec, "file:"); ok {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return fileNotifier{dir}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme != "smtp" || u.Host == "" {
+		return nil, fmt.Errorf("%q is neither file:DIR nor smtp://host:port", spec)
+	}
+	n := smtpNotifier{addr: u.Host}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		n.auth = smtp.PlainAuth("", u.User.Username(), password, u.Hostname())
+	}
+	return n, nil
+}
+
+// the message, headers included
+func formatMessage(to []string, subject string, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", notifyFrom)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// writes each message to a file of dir
+type fileNotifier struct {
+	dir string
+}
+
+func (n fileNotifier) Notify(ctx context.Context, to []string, subject string, body string) error {
+	f, err := os.CreateTemp(n.dir, time.Now().UTC().Format(snapshotTimeFormat)+"-*.eml")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(formatMessage(to, subject, body))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sends each message to an SMTP server
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth // nil without a user
+}
+
+// how long sending a message may take when ctx has no deadline of its own
+const smtpTimeout = 30 * time.Second
+
+// sends as smtp.SendMail does, over a connection that ctx can cut short
+func (n smtpNotifier) Notify(ctx context.Context, to []string, subject string, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(notifyFrom); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatMessage(to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPNotifierHonorsContext(t *testing.T) {
+	// a server that accepts the connection and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// read until the notifier hangs up
+			go func(conn net.Conn) {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}(conn)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = smtpNotifier{addr: listener.Addr().String()}.Notify(ctx, []string{"instructor@csumb.edu"}, "At-risk students", "none")
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("Notify to a silent server: %v after %v", err, time.Since(start))
+	}
+}
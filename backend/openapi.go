@@ -0,0 +1,315 @@
+package main
+
+// OpenAPI 3 document of the backend
+//
+// The document is built by reflection from the request and response types
+// each route declares in its routeDoc, so it cannot drift from the structs
+// the handlers decode and encode. It is served at /openapi.json; the copy
+// checked in as openapi.json is compared against it by the tests and is
+// refreshed with:
+//
+//	go test -run TestOpenAPISpecUpToDate -update
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// description of one route for the OpenAPI document
+type routeDoc struct {
+	Summary  string
+	Access   string       // who may call the route
+	Public   bool         // no X-Auth-Token required
+	Query    []queryParam // query string parameters
+	Request  interface{}  // zero value of the JSON request body, nil for none
+	Form     bool         // the request body is form fields named like Request's rather than JSON
+	Response interface{}  // zero value of the JSON success body, nil for none
+	Status   int          // success status code, 200 if zero
+
+	EventStream bool     // the success body is a text/event-stream of Response events
+	MediaTypes  []string // other types the request and success bodies may have, e.g. text/plain
+}
+
+type queryParam struct {
+	Name        string
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+// a response body that is one of several types
+type oneOf []interface{}
+
+// builds component schemas from Go types
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+// return a schema for t, adding named struct types to the components
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{} // any JSON value
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, found := b.schemas[t.Name()]; !found {
+			b.schemas[t.Name()] = nil // placeholder, guards against recursive types
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object schema with one property per field encoding/json would write
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	b.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "" {
+			b.addFields(field.Type, properties)
+			continue
+		}
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schemaFor(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+	}
+}
+
+// JSON content for a body type, nil if the route has no body
+func (b *schemaBuilder) content(body interface{}) map[string]interface{} {
+	if body == nil {
+		return nil
+	}
+
+	var schema map[string]interface{}
+	if choices, ok := body.(oneOf); ok {
+		var schemas []interface{}
+		for _, choice := range choices {
+			schemas = append(schemas, b.schemaFor(reflect.TypeOf(choice)))
+		}
+		schema = map[string]interface{}{"oneOf": schemas}
+	} else {
+		schema = b.schemaFor(reflect.TypeOf(body))
+	}
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// name of the function behind a handler, e.g. "addSection"
+func handlerName(handler interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// OpenAPI operation object for one route
+func (b *schemaBuilder) operation(doc routeDoc, operationId string, pathParams []string, errorResponse map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": operationId,
+		"summary":     doc.Summary,
+		"description": "Access: " + doc.Access,
+	}
+
+	var parameters []interface{}
+	for _, name := range pathParams {
+		parameters = append(parameters, map[string]interface{}{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, param := range doc.Query {
+		schema := map[string]interface{}{"type": "string"}
+		if param.Enum != nil {
+			schema["enum"] = param.Enum
+		}
+		parameter := map[string]interface{}{
+			"name": param.Name, "in": "query", "required": param.Required, "schema": schema,
+		}
+		if param.Description != "" {
+			parameter["description"] = param.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+
+	if content := b.content(doc.Request); content != nil {
+		addMediaTypes(content, doc.MediaTypes)
+		if doc.Form {
+			schema := content["application/json"]
+			content = map[string]interface{}{"application/x-www-form-urlencoded": schema, "multipart/form-data": schema}
+		}
+		op["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = 200
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if doc.EventStream {
+		success["content"] = map[string]interface{}{"text/event-stream": map[string]interface{}{
+			"schema": b.schemaFor(reflect.TypeOf(doc.Response)),
+		}}
+	} else if content := b.content(doc.Response); content != nil || doc.MediaTypes != nil {
+		if content == nil {
+			content = map[string]interface{}{}
+		}
+		addMediaTypes(content, doc.MediaTypes)
+		success["content"] = content
+	}
+	op["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default":            errorResponse,
+	}
+
+	if !doc.Public {
+		op["security"] = []interface{}{map[string]interface{}{"googleIdToken": []string{}}}
+	}
+	return op
+}
+
+// document bodies of mediaTypes beside the JSON one of content
+func addMediaTypes(content map[string]interface{}, mediaTypes []string) {
+	for _, mediaType := range mediaTypes {
+		schema := map[string]interface{}{"type": "string"}
+		if !strings.HasPrefix(mediaType, "text/") {
+			schema["format"] = "binary"
+		}
+		content[mediaType] = map[string]interface{}{"schema": schema}
+	}
+}
+
+// build the OpenAPI document for the legacy routes and /api/v1
+func (env *Env) openAPI() map[string]interface{} {
+	b := &schemaBuilder{schemas: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+
+	addOperation := func(path string, method string, op map[string]interface{}) {
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = op
+	}
+
+	legacyError := map[string]interface{}{
+		"description": "Error message",
+		"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+	}
+	for _, route := range env.legacyRoutes() {
+		op := b.operation(route.doc, handlerName(route.handler), nil, legacyError)
+		op["tags"] = []string{"legacy"}
+		addOperation(route.path, route.method, op)
+	}
+
+	apiErrorResponse := map[string]interface{}{
+		"description": "Error envelope",
+		"content":     b.content(apiErrorEnvelope{}),
+	}
+	for _, route := range env.apiV1().routes {
+		var pathParams []string
+		for _, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") {
+				pathParams = append(pathParams, strings.Trim(segment, "{}"))
+			}
+		}
+		op := b.operation(route.doc, handlerName(route.handler), pathParams, apiErrorResponse)
+		op["tags"] = []string{"v1"}
+		addOperation(apiV1Prefix+route.pattern, route.method, op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Proof Checker backend",
+			"version": "1",
+		},
+		// nginx strips the /backend prefix before proxying to the Go backend
+		"servers": []interface{}{map[string]interface{}{"url": "/backend"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"googleIdToken": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-Auth-Token",
+					"description": "Google-issued ID token of the signed-in user",
+				},
+			},
+		},
+	}
+}
+
+// indented JSON encoding of the OpenAPI document
+func (env *Env) openAPIJSON() ([]byte, error) {
+	output, err := json.MarshalIndent(env.openAPI(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(output, '\n'), nil
+}
+
+// serve the OpenAPI document -- this is a public endpoint, no token required
+func (env *Env) getOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Request not accepted.", 400)
+		return
+	}
+
+	output, err := env.openAPIJSON()
+	if err != nil {
+		http.Error(w, "json marshal error", 500)
+		logger.ErrorContext(req.Context(), "getOpenAPI: json marshal error", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	io.WriteString(w, string(output))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+var updateOpenAPI = flag.Bool("update", false, "rewrite openapi.json from the Go types")
+
+func TestOpenAPISpecUpToDate(t *testing.T) {
+	generated, err := (&Env{}).openAPIJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *updateOpenAPI {
+		if err := os.WriteFile("openapi.json", generated, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkedIn, err := os.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, checkedIn) {
+		t.Errorf("openapi.json is out of date with the handler types; run: go test -run TestOpenAPISpecUpToDate -update")
+	}
+}
+
+// load the checked-in document as plain JSON values
+func loadOpenAPI(t *testing.T) map[string]interface{} {
+	t.Helper()
+	checkedIn, err := os.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(checkedIn, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// report every place where value does not conform to schema
+func checkSchema(spec map[string]interface{}, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})[name]
+		return checkSchema(spec, resolved.(map[string]interface{}), value, at)
+	}
+	if choices, ok := schema["oneOf"].([]interface{}); ok {
+		var problems []string
+		for _, choice := range choices {
+			problems = checkSchema(spec, choice.(map[string]interface{}), value, at)
+			if problems == nil {
+				return nil
+			}
+		}
+		return problems
+	}
+
+	wrongType := []string{fmt.Sprintf("%s: %T does not match schema type %v", at, value, schema["type"])}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return wrongType
+		}
+		var problems []string
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for key, v := range object {
+			propSchema, found := properties[key].(map[string]interface{})
+			if !found {
+				propSchema = additional
+			}
+			if propSchema == nil {
+				problems = append(problems, fmt.Sprintf("%s: property %q is not in the spec", at, key))
+				continue
+			}
+			problems = append(problems, checkSchema(spec, propSchema, v, at+"."+key)...)
+		}
+		return problems
+	case "array":
+		if value == nil {
+			return nil // encoding/json writes nil slices as null
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return wrongType
+		}
+		var problems []string
+		for i, v := range array {
+			problems = append(problems, checkSchema(spec, schema["items"].(map[string]interface{}), v, at+"["+strconv.Itoa(i)+"]")...)
+		}
+		return problems
+	case "string":
+		if _, ok := value.(string); !ok {
+			return wrongType
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return wrongType
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return wrongType
+		}
+	}
+	return nil
+}
+
+// check a recorded response body against the documented success schema of a route
+func expectMatchesSpec(t *testing.T, spec map[string]interface{}, method string, path string, status int, body []byte) {
+	t.Helper()
+	op, ok := spec["paths"].(map[string]interface{})[path].(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s is not in openapi.json", method, path)
+	}
+	response, ok := op["responses"].(map[string]interface{})[strconv.Itoa(status)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s %s: status %d is not in openapi.json", method, path, status)
+	}
+	content, ok := response["content"].(map[string]interface{})
+	if !ok {
+		if len(body) != 0 {
+			t.Errorf("%s %s: spec has no body but handler wrote %s", method, path, body)
+		}
+		return
+	}
+
+	if _, ok := content["application/json"]; !ok {
+		return // a text or binary body
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Fatalf("%s %s: response is not JSON: %s", method, path, body)
+	}
+	schema := content["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	for _, problem := range checkSchema(spec, schema, value, "body") {
+		t.Errorf("%s %s: %s", method, path, problem)
+	}
+}
+
+func TestOpenAPIResponsesMatchSpec(t *testing.T) {
+	spec := loadOpenAPI(t)
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor, Admin: 1})
+
+	env.ds.Store(datastore.Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - Spec", ProofType: "prop",
+		Premise: []string{"P"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P", RepoProblem: "true"})
+
+	calls := []struct {
+		method, pattern, path, body string
+		status                      int
+	}{
+		{"POST", "/sections", "/sections", `{"name":"Spec"}`, 201},
+		{"GET", "/sections", "/sections", ``, 200},
+		{"GET", "/sections/{section}", "/sections/Spec", ``, 200},
+		{"PATCH", "/sections/{section}", "/sections/Spec", `{"term":"Fall 2026"}`, 200},
+		{"POST", "/sections/{section}/roster", "/sections/Spec/roster", `{"studentEmails":["student@csumb.edu"]}`, 200},
+		{"GET", "/sections/{section}/roster", "/sections/Spec/roster", ``, 200},
+		{"GET", "/sections/{section}/join-code", "/sections/Spec/join-code", ``, 200},
+		{"PUT", "/sections/{section}/join-code", "/sections/Spec/join-code", `{"seatLimit":30}`, 200},
+		{"POST", "/sections/{section}/assignments", "/sections/Spec/assignments", `{"name":"HW","proofIds":[1],"visibility":"true"}`, 201},
+		{"GET", "/sections/{section}/assignments", "/sections/Spec/assignments", ``, 200},
+		{"POST", "/sections/{section}/clone", "/sections/Spec/clone", `{"name":"Spec 2"}`, 201},
+		{"GET", "/arguments", "/arguments", ``, 200},
+		{"GET", "/rule-sets", "/rule-sets", ``, 200},
+		{"GET", "/sections/{section}/proofs", "/sections/Spec/proofs?limit=1", ``, 200},
+		{"GET", "/sections/{section}/completed-proofs", "/sections/Spec/completed-proofs", ``, 200},
+		{"GET", "/sections/{section}/analytics", "/sections/Spec/analytics", ``, 200},
+		{"GET", "/sections/{section}/mistakes", "/sections/Spec/mistakes", ``, 200},
+		{"GET", "/sections/{section}/at-risk", "/sections/Spec/at-risk", ``, 200},
+		{"GET", "/sections/{section}/similarity", "/sections/Spec/similarity", ``, 200},
+		{"GET", "/proofs", "/proofs?selection=repo", ``, 200},
+		{"POST", "/proofs", "/proofs", `{"ProofName":"Practice","ProofCompleted":"false"}`, 204},
+		{"GET", "/proofs", "/proofs?selection=user", ``, 200},
+		{"GET", "/admins", "/admins", ``, 200},
+		{"POST", "/problems", "/problems", `{"name":"Bank","proofType":"prop","premise":["P"],"conclusion":"P","tags":["easy"]}`, 201},
+		{"GET", "/problems", "/problems?tag=easy", ``, 200},
+		{"GET", "/problems/{problem}", "/problems/3", ``, 200},
+		{"POST", "/problem-sets", "/problem-sets?format=json&section=Spec&assignment=Set", `{"version":1,"problems":[{"name":"Set","premise":["P"],"conclusion":"P"}]}`, 201},
+		{"GET", "/sections/{section}/problem-set", "/sections/Spec/problem-set?format=json", ``, 200},
+		{"GET", "/proofs/{proof}/render", "/proofs/3/render?format=latex", ``, 200},
+		{"PUT", "/problems/{problem}", "/problems/3", `{"name":"Bank","proofType":"prop","conclusion":"P","difficulty":1}`, 200},
+	}
+	for _, call := range calls {
+		rr := apiRequest(t, api, instructor, call.method, call.path, call.body)
+		expectAPIStatus(t, rr, call.status, "")
+		expectMatchesSpec(t, spec, call.method, apiV1Prefix+call.pattern, call.status, rr.Body.Bytes())
+	}
+
+	// error envelopes are documented as the default response of every v1 route
+	rr := apiRequest(t, api, "student@csumb.edu", "GET", "/sections/Spec/roster", ``)
+	expectAPIStatus(t, rr, 403, errCodeForbidden)
+}
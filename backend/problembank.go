@@ -0,0 +1,179 @@
+package main
+
+// Problem bank
+//
+// Bank problems are arguments with tags, a difficulty, a chapter, an
+// author and a sharing scope. Their ids do not belong to any section, and
+// assignments list them in proofIds like any other problem. Only staff
+// (admins, instructors and TAs) can share problems beyond themselves.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"datastore"
+)
+
+const (
+	defaultProblemPageSize = 100
+	maxProblemPageSize     = 1000
+)
+
+// filters and paging of the problem search
+var problemSearchParams = []queryParam{
+	{Name: "q", Description: "text in the name, premises, conclusion, chapter or author"},
+	{Name: "tag", Description: "comma-separated tags; problems must have all of them"},
+	{Name: "minDifficulty", Description: fmt.Sprintf("1 to %d", datastore.MaxProblemDifficulty)},
+	{Name: "maxDifficulty", Description: fmt.Sprintf("1 to %d", datastore.MaxProblemDifficulty)},
+	{Name: "chapter"},
+	{Name: "author"},
+	{Name: "owner", Description: "email of the user who stored the problem"},
+	{Name: "scope", Enum: datastore.ProblemScopes},
+	{Name: "proofType", Enum: []string{"prop", "fol"}},
+	{Name: "limit", Description: fmt.Sprintf("page size, default %d, at most %d", defaultProblemPageSize, maxProblemPageSize)},
+	{Name: "cursor", Description: "nextCursor of the previous page"},
+}
+
+// build the search of the current user from problemSearchParams
+func parseProblemQuery(values url.Values, viewer string) (datastore.ProblemQuery, error) {
+	q := datastore.ProblemQuery{
+		Viewer:    viewer,
+		Text:      values.Get("q"),
+		Chapter:   values.Get("chapter"),
+		Author:    values.Get("author"),
+		Owner:     values.Get("owner"),
+		Scope:     values.Get("scope"),
+		ProofType: values.Get("proofType"),
+		Cursor:    values.Get("cursor"),
+		Limit:     defaultProblemPageSize,
+	}
+	if tags := values.Get("tag"); tags != "" {
+		q.Tags = strings.Split(tags, ",")
+	}
+	if q.Scope != "" && q.Scope != "private" && q.Scope != "department" && q.Scope != "public" {
+		return q, fmt.Errorf("invalid scope %q", q.Scope)
+	}
+	if q.ProofType != "" && q.ProofType != "prop" && q.ProofType != "fol" {
+		return q, fmt.Errorf("invalid proofType %q", q.ProofType)
+	}
+	for _, bound := range []struct {
+		name string
+		dest *int
+	}{{"minDifficulty", &q.MinDifficulty}, {"maxDifficulty", &q.MaxDifficulty}} {
+		value := values.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > datastore.MaxProblemDifficulty {
+			return q, fmt.Errorf("%s must be between 1 and %d", bound.name, datastore.MaxProblemDifficulty)
+		}
+		*bound.dest = n
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxProblemPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxProblemPageSize)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// bank problems the current user can see, one page at a time
+func (env *Env) apiSearchProblems(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	q, err := parseProblemQuery(req.URL.Query(), user.GetEmail())
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	page, err := env.ds.SearchProblems(q)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, page)
+}
+
+func (env *Env) apiGetProblem(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	problem, err := env.ds.GetProblem(params["problem"], user.GetEmail())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, problem)
+}
+
+// add a problem to the bank, owned by the current user
+func (env *Env) apiCreateProblem(w http.ResponseWriter, req *http.Request, params apiParams) {
+	env.saveProblem(w, req, "", 201)
+}
+
+// replace a problem of the current user
+func (env *Env) apiUpdateProblem(w http.ResponseWriter, req *http.Request, params apiParams) {
+	env.saveProblem(w, req, params["problem"], 200)
+}
+
+func (env *Env) saveProblem(w http.ResponseWriter, req *http.Request, id string, status int) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	var problem datastore.Problem
+	if !decodeAPIBody(w, req, &problem) {
+		return
+	}
+	problem.Id = id
+	problem.Owner = user.GetEmail()
+
+	if problem.Scope != "" && problem.Scope != "private" {
+		staff, err := env.ds.IsStaff(user.GetEmail())
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		if !staff && !admin_users[user.GetEmail()] {
+			writeAPIError(w, 403, errCodeForbidden, "only instructors, TAs and admins can share problems")
+			return
+		}
+	}
+
+	var before *datastore.Problem
+	if id != "" {
+		before, _ = env.ds.GetProblem(id, user.GetEmail())
+	}
+	saved, err := env.ds.SaveProblem(problem)
+	if errors.Is(err, datastore.ErrInvalidProblem) {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "problem.save", "", saved.Id, before, saved)
+	writeAPIJSON(w, status, saved)
+}
+
+// answer 403 unless the current user can see every bank problem in ids;
+// ids that are not bank problems are not checked
+func (env *Env) apiAuthorizeProblems(w http.ResponseWriter, req *http.Request, ids []int) bool {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	hidden, err := env.ds.HiddenProblems(ids, user.GetEmail())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return false
+	}
+	if len(hidden) != 0 {
+		writeAPIError(w, 403, errCodeForbidden, fmt.Sprintf("problems %v are not shared with you", hidden))
+		return false
+	}
+	return true
+}
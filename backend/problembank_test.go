@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"datastore"
+)
+
+func TestAPIProblemBank(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	owner, colleague, student := "owner@csumb.edu", "colleague@csumb.edu", "student@csumb.edu"
+	for _, email := range []string{owner, colleague} {
+		env.ds.InsertUser(datastore.User{Email: email})
+		expectAPIStatus(t, apiRequest(t, api, email, "POST", "/sections", fmt.Sprintf(`{"name":%q}`, email)), 201, "")
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/problems", `{"name":"Mine","proofType":"prop","conclusion":"P","scope":"public"}`), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/problems", `{"name":"Mine","proofType":"prop","conclusion":"P"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, owner, "POST", "/problems", `{"name":"Bad","proofType":"modal","conclusion":"P"}`), 400, errCodeBadRequest)
+
+	var private, shared datastore.Problem
+	rr := apiRequest(t, api, owner, "POST", "/problems", `{"name":"Private","proofType":"prop","premise":["P"],"conclusion":"P","tags":["easy"]}`)
+	expectAPIStatus(t, rr, 201, "")
+	json.Unmarshal(rr.Body.Bytes(), &private)
+	rr = apiRequest(t, api, owner, "POST", "/problems", `{"name":"Shared","proofType":"prop","premise":["P"],"conclusion":"P","tags":["easy"],"scope":"department"}`)
+	expectAPIStatus(t, rr, 201, "")
+	json.Unmarshal(rr.Body.Bytes(), &shared)
+
+	rr = apiRequest(t, api, colleague, "GET", "/problems?tag=easy", "")
+	expectAPIStatus(t, rr, 200, "")
+	var page datastore.ProblemPage
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Problems) != 1 || page.Problems[0].Id != shared.Id {
+		t.Errorf("colleague's search: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, colleague, "GET", "/problems?minDifficulty=9", ""), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, colleague, "GET", "/problems/"+private.Id, ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, colleague, "PUT", "/problems/"+shared.Id, `{"name":"Taken","proofType":"prop","conclusion":"P"}`), 404, errCodeNotFound)
+
+	// assignments may use shared problems, but not private ones of others
+	expectAPIStatus(t, apiRequest(t, api, colleague, "POST", "/sections/colleague@csumb.edu/assignments",
+		fmt.Sprintf(`{"name":"HW","proofIds":[%s],"visibility":"true"}`, shared.Id)), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, colleague, "PUT", "/sections/colleague@csumb.edu/assignments/HW",
+		fmt.Sprintf(`{"proofIds":[%s,%s],"visibility":"true"}`, shared.Id, private.Id)), 403, errCodeForbidden)
+}
@@ -0,0 +1,619 @@
+package main
+
+// Problem sets
+//
+// Problem sets move problems between this server, text files and other
+// tools, in three formats:
+//
+//   - text: a paragraph per problem of "field: value" metadata lines,
+//     premise lines, and a line starting with ∴ holding the conclusion
+//   - carnap: Carnap's "label premise, premise :|-: conclusion" lines, in
+//     ProofChecker blocks whose system (ForallxSL, ForallxQL) gives the type
+//   - json: {"version": 1, "problems": [...]}
+//
+// Imported formulas go through proofcheck.ParseFormula, so the ASCII
+// spellings the proof editor accepts are accepted too, and every bad line
+// is reported. Imported problems join the problem bank, and the
+// assignments named in the set when it is imported into a section.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"datastore"
+	"proofcheck"
+)
+
+const (
+	problemSetVersion  = 1
+	maxProblemSetBytes = 4 << 20
+)
+
+var problemSetFormats = []string{"text", "carnap", "json"}
+
+// one problem of a problem set
+type setProblem struct {
+	Name       string   `json:"name"`
+	ProofType  string   `json:"proofType"` // 'prop' or 'fol'; guessed from the formulas if empty
+	Premise    []string `json:"premise"`
+	Conclusion string   `json:"conclusion"`
+	Tags       []string `json:"tags,omitempty"`
+	Difficulty int      `json:"difficulty,omitempty"`
+	Chapter    string   `json:"chapter,omitempty"`
+	Author     string   `json:"author,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	Assignment string   `json:"assignment,omitempty"` // the assignment it is in
+
+	// where the problem and its formulas were read, 0 for JSON sets
+	line           int
+	premiseLines   []int
+	conclusionLine int
+}
+
+type problemSet struct {
+	Version  int          `json:"version"`
+	Problems []setProblem `json:"problems"`
+}
+
+// something wrong with a problem set; Line is left out for JSON sets
+type problemSetError struct {
+	Line    int    `json:"line,omitempty"`
+	Problem int    `json:"problem,omitempty"` // 1 for the first problem of the set
+	Message string `json:"message"`
+}
+
+func validProblemSetFormat(format string) bool {
+	for _, f := range problemSetFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// read the problems of a set in format and check their formulas
+func readProblemSet(format string, data []byte) ([]setProblem, []problemSetError) {
+	var problems []setProblem
+	var errs []problemSetError
+	switch format {
+	case "text":
+		problems, errs = readTextProblemSet(string(data))
+	case "carnap":
+		problems, errs = readCarnapProblemSet(string(data))
+	case "json":
+		var set problemSet
+		if err := json.Unmarshal(data, &set); err != nil {
+			return nil, []problemSetError{{Message: "invalid JSON: " + err.Error()}}
+		}
+		if set.Version != problemSetVersion {
+			return nil, []problemSetError{{Message: fmt.Sprintf("problem set version %d is not supported; this server reads version %d", set.Version, problemSetVersion)}}
+		}
+		problems = set.Problems
+	}
+	if len(problems) == 0 && len(errs) == 0 {
+		errs = append(errs, problemSetError{Message: "no problems found"})
+	}
+	return problems, append(errs, checkProblemSet(problems)...)
+}
+
+var metadataLine = regexp.MustCompile(`^([A-Za-z]+):\s*(.*)$`)
+
+// set a metadata field of the text format
+func (p *setProblem) setField(name string, value string) error {
+	switch strings.ToLower(name) {
+	case "name":
+		p.Name = value
+	case "type":
+		switch value {
+		case "prop", "tfl":
+			p.ProofType = "prop"
+		case "fol":
+			p.ProofType = "fol"
+		default:
+			return fmt.Errorf("type must be prop or fol, not %q", value)
+		}
+	case "tags":
+		p.Tags = strings.Split(value, ",")
+	case "difficulty":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("difficulty must be a number, not %q", value)
+		}
+		p.Difficulty = n
+	case "chapter":
+		p.Chapter = value
+	case "author":
+		p.Author = value
+	case "scope":
+		p.Scope = value
+	case "assignment":
+		p.Assignment = value
+	default:
+		return fmt.Errorf("unknown field %q", name)
+	}
+	return nil
+}
+
+// problems are separated by blank lines; lines starting with "# " are comments
+func readTextProblemSet(data string) ([]setProblem, []problemSetError) {
+	var problems []setProblem
+	var errs []problemSetError
+	var current *setProblem
+	awaitingConclusion := false
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+		if current.Name == "" {
+			current.Name = fmt.Sprintf("Problem %d", len(problems)+1)
+		}
+		problems = append(problems, *current)
+		current, awaitingConclusion = nil, false
+	}
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, problemSetError{Line: line, Problem: len(problems) + 1, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, raw := range strings.Split(data, "\n") {
+		n := i + 1
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			finish()
+			continue
+		}
+		if strings.HasPrefix(line, "# ") {
+			continue
+		}
+		if current == nil {
+			current = &setProblem{line: n, Premise: []string{}}
+		}
+
+		if m := metadataLine.FindStringSubmatch(line); m != nil {
+			if err := current.setField(m[1], strings.TrimSpace(m[2])); err != nil {
+				fail(n, "%v", err)
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "∴"); ok {
+			if current.conclusionLine != 0 {
+				fail(n, "a second ∴ line")
+				continue
+			}
+			current.conclusionLine = n
+			current.Conclusion = strings.TrimSpace(rest)
+			awaitingConclusion = current.Conclusion == ""
+			continue
+		}
+		switch {
+		case awaitingConclusion:
+			current.Conclusion, current.conclusionLine = line, n
+			awaitingConclusion = false
+		case current.conclusionLine != 0:
+			fail(n, "%q follows the conclusion; separate problems with a blank line", line)
+		default:
+			current.Premise = append(current.Premise, line)
+			current.premiseLines = append(current.premiseLines, n)
+		}
+	}
+	finish()
+	return problems, errs
+}
+
+var (
+	carnapFence = regexp.MustCompile("^(```|~~~)\\s*(\\{.*\\})?")
+	// Carnap spellings the proof editor does not accept
+	fromCarnap = strings.NewReplacer(`/\`, "∧", `\/`, "∨", "!?", "⊥", "_|_", "⊥")
+	toCarnap   = strings.NewReplacer("→", "->", "↔", "<->", "∧", `/\`, "∨", `\/`, "¬", "~", "⊥", "!?", "∀", "A", "∃", "E")
+)
+
+// the proof type of a Carnap block from its classes, e.g. {.ProofChecker .ForallxQL}
+func carnapProofType(classes string) string {
+	switch {
+	case strings.Contains(classes, "QL"), strings.Contains(classes, "FOL"):
+		return "fol"
+	case strings.Contains(classes, "SL"), strings.Contains(classes, "TFL"):
+		return "prop"
+	}
+	return ""
+}
+
+// problem lines may be inside or outside fenced blocks; other lines outside
+// blocks are prose and are skipped
+func readCarnapProblemSet(data string) ([]setProblem, []problemSetError) {
+	var problems []setProblem
+	var errs []problemSetError
+	inBlock, proofType := false, ""
+
+	for i, raw := range strings.Split(data, "\n") {
+		n := i + 1
+		line := strings.TrimSpace(raw)
+		if m := carnapFence.FindStringSubmatch(line); m != nil {
+			inBlock = !inBlock
+			proofType = ""
+			if inBlock {
+				proofType = carnapProofType(m[2])
+			}
+			continue
+		}
+		left, conclusion, ok := strings.Cut(line, ":|-:")
+		if !ok {
+			if inBlock && line != "" {
+				errs = append(errs, problemSetError{Line: n, Problem: len(problems) + 1, Message: "expected label premise, premise :|-: conclusion"})
+			}
+			continue
+		}
+		label, premises, _ := strings.Cut(strings.TrimSpace(left), " ")
+		if label == "" {
+			errs = append(errs, problemSetError{Line: n, Problem: len(problems) + 1, Message: "a Carnap problem starts with its label"})
+			continue
+		}
+
+		problem := setProblem{Name: label, ProofType: proofType, Premise: []string{},
+			Conclusion: fromCarnap.Replace(strings.TrimSpace(conclusion)), line: n, conclusionLine: n}
+		for _, premise := range strings.Split(premises, ",") {
+			if premise = strings.TrimSpace(premise); premise != "" {
+				problem.Premise = append(problem.Premise, fromCarnap.Replace(premise))
+				problem.premiseLines = append(problem.premiseLines, n)
+			}
+		}
+		problems = append(problems, problem)
+	}
+	return problems, errs
+}
+
+// first-order if a formula has a quantifier or a term; 'v' is a disjunction
+func guessProofType(formulas []string) string {
+	for _, formula := range formulas {
+		for _, r := range formula {
+			if r == '∀' || r == '∃' || (r >= 'a' && r <= 'z' && r != 'v') {
+				return "fol"
+			}
+		}
+	}
+	return "prop"
+}
+
+// normalize the formulas of problems in place, and report what would keep
+// them from being saved
+func checkProblemSet(problems []setProblem) []problemSetError {
+	var errs []problemSetError
+	names := map[string]int{}
+
+	for i := range problems {
+		p := &problems[i]
+		fail := func(line int, format string, args ...interface{}) {
+			errs = append(errs, problemSetError{Line: line, Problem: i + 1, Message: fmt.Sprintf(format, args...)})
+		}
+
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			fail(p.line, "a name is required")
+		}
+		if p.Premise == nil {
+			p.Premise = []string{}
+		}
+		if p.ProofType == "" {
+			p.ProofType = guessProofType(append(append([]string{}, p.Premise...), p.Conclusion))
+		}
+		if p.ProofType != "prop" && p.ProofType != "fol" {
+			fail(p.line, "proofType must be prop or fol")
+			continue
+		}
+		if p.Difficulty < 0 || p.Difficulty > datastore.MaxProblemDifficulty {
+			fail(p.line, "difficulty must be between 0 and %d", datastore.MaxProblemDifficulty)
+		}
+		if p.Scope != "" && p.Scope != "private" && p.Scope != "department" && p.Scope != "public" {
+			fail(p.line, "scope must be private, department or public")
+		}
+
+		for j, premise := range p.Premise {
+			formula, err := proofcheck.ParseFormula(premise, p.ProofType == "fol")
+			if err != nil {
+				line := p.line
+				if j < len(p.premiseLines) {
+					line = p.premiseLines[j]
+				}
+				fail(line, "premise %q: %v", premise, err)
+				continue
+			}
+			p.Premise[j] = formula
+		}
+		if p.Conclusion == "" {
+			fail(p.line, "no conclusion; it goes on a line starting with ∴")
+		} else if formula, err := proofcheck.ParseFormula(p.Conclusion, p.ProofType == "fol"); err != nil {
+			line := p.conclusionLine
+			if line == 0 {
+				line = p.line
+			}
+			fail(line, "conclusion %q: %v", p.Conclusion, err)
+		} else {
+			p.Conclusion = formula
+		}
+
+		// a problem may be repeated, e.g. in two assignments, but a name
+		// must not stand for two problems
+		if first, ok := names[p.Name]; ok {
+			q := problems[first]
+			if q.ProofType != p.ProofType || q.Conclusion != p.Conclusion || fmt.Sprint(q.Premise) != fmt.Sprint(p.Premise) {
+				fail(p.line, "problem %d is also named %q", first+1, p.Name)
+			}
+		} else if p.Name != "" {
+			names[p.Name] = i
+		}
+	}
+	return errs
+}
+
+// write problems in format; the JSON format is written by writeAPIJSON
+func writeProblemSet(w io.Writer, format string, problems []setProblem) {
+	switch format {
+	case "text":
+		for i, p := range problems {
+			if i != 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "name: %s\ntype: %s\n", p.Name, p.ProofType)
+			for _, field := range []struct{ name, value string }{
+				{"assignment", p.Assignment},
+				{"tags", strings.Join(p.Tags, ", ")},
+				{"chapter", p.Chapter},
+				{"author", p.Author},
+			} {
+				if field.value != "" {
+					fmt.Fprintf(w, "%s: %s\n", field.name, field.value)
+				}
+			}
+			if p.Difficulty != 0 {
+				fmt.Fprintf(w, "difficulty: %d\n", p.Difficulty)
+			}
+			if p.Scope != "" && p.Scope != "private" {
+				fmt.Fprintf(w, "scope: %s\n", p.Scope)
+			}
+			for _, premise := range p.Premise {
+				fmt.Fprintln(w, premise)
+			}
+			fmt.Fprintf(w, "∴ %s\n", p.Conclusion)
+		}
+
+	case "carnap":
+		// one block per run of problems of the same type
+		for i, p := range problems {
+			if i == 0 || problems[i-1].ProofType != p.ProofType {
+				if i != 0 {
+					fmt.Fprint(w, "```\n\n")
+				}
+				system := "ForallxSL"
+				if p.ProofType == "fol" {
+					system = "ForallxQL"
+				}
+				fmt.Fprintf(w, "```{.ProofChecker .%s}\n", system)
+			}
+			label := strings.Join(strings.Fields(p.Name), "_")
+			premises := make([]string, len(p.Premise))
+			for j, premise := range p.Premise {
+				premises[j] = toCarnap.Replace(premise)
+			}
+			if len(premises) == 0 {
+				fmt.Fprintf(w, "%s :|-: %s\n", label, toCarnap.Replace(p.Conclusion))
+			} else {
+				fmt.Fprintf(w, "%s %s :|-: %s\n", label, strings.Join(premises, ", "), toCarnap.Replace(p.Conclusion))
+			}
+		}
+		if len(problems) != 0 {
+			fmt.Fprint(w, "```\n")
+		}
+	}
+}
+
+// what an import added
+type apiProblemSetImport struct {
+	Problems    []datastore.Problem    `json:"problems"`
+	Assignments []datastore.Assignment `json:"assignments,omitempty"`
+}
+
+// the error envelope of a problem set with mistakes, with every one of them
+type apiProblemSetErrors struct {
+	Error  apiError          `json:"error"`
+	Errors []problemSetError `json:"errors"`
+}
+
+// add the problems of a set to the bank; with ?section= they are also
+// added to the assignments the set names, or to ?assignment=
+func (env *Env) apiImportProblemSet(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	values := req.URL.Query()
+
+	format := values.Get("format")
+	if !validProblemSetFormat(format) {
+		writeAPIError(w, 400, errCodeBadRequest, "format must be text, carnap or json")
+		return
+	}
+	sectionName, assignmentName := values.Get("section"), values.Get("assignment")
+	if sectionName == "" && assignmentName != "" {
+		writeAPIError(w, 400, errCodeBadRequest, "assignment requires section")
+		return
+	}
+	if sectionName != "" && !env.apiAuthorize(w, req, sectionName, false) {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxProblemSetBytes))
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, "Unable to read request body.")
+		return
+	}
+	problems, errs := readProblemSet(format, data)
+	if len(errs) != 0 {
+		writeAPIJSON(w, 400, apiProblemSetErrors{
+			Error:  apiError{Code: errCodeBadRequest, Message: fmt.Sprintf("the problem set has %d errors", len(errs))},
+			Errors: errs,
+		})
+		return
+	}
+
+	// the problems of each assignment, in order, by name
+	var assignmentNames []string
+	assignmentProblems := map[string][]string{}
+	if sectionName != "" {
+		for _, p := range problems {
+			name := p.Assignment
+			if name == "" {
+				name = assignmentName
+			}
+			if name == "" {
+				continue
+			}
+			if _, ok := assignmentProblems[name]; !ok {
+				assignmentNames = append(assignmentNames, name)
+			}
+			assignmentProblems[name] = append(assignmentProblems[name], p.Name)
+		}
+		existing, err := env.ds.GetAssignmentsBySection(sectionName)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		for _, assignment := range existing {
+			if _, ok := assignmentProblems[assignment.Name]; ok {
+				writeAPIError(w, 409, errCodeConflict, fmt.Sprintf("assignment %q already exists", assignment.Name))
+				return
+			}
+		}
+	}
+
+	var bank []datastore.Problem
+	seen := map[string]bool{}
+	shares := false
+	for _, p := range problems {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		shares = shares || (p.Scope != "" && p.Scope != "private")
+		bank = append(bank, datastore.Problem{Owner: user.GetEmail(), Name: p.Name, ProofType: p.ProofType,
+			Premise: p.Premise, Conclusion: p.Conclusion, Tags: p.Tags, Difficulty: p.Difficulty,
+			Chapter: p.Chapter, Author: p.Author, Scope: p.Scope})
+	}
+	if shares {
+		staff, err := env.ds.IsStaff(user.GetEmail())
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		if !staff && !admin_users[user.GetEmail()] {
+			writeAPIError(w, 403, errCodeForbidden, "only instructors, TAs and admins can share problems")
+			return
+		}
+	}
+
+	saved, err := env.ds.SaveProblems(bank)
+	if errors.Is(err, datastore.ErrInvalidProblem) {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	response := apiProblemSetImport{Problems: saved}
+	for _, problem := range saved {
+		env.audit(req, "problem.save", "", problem.Id, nil, problem)
+	}
+
+	ids := map[string]int{}
+	for _, problem := range saved {
+		ids[problem.Name], _ = strconv.Atoi(problem.Id)
+	}
+	for _, name := range assignmentNames {
+		var proofIds []int
+		for _, problemName := range assignmentProblems[name] {
+			proofIds = append(proofIds, ids[problemName])
+		}
+		// hidden until the instructor has looked it over
+		assignment := datastore.Assignment{SectionName: sectionName, Name: name, ProofIds: fmt.Sprint(proofIds), Visibility: "false"}
+		if err := env.ds.InsertAssignment(assignment); err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		env.audit(req, "assignment.create", sectionName, name, nil, assignment)
+		response.Assignments = append(response.Assignments, assignment)
+	}
+
+	logger.InfoContext(req.Context(), "apiImportProblemSet: problem set imported", "problems", len(saved), "assignments", len(assignmentNames))
+	writeAPIJSON(w, 201, response)
+}
+
+// the problems of a section's assignments, or of ?assignment=, as a download
+func (env *Env) apiExportProblemSet(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	values := req.URL.Query()
+	format := values.Get("format")
+	if !validProblemSetFormat(format) {
+		writeAPIError(w, 400, errCodeBadRequest, "format must be text, carnap or json")
+		return
+	}
+
+	assignments, err := env.ds.GetAssignmentsBySection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	problems := []setProblem{}
+	found := false
+	for _, assignment := range assignments {
+		if name := values.Get("assignment"); name != "" && name != assignment.Name {
+			continue
+		}
+		found = true
+		proofs, err := env.ds.GetAssignmentProofs(assignment)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		for _, proof := range proofs {
+			p := setProblem{Name: proof.ProofName, ProofType: proof.ProofType, Premise: proof.Premise,
+				Conclusion: proof.Conclusion, Assignment: assignment.Name}
+			if p.Premise == nil {
+				p.Premise = []string{}
+			}
+			// bank metadata, where the caller can see it
+			problem, err := env.ds.GetProblem(proof.Id, user.GetEmail())
+			if err != nil && !errors.Is(err, datastore.ErrNotExists) {
+				writeDatastoreError(w, err)
+				return
+			}
+			if err == nil {
+				p.Tags, p.Difficulty, p.Chapter, p.Author, p.Scope = problem.Tags, problem.Difficulty, problem.Chapter, problem.Author, problem.Scope
+			}
+			problems = append(problems, p)
+		}
+	}
+	if values.Get("assignment") != "" && !found {
+		writeAPIError(w, 404, errCodeNotFound, "no such assignment")
+		return
+	}
+
+	extension := map[string]string{"text": ".txt", "carnap": ".md", "json": ".json"}[format]
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": params["section"] + extension}))
+	switch format {
+	case "json":
+		writeAPIJSON(w, 200, problemSet{Version: problemSetVersion, Problems: problems})
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeProblemSet(w, format, problems)
+	case "carnap":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		writeProblemSet(w, format, problems)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+const textProblemSet = `# chapter 15 exercises
+name: Modus ponens
+tags: mp, conditionals
+difficulty: 1
+chapter: 15
+P -> Q
+P
+∴ Q
+
+name: Quantifier shift
+author: forall x
+Ex Ay Rxy
+∴
+Ay Ex Rxy
+
+∴ P v ~P
+`
+
+func TestReadTextProblemSet(t *testing.T) {
+	problems, errs := readProblemSet("text", []byte(textProblemSet))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []setProblem{
+		{Name: "Modus ponens", ProofType: "prop", Premise: []string{"P → Q", "P"}, Conclusion: "Q",
+			Tags: []string{"mp", " conditionals"}, Difficulty: 1, Chapter: "15"},
+		{Name: "Quantifier shift", ProofType: "fol", Premise: []string{"∃x ∀y Rxy"}, Conclusion: "∀y ∃x Rxy", Author: "forall x"},
+		{Name: "Problem 3", ProofType: "prop", Premise: []string{}, Conclusion: "P ∨ ¬P"},
+	}
+	for i := range problems {
+		problems[i].line, problems[i].premiseLines, problems[i].conclusionLine = 0, nil, 0
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got %+v\nwant %+v", problems, want)
+	}
+}
+
+func TestProblemSetErrors(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		set    string
+		want   []problemSetError
+	}{
+		{"text", "P\nP → \n∴ Q\n\ncolour: red\nP\n∴ P\nQ\n", []problemSetError{
+			{Line: 5, Problem: 2, Message: `unknown field "colour"`},
+			{Line: 8, Problem: 2, Message: `"Q" follows the conclusion; separate problems with a blank line`},
+			{Line: 2, Problem: 1, Message: `premise "P →": Formula or subformula is blank.`},
+		}},
+		{"text", "name: A\nP\n\nname: A\nQ\n∴ Q\n", []problemSetError{
+			{Line: 1, Problem: 1, Message: "no conclusion; it goes on a line starting with ∴"},
+			{Line: 4, Problem: 2, Message: `problem 1 is also named "A"`},
+		}},
+		{"carnap", "Some prose.\n```{.ProofChecker .ForallxSL}\n1.1 P, P->Q :|-: Q\nP :|-\n :|-: P\n```\n", []problemSetError{
+			{Line: 4, Problem: 2, Message: "expected label premise, premise :|-: conclusion"},
+			{Line: 5, Problem: 2, Message: "a Carnap problem starts with its label"},
+		}},
+		{"json", `{"version":2,"problems":[]}`, []problemSetError{
+			{Message: "problem set version 2 is not supported; this server reads version 1"},
+		}},
+		{"json", `{"version":1,"problems":[{"name":"A","conclusion":"P ∧"}]}`, []problemSetError{
+			{Problem: 1, Message: `conclusion "P ∧": Formula or subformula is blank.`},
+		}},
+		{"carnap", "", []problemSetError{{Message: "no problems found"}}},
+	} {
+		_, errs := readProblemSet(c.format, []byte(c.set))
+		if !reflect.DeepEqual(errs, c.want) {
+			t.Errorf("%s %q:\ngot  %+v\nwant %+v", c.format, c.set, errs, c.want)
+		}
+	}
+}
+
+func TestProblemSetRoundTrip(t *testing.T) {
+	problems, errs := readProblemSet("text", []byte(textProblemSet))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, format := range []string{"text", "carnap"} {
+		var out bytes.Buffer
+		writeProblemSet(&out, format, problems)
+		again, errs := readProblemSet(format, out.Bytes())
+		if len(errs) != 0 {
+			t.Fatalf("%s: %v\n%s", format, errs, out.String())
+		}
+		for i := range problems {
+			if again[i].ProofType != problems[i].ProofType || again[i].Conclusion != problems[i].Conclusion ||
+				fmt.Sprint(again[i].Premise) != fmt.Sprint(problems[i].Premise) {
+				t.Errorf("%s: %+v came back as %+v\n%s", format, problems[i], again[i], out.String())
+			}
+		}
+	}
+}
+
+func TestAPIProblemSets(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+
+	rr := apiRequest(t, api, instructor, "POST", "/problem-sets?format=text", "P\n∴ Q ∧\n")
+	expectAPIStatus(t, rr, 400, errCodeBadRequest)
+	if !strings.Contains(rr.Body.String(), `"line":2`) {
+		t.Errorf("no line number: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/problem-sets?format=docx", textProblemSet), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/problem-sets?format=text&section=Logic&assignment=HW", textProblemSet), 403, errCodeForbidden)
+
+	rr = apiRequest(t, api, instructor, "POST", "/problem-sets?format=text&section=Logic&assignment=HW%201", textProblemSet)
+	expectAPIStatus(t, rr, 201, "")
+	var imported apiProblemSetImport
+	json.Unmarshal(rr.Body.Bytes(), &imported)
+	if len(imported.Problems) != 3 || len(imported.Assignments) != 1 || imported.Assignments[0].Visibility != "false" {
+		t.Fatalf("unexpected import: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/problem-sets?format=text&section=Logic&assignment=HW%201", textProblemSet), 409, errCodeConflict)
+
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/problem-set?format=carnap", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), "Modus_ponens P -> Q, P :|-: Q\n") {
+		t.Errorf("carnap export:\n%s", rr.Body.String())
+	}
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/problem-set?format=text", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), "name: Modus ponens\ntype: prop\nassignment: HW 1\ntags: conditionals, mp\nchapter: 15\ndifficulty: 1\n") {
+		t.Errorf("text export:\n%s", rr.Body.String())
+	}
+
+	// the export imports into another section as the same assignment
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic 2"}`), 201, "")
+	rr = apiRequest(t, api, instructor, "POST", "/problem-sets?format=text&section=Logic%202", rr.Body.String())
+	expectAPIStatus(t, rr, 201, "")
+	json.Unmarshal(rr.Body.Bytes(), &imported)
+	if len(imported.Assignments) != 1 || imported.Assignments[0].Name != "HW 1" {
+		t.Errorf("re-import: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/problem-set?format=json&assignment=HW%209", ""), 404, errCodeNotFound)
+}
@@ -0,0 +1,675 @@
+// Package proofcheck checks Fitch-style proofs, as frontend/checkproof.php
+// does: the same rules, the same issues in the same order and wording, and
+// the same verdict on whether the wanted conclusion was reached.
+package proofcheck
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Entry is a line of a proof, or a subproof with its own entries. In JSON a
+// line is {"wffstr": ..., "jstr": ...} and a subproof is an array.
+type Entry struct {
+	WffStr     string  // the formula
+	JStr       string  // the justification, e.g. "1, 2 →E"
+	IsSubproof bool    // whether this is a subproof rather than a line
+	Subproof   []Entry // the entries of a subproof
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	*e = Entry{}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		e.IsSubproof = true
+		e.Subproof = []Entry{}
+		return json.Unmarshal(data, &e.Subproof)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return errors.New("proofcheck: a proof entry must be a line object or a subproof array")
+	}
+	var err error
+	if e.WffStr, err = phpString(fields["wffstr"]); err != nil {
+		return err
+	}
+	e.JStr, err = phpString(fields["jstr"])
+	return err
+}
+
+func (e Entry) MarshalJSON() ([]byte, error) {
+	if e.IsSubproof {
+		if e.Subproof == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(e.Subproof)
+	}
+	return json.Marshal(struct {
+		WffStr string `json:"wffstr"`
+		JStr   string `json:"jstr"`
+	}{e.WffStr, e.JStr})
+}
+
+// a JSON scalar as PHP converts it to a string; missing and null are ""
+func phpString(raw json.RawMessage) (string, error) {
+	text := strings.TrimSpace(string(raw))
+	switch {
+	case text == "" || text == "null" || text == "false":
+		return "", nil
+	case text == "true":
+		return "1", nil
+	case strings.HasPrefix(text, `"`):
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		return "", errors.New("proofcheck: a formula or justification must be a string")
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return strconv.FormatInt(n, 10), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f, 'G', 14, 64), nil
+}
+
+// ParseProof decodes the proofData of a check request: a JSON array of
+// entries.
+func ParseProof(data []byte) ([]Entry, error) {
+	var proof []Entry
+	if err := json.Unmarshal(data, &proof); err != nil {
+		return nil, err
+	}
+	if proof == nil {
+		return nil, errors.New("proofcheck: proof data must be an array")
+	}
+	return proof, nil
+}
+
+// Intval converts a string to an integer as PHP's intval does, e.g. the
+// numPrems of a check request; anything unparsable is 0.
+func Intval(s string) int {
+	s = strings.TrimLeft(s, " \t\n\r\v\f")
+	if f, err := strconv.ParseFloat(strings.TrimRight(s, " \t\n\r\v\f"), 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		return saturate(f)
+	}
+	end := 0
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.ParseInt(s[:end], 10, 64)
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) && numErr.Err == strconv.ErrRange {
+			if strings.HasPrefix(s, "-") {
+				return math.MinInt64
+			}
+			return math.MaxInt64
+		}
+		return 0
+	}
+	return int(n)
+}
+
+func saturate(f float64) int {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int(f)
+}
+
+// CheckResult is the answer to a check request.
+type CheckResult struct {
+	Issues      []string `json:"issues"`      // "Line n: ..." for every problem, in line order
+	ConcReached bool     `json:"concReached"` // whether a top-level line is the wanted conclusion
+}
+
+// rule names that may be cited
+var (
+	tflRules = []string{"∧I", "∧E", "⊥I", "⊥E", "→I", "→E", "RAA", "TND", "∨I", "∨E", "↔I", "↔E", "DS", "Rep", "MT", "DNE", "DeM", "Pr", "Hyp", "X", "IP", "LEM", "Bicondition"}
+	folRules = []string{"∀E", "∀I", "∃I", "∃E", "=I", "=E", "CQ"}
+)
+
+// how many lines and subproofs each rule cites
+var citeNums = map[string][2]int{
+	"∧I": {2, 0}, "∧E": {1, 0}, "⊥I": {2, 0}, "⊥E": {1, 0},
+	"¬I": {0, 1}, "¬E": {2, 0}, "→I": {0, 1}, "→E": {2, 0},
+	"RAA": {0, 1}, "TND": {0, 2}, "∨I": {1, 0}, "∨E": {1, 2},
+	"↔I": {0, 2}, "↔E": {2, 0}, "DS": {2, 0}, "Rep": {1, 0},
+	"MT": {2, 0}, "DNE": {1, 0}, "DeM": {1, 0},
+	"∀E": {1, 0}, "∀I": {1, 0}, "∃I": {1, 0}, "∃E": {1, 1},
+	"=I": {0, 0}, "=E": {2, 0}, "CQ": {1, 0},
+	"Hyp": {0, 0}, "Pr": {0, 0}, "X": {1, 0}, "IP": {0, 1},
+	"LEM": {0, 2}, "Bicondition": {2, 0},
+}
+
+// names of the rules in the frontend's terminology, for issues
+var ruleDisplayNames = []struct{ rule, name string }{
+	{"DNE", "Double Negation"},
+	{"→E", "Modus Ponens"},
+	{"MT", "Modus Tollens"},
+	{"DS", "Modus Tollendo Ponens"},
+	{"∧E", "Simplification"},
+	{"∨I", "Addition"},
+	{"∧I", "Adjunction"},
+	{"↔E", "Equivalence"},
+	{"↔I", "Bicondition"},
+	{"=E", "Substitution of identicals"},
+	{"=I", "Identity introduction"},
+	{"∀E", "Universal instantiation"},
+	{"∀I", "Universal derivation"},
+	{"∃E", "Existential instantiation"},
+	{"∃I", "existential generalization"},
+	{"Rep", "repeat"},
+}
+
+func displayName(rule string) string {
+	for _, d := range ruleDisplayNames {
+		if strings.Contains(rule, d.rule) {
+			return d.name
+		}
+	}
+	return rule
+}
+
+// the frontend's names for rules, as unChangeRuleNames in proofs.js maps
+// them back; each pattern replaces its first match only, in this order
+var ruleNamePatterns = []struct {
+	pattern *regexp.Regexp
+	rule    string
+}{
+	{regexp.MustCompile(`(?i)double negation`), "DNE"},
+	{regexp.MustCompile(`(?i)modus ponens`), "→E"},
+	{regexp.MustCompile(`(?i)modus tollens`), "MT"},
+	{regexp.MustCompile(`(?i)modus tollendo ponens`), "DS"},
+	{regexp.MustCompile(`(?i)reductio ad absurdum`), "RAA"},
+	{regexp.MustCompile(`(?i)simplification`), "∧E"},
+	{regexp.MustCompile(`(?i)addition`), "∨I"},
+	{regexp.MustCompile(`(?i)adjunction`), "∧I"},
+	{regexp.MustCompile(`(?i)equi[v∨]alence`), "↔E"},
+	{regexp.MustCompile(`(?i)bicondition`), "Bicondition"},
+	{regexp.MustCompile(`(?i)conditional deri[v∨]ation`), "→I"},
+	{regexp.MustCompile(`(?i)identity introduction`), "=I"},
+	{regexp.MustCompile(`(?i)substitution of identicals`), "=E"},
+	{regexp.MustCompile(`(?i)uni[v∨]ersal instantiation`), "∀E"},
+	{regexp.MustCompile(`(?i)uni[v∨]ersal derivation`), "∀I"},
+	{regexp.MustCompile(`(?i)existential generalization`), "∃I"},
+	{regexp.MustCompile(`(?i)existential instantiation`), "∃E"},
+	{regexp.MustCompile(`(?i)repeat`), "Rep"},
+}
+
+// UnchangeRuleNames replaces the frontend's names for rules in a
+// justification with the names the checker knows, as the frontend does
+// before sending a proof to be checked.
+func UnchangeRuleNames(jstr string) string {
+	for _, p := range ruleNamePatterns {
+		if loc := p.pattern.FindStringIndex(jstr); loc != nil {
+			jstr = jstr[:loc[0]] + p.rule + jstr[loc[1]:]
+		}
+	}
+	return jstr
+}
+
+// UnchangeAllRuleNames applies UnchangeRuleNames to every line of proof.
+func UnchangeAllRuleNames(proof []Entry) []Entry {
+	unchanged := make([]Entry, len(proof))
+	for i, e := range proof {
+		if e.IsSubproof {
+			e.Subproof = UnchangeAllRuleNames(e.Subproof)
+		} else {
+			e.JStr = UnchangeRuleNames(e.JStr)
+		}
+		unchanged[i] = e
+	}
+	return unchanged
+}
+
+type subproofCite struct {
+	start, end int
+}
+
+// a parsed justification
+type justification struct {
+	rules    []string // cited so far when parsing failed
+	lines    []int
+	subps    []subproofCite
+	parsedOK bool
+	errMsg   string
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// collapse each run of the characters in set to replacement
+func collapseRuns(s string, in func(rune) bool, replacement string) string {
+	var b strings.Builder
+	inRun := false
+	for _, r := range s {
+		if in(r) {
+			if !inRun {
+				b.WriteString(replacement)
+			}
+			inRun = true
+			continue
+		}
+		inRun = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (c *checker) parseJustification(jstr string) justification {
+	j := justification{parsedOK: true}
+	jstr = collapseRuns(jstr, func(r rune) bool { return r == ';' || r == ',' || unicode.IsSpace(r) }, ",")
+	jstr = collapseRuns(jstr, func(r rune) bool { return r == '-' || r == '–' }, "-")
+
+	for _, part := range strings.Split(jstr, ",") {
+		if part == "" {
+			j.parsedOK = false
+			j.errMsg = "Justification left blank."
+			return j
+		}
+		if isDigits(part) {
+			j.lines = append(j.lines, Intval(part))
+			continue
+		}
+		if start, end, ok := strings.Cut(part, "-"); ok && start != "" && end != "" && isDigits(start) && isDigits(end) {
+			j.subps = append(j.subps, subproofCite{Intval(start), Intval(end)})
+			continue
+		}
+		if contains(tflRules, part) || (c.predicate && contains(folRules, part)) {
+			j.rules = append(j.rules, part)
+		} else {
+			j.parsedOK = false
+			j.errMsg = "Justification cites nonexistent rule (" + part + ") or is badly formed."
+			return j
+		}
+	}
+	if len(j.rules) > 1 {
+		j.parsedOK = false
+		j.errMsg = "More than one rule cited."
+	}
+	if len(j.rules) < 1 {
+		j.parsedOK = false
+		j.errMsg = "No rule cited."
+	}
+	return j
+}
+
+func (j *justification) rule() string {
+	if len(j.rules) == 0 {
+		return ""
+	}
+	return j.rules[0]
+}
+
+// a line of a flattened proof
+type line struct {
+	wffStr       string
+	jStr         string
+	location     []int // index in each enclosing subproof
+	issues       []string
+	kinds        []string // the Mistake kind of each issue
+	wff          *wff
+	j            justification
+	canBeChecked bool
+}
+
+func flatten(proof []Entry, depth []int) []*line {
+	var lines []*line
+	for i, e := range proof {
+		location := append(append([]int{}, depth...), i)
+		if e.IsSubproof {
+			lines = append(lines, flatten(e.Subproof, location)...)
+		} else {
+			lines = append(lines, &line{wffStr: e.WffStr, jStr: e.JStr, location: location})
+		}
+	}
+	return lines
+}
+
+func itoa(n int) string { return strconv.Itoa(n) }
+
+// Check checks a proof whose first numPrems lines may be premises and
+// which should reach conclusion; predicate selects first-order logic.
+func Check(proof []Entry, numPrems int, conclusion string, predicate bool) CheckResult {
+	return CheckRules(proof, numPrems, conclusion, predicate, nil)
+}
+
+// CheckRules is Check allowing only the rules in allowed, or every rule
+// when allowed is nil; see AllowedRules.
+func CheckRules(proof []Entry, numPrems int, conclusion string, predicate bool, allowed []string) CheckResult {
+	rv, _ := check(proof, numPrems, conclusion, predicate, allowed)
+	return rv
+}
+
+// check checks a proof, returning its flattened lines with their issues
+func check(proof []Entry, numPrems int, conclusion string, predicate bool, allowed []string) (CheckResult, []*line) {
+	c := &checker{predicate: predicate}
+	rv := CheckResult{Issues: []string{}}
+	lines := flatten(proof, nil)
+	count := len(lines)
+
+	// formula syntax
+	for _, l := range lines {
+		l.wff = c.parse(l.wffStr)
+		if !l.wff.isWellFormed {
+			l.addIssue(MistakeNotWellFormed, "Not well-formed: "+l.wff.errMsg)
+		}
+	}
+
+	// justification syntax
+	for _, l := range lines {
+		l.j = c.parseJustification(l.jStr)
+		if !l.j.parsedOK {
+			l.addIssue(MistakeJustification, "Cannot parse justification: "+l.j.errMsg)
+		}
+	}
+
+	// rules the problem allows
+	for _, l := range lines {
+		if l.j.parsedOK && !ruleAllowed(allowed, l.j.rule()) {
+			l.addIssue(MistakeDisallowedRule, disallowedIssue(l.j.rule()))
+		}
+	}
+
+	// the right number of citations
+	for _, l := range lines {
+		if !l.j.parsedOK {
+			continue
+		}
+		rule := l.j.rule()
+		want := citeNums[rule]
+		if len(l.j.lines) < want[0] {
+			l.addIssue(MistakeCitationCount, "Cites too few line numbers for the rule "+displayName(rule)+".")
+		}
+		if len(l.j.lines) > want[0] {
+			l.addIssue(MistakeCitationCount, "Cites too many line numbers for the rule "+displayName(rule)+".")
+		}
+		if len(l.j.subps) < want[1] {
+			l.addIssue(MistakeCitationCount, "Cites too few ranges of lines for the rule "+displayName(rule)+".")
+		}
+		if len(l.j.subps) > want[1] {
+			l.addIssue(MistakeCitationCount, "Cites too many ranges of lines for the rule "+displayName(rule)+".")
+		}
+	}
+
+	// cited lines and subproofs are available
+	for i, l := range lines {
+		if !l.j.parsedOK {
+			continue
+		}
+		n := i + 1
+		nloc := l.location
+		for _, cited := range l.j.lines {
+			switch {
+			case cited > count || cited < 1:
+				l.addIssue(MistakeBadCitation, "Cites nonexistent line ("+itoa(cited)+").")
+			case cited == n:
+				l.addIssue(MistakeBadCitation, "Cites itself.")
+			case cited > n:
+				l.addIssue(MistakeBadCitation, "Cites a line ("+itoa(cited)+") that occurs after it.")
+			case !available(lines[cited-1].location, nloc):
+				l.addIssue(MistakeClosedSubproof, "Cites an unavailable line ("+itoa(cited)+").")
+			}
+		}
+		for _, sp := range l.j.subps {
+			cite := " (" + itoa(sp.start) + "–" + itoa(sp.end) + ")."
+			if sp.start > sp.end {
+				l.addIssue(MistakeBadCitation, "Cites a range of lines in the wrong order"+cite)
+				continue
+			}
+			if sp.start > count || sp.end > count || sp.start < 1 || sp.end < 0 {
+				l.addIssue(MistakeBadCitation, "Cites a line nonexistent range of lines"+cite)
+				continue
+			}
+			if sp.end >= n {
+				l.addIssue(MistakeBadCitation, "Cites a line range after or including itself"+cite)
+				continue
+			}
+			// an actual subproof
+			startloc := lines[sp.start-1].location
+			endloc := lines[sp.end-1].location
+			problem := len(endloc) != len(startloc) || startloc[len(startloc)-1] != 0
+			for d := 0; d < len(startloc)-1 && !problem; d++ {
+				problem = endloc[d] != startloc[d]
+			}
+			if problem {
+				l.addIssue(MistakeBadCitation, "Cites a range of lines which do not make up a subproof"+cite)
+				continue
+			}
+			// at the level of this line
+			cloc := startloc[:len(startloc)-1]
+			if len(cloc) != len(nloc) || !samePrefix(cloc, nloc, len(cloc)-1) {
+				l.addIssue(MistakeClosedSubproof, "Cites an unavailable subproof"+cite)
+			}
+		}
+	}
+
+	// cited lines are well-formed
+	for _, l := range lines {
+		l.canBeChecked = len(l.issues) == 0
+		if !l.canBeChecked {
+			continue
+		}
+		for _, cited := range l.j.lines {
+			if !lines[cited-1].wff.isWellFormed {
+				l.canBeChecked = false
+				l.addIssue(MistakeBadCitation, "Cites another line that is not well-formed ("+itoa(cited)+").")
+			}
+		}
+		for _, sp := range l.j.subps {
+			if !lines[sp.start-1].wff.isWellFormed {
+				l.canBeChecked = false
+				l.addIssue(MistakeBadCitation, "Cites another line that is not well-formed ("+itoa(sp.start)+").")
+			}
+			if !lines[sp.end-1].wff.isWellFormed {
+				l.canBeChecked = false
+				l.addIssue(MistakeBadCitation, "Cites another line that is not well-formed ("+itoa(sp.end)+").")
+			}
+		}
+	}
+
+	// the rules
+	for i, l := range lines {
+		if l.canBeChecked && !c.follows(lines, i, numPrems) {
+			l.addIssue(applicationMistake(l.j.rule()), "Is not a proper application of the rule "+displayName(l.j.rule())+" (for the line(s) cited).")
+		}
+	}
+
+	for i, l := range lines {
+		for _, issue := range l.issues {
+			rv.Issues = append(rv.Issues, "Line "+itoa(i+1)+": "+issue)
+		}
+	}
+
+	if len(rv.Issues) == 0 {
+		conc := c.parse(conclusion)
+		if !conc.isWellFormed {
+			rv.Issues = append(rv.Issues, "Desired conclusion is not a wff. Oops!")
+		} else {
+			for _, l := range lines {
+				if len(l.location) == 1 && c.sameWff(l.wff, conc) {
+					rv.ConcReached = true
+				}
+			}
+		}
+	}
+	return rv, lines
+}
+
+// whether a line at cloc can be cited from a line at nloc
+func available(cloc, nloc []int) bool {
+	return len(cloc) <= len(nloc) && samePrefix(cloc, nloc, len(cloc)-1)
+}
+
+// whether a and b agree on their first n indexes
+func samePrefix(a, b []int, n int) bool {
+	for d := 0; d < n; d++ {
+		if a[d] != b[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// whether line i follows by the rule it cites
+func (c *checker) follows(lines []*line, i int, numPrems int) bool {
+	l := lines[i]
+	w := l.wff
+	cited := func(k int) *wff { return lines[l.j.lines[k]-1].wff }
+	start := func(k int) *wff { return lines[l.j.subps[k].start-1].wff }
+	end := func(k int) *wff { return lines[l.j.subps[k].end-1].wff }
+
+	switch l.j.rule() {
+	case "Pr":
+		return i+1 <= numPrems
+	case "Hyp":
+		return l.location[len(l.location)-1] == 0
+	case "∧I":
+		return c.followsByConjIntro(w, cited(0), cited(1))
+	case "∧E":
+		return c.followsByConjElim(w, cited(0))
+	case "⊥E", "X":
+		return cited(0).typ() == "splat"
+	case "⊥I", "¬E":
+		return c.followsByContraIntro(w, cited(0), cited(1))
+	case "→E":
+		return c.followsByMP(w, cited(0), cited(1))
+	case "→I":
+		return c.followsByCP(w, start(0), end(0))
+	case "¬I":
+		return c.followsByRAA(w, start(0), end(0))
+	case "IP":
+		return c.followsByIP(w, start(0), end(0))
+	case "RAA":
+		// the last two lines of the subproof, at the same depth
+		last := l.j.subps[0].end - 1
+		if last < 1 || len(lines[last-1].location) != len(lines[last].location) {
+			return false // PHP reads before the first line here, and fails or finds no line
+		}
+		return c.followsByRAA2(w, start(0), lines[last-1].wff, end(0))
+	case "TND", "LEM":
+		return c.followsByTND(w, start(0), end(0), start(1), end(1))
+	case "∨I":
+		return c.followsByAdd(w, cited(0))
+	case "∨E":
+		return c.followsByDisjElim(w, cited(0), start(0), end(0), start(1), end(1))
+	case "↔I":
+		return c.followsByBiconIntro(w, start(0), end(0), start(1), end(1))
+	case "↔E":
+		return c.followsByBiconElim(w, cited(0), cited(1))
+	case "DS":
+		return c.followsByDS(w, cited(0), cited(1))
+	case "Rep":
+		return c.sameWff(w, cited(0))
+	case "MT":
+		return c.followsByMT(w, cited(0), cited(1))
+	case "Bicondition":
+		return c.bicondition(w, cited(0), cited(1))
+	case "DNE":
+		return c.followsByDNE(w, cited(0))
+	case "DeM":
+		return c.followsByDeM(w, cited(0))
+	case "∀E":
+		return c.followsByUI(w, cited(0))
+	case "∃I":
+		return c.followsByEG(w, cited(0))
+	case "∀I":
+		return c.followsByUG(lines, i)
+	case "∃E":
+		return c.followsByEE(lines, i)
+	case "=I":
+		return isSelfID(w)
+	case "=E":
+		return followsByLL(w, cited(0), cited(1))
+	case "CQ":
+		return c.followsByCQ(w, cited(0))
+	}
+	return false
+}
+
+// whether term t occurs in a premise or hypothesis in scope at line i
+func inScopeAssumption(lines []*line, i int, t string) bool {
+	for k := 0; k < i; k++ {
+		if rule := lines[k].j.rule(); rule != "Pr" && rule != "Hyp" {
+			continue
+		}
+		if available(lines[k].location, lines[i].location) && contains(lines[k].wff.terms(), t) {
+			return true
+		}
+	}
+	return false
+}
+
+// universal derivation: the cited instance uses a term that is new to
+// the universal and occurs in no premise or hypothesis in scope
+func (c *checker) followsByUG(lines []*line, i int) bool {
+	univ := lines[i].wff
+	if univ.op() != "∀" {
+		return false
+	}
+	inst := lines[lines[i].j.lines[0]-1].wff
+	if !contains(univ.right().freeVars(), univ.letter()) {
+		return c.sameWff(univ.right(), inst)
+	}
+	worked := false
+	for _, t := range inst.terms() {
+		if contains(univ.terms(), t) || isVar(t) {
+			continue
+		}
+		if c.sameWff(inst, subTerm(univ.right(), t, univ.letter())) && !inScopeAssumption(lines, i, t) {
+			worked = true
+		}
+	}
+	return worked
+}
+
+// existential instantiation: the subproof's hypothesis is an instance of
+// the cited existential with a new term, and it ends with this line
+func (c *checker) followsByEE(lines []*line, i int) bool {
+	l := lines[i]
+	exwff := lines[l.j.lines[0]-1].wff
+	if exwff.op() != "∃" {
+		return false
+	}
+	hyp := lines[l.j.subps[0].start-1].wff
+	res := l.wff
+	if !c.sameWff(lines[l.j.subps[0].end-1].wff, res) {
+		return false
+	}
+	if !contains(exwff.right().freeVars(), exwff.letter()) {
+		return c.sameWff(exwff.right(), hyp)
+	}
+	worked := false
+	for _, t := range hyp.terms() {
+		if isVar(t) || !c.sameWff(hyp, subTerm(exwff.right(), t, exwff.letter())) {
+			continue
+		}
+		if contains(res.terms(), t) || contains(exwff.terms(), t) || inScopeAssumption(lines, i, t) {
+			continue
+		}
+		worked = true
+	}
+	return worked
+}
@@ -0,0 +1,228 @@
+package proofcheck
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check requests with the answers checkproof.php gives them
+type corpusCase struct {
+	Name    string       `json:"name"`
+	Request CheckRequest `json:"request"`
+	Want    CheckResult  `json:"want"`
+}
+
+func readCorpus(t *testing.T) []corpusCase {
+	t.Helper()
+	data, err := os.ReadFile("testdata/requests.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []corpusCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+func TestCheck(t *testing.T) {
+	for _, c := range readCorpus(t) {
+		got, ok := c.Request.Check()
+		if !ok || !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("%s: got %+v (%v) want %+v", c.Name, got, ok, c.Want)
+		}
+	}
+}
+
+// the corpus answers are checkproof.php's own, where PHP is installed
+func TestMatchesPHP(t *testing.T) {
+	if _, err := exec.LookPath("php"); err != nil {
+		t.Skip("php is not installed")
+	}
+	for _, c := range readCorpus(t) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		got, err := CheckWithPHP(ctx, "../../frontend", c.Request)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		if !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("%s: php answered %+v want %+v", c.Name, got, c.Want)
+		}
+	}
+}
+
+func TestRequestNotAProof(t *testing.T) {
+	for _, proofData := range []string{"", "{", "{}", "null", `"P"`, `[null]`, `[{"wffstr": ["P"], "jstr": "Pr"}]`} {
+		if result, ok := (CheckRequest{ProofData: proofData, NumPrems: "0", WantedConc: "P"}).Check(); ok {
+			t.Errorf("%q checked as %+v", proofData, result)
+		}
+	}
+}
+
+func TestProofJSON(t *testing.T) {
+	data := `[{"wffstr":"P","jstr":"Pr"},[],[{"wffstr":"Q","jstr":"Hyp"}]]`
+	proof, err := ParseProof([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := json.Marshal(proof); string(out) != data {
+		t.Errorf("round trip gave %s", out)
+	}
+}
+
+func TestUnchangeRuleNames(t *testing.T) {
+	for in, want := range map[string]string{
+		"1, 2 Modus Ponens":                 "1, 2 →E",
+		"2-4 conditional deri∨ation":        "2-4 →I",
+		"1 repeat":                          "1 Rep",
+		"1 Modus Tollendo Ponens":           "1 DS",
+		"1 double negation double negation": "1 DNE double negation",
+		"1, 2 ∧I":                           "1, 2 ∧I",
+	} {
+		if got := UnchangeRuleNames(in); got != want {
+			t.Errorf("UnchangeRuleNames(%q) = %q want %q", in, got, want)
+		}
+	}
+}
+
+func TestIntval(t *testing.T) {
+	for in, want := range map[string]int{
+		"3": 3, " 3": 3, "3 ": 3, "+3": 3, "-2": -2, "2 premises": 2, "1e1": 10, "2.9": 2,
+		"": 0, "abc": 0, "0x1A": 0, "99999999999999999999": 9223372036854775807,
+	} {
+		if got := Intval(in); got != want {
+			t.Errorf("Intval(%q) = %v want %v", in, got, want)
+		}
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	for _, c := range []struct {
+		in        string
+		predicate bool
+		want      string
+	}{
+		{"P -> Q", false, "P → Q"},
+		{"~(P & Q) <-> (~P v ~Q)", false, "¬(P ∧ Q) ↔ (¬P ∨ ¬Q)"},
+		{"P = Q", false, "P ↔ Q"},
+		{"  P  ⊃  # ", false, "P → ⊥"},
+		{"Ax(Fx -> Ey Rxy)", true, "∀x(Fx → ∃y Rxy)"},
+		{"(x)Fx", true, "∀xFx"},
+		{"a = b", true, "a = b"},
+	} {
+		got, err := ParseFormula(c.in, c.predicate)
+		if err != nil || got != c.want {
+			t.Errorf("ParseFormula(%q) = %q, %v want %q", c.in, got, err, c.want)
+		}
+	}
+	for _, in := range []string{"", "P Q", "(P → Q", "P → Q ∧ R", "Fa"} {
+		if _, err := ParseFormula(in, false); err == nil {
+			t.Errorf("ParseFormula(%q) is well formed", in)
+		}
+	}
+}
+
+func TestAllowedRules(t *testing.T) {
+	// P → Q, ¬Q ∴ ¬P by MT, which the basic rules do not have
+	proof := []Entry{{WffStr: "P → Q", JStr: "Pr"}, {WffStr: "¬Q", JStr: "Pr"}, {WffStr: "¬P", JStr: "1, 2 MT"}}
+	for ruleSet, want := range map[string][]string{
+		"":                       {},
+		"derived":                {},
+		"MT, modus ponens":       {},
+		"forall x basic":         {"Line 3: Uses the rule Modus Tollens, which this problem does not allow."},
+		"→E, →I":                 {"Line 3: Uses the rule Modus Tollens, which this problem does not allow."},
+		"full FOL with identity": {},
+	} {
+		allowed, err := AllowedRules(ruleSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := CheckRules(proof, 2, "¬P", false, allowed)
+		if !reflect.DeepEqual(result.Issues, want) || result.ConcReached != (len(want) == 0) {
+			t.Errorf("%q: got %+v", ruleSet, result)
+		}
+		if issues := DisallowedRules(proof, false, allowed); len(issues) != len(want) {
+			t.Errorf("%q: DisallowedRules gave %v", ruleSet, issues)
+		}
+	}
+	if basic, _ := AllowedRules("forall x basic"); contains(basic, "Rep") {
+		t.Error("forall x basic allows Rep")
+	}
+	// changing the rules a preset resolves to leaves the preset alone
+	basic, _ := AllowedRules("forall x basic")
+	basic[0] = "MT"
+	if again, _ := AllowedRules("forall x basic"); contains(again, "MT") {
+		t.Error("changing the resolved rules changed the preset")
+	}
+	for _, preset := range RuleSets {
+		if preset.Name == "derived" && !strings.HasSuffix(preset.Description, "Rep, DS, MT, DNE, TND, LEM, DeM and CQ") {
+			t.Errorf("derived preset: %+v", preset)
+		}
+	}
+	if _, err := AllowedRules("∧I, shortcut"); err == nil {
+		t.Error("unknown rule accepted")
+	}
+	if _, ok := (CheckRequest{ProofData: "[]", AllowedRules: "no such set"}).Check(); ok {
+		t.Error("unknown rule set checked")
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	proof := []Entry{
+		{WffStr: "P ∧ R", JStr: "Pr"},
+		{WffStr: "Q", JStr: "1 ∧E"},
+		{WffStr: "P ∧", JStr: "1 ∧E"},
+		{WffStr: "P", JStr: "9 ∧E"},
+		{WffStr: "P", JStr: "∧E"},
+		{WffStr: "P", JStr: "1 and"},
+		{WffStr: "P", JStr: "1 MT"},
+	}
+	allowed, _ := AllowedRules("forall x basic")
+	result, mistakes := Diagnose(proof, 1, "P", false, allowed)
+	if !reflect.DeepEqual(result, CheckRules(proof, 1, "P", false, allowed)) {
+		t.Errorf("result differs from CheckRules: %+v", result)
+	}
+	var got []string
+	for _, m := range mistakes {
+		got = append(got, itoa(m.Line)+" "+m.Rule+" "+m.Kind)
+	}
+	want := []string{"2 ∧E formula-mismatch", "3 ∧E not-well-formed", "4 ∧E bad-citation", "5 ∧E citation-count",
+		"6  justification", "7 MT disallowed-rule", "7 MT citation-count"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(mistakes) != len(result.Issues) || mistakes[0].Issue != result.Issues[0] {
+		t.Errorf("mistakes %+v do not match issues %q", mistakes, result.Issues)
+	}
+
+	fol := []Entry{{WffStr: "∀xFx", JStr: "Pr"}, {WffStr: "Gb", JStr: "1 ∀E"}}
+	if _, mistakes := Diagnose(fol, 1, "Gb", true, nil); len(mistakes) != 1 || mistakes[0].Kind != MistakeQuantifier {
+		t.Errorf("∀E misapplied: %+v", mistakes)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	a := []Entry{{WffStr: "[P → Q]", JStr: "Pr"}, {WffStr: "P", JStr: "Pr"},
+		{IsSubproof: true, Subproof: []Entry{{WffStr: "R", JStr: "Hyp"}, {WffStr: "((Q))", JStr: "1,2  Modus Ponens"}}},
+		{WffStr: "R ∧", JStr: "3–4 →I"}}
+	b := []Entry{{WffStr: "P→Q", JStr: "Pr"}, {WffStr: "(P)", JStr: "Pr"},
+		{IsSubproof: true, Subproof: []Entry{{WffStr: "R", JStr: "Hyp"}, {WffStr: "Q", JStr: "1 2 →E"}}},
+		{WffStr: "R∧", JStr: "3-4 →I"}}
+	want := []NormalizedLine{{0, "P→Q", "Pr"}, {0, "P", "Pr"}, {1, "R", "Hyp"}, {1, "Q", "→E 1 2"}, {0, "R∧", "→I 3-4"}}
+	for _, proof := range [][]Entry{a, b} {
+		if got := Normalize(proof, false); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q", got)
+		}
+	}
+	fol := []Entry{{WffStr: "∀x(Fx → (Gx ∧ ¬Hxa))", JStr: "Pr"}}
+	if got := Normalize(fol, true); got[0].Formula != "∀x(Fx→(Gx∧¬Hxa))" {
+		t.Errorf("first-order: %q", got[0].Formula)
+	}
+}
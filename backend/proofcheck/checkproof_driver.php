@@ -0,0 +1,10 @@
+<?php
+// Answers one check request with frontend/checkproof.php, for comparing it
+// with the Go checker: the form fields are read as a JSON object from stdin.
+//
+//    php checkproof_driver.php <frontend directory> < request.json
+
+ini_set('display_errors', 'stderr');
+$_POST = json_decode(file_get_contents('php://stdin'), true);
+require $argv[1] . '/checkproof.php';
+?>
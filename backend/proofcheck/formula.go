@@ -0,0 +1,61 @@
+package proofcheck
+
+// Formulas as users type them, ported from fixWffInputStr in
+// frontend/syntax.js, for input that does not come through the proof
+// editor (e.g. imported problem sets).
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	biconditional = regexp.MustCompile(`<[-−]*>`)
+	conditional   = regexp.MustCompile(`[-−]*>`)
+	spaces        = regexp.MustCompile(`  +`)
+
+	// first-order quantifier spellings, in the order syntax.js tries them
+	quantifiers = []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`\([A∀⋀]([x-z])\)`), "∀$1"},
+		{regexp.MustCompile(`\([E∃⋁]([x-z])\)`), "∃$1"},
+		{regexp.MustCompile(`[E⋁]([x-z])`), "∃$1"},
+		{regexp.MustCompile(`[A⋀]([x-z])`), "∀$1"},
+		{regexp.MustCompile(`\(([x-z])\)`), "∀$1"},
+	}
+)
+
+// NormalizeFormula puts the alternative spellings of the operators in s
+// (->, &, v, ~, # and so on) into the standard symbols, as the proof editor
+// does. In first-order logic = is identity and Ax, (x) and Ex quantify; in
+// truth-functional logic = is the biconditional.
+func NormalizeFormula(s string, predicate bool) string {
+	s = biconditional.ReplaceAllString(s, "↔")
+	s = conditional.ReplaceAllString(s, "→")
+	s = strings.NewReplacer("&", "∧", "^", "∧", ".", "∧", "*", "∧", "·", "∧", "v", "∨").Replace(s)
+	if !predicate {
+		s = strings.ReplaceAll(s, "=", "↔")
+	}
+	s = strings.NewReplacer("≡", "↔", "⊃", "→", "⇒", "→", "XX", "⊥", "#", "⊥").Replace(s)
+	if predicate {
+		for _, q := range quantifiers {
+			s = q.pattern.ReplaceAllString(s, q.replacement)
+		}
+	}
+	s = strings.NewReplacer("~", "¬", "∼", "¬", "−", "¬", "-", "¬").Replace(s)
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+// ParseFormula normalizes s and checks that it is well formed, returning
+// the normalized formula or the parser's message.
+func ParseFormula(s string, predicate bool) (string, error) {
+	formula := NormalizeFormula(s, predicate)
+	c := &checker{predicate: predicate}
+	if w := c.parse(formula); !w.isWellFormed {
+		return "", errors.New(w.errMsg)
+	}
+	return formula, nil
+}
@@ -0,0 +1,3 @@
+module proofcheck
+
+go 1.21
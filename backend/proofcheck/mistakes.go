@@ -0,0 +1,53 @@
+package proofcheck
+
+// Mistakes: the issues of a check, classified. Instructors mining failed
+// checks for common mistakes want "∀E applied to the wrong term" rather than
+// the wording of each issue, so Diagnose gives every issue a kind and the
+// rule its line cites.
+
+// the kinds of Mistake
+const (
+	MistakeNotWellFormed   = "not-well-formed"          // the formula does not parse
+	MistakeJustification   = "justification"            // the justification does not parse
+	MistakeDisallowedRule  = "disallowed-rule"          // a rule the problem does not allow
+	MistakeCitationCount   = "citation-count"           // too few or too many lines or subproofs cited
+	MistakeBadCitation     = "bad-citation"             // a cited line is missing, later, or not well-formed
+	MistakeClosedSubproof  = "closed-subproof"          // a cited line or subproof is no longer available
+	MistakeQuantifier      = "quantifier-instantiation" // a quantifier rule misapplied
+	MistakeFormulaMismatch = "formula-mismatch"         // any other rule misapplied
+)
+
+// Mistake is one issue of a check, classified.
+type Mistake struct {
+	Line  int    `json:"line"`  // as in the issue
+	Rule  string `json:"rule"`  // the rule the line cites; "" when there is none
+	Kind  string `json:"kind"`  // one of the Mistake kinds
+	Issue string `json:"issue"` // as in CheckResult.Issues
+}
+
+func (l *line) addIssue(kind string, issue string) {
+	l.issues = append(l.issues, issue)
+	l.kinds = append(l.kinds, kind)
+}
+
+// the kind of a misapplication of rule
+func applicationMistake(rule string) string {
+	switch rule {
+	case "∀E", "∀I", "∃I", "∃E":
+		return MistakeQuantifier
+	}
+	return MistakeFormulaMismatch
+}
+
+// Diagnose is CheckRules also giving the issues of the lines of the proof as
+// mistakes, in the same order.
+func Diagnose(proof []Entry, numPrems int, conclusion string, predicate bool, allowed []string) (CheckResult, []Mistake) {
+	rv, lines := check(proof, numPrems, conclusion, predicate, allowed)
+	var mistakes []Mistake
+	for i, l := range lines {
+		for k, issue := range l.issues {
+			mistakes = append(mistakes, Mistake{Line: i + 1, Rule: l.j.rule(), Kind: l.kinds[k], Issue: "Line " + itoa(i+1) + ": " + issue})
+		}
+	}
+	return rv, mistakes
+}
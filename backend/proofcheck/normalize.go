@@ -0,0 +1,76 @@
+package proofcheck
+
+// Normalized proofs, for comparing the proofs of different students: two
+// lines that differ only in spacing, brackets, redundant parentheses or the
+// frontend's names for rules normalize alike.
+
+import (
+	"strings"
+)
+
+// NormalizedLine is a line of a proof in normal form.
+type NormalizedLine struct {
+	Depth         int    `json:"depth"`         // 0 outside subproofs
+	Formula       string `json:"formula"`       // parenthesized as parsed; as typed, less spacing, if it is not well-formed
+	Justification string `json:"justification"` // the rule, then the citations; likewise
+}
+
+// the formula w fully parenthesized, except at the top
+func writeWff(b *strings.Builder, w *wff, top bool) {
+	switch w.typ() {
+	case "splat":
+		b.WriteString("⊥")
+	case "identity":
+		b.WriteString(w.term(0) + "=" + w.term(1))
+	case "atomic":
+		b.WriteString(w.letter() + strings.Join(w.terms(), ""))
+	case "quantified":
+		b.WriteString(w.op() + w.letter())
+		writeWff(b, w.right(), false)
+	default:
+		if w.op() == "¬" {
+			b.WriteString("¬")
+			writeWff(b, w.right(), false)
+			return
+		}
+		if !top {
+			b.WriteString("(")
+		}
+		writeWff(b, w.left(), false)
+		b.WriteString(w.op())
+		writeWff(b, w.right(), false)
+		if !top {
+			b.WriteString(")")
+		}
+	}
+}
+
+// Normalize flattens proof into normalized lines, in order.
+func Normalize(proof []Entry, predicate bool) []NormalizedLine {
+	c := &checker{predicate: predicate}
+	var lines []NormalizedLine
+	for _, l := range flatten(UnchangeAllRuleNames(proof), nil) {
+		line := NormalizedLine{Depth: len(l.location) - 1}
+		if w := c.parse(l.wffStr); w.isWellFormed {
+			var b strings.Builder
+			writeWff(&b, w, true)
+			line.Formula = b.String()
+		} else {
+			line.Formula = string(regularize(l.wffStr))
+		}
+		if j := c.parseJustification(l.jStr); j.parsedOK {
+			citations := []string{j.rule()}
+			for _, n := range j.lines {
+				citations = append(citations, itoa(n))
+			}
+			for _, s := range j.subps {
+				citations = append(citations, itoa(s.start)+"-"+itoa(s.end))
+			}
+			line.Justification = strings.Join(citations, " ")
+		} else {
+			line.Justification = string(regularize(l.jStr))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
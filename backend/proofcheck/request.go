@@ -0,0 +1,83 @@
+package proofcheck
+
+// Check requests as checkproof.php takes them, and running checkproof.php
+// itself to compare the two checkers.
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// CheckRequest is a check request, with the form fields the frontend posts.
+type CheckRequest struct {
+	ProofData         string `json:"proofData"`         // JSON array of lines and subproofs
+	NumPrems          string `json:"numPrems"`          // how many leading lines may be premises
+	WantedConc        string `json:"wantedConc"`        // the conclusion to reach
+	PredicateSettings string `json:"predicateSettings"` // "true" for first-order logic
+
+	// the rule set the problem allows (see AllowedRules); checkproof.php
+	// has no such field and allows every rule
+	AllowedRules string `json:"allowedRules,omitempty"`
+}
+
+// Check answers a request as checkproof.php does; ok is false where
+// checkproof.php answers nothing, i.e. when the proof data is not a proof,
+// and when the allowed rules are not a rule set.
+func (r CheckRequest) Check() (result CheckResult, ok bool) {
+	proof, err := ParseProof([]byte(r.ProofData))
+	if err != nil {
+		return CheckResult{}, false
+	}
+	allowed, err := AllowedRules(r.AllowedRules)
+	if err != nil {
+		return CheckResult{}, false
+	}
+	return CheckRules(proof, Intval(r.NumPrems), r.WantedConc, r.PredicateSettings == "true", allowed), true
+}
+
+//go:embed checkproof_driver.php
+var phpDriver []byte
+
+// CheckWithPHP answers a request with frontendDir/checkproof.php, run by
+// the php command.
+func CheckWithPHP(ctx context.Context, frontendDir string, r CheckRequest) (CheckResult, error) {
+	dir, err := filepath.Abs(frontendDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	driver, err := os.CreateTemp("", "checkproof_driver-*.php")
+	if err != nil {
+		return CheckResult{}, err
+	}
+	defer os.Remove(driver.Name())
+	_, err = driver.Write(phpDriver)
+	if closeErr := driver.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	input, _ := json.Marshal(r)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "php", driver.Name(), dir)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return CheckResult{}, fmt.Errorf("proofcheck: php: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var result CheckResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return CheckResult{}, fmt.Errorf("proofcheck: php answered %q: %w", stdout.Bytes(), err)
+	}
+	if result.Issues == nil {
+		result.Issues = []string{}
+	}
+	return result, nil
+}
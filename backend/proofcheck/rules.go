@@ -0,0 +1,238 @@
+package proofcheck
+
+// Rules of inference, ported from the followsBy functions of
+// frontend/proofs.php. c is the line being checked and the other arguments
+// are the lines and subproof ends it cites, in the order cited.
+
+func (c *checker) followsByCQThisWay(a, b *wff) bool {
+	return a.op() == "¬" &&
+		b.right().op() == "¬" &&
+		((a.right().op() == "∀" && b.op() == "∃") || (a.right().op() == "∃" && b.op() == "∀")) &&
+		b.letter() == a.right().letter() &&
+		c.sameWff(a.right().right(), b.right().right())
+}
+
+func (c *checker) followsByCQ(a, b *wff) bool {
+	return c.followsByCQThisWay(a, b) || c.followsByCQThisWay(b, a)
+}
+
+func isSelfID(w *wff) bool {
+	return w.typ() == "identity" && !isVar(w.term(0)) && w.term(0) == w.term(1)
+}
+
+func followsByLLThisWay(r, a, b *wff) bool {
+	return a.typ() == "identity" &&
+		(differsBySwappingFor(r, b, a.term(0), a.term(1)) || differsBySwappingFor(r, b, a.term(1), a.term(0)))
+}
+
+// whether q is p with some occurrences of t replaced by s; quantifier
+// letters are not compared, as in PHP
+func differsBySwappingFor(q, p *wff, s, t string) bool {
+	if p == nil || q == nil {
+		return false // PHP recurses forever on two missing sides
+	}
+	if p.wffType != q.wffType {
+		return false
+	}
+	if p.wffType == "splat" {
+		return true
+	}
+	if p.wffType == "atomic" || p.wffType == "identity" {
+		if len(p.myTerms) != len(q.myTerms) {
+			return false
+		}
+		if p.wffType == "atomic" && p.myLetter != q.myLetter {
+			return false
+		}
+		for i := range p.myTerms {
+			if p.myTerms[i] != q.myTerms[i] && !(p.myTerms[i] == t && q.myTerms[i] == s) {
+				return false
+			}
+		}
+		return true
+	}
+	if p.mainOp != q.mainOp {
+		return false
+	}
+	if isMonOp(p.mainOp) {
+		return differsBySwappingFor(q.rightSide, p.rightSide, s, t)
+	}
+	return differsBySwappingFor(q.rightSide, p.rightSide, s, t) &&
+		differsBySwappingFor(q.leftSide, p.leftSide, s, t)
+}
+
+func followsByLL(r, a, b *wff) bool {
+	return followsByLLThisWay(r, a, b) || followsByLLThisWay(r, b, a)
+}
+
+func (c *checker) followsByEG(r, a *wff) bool {
+	if r.op() != "∃" {
+		return false
+	}
+	// vacuous instance
+	if !contains(r.right().freeVars(), r.letter()) {
+		return c.sameWff(r.right(), a)
+	}
+	// no double binding unless vacuous
+	if contains(a.terms(), r.letter()) {
+		return false
+	}
+	for _, t := range a.terms() {
+		if !isVar(t) && c.sameWff(a, subTerm(r.right(), t, r.letter())) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) followsByUI(r, a *wff) bool {
+	if a.op() != "∀" {
+		return false
+	}
+	for _, t := range r.terms() {
+		if !isVar(t) && c.sameWff(r, subTerm(a.right(), t, a.letter())) {
+			return true
+		}
+	}
+	// vacuous binding
+	return !contains(a.right().freeVars(), a.letter()) && c.sameWff(r, a.right())
+}
+
+func (c *checker) followsByDeMThisWay(a, b *wff) bool {
+	return b.op() == "¬" &&
+		((a.op() == "∧" && b.right().op() == "∨") || (a.op() == "∨" && b.right().op() == "∧")) &&
+		a.right().op() == "¬" && a.left().op() == "¬" &&
+		c.sameWff(a.right().right(), b.right().right()) &&
+		c.sameWff(a.left().right(), b.right().left())
+}
+
+func (c *checker) followsByDeM(r, a *wff) bool {
+	return c.followsByDeMThisWay(r, a) || c.followsByDeMThisWay(a, r)
+}
+
+func (c *checker) followsByDNE(r, a *wff) bool {
+	return (a.op() == "¬" && a.right().op() == "¬" && c.sameWff(r, a.right().right())) ||
+		(r.op() == "¬" && r.right().op() == "¬" && c.sameWff(a, r.right().right()))
+}
+
+func (c *checker) followsByMTThisWay(r, a, b *wff) bool {
+	return a.op() == "→" && b.op() == "¬" && r.op() == "¬" &&
+		c.sameWff(a.right(), b.right()) &&
+		c.sameWff(a.left(), r.right())
+}
+
+func (c *checker) followsByMT(r, a, b *wff) bool {
+	return c.followsByMTThisWay(r, a, b) || c.followsByMTThisWay(r, b, a)
+}
+
+func (c *checker) followsByDSThisWay(r, a, b *wff) bool {
+	return a.op() == "∨" && b.op() == "¬" &&
+		((c.sameWff(b.right(), a.right()) && c.sameWff(r, a.left())) ||
+			(c.sameWff(b.right(), a.left()) && c.sameWff(r, a.right())))
+}
+
+func (c *checker) followsByDS(r, a, b *wff) bool {
+	return c.followsByDSThisWay(r, a, b) || c.followsByDSThisWay(r, b, a)
+}
+
+func (c *checker) followsByConjIntroThisWay(r, a, b *wff) bool {
+	return r.op() == "∧" && c.sameWff(r.right(), a) && c.sameWff(r.left(), b)
+}
+
+func (c *checker) followsByConjIntro(r, a, b *wff) bool {
+	return c.followsByConjIntroThisWay(r, a, b) || c.followsByConjIntroThisWay(r, b, a)
+}
+
+func (c *checker) followsByConjElim(r, a *wff) bool {
+	return a.op() == "∧" && (c.sameWff(a.right(), r) || c.sameWff(a.left(), r))
+}
+
+func (c *checker) followsByContraIntro(r, a, b *wff) bool {
+	return r.typ() == "splat" &&
+		((b.op() == "¬" && c.sameWff(a, b.right())) || (a.op() == "¬" && c.sameWff(b, a.right())))
+}
+
+func (c *checker) followsByMPThisWay(r, a, b *wff) bool {
+	return a.op() == "→" && c.sameWff(a.right(), r) && c.sameWff(a.left(), b)
+}
+
+func (c *checker) followsByMP(r, a, b *wff) bool {
+	return c.followsByMPThisWay(r, a, b) || c.followsByMPThisWay(r, b, a)
+}
+
+func (c *checker) followsByCP(r, a, b *wff) bool {
+	return r.op() == "→" && c.sameWff(r.left(), a) && c.sameWff(r.right(), b)
+}
+
+// negation introduction, kept like the ¬I rule itself for reinstating it
+func (c *checker) followsByRAA(r, a, b *wff) bool {
+	return r.op() == "¬" && c.sameWff(r.right(), a) && b.typ() == "splat"
+}
+
+// reductio ad absurdum as in DeLancey's text: a hypothesis, and a
+// statement and its negation as the last two lines of its subproof
+func (c *checker) followsByRAA2ThisWay(r, a, b, d *wff) bool {
+	return a.op() == "¬" && c.sameWff(a.right(), r) &&
+		d.op() == "¬" && c.sameWff(d.right(), b)
+}
+
+func (c *checker) followsByRAA2(r, a, b, d *wff) bool {
+	return c.followsByRAA2ThisWay(r, a, b, d) || c.followsByRAA2ThisWay(r, a, d, b)
+}
+
+func (c *checker) followsByIP(r, a, b *wff) bool {
+	return a.op() == "¬" && c.sameWff(a.right(), r) && b.typ() == "splat"
+}
+
+func (c *checker) followsByTNDThisWay(r, i, j, k, l *wff) bool {
+	return k.op() == "¬" && c.sameWff(k.right(), i) && c.sameWff(j, l) && c.sameWff(r, j)
+}
+
+func (c *checker) followsByTND(r, i, j, k, l *wff) bool {
+	return c.followsByTNDThisWay(r, i, j, k, l) || c.followsByTNDThisWay(r, k, l, i, j)
+}
+
+func (c *checker) followsByAdd(r, a *wff) bool {
+	return r.op() == "∨" && (c.sameWff(r.left(), a) || c.sameWff(r.right(), a))
+}
+
+func (c *checker) followsByDisjElimThisWay(r, m, i, j, k, l *wff) bool {
+	return m.op() == "∨" &&
+		c.sameWff(m.left(), i) && c.sameWff(m.right(), k) &&
+		c.sameWff(j, l) && c.sameWff(j, r)
+}
+
+func (c *checker) followsByDisjElim(r, m, i, j, k, l *wff) bool {
+	return c.followsByDisjElimThisWay(r, m, i, j, k, l) || c.followsByDisjElimThisWay(r, m, k, l, i, j)
+}
+
+func (c *checker) followsByBiconIntroThisWay(r, i, j, k, l *wff) bool {
+	return r.op() == "↔" &&
+		c.sameWff(r.left(), i) && c.sameWff(r.right(), j) &&
+		c.sameWff(r.right(), k) && c.sameWff(r.left(), l)
+}
+
+func (c *checker) followsByBiconIntro(r, i, j, k, l *wff) bool {
+	return c.followsByBiconIntroThisWay(r, i, j, k, l) || c.followsByBiconIntroThisWay(r, k, l, i, j)
+}
+
+func (c *checker) followsByBiconElimThisWay(r, a, b *wff) bool {
+	return a.op() == "↔" &&
+		((c.sameWff(a.left(), b) && c.sameWff(a.right(), r)) ||
+			(c.sameWff(a.left(), r) && c.sameWff(a.right(), b)) ||
+			(c.sameWff(a.left(), b.right()) && c.sameWff(a.right(), r.right())) ||
+			(c.sameWff(a.left(), r.right()) && c.sameWff(a.right(), b.right())))
+}
+
+func (c *checker) followsByBiconElim(r, a, b *wff) bool {
+	return c.followsByBiconElimThisWay(r, a, b) || c.followsByBiconElimThisWay(r, b, a)
+}
+
+// a biconditional from the two conditionals, cited in either order
+func (c *checker) bicondition(r, a, b *wff) bool {
+	return a.op() == "→" && b.op() == "→" && r.op() == "↔" &&
+		c.sameWff(a.left(), b.right()) &&
+		c.sameWff(a.right(), b.left()) &&
+		((c.sameWff(a.left(), r.left()) && c.sameWff(a.right(), r.right())) ||
+			(c.sameWff(b.left(), r.left()) && c.sameWff(b.right(), r.right())))
+}
@@ -0,0 +1,90 @@
+package proofcheck
+
+// Rule sets: the rules a problem allows. Instructors teaching the primitive
+// rules first pick a preset or list the rules themselves; lines citing any
+// other rule are issues. Pr and Hyp are always allowed.
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RuleSet is a named list of allowed rules.
+type RuleSet struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+}
+
+var (
+	basicRules   = []string{"∧I", "∧E", "∨I", "∨E", "→I", "→E", "↔I", "↔E", "⊥I", "⊥E", "X", "RAA", "IP", "∀E", "∀I", "∃I", "∃E", "=I", "=E"}
+	derivedRules = []string{"Rep", "DS", "MT", "DNE", "TND", "LEM", "DeM", "CQ"}
+)
+
+// RuleSets are the presets, by name.
+var RuleSets = []RuleSet{
+	{Name: "forall x basic", Description: "the basic rules of forall x, without reiteration or derived rules",
+		Rules: append([]string{}, basicRules...)},
+	{Name: "derived", Description: "the basic rules with reiteration and the derived rules: " + listRules(derivedRules),
+		Rules: append(append([]string{}, basicRules...), derivedRules...)},
+	{Name: "full FOL with identity", Description: "every rule the checker knows",
+		Rules: append(append([]string{}, tflRules...), folRules...)},
+}
+
+// rules as "A, B and C"
+func listRules(rules []string) string {
+	if len(rules) < 2 {
+		return strings.Join(rules, "")
+	}
+	return strings.Join(rules[:len(rules)-1], ", ") + " and " + rules[len(rules)-1]
+}
+
+// AllowedRules resolves a rule set: the name of a preset, a comma-separated
+// list of rules, or "" for every rule, which gives nil. The rules are the
+// caller's to change.
+func AllowedRules(ruleSet string) ([]string, error) {
+	ruleSet = strings.TrimSpace(ruleSet)
+	if ruleSet == "" {
+		return nil, nil
+	}
+	for _, preset := range RuleSets {
+		if preset.Name == ruleSet {
+			return slices.Clone(preset.Rules), nil
+		}
+	}
+	var rules []string
+	for _, rule := range strings.Split(ruleSet, ",") {
+		rule = UnchangeRuleNames(strings.TrimSpace(rule))
+		if !contains(tflRules, rule) && !contains(folRules, rule) {
+			return nil, fmt.Errorf("%q is neither a rule set nor a rule", rule)
+		}
+		if !contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// whether a line may cite rule; nil allows every rule
+func ruleAllowed(allowed []string, rule string) bool {
+	return allowed == nil || rule == "Pr" || rule == "Hyp" || contains(allowed, rule)
+}
+
+func disallowedIssue(rule string) string {
+	return "Uses the rule " + displayName(rule) + ", which this problem does not allow."
+}
+
+// DisallowedRules lists an issue for every line of proof that cites a rule
+// allowed does not have, in the wording of Check; nil allows every rule.
+func DisallowedRules(proof []Entry, predicate bool, allowed []string) []string {
+	c := &checker{predicate: predicate}
+	var issues []string
+	for i, l := range flatten(proof, nil) {
+		j := c.parseJustification(l.jStr)
+		if j.parsedOK && !ruleAllowed(allowed, j.rule()) {
+			issues = append(issues, "Line "+itoa(i+1)+": "+disallowedIssue(j.rule()))
+		}
+	}
+	return issues
+}
@@ -0,0 +1,453 @@
+package proofcheck
+
+// Formulas, ported from frontend/syntax.php. The PHP quirks are kept on
+// purpose (e.g. an identity must be exactly three characters, quantifier
+// letters are ignored when comparing substitutions) so that both checkers
+// accept exactly the same proofs.
+
+import (
+	"strings"
+	"unicode"
+)
+
+// a parsed formula; the zero-valued parts where PHP has an empty object are nil
+type wff struct {
+	isWellFormed bool
+	errMsg       string
+	wffType      string // splat, identity, atomic, quantified, molecular, or unknown
+	mainOp       string // "?" until found
+	myLetter     string // statement letter, predicate, or bound variable
+	leftSide     *wff
+	rightSide    *wff
+	myTerms      []string // terms and variables occurring in the formula (first-order only)
+	allFreeVars  []string // free variables (first-order only)
+}
+
+// accessors that read a missing side as PHP reads an empty object
+func (w *wff) typ() string {
+	if w == nil {
+		return ""
+	}
+	return w.wffType
+}
+
+func (w *wff) op() string {
+	if w == nil {
+		return ""
+	}
+	return w.mainOp
+}
+
+func (w *wff) letter() string {
+	if w == nil {
+		return ""
+	}
+	return w.myLetter
+}
+
+func (w *wff) left() *wff {
+	if w == nil {
+		return nil
+	}
+	return w.leftSide
+}
+
+func (w *wff) right() *wff {
+	if w == nil {
+		return nil
+	}
+	return w.rightSide
+}
+
+func (w *wff) terms() []string {
+	if w == nil {
+		return nil
+	}
+	return w.myTerms
+}
+
+func (w *wff) freeVars() []string {
+	if w == nil {
+		return nil
+	}
+	return w.allFreeVars
+}
+
+// term i of an atomic formula or identity, "" past the end
+func (w *wff) term(i int) string {
+	if terms := w.terms(); i < len(terms) {
+		return terms[i]
+	}
+	return ""
+}
+
+// the language a proof is written in
+type checker struct {
+	predicate bool // first-order logic rather than truth-functional
+}
+
+func isBinOp(op string) bool {
+	return op == "→" || op == "∨" || op == "∧" || op == "↔"
+}
+
+func isMonOp(op string) bool {
+	return op == "¬" || op == "∀" || op == "∃"
+}
+
+func isOp(op string) bool {
+	return isBinOp(op) || isMonOp(op)
+}
+
+func isQuantifier(op string) bool {
+	return op == "∀" || op == "∃"
+}
+
+func isVar(term string) bool {
+	return term == "x" || term == "y" || term == "z"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// z followed by the elements of x not already in it
+func listUnion(z []string, x []string) []string {
+	var union []string
+	for _, s := range append(append([]string{}, z...), x...) {
+		if !contains(union, s) {
+			union = append(union, s)
+		}
+	}
+	return union
+}
+
+func isUpper(r rune) bool { return r >= 'A' && r <= 'Z' }
+func isLower(r rune) bool { return r >= 'a' && r <= 'z' }
+
+// brackets and braces become parentheses; whitespace is dropped
+func regularize(s string) []rune {
+	var out []rune
+	for _, r := range s {
+		switch {
+		case r == '[' || r == '{':
+			out = append(out, '(')
+		case r == ']' || r == '}':
+			out = append(out, ')')
+		case unicode.IsSpace(r):
+		default:
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (c *checker) hasStrayChars(s []rune) bool {
+	for _, r := range s {
+		switch {
+		case isUpper(r), strings.ContainsRune("¬∨∧↔→⊥()[]{}", r), unicode.IsSpace(r):
+		case c.predicate && (isLower(r) || strings.ContainsRune("∀∃=", r)):
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s []rune, chars string) bool {
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) newWff() *wff {
+	return &wff{isWellFormed: true, errMsg: "none", wffType: "unknown", mainOp: "?"}
+}
+
+func (w *wff) fail(msg string) *wff {
+	w.isWellFormed = false
+	w.errMsg = msg
+	return w
+}
+
+// parse a formula; errors are reported in the result, as by parseIt
+func (c *checker) parse(str string) *wff {
+	w := c.newWff()
+	s := regularize(str)
+
+	if len(s) == 0 {
+		return w.fail("Formula or subformula is blank.")
+	}
+
+	if c.hasStrayChars(s) {
+		if c.predicate {
+			return w.fail("Input field contains characters or punctuation not allowed in the language of FOL. A statement should contain only parentheses ( [ { } ] ), predicates A–Z and =, terms a–w, variables x–z, the contradiction symbol ⊥, and the operators ¬, ∨, ∧, →, ↔, ∃, ∀ (or their alternatives).")
+		}
+		return w.fail("Input field contains characters or punctuation not allowed in the language of TFL. A statement should contain only parentheses ( [ { } ] ), statement letters A–Z, the contradiction symbol ⊥, and the operators ¬, ∨, ∧, →, and ↔ (or their alternatives).")
+	}
+
+	// parenthesis depth after each character
+	depths := make([]int, len(s))
+	d := 0
+	for i, r := range s {
+		if r == '(' {
+			d++
+		}
+		if r == ')' {
+			d--
+		}
+		depths[i] = d
+	}
+	if depths[len(s)-1] != 0 {
+		return w.fail("Parentheses are unbalanced.")
+	}
+
+	// remove matching outermost parentheses
+	if depths[0] == 1 {
+		theyMatch := true
+		for i := 1; i < len(s)-1; i++ {
+			theyMatch = theyMatch && depths[i] > 0
+		}
+		if theyMatch {
+			return c.parse(string(s[1 : len(s)-1]))
+		}
+	}
+
+	if !containsAny(s, "¬∧∨→↔∀∃") {
+		return c.parseAtomic(w, s)
+	}
+
+	// find the main operator
+	mainOpPos := 0
+	for i, r := range s {
+		op := string(r)
+		if !isOp(op) || depths[i] != 0 {
+			continue
+		}
+		if w.mainOp == "?" {
+			w.mainOp, mainOpPos = op, i
+		} else if isBinOp(w.mainOp) && isBinOp(op) {
+			return w.fail("Too many operators or too few parentheses to disambiguate.")
+		} else if isMonOp(w.mainOp) && isBinOp(op) {
+			w.mainOp, mainOpPos = op, i
+		}
+	}
+
+	if w.mainOp == "?" {
+		return w.fail("Missing connective/operator or misplaced parentheses.")
+	}
+
+	if isQuantifier(w.mainOp) {
+		w.wffType = "quantified"
+		if mainOpPos != 0 {
+			return w.fail("Misuse of a quantifier internally in a formula.")
+		}
+		if len(s) > 1 {
+			w.myLetter = string(s[1])
+		}
+		if !isVar(w.myLetter) {
+			// reported unless the rest of the formula has an error of its own
+			w.fail("A quantifier is used without binding a variable.")
+		}
+		rest := ""
+		if len(s) > 2 {
+			rest = string(s[2:])
+		}
+		w.rightSide = c.parse(rest)
+		if !w.rightSide.isWellFormed {
+			return w.fail(w.rightSide.errMsg)
+		}
+		w.myTerms = append([]string{}, w.rightSide.myTerms...)
+		if !contains(w.myTerms, w.myLetter) {
+			w.myTerms = append(w.myTerms, w.myLetter)
+		}
+		w.allFreeVars = nil
+		for _, v := range w.rightSide.allFreeVars {
+			if v != w.myLetter {
+				w.allFreeVars = append(w.allFreeVars, v)
+			}
+		}
+		return w
+	}
+
+	w.wffType = "molecular"
+
+	if w.mainOp == "¬" {
+		if mainOpPos != 0 {
+			return w.fail("Misuse of negation internally in formula.")
+		}
+		w.rightSide = c.parse(string(s[1:]))
+		if !w.rightSide.isWellFormed {
+			return w.fail(w.rightSide.errMsg)
+		}
+		if c.predicate {
+			w.myTerms = w.rightSide.myTerms
+			w.allFreeVars = w.rightSide.allFreeVars
+		}
+		return w
+	}
+
+	w.leftSide = c.parse(string(s[:mainOpPos]))
+	if !w.leftSide.isWellFormed {
+		return w.fail(w.leftSide.errMsg)
+	}
+	w.rightSide = c.parse(string(s[mainOpPos+1:]))
+	if !w.rightSide.isWellFormed {
+		return w.fail(w.rightSide.errMsg)
+	}
+	if c.predicate {
+		w.myTerms = listUnion(w.leftSide.myTerms, w.rightSide.myTerms)
+		w.allFreeVars = listUnion(w.leftSide.allFreeVars, w.rightSide.allFreeVars)
+	}
+	return w
+}
+
+// parse a formula without operators: ⊥, an identity, or an atomic formula
+func (c *checker) parseAtomic(w *wff, s []rune) *wff {
+	if containsAny(s, "()") {
+		return w.fail("Misplaced parentheses.")
+	}
+
+	if string(s) == "⊥" {
+		w.wffType = "splat"
+		return w
+	}
+	if containsAny(s, "⊥") {
+		return w.fail("Formula contains ⊥ but not in isolation.")
+	}
+
+	if containsAny(s, "=") {
+		if len(s) != 3 || !isLower(s[0]) || s[1] != '=' || !isLower(s[2]) {
+			return w.fail("Poorly formed identity statement. Identity statement should be of the form <var>t</var> = <var>s</var>.")
+		}
+		w.wffType = "identity"
+		w.myTerms = []string{string(s[0]), string(s[2])}
+		w.allFreeVars = nil
+		if isVar(w.myTerms[0]) {
+			w.allFreeVars = append(w.allFreeVars, w.myTerms[0])
+		}
+		if isVar(w.myTerms[1]) && w.myTerms[1] != w.myTerms[0] {
+			w.allFreeVars = append(w.allFreeVars, w.myTerms[1])
+		}
+		return w
+	}
+
+	if !c.predicate {
+		if len(s) != 1 || !isUpper(s[0]) {
+			return w.fail("Poorly formed atomic statement. In TFL, an atomic statement should be a single statement letter.")
+		}
+		w.wffType = "atomic"
+		w.myLetter = string(s)
+		return w
+	}
+
+	if !isUpper(s[0]) {
+		return w.fail("An atomic formula must begin with a predicate.")
+	}
+	if len(s) == 1 {
+		return w.fail("An atomic formula must have terms, not just a predicate.")
+	}
+	for _, r := range s[1:] {
+		if isUpper(r) {
+			return w.fail("Predicates may only appear at the beginning of an atomic formula.")
+		}
+	}
+	for _, r := range s[1:] {
+		if !isLower(r) {
+			return w.fail("An atomic formula should contain only predicates followed by terms.")
+		}
+	}
+	w.wffType = "atomic"
+	w.myLetter = string(s[0])
+	w.myTerms = nil
+	w.allFreeVars = nil
+	for _, r := range s[1:] {
+		term := string(r)
+		w.myTerms = append(w.myTerms, term)
+		if isVar(term) && !contains(w.allFreeVars, term) {
+			w.allFreeVars = append(w.allFreeVars, term)
+		}
+	}
+	return w
+}
+
+// w with the free occurrences of variable v replaced by term n
+func subTerm(w *wff, n string, v string) *wff {
+	if !contains(w.freeVars(), v) {
+		return w // PHP clones here; formulas are never modified after parsing
+	}
+	x := &wff{isWellFormed: true, errMsg: "none", wffType: w.wffType, mainOp: w.mainOp, myLetter: w.myLetter}
+	for _, fv := range w.allFreeVars {
+		if fv != v {
+			x.allFreeVars = append(x.allFreeVars, fv)
+		}
+	}
+
+	if w.wffType == "atomic" || w.wffType == "identity" {
+		for _, t := range w.myTerms {
+			if t == v {
+				x.myTerms = append(x.myTerms, n)
+			} else {
+				x.myTerms = append(x.myTerms, t)
+			}
+		}
+		return x
+	}
+
+	x.rightSide = subTerm(w.rightSide, n, v)
+	x.myTerms = x.rightSide.terms()
+	if isMonOp(x.mainOp) {
+		return x
+	}
+	x.leftSide = subTerm(w.leftSide, n, v)
+	x.myTerms = listUnion(x.myTerms, x.leftSide.terms())
+	return x
+}
+
+// whether two formulas are the same, as sameWff
+func (c *checker) sameWff(a *wff, b *wff) bool {
+	if a == nil || b == nil {
+		// PHP recurses forever on two missing sides; that cannot happen
+		// with a well-formed formula on either side
+		return false
+	}
+	if a.wffType != b.wffType {
+		return false
+	}
+	switch a.wffType {
+	case "splat":
+		return true
+	case "identity":
+		return a.term(0) == b.term(0) && a.term(1) == b.term(1)
+	case "atomic":
+		if !c.predicate {
+			return a.myLetter == b.myLetter
+		}
+		if a.myLetter != b.myLetter || len(a.myTerms) != len(b.myTerms) {
+			return false
+		}
+		for i := range a.myTerms {
+			if a.myTerms[i] != b.myTerms[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if a.mainOp != b.mainOp {
+		return false
+	}
+	if isQuantifier(a.mainOp) && a.myLetter != b.myLetter {
+		return false
+	}
+	if isMonOp(a.mainOp) {
+		return c.sameWff(a.rightSide, b.rightSide)
+	}
+	return c.sameWff(a.leftSide, b.leftSide) && c.sameWff(a.rightSide, b.rightSide)
+}
@@ -0,0 +1,433 @@
+package main
+
+// Rendering proofs
+//
+// A stored proof, from the Logic lines saveProof keeps, can be rendered as
+// Fitch-style LaTeX for the fitch.sty (\hypo, \have, \open, \close) or
+// lplfitch (\fitchprf, \subproof, \pline) package, as a PDF made by a local
+// pdflatex with that LaTeX, or as Unicode text for email. Lines are numbered
+// through subproofs as in the proof editor, and justifications use the
+// checker's rule names. An argument, which has no lines, renders as its
+// premises.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"datastore"
+	"proofcheck"
+)
+
+// the -pdflatex command; empty disables PDF rendering
+var pdflatexCommand = "pdflatex"
+
+const pdflatexTimeout = 30 * time.Second
+
+var (
+	proofRenderFormats = []string{"text", "latex", "pdf"}
+	proofRenderLayouts = []string{"fitch", "lplfitch"}
+)
+
+type fitchLine struct {
+	number        int
+	formula       string
+	justification string
+}
+
+// a line, or a subproof whose first node is its assumption
+type fitchNode struct {
+	line     *fitchLine
+	subproof []fitchNode
+}
+
+// a proof as rendered: the premises above the main bar, and the rest
+type fitchProof struct {
+	premises []fitchLine
+	body     []fitchNode
+}
+
+// number the lines of a stored proof; the leading top-level Pr lines are
+// its premises
+func newFitchProof(proof datastore.Proof) (fitchProof, error) {
+	var entries []proofcheck.Entry
+	if len(proof.Logic) != 0 && strings.TrimSpace(proof.Logic[0]) != "" {
+		var err error
+		if entries, err = proofcheck.ParseProof([]byte(proof.Logic[0])); err != nil {
+			return fitchProof{}, err
+		}
+	}
+	if len(entries) == 0 {
+		for _, premise := range proof.Premise {
+			entries = append(entries, proofcheck.Entry{WffStr: premise, JStr: "Pr"})
+		}
+	}
+	entries = proofcheck.UnchangeAllRuleNames(entries)
+
+	var fp fitchProof
+	number := 0
+	for len(entries) != 0 && !entries[0].IsSubproof && strings.TrimSpace(entries[0].JStr) == "Pr" {
+		number++
+		fp.premises = append(fp.premises, fitchLine{number, entries[0].WffStr, "Pr"})
+		entries = entries[1:]
+	}
+	var nodes func(entries []proofcheck.Entry) []fitchNode
+	nodes = func(entries []proofcheck.Entry) []fitchNode {
+		var list []fitchNode
+		for _, e := range entries {
+			if e.IsSubproof {
+				list = append(list, fitchNode{subproof: nodes(e.Subproof)})
+				continue
+			}
+			number++
+			list = append(list, fitchNode{line: &fitchLine{number, e.WffStr, strings.TrimSpace(e.JStr)}})
+		}
+		return list
+	}
+	fp.body = nodes(entries)
+	return fp, nil
+}
+
+func (fp fitchProof) lineCount() int {
+	var count func(nodes []fitchNode) int
+	count = func(nodes []fitchNode) int {
+		n := 0
+		for _, node := range nodes {
+			if node.line != nil {
+				n++
+			} else {
+				n += count(node.subproof)
+			}
+		}
+		return n
+	}
+	return len(fp.premises) + count(fp.body)
+}
+
+// ===== Unicode text =====
+
+// a row of the text rendering: a line, or the bar under premises and assumptions
+type textRow struct {
+	line  *fitchLine
+	depth int // enclosing subproofs
+	bar   int // width of the bar, for bar rows
+}
+
+// render as text with box-drawing bars:
+//
+//	1 │ P → Q      Pr
+//	  ├─────
+//	2 │ │ P        Hyp
+//	  │ ├──
+func renderFitchText(fp fitchProof) string {
+	var rows []textRow
+	for i := range fp.premises {
+		rows = append(rows, textRow{line: &fp.premises[i]})
+	}
+	if len(fp.premises) != 0 {
+		rows = append(rows, textRow{bar: barWidth(fp.premises)})
+	}
+	var walk func(nodes []fitchNode, depth int)
+	walk = func(nodes []fitchNode, depth int) {
+		for _, node := range nodes {
+			if node.line != nil {
+				rows = append(rows, textRow{line: node.line, depth: depth})
+				continue
+			}
+			for i, child := range node.subproof {
+				if child.line != nil {
+					rows = append(rows, textRow{line: child.line, depth: depth + 1})
+				} else {
+					walk([]fitchNode{child}, depth+1)
+				}
+				if i == 0 && child.line != nil {
+					rows = append(rows, textRow{depth: depth + 1, bar: utf8.RuneCountInString(child.line.formula) + 1})
+				}
+			}
+		}
+	}
+	walk(fp.body, 0)
+
+	numberWidth := len(strconv.Itoa(fp.lineCount()))
+	formulaWidth := 0
+	for _, row := range rows {
+		if row.line != nil {
+			if w := 2*row.depth + utf8.RuneCountInString(row.line.formula); w > formulaWidth {
+				formulaWidth = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, row := range rows {
+		if row.line == nil {
+			fmt.Fprintf(&b, "%*s %s├%s\n", numberWidth, "", strings.Repeat("│ ", row.depth), strings.Repeat("─", row.bar))
+			continue
+		}
+		formula := strings.Repeat("│ ", row.depth) + row.line.formula
+		padding := formulaWidth - utf8.RuneCountInString(formula)
+		fmt.Fprintf(&b, "%*d │ %s%s   %s\n", numberWidth, row.line.number, formula, strings.Repeat(" ", padding), row.line.justification)
+	}
+	return b.String()
+}
+
+func barWidth(lines []fitchLine) int {
+	width := 0
+	for _, line := range lines {
+		if w := utf8.RuneCountInString(line.formula); w > width {
+			width = w
+		}
+	}
+	return width + 1
+}
+
+// ===== LaTeX =====
+
+var (
+	// formulas are set in math mode; anything TeX would act on is escaped
+	latexMath = strings.NewReplacer(
+		`\`, `\backslash `, "{", `\{`, "}", `\}`, "%", `\%`, "#", `\#`, "$", `\$`, "&", `\&`,
+		"_", `\_`, "^", `\hat{}`, "~", `\sim `,
+		"→", `\to `, "↔", `\leftrightarrow `, "∧", `\land `, "∨", `\lor `, "¬", `\lnot `,
+		"⊥", `\bot `, "∀", `\forall `, "∃", `\exists `)
+	latexText = strings.NewReplacer(
+		`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "%", `\%`, "#", `\#`, "$", `\$`, "&", `\&`,
+		"_", `\_`, "^", `\textasciicircum{}`, "~", `\textasciitilde{}`,
+		"→", `$\to$`, "↔", `$\leftrightarrow$`, "∧", `$\land$`, "∨", `$\lor$`, "¬", `$\lnot$`,
+		"⊥", `$\bot$`, "∀", `$\forall$`, "∃", `$\exists$`, "–", "--")
+
+	// the cited lines at the start of a justification, e.g. "1, 2" of "1, 2 →E"
+	citations = regexp.MustCompile(`^([0-9][0-9,\s–-]*)(.*)$`)
+)
+
+// split a justification into its rule and its cited lines
+func splitJustification(justification string) (rule string, cites string) {
+	if m := citations.FindStringSubmatch(justification); m != nil {
+		return strings.TrimSpace(m[2]), strings.TrimRight(strings.TrimSpace(m[1]), ",")
+	}
+	return justification, ""
+}
+
+// \hypo for premises and assumptions, \have ... \by{rule}{lines} for the rest
+func renderFitchSty(fp fitchProof) string {
+	var b strings.Builder
+	b.WriteString("\\begin{nd}\n")
+	for _, line := range fp.premises {
+		fmt.Fprintf(&b, "  \\hypo{%d}{%s}\n", line.number, latexMath.Replace(line.formula))
+	}
+	var walk func(nodes []fitchNode, indent string)
+	walk = func(nodes []fitchNode, indent string) {
+		for _, node := range nodes {
+			if node.line == nil {
+				fmt.Fprintf(&b, "%s\\open\n", indent)
+				for i, child := range node.subproof {
+					if i == 0 && child.line != nil {
+						fmt.Fprintf(&b, "%s  \\hypo{%d}{%s}\n", indent, child.line.number, latexMath.Replace(child.line.formula))
+					} else {
+						walk([]fitchNode{child}, indent+"  ")
+					}
+				}
+				fmt.Fprintf(&b, "%s\\close\n", indent)
+				continue
+			}
+			rule, cites := splitJustification(node.line.justification)
+			fmt.Fprintf(&b, "%s\\have{%d}{%s} \\by{%s}{%s}\n", indent, node.line.number, latexMath.Replace(node.line.formula),
+				latexText.Replace(rule), strings.NewReplacer("–", "-", " ", "").Replace(cites))
+		}
+	}
+	walk(fp.body, "  ")
+	b.WriteString("\\end{nd}\n")
+	return b.String()
+}
+
+// \fitchprf{premises}{body}, with \subproof{assumption}{body} and \pline
+func renderLplfitch(fp fitchProof) string {
+	pline := func(line *fitchLine) string {
+		s := fmt.Sprintf("\\pline[%d.]{%s}", line.number, latexMath.Replace(line.formula))
+		if rule, cites := splitJustification(line.justification); rule != "Pr" && rule != "Hyp" {
+			if cites != "" {
+				rule += ": " + cites
+			}
+			s += "[" + latexText.Replace(rule) + "]"
+		}
+		return s
+	}
+	var nodes func(list []fitchNode, indent string) string
+	nodes = func(list []fitchNode, indent string) string {
+		var parts []string
+		for _, node := range list {
+			if node.line != nil {
+				parts = append(parts, indent+pline(node.line))
+				continue
+			}
+			assumption, rest := "", node.subproof
+			if len(rest) != 0 && rest[0].line != nil {
+				assumption, rest = pline(rest[0].line), rest[1:]
+			}
+			parts = append(parts, fmt.Sprintf("%s\\subproof{%s}{\n%s\n%s}", indent, assumption, nodes(rest, indent+"  "), indent))
+		}
+		return strings.Join(parts, " \\\\\n")
+	}
+
+	var premises []string
+	for i := range fp.premises {
+		premises = append(premises, pline(&fp.premises[i]))
+	}
+	return fmt.Sprintf("\\fitchprf{%s}{\n%s\n}\n", strings.Join(premises, " \\\\ "), nodes(fp.body, "  "))
+}
+
+// a document around the rendering, for pdflatex
+func latexDocument(layout string, body string) string {
+	pkg := "fitch"
+	if layout == "lplfitch" {
+		pkg = "lplfitch"
+	}
+	return "\\documentclass{article}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb}\n\\usepackage{" + pkg + "}\n" +
+		"\\pagestyle{empty}\n\\begin{document}\n" + body + "\\end{document}\n"
+}
+
+var errNoTeX = errors.New("no TeX installation; set -pdflatex")
+
+// run pdflatex on document in a scratch directory, without shell escapes
+func renderPDF(ctx context.Context, document string) ([]byte, error) {
+	if pdflatexCommand == "" {
+		return nil, errNoTeX
+	}
+	command, err := exec.LookPath(pdflatexCommand)
+	if err != nil {
+		return nil, errNoTeX
+	}
+	dir, err := os.MkdirTemp("", "proof-render-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "proof.tex"), []byte(document), 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdflatexTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, "-interaction=nonstopmode", "-halt-on-error", "-no-shell-escape", "proof.tex")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if len(output) > 2000 {
+			output = output[len(output)-2000:]
+		}
+		return nil, fmt.Errorf("%s: %w\n%s", pdflatexCommand, err, output)
+	}
+	return os.ReadFile(filepath.Join(dir, "proof.pdf"))
+}
+
+// whether user may read proof: its owner, admins, and the instructors and
+// TAs of a section the owner is a student of
+func (env *Env) canViewProof(user string, proof *datastore.Proof) (bool, error) {
+	if proof.UserSubmitted == user || admin_users[user] {
+		return true, nil
+	}
+	sections, err := env.ds.GetSections(user)
+	if err != nil {
+		return false, err
+	}
+	for _, section := range sections {
+		role, err := env.ds.GetRole(section.Name, user)
+		if err != nil || (role != "instructor" && role != "ta") {
+			continue
+		}
+		if role, err := env.ds.GetRole(section.Name, proof.UserSubmitted); err == nil && role == "student" {
+			return true, nil
+		}
+	}
+	if proof.EntryType == "argument" {
+		// bank problems shared with the user
+		if _, err := env.ds.GetProblem(proof.Id, user); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// render a stored proof as text, LaTeX or PDF
+func (env *Env) apiRenderProof(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+	values := req.URL.Query()
+
+	format := values.Get("format")
+	if format != "text" && format != "latex" && format != "pdf" {
+		writeAPIError(w, 400, errCodeBadRequest, "format must be text, latex or pdf")
+		return
+	}
+	layout := values.Get("layout")
+	if layout == "" {
+		layout = "fitch"
+	}
+	if layout != "fitch" && layout != "lplfitch" {
+		writeAPIError(w, 400, errCodeBadRequest, "layout must be fitch or lplfitch")
+		return
+	}
+
+	proof, err := env.ds.GetProof(params["proof"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	if ok, err := env.canViewProof(user.GetEmail(), proof); err != nil {
+		writeDatastoreError(w, err)
+		return
+	} else if !ok {
+		// as if it did not exist, like other users' bank problems
+		writeAPIError(w, 404, errCodeNotFound, datastore.ErrNotExists.Error())
+		return
+	}
+	fp, err := newFitchProof(*proof)
+	if err != nil {
+		logger.ErrorContext(req.Context(), "apiRenderProof: stored proof is not a proof", "proof", proof.Id, "error", err)
+		writeAPIError(w, 500, errCodeInternal, "the stored proof cannot be read")
+		return
+	}
+
+	filename := strings.Join(strings.Fields(proof.ProofName), "_")
+	if filename == "" {
+		filename = "proof-" + proof.Id
+	}
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(renderFitchText(fp)))
+		return
+	}
+
+	body := renderFitchSty(fp)
+	if layout == "lplfitch" {
+		body = renderLplfitch(fp)
+	}
+	if format == "latex" {
+		w.Header().Set("Content-Type", "text/x-tex; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename + ".tex"}))
+		w.Write([]byte(body))
+		return
+	}
+
+	pdf, err := renderPDF(req.Context(), latexDocument(layout, body))
+	if errors.Is(err, errNoTeX) {
+		writeAPIError(w, 501, errCodeNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(req.Context(), "apiRenderProof: pdflatex failed", "error", err)
+		writeAPIError(w, 500, errCodeInternal, "pdflatex failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + ".pdf"}))
+	w.Write(pdf)
+}
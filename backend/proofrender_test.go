@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+// P → Q, Q → R ∴ P → R, with frontend rule names as saveProof stores them
+var renderTestProof = datastore.Proof{
+	EntryType: "proof", UserSubmitted: "student@csumb.edu", ProofName: "Hypothetical syllogism", ProofType: "prop",
+	Premise: []string{"P → Q", "Q → R"}, Conclusion: "P → R", ProofCompleted: "true", RepoProblem: "false",
+	Logic: []string{`[{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"Q → R","jstr":"Pr"},` +
+		`[{"wffstr":"P","jstr":"Hyp"},{"wffstr":"Q","jstr":"1, 3 Modus Ponens"},{"wffstr":"R","jstr":"2, 4 →E"}],` +
+		`{"wffstr":"P → R","jstr":"3–5 →I"}]`},
+	Rules: []string{},
+}
+
+func TestRenderFitchText(t *testing.T) {
+	fp, err := newFitchProof(renderTestProof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"1 │ P → Q   Pr\n" +
+		"2 │ Q → R   Pr\n" +
+		"  ├──────\n" +
+		"3 │ │ P     Hyp\n" +
+		"  │ ├──\n" +
+		"4 │ │ Q     1, 3 →E\n" +
+		"5 │ │ R     2, 4 →E\n" +
+		"6 │ P → R   3–5 →I\n"
+	if got := renderFitchText(fp); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderFitchLaTeX(t *testing.T) {
+	fp, err := newFitchProof(renderTestProof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `\begin{nd}
+  \hypo{1}{P \to  Q}
+  \hypo{2}{Q \to  R}
+  \open
+    \hypo{3}{P}
+    \have{4}{Q} \by{$\to$E}{1,3}
+    \have{5}{R} \by{$\to$E}{2,4}
+  \close
+  \have{6}{P \to  R} \by{$\to$I}{3-5}
+\end{nd}
+`
+	if got := renderFitchSty(fp); got != want {
+		t.Errorf("fitch.sty: got\n%s\nwant\n%s", got, want)
+	}
+
+	want = `\fitchprf{\pline[1.]{P \to  Q} \\ \pline[2.]{Q \to  R}}{
+  \subproof{\pline[3.]{P}}{
+    \pline[4.]{Q}[$\to$E: 1, 3] \\
+    \pline[5.]{R}[$\to$E: 2, 4]
+  } \\
+  \pline[6.]{P \to  R}[$\to$I: 3--5]
+}
+`
+	if got := renderLplfitch(fp); got != want {
+		t.Errorf("lplfitch: got\n%s\nwant\n%s", got, want)
+	}
+
+	// TeX never sees a command from the stored proof
+	evil := datastore.Proof{Logic: []string{`[{"wffstr":"\\input{/etc/passwd}","jstr":"$x$ \\write18"}]`}}
+	if fp, err = newFitchProof(evil); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderFitchSty(fp); strings.Contains(got, `\input`) || strings.Contains(got, `\write`) {
+		t.Errorf("unescaped: %s", got)
+	}
+}
+
+func TestAPIRenderProof(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student, other := "instructor@csumb.edu", "student@csumb.edu", "other@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	if err := env.ds.Store(renderTestProof); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{student, instructor} {
+		rr := apiRequest(t, api, user, "GET", "/proofs/1/render?format=text", "")
+		expectAPIStatus(t, rr, 200, "")
+		if !strings.HasPrefix(rr.Body.String(), "1 │ P → Q") {
+			t.Errorf("%s got %s", user, rr.Body.String())
+		}
+	}
+	expectAPIStatus(t, apiRequest(t, api, other, "GET", "/proofs/1/render?format=text", ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/proofs/9/render?format=text", ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/proofs/1/render?format=docx", ""), 400, errCodeBadRequest)
+
+	rr := apiRequest(t, api, student, "GET", "/proofs/1/render?format=latex&layout=lplfitch", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.HasPrefix(rr.Body.String(), `\fitchprf`) {
+		t.Errorf("lplfitch: %s", rr.Body.String())
+	}
+
+	defer func(command string) { pdflatexCommand = command }(pdflatexCommand)
+	pdflatexCommand = filepath.Join(t.TempDir(), "missing-pdflatex")
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/proofs/1/render?format=pdf", ""), 501, errCodeNotImplemented)
+
+	// a stand-in for pdflatex that checks its document and writes a PDF
+	pdflatexCommand = filepath.Join(t.TempDir(), "pdflatex")
+	script := "#!/bin/sh\ngrep -q 'usepackage{fitch}' proof.tex && printf '%%PDF-1.5' > proof.pdf\n"
+	if err := os.WriteFile(pdflatexCommand, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rr = apiRequest(t, api, student, "GET", "/proofs/1/render?format=pdf", "")
+	expectAPIStatus(t, rr, 200, "")
+	if rr.Body.String() != "%PDF-1.5" || rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("pdf: %q %s", rr.Body.String(), rr.Header().Get("Content-Type"))
+	}
+}
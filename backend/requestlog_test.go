@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"logging"
+)
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+
+	handler := withRequestLog(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if logging.RequestID(req.Context()) == "" {
+			t.Error("handler context has no request ID")
+		}
+		http.Error(w, "gone", 404)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/api/v1/sections/Logic/roster/student@csumb.edu?sectionName=Logic", nil)
+	req.Header.Set("X-Request-ID", "nginx-42")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if id := rr.Header().Get("X-Request-ID"); id != "nginx-42" {
+		t.Errorf("got X-Request-ID %q want the one nginx sent", id)
+	}
+	line := buf.String()
+	for _, want := range []string{`"request_id":"nginx-42"`, `"status":404`, `"path":"/api/v1/sections/Logic/roster/u_`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log %s is missing %s", line, want)
+		}
+	}
+	if strings.Contains(line, "csumb.edu") || strings.Contains(line, "sectionName") {
+		t.Errorf("access log leaks the email or query: %s", line)
+	}
+
+	// malformed IDs are replaced
+	req = httptest.NewRequest("GET", "/admins", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if id := rr.Header().Get("X-Request-ID"); len(id) != 16 {
+		t.Errorf("got generated X-Request-ID %q", id)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+// Allowed rule sets
+//
+// An assignment carries a rule set (see proofcheck.AllowedRules): a preset
+// such as "forall x basic", a comma-separated list of rules, or "" for
+// every rule. Students see the rule set of each problem, and the rules it
+// stands for, in the repository listing. Saving a proof of an assigned
+// problem that cites a rule none of its assignments allow is refused, with
+// an issue for every such line, and so is saving one that does not parse.
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"datastore"
+	"proofcheck"
+)
+
+// list the rule set presets
+func (env *Env) apiListRuleSets(w http.ResponseWriter, req *http.Request, params apiParams) {
+	writeAPIJSON(w, 200, proofcheck.RuleSets)
+}
+
+// the rule set an assignment is saved with; nil keeps current
+func (env *Env) assignmentRuleSet(sectionName string, assignmentName string, ruleSet *string) (string, error) {
+	if ruleSet != nil {
+		_, err := proofcheck.AllowedRules(*ruleSet)
+		return strings.TrimSpace(*ruleSet), err
+	}
+	assignments, err := env.ds.GetAssignmentsBySection(sectionName)
+	if err != nil {
+		return "", err
+	}
+	for _, assignment := range assignments {
+		if assignment.Name == assignmentName {
+			return assignment.RuleSet, nil
+		}
+	}
+	return "", nil
+}
+
+// the rules a user may prove proofName with, nil for every rule; a problem
+// in several assignments allows what any of them allows
+func (env *Env) allowedRules(userEmail string, proofName string) ([]string, error) {
+	ruleSets, err := env.ds.GetProblemRuleSets(userEmail, proofName)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []string
+	for _, ruleSet := range ruleSets {
+		rules, err := proofcheck.AllowedRules(ruleSet)
+		if err != nil {
+			logger.Warn("allowedRules: stored rule set is not a rule set", "ruleSet", ruleSet, "error", err)
+			continue
+		}
+		if rules == nil {
+			return nil, nil
+		}
+		for _, rule := range rules {
+			if !slices.Contains(allowed, rule) {
+				allowed = append(allowed, rule)
+			}
+		}
+	}
+	return allowed, nil
+}
+
+// issues for the lines of a proof that cite a rule its assignments do not
+// allow, or a single issue when they restrict its rules and it does not parse
+func (env *Env) disallowedRules(proof datastore.Proof) ([]string, error) {
+	if proof.EntryType != "proof" || proof.RepoProblem != "true" || len(proof.Logic) == 0 {
+		return nil, nil
+	}
+	allowed, err := env.allowedRules(proof.UserSubmitted, proof.ProofName)
+	if err != nil || allowed == nil {
+		return nil, err
+	}
+	entries, err := proofcheck.ParseProof([]byte(proof.Logic[0]))
+	if err != nil {
+		// a proof the rules cannot be read from cannot be shown to keep to them
+		return []string{"The proof could not be read, so its rules cannot be checked."}, nil
+	}
+	return proofcheck.DisallowedRules(proofcheck.UnchangeAllRuleNames(entries), proof.ProofType == "fol", allowed), nil
+}
+
+// fill in the rules each problem of the repository listing allows
+func withAllowedRules(sections []datastore.SectionProofs) {
+	for _, section := range sections {
+		for i := range section.ProofList {
+			section.ProofList[i].AllowedRules, _ = proofcheck.AllowedRules(section.ProofList[i].RuleSet)
+		}
+	}
+}
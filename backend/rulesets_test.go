@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+func TestAPIRuleSets(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student := "instructor@csumb.edu", "student@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	problem := datastore.Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - MT", ProofType: "prop",
+		Premise: []string{"P → Q", "¬Q"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "¬P", RepoProblem: "true"}
+	if err := env.ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := apiRequest(t, api, student, "GET", "/rule-sets", "")
+	expectAPIStatus(t, rr, 200, "")
+	if !strings.Contains(rr.Body.String(), `"name":"forall x basic"`) {
+		t.Errorf("presets: %s", rr.Body.String())
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments",
+		`{"name":"HW","proofIds":[1],"visibility":"true","ruleSet":"shortcuts"}`), 400, errCodeBadRequest)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments",
+		`{"name":"HW","proofIds":[1],"visibility":"true","ruleSet":"forall x basic"}`), 201, "")
+	// left out of an update, the rule set is kept
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PUT", "/sections/Logic/assignments/HW",
+		`{"proofIds":[1],"visibility":"true"}`), 200, "")
+
+	rr = apiRequest(t, api, student, "GET", "/proofs?selection=repo", "")
+	expectAPIStatus(t, rr, 200, "")
+	var repo []datastore.SectionProofs
+	json.Unmarshal(rr.Body.Bytes(), &repo)
+	if len(repo) != 1 || len(repo[0].ProofList) != 1 || repo[0].ProofList[0].RuleSet != "forall x basic" ||
+		strings.Contains(fmt.Sprint(repo[0].ProofList[0].AllowedRules), "MT") {
+		t.Fatalf("repository listing: %s", rr.Body.String())
+	}
+
+	attempt := `{"EntryType":"proof","ProofName":"Repository - MT","ProofType":"prop","Premise":["P → Q","¬Q"],"Conclusion":"¬P",
+		"RepoProblem":"true","ProofCompleted":"true","Rules":[],"Logic":["[{\"wffstr\":\"P → Q\",\"jstr\":\"Pr\"},{\"wffstr\":\"¬Q\",\"jstr\":\"Pr\"},{\"wffstr\":\"¬P\",\"jstr\":\"1, 2 Modus Tollens\"}]"]}`
+	rr = apiRequest(t, api, student, "POST", "/proofs", attempt)
+	expectAPIStatus(t, rr, 400, errCodeBadRequest)
+	if !strings.Contains(rr.Body.String(), "Line 3: Uses the rule Modus Tollens") {
+		t.Errorf("rejection: %s", rr.Body.String())
+	}
+	// other users' arguments of the same name are not restricted
+	expectAPIStatus(t, apiRequest(t, api, "other@csumb.edu", "POST", "/proofs", attempt), 204, "")
+	// nor can a proof whose rules cannot be read
+	malformed := strings.Replace(attempt, `"Logic":["[{`, `"Logic":["{[`, 1)
+	rr = apiRequest(t, api, student, "POST", "/proofs", malformed)
+	expectAPIStatus(t, rr, 400, errCodeBadRequest)
+	if !strings.Contains(rr.Body.String(), "could not be read") {
+		t.Errorf("rejection of a malformed proof: %s", rr.Body.String())
+	}
+
+	expectAPIStatus(t, apiRequest(t, api, instructor, "PUT", "/sections/Logic/assignments/HW",
+		`{"proofIds":[1],"visibility":"true","ruleSet":"derived"}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, student, "POST", "/proofs", attempt), 204, "")
+}
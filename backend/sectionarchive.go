@@ -0,0 +1,131 @@
+package main
+
+// Section archives
+//
+// A section can be exported to a versioned JSON archive, with its roster,
+// assignments, problems and student proofs, and imported on another
+// server (or under another name on this one), where its proofs get new ids.
+// Both are available as /api/v1 routes and as backend subcommands.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+
+	"datastore"
+)
+
+const maxSectionArchiveBytes = 64 << 20
+
+// the archive of a section, as a download named after it
+func (env *Env) apiExportSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	archive, err := env.ds.ExportSection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": params["section"] + ".json"}))
+	writeAPIJSON(w, 200, archive)
+}
+
+// recreate an archived section; admins may import any archive, instructors
+// their own sections as long as it names no other user this server has
+func (env *Env) apiImportSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxSectionArchiveBytes)
+	var archive datastore.SectionArchive
+	if !decodeAPIBody(w, req, &archive) {
+		return
+	}
+	importer := user.GetEmail()
+	if admin_users[importer] {
+		importer = ""
+	} else if archive.Section.InstructorEmail != importer {
+		writeAPIError(w, 403, errCodeForbidden, "Insufficient privileges")
+		return
+	}
+
+	summary, err := env.ds.ImportSection(&archive, req.URL.Query().Get("name"), importer)
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.import", summary.Section, summary.Section, nil, summary)
+	logger.InfoContext(req.Context(), "apiImportSection: section imported", "section", summary.Section)
+	writeAPIJSON(w, 201, summary)
+}
+
+// `backend export-section [-o file] section`
+func exportSectionCommand(args []string) error {
+	flags := flag.NewFlagSet("export-section", flag.ExitOnError)
+	output := flags.String("o", "", "File to write the archive to; <section>.json if empty")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("export-section takes one section name")
+	}
+	sectionName := flags.Arg(0)
+	if *output == "" {
+		*output = sectionName + ".json"
+	}
+
+	ds, err := datastore.InitDB(database_uri)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	archive, err := ds.ExportSection(sectionName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		return err
+	}
+	logger.Info("Section exported", "section", sectionName, "path", *output,
+		"assignments", len(archive.Assignments), "proofs", len(archive.Proofs))
+	return nil
+}
+
+// `backend import-section [-name section] file`
+func importSectionCommand(args []string) error {
+	flags := flag.NewFlagSet("import-section", flag.ExitOnError)
+	name := flags.String("name", "", "Name of the imported section; the archived name if empty")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("import-section takes one archive file")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var archive datastore.SectionArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+
+	ds, err := datastore.InitDB(database_uri)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	summary, err := ds.ImportSection(&archive, *name, "")
+	if err != nil {
+		return err
+	}
+	recordAudit(context.Background(), ds, newAuditEntry(osActor(), "section.import", summary.Section, summary.Section, nil, summary))
+	return nil
+}
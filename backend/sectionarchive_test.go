@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"datastore"
+)
+
+func TestAPISectionArchive(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+
+	expectAPIStatus(t, apiRequest(t, api, "student@csumb.edu", "GET", "/sections/Logic/archive", ""), 403, errCodeForbidden)
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/archive", "")
+	expectAPIStatus(t, rr, 200, "")
+	if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename=Logic.json` {
+		t.Errorf("got Content-Disposition %q", disposition)
+	}
+	var archive datastore.SectionArchive
+	if err := json.Unmarshal(rr.Body.Bytes(), &archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.Version != datastore.SectionArchiveVersion || len(archive.Roster) != 2 {
+		t.Errorf("unexpected archive: %s", rr.Body.String())
+	}
+
+	body := rr.Body.String()
+	expectAPIStatus(t, apiRequest(t, api, "student@csumb.edu", "POST", "/section-archives?name=Mine", body), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/section-archives", body), 409, errCodeConflict)
+	newer := strings.Replace(body, `"version":1`, `"version":2`, 1)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/section-archives?name=Newer", newer), 400, errCodeBadRequest)
+	// the student is already on this server, so only an admin may import them
+	rr = apiRequest(t, api, instructor, "POST", "/section-archives?name=Logic%202", body)
+	expectAPIStatus(t, rr, 403, errCodeForbidden)
+	if _, err := env.ds.GetSection("Logic 2"); err == nil {
+		t.Error("a refused import created the section")
+	}
+	rr = apiRequest(t, api, "cohunter@csumb.edu", "POST", "/section-archives?name=Logic%202", body)
+	expectAPIStatus(t, rr, 201, "")
+	if role, err := env.ds.GetRole("Logic 2", "student@csumb.edu"); err != nil || role != "student" {
+		t.Errorf("imported roster: %q %v", role, err)
+	}
+}
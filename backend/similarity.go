@@ -0,0 +1,340 @@
+package main
+
+// Similarity detection
+//
+// GET /sections/{section}/similarity compares, for every problem of the
+// section's assignments, the latest proof of each student with those of the
+// others, and ranks the pairs that look copied. Lines are compared in
+// normal form (see proofcheck.Normalize), and a pair is reported when the
+// proofs are the same line for line, share lines with the same mistake, or
+// are within minSimilarity of each other by line edit distance. Proofs with
+// fewer than minLines lines besides their premises are left out: short
+// problems have one solution everybody finds.
+// GET /sections/{section}/similarity/compare shows two proofs side by side.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"datastore"
+	"proofcheck"
+)
+
+const (
+	defaultSimilarityMinLines = 3
+	defaultMinSimilarity      = 0.8
+	defaultSimilarityLimit    = 50
+	maxSimilarityLimit        = 500
+)
+
+type similarityReport struct {
+	Section       string        `json:"section"`
+	MinLines      int           `json:"minLines"`
+	MinSimilarity float64       `json:"minSimilarity"`
+	Pairs         []similarPair `json:"pairs"` // the most suspicious first, at most limit
+}
+
+type similarPair struct {
+	Assignment       string  `json:"assignment"`
+	Problem          string  `json:"problem"`
+	StudentA         string  `json:"studentA"`
+	ProofA           string  `json:"proofA"` // proof id, for compare
+	StudentB         string  `json:"studentB"`
+	ProofB           string  `json:"proofB"`
+	ExactMatch       bool    `json:"exactMatch"`       // the same lines in the same order
+	SharedErrorLines int     `json:"sharedErrorLines"` // lines with the same mistake in both
+	EditDistance     int     `json:"editDistance"`     // lines added, removed or changed to make one the other
+	Similarity       float64 `json:"similarity"`       // 1 less the edit distance over the lines of the longer proof
+}
+
+type sideBySide struct {
+	Problem  string          `json:"problem"`
+	StudentA string          `json:"studentA"`
+	StudentB string          `json:"studentB"`
+	Rows     []sideBySideRow `json:"rows"` // the lines of both, aligned
+}
+
+type sideBySideRow struct {
+	A    *comparedLine `json:"a,omitempty"` // left out where only the other proof has a line
+	B    *comparedLine `json:"b,omitempty"`
+	Same bool          `json:"same"`
+}
+
+type comparedLine struct {
+	Line int `json:"line"`
+	proofcheck.NormalizedLine
+	Issues []string `json:"issues,omitempty"`
+}
+
+// a proof prepared for comparison
+type comparedProof struct {
+	proof   datastore.Proof
+	lines   []proofcheck.NormalizedLine
+	keys    []string         // a line each, as compared
+	issues  map[int][]string // by line number
+	errors  map[string]bool  // the key and kind of each mistake
+	derived int              // lines that are not premises
+}
+
+func prepareProof(proof datastore.Proof) *comparedProof {
+	if len(proof.Logic) == 0 {
+		return nil
+	}
+	entries, err := proofcheck.ParseProof([]byte(proof.Logic[0]))
+	if err != nil {
+		return nil
+	}
+	p := &comparedProof{proof: proof, lines: proofcheck.Normalize(entries, proof.ProofType == "fol"),
+		issues: map[int][]string{}, errors: map[string]bool{}}
+	for _, line := range p.lines {
+		p.keys = append(p.keys, fmt.Sprintf("%d|%s|%s", line.Depth, line.Formula, line.Justification))
+		if line.Justification != "Pr" {
+			p.derived++
+		}
+	}
+	for _, mistake := range diagnoseStored(proof) {
+		if mistake.Line <= len(p.keys) {
+			p.issues[mistake.Line] = append(p.issues[mistake.Line], mistake.Issue)
+			p.errors[p.keys[mistake.Line-1]+"|"+mistake.Kind] = true
+		}
+	}
+	return p
+}
+
+// the edit distance of a and b and, for each step of the alignment, the
+// index into a and into b, -1 on the side without a line
+func alignLines(a []string, b []string) (int, [][2]int) {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			change := 1
+			if a[i-1] == b[j-1] {
+				change = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+change)
+		}
+	}
+
+	var steps [][2]int
+	for i, j := len(a), len(b); i > 0 || j > 0; {
+		switch {
+		case i > 0 && j > 0 && a[i-1] == b[j-1] && d[i][j] == d[i-1][j-1]:
+			i, j = i-1, j-1
+			steps = append(steps, [2]int{i, j})
+		case i > 0 && j > 0 && d[i][j] == d[i-1][j-1]+1:
+			i, j = i-1, j-1
+			steps = append(steps, [2]int{i, j})
+		case i > 0 && d[i][j] == d[i-1][j]+1:
+			i--
+			steps = append(steps, [2]int{i, -1})
+		default:
+			j--
+			steps = append(steps, [2]int{-1, j})
+		}
+	}
+	for l, r := 0, len(steps)-1; l < r; l, r = l+1, r-1 {
+		steps[l], steps[r] = steps[r], steps[l]
+	}
+	return d[len(a)][len(b)], steps
+}
+
+func comparePair(a *comparedProof, b *comparedProof) similarPair {
+	pair := similarPair{Problem: a.proof.ProofName, StudentA: a.proof.UserSubmitted, ProofA: a.proof.Id,
+		StudentB: b.proof.UserSubmitted, ProofB: b.proof.Id}
+	pair.EditDistance, _ = alignLines(a.keys, b.keys)
+	pair.ExactMatch = pair.EditDistance == 0
+	pair.Similarity = 1 - float64(pair.EditDistance)/float64(max(len(a.keys), len(b.keys), 1))
+	for signature := range a.errors {
+		if b.errors[signature] {
+			pair.SharedErrorLines++
+		}
+	}
+	return pair
+}
+
+// the pairs worth a look, of the latest proof of each student of a problem
+func similarPairs(proofs []datastore.Proof, minLines int, minSimilarity float64) []similarPair {
+	seen := map[string]bool{}
+	var prepared []*comparedProof
+	for _, proof := range proofs { // latest first
+		if seen[proof.UserSubmitted] {
+			continue
+		}
+		seen[proof.UserSubmitted] = true
+		if p := prepareProof(proof); p != nil && p.derived >= minLines {
+			prepared = append(prepared, p)
+		}
+	}
+	sort.Slice(prepared, func(i, j int) bool { return prepared[i].proof.UserSubmitted < prepared[j].proof.UserSubmitted })
+
+	var pairs []similarPair
+	for i, a := range prepared {
+		for _, b := range prepared[i+1:] {
+			pair := comparePair(a, b)
+			if pair.ExactMatch || pair.SharedErrorLines > 0 || pair.Similarity >= minSimilarity {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	return pairs
+}
+
+// the similarity parameters of a request
+func similarityParams(req *http.Request) (minLines int, minSimilarity float64, limit int, err error) {
+	values := req.URL.Query()
+	minLines, minSimilarity, limit = defaultSimilarityMinLines, defaultMinSimilarity, defaultSimilarityLimit
+	if value := values.Get("minLines"); value != "" {
+		if minLines, err = strconv.Atoi(value); err != nil || minLines < 0 {
+			return 0, 0, 0, errors.New("minLines must be a number of lines")
+		}
+	}
+	if value := values.Get("minSimilarity"); value != "" {
+		if minSimilarity, err = strconv.ParseFloat(value, 64); err != nil || minSimilarity < 0 || minSimilarity > 1 {
+			return 0, 0, 0, errors.New("minSimilarity must be between 0 and 1")
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxSimilarityLimit {
+			return 0, 0, 0, fmt.Errorf("limit must be between 1 and %d", maxSimilarityLimit)
+		}
+	}
+	return minLines, minSimilarity, limit, nil
+}
+
+func (env *Env) apiSectionSimilarity(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	minLines, minSimilarity, limit, err := similarityParams(req)
+	if err != nil {
+		writeAPIError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	assignmentName := req.URL.Query().Get("assignment")
+
+	assignments, err := env.ds.GetAssignmentsBySection(params["section"])
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	report := similarityReport{Section: params["section"], MinLines: minLines, MinSimilarity: minSimilarity, Pairs: []similarPair{}}
+	compared := map[string]bool{}
+	found := false
+	for _, assignment := range assignments {
+		if assignmentName != "" && assignment.Name != assignmentName {
+			continue
+		}
+		found = true
+		problems, err := env.ds.GetAssignmentProofs(assignment)
+		if err != nil {
+			writeDatastoreError(w, err)
+			return
+		}
+		for _, problem := range problems {
+			if compared[problem.ProofName] {
+				continue
+			}
+			compared[problem.ProofName] = true
+			page, err := env.ds.QueryProofs(datastore.ProofQuery{SectionName: params["section"], ProofName: problem.ProofName,
+				EntryType: "proof", Sort: "time", Descending: true})
+			if err != nil {
+				writeDatastoreError(w, err)
+				return
+			}
+			for _, pair := range similarPairs(page.Proofs, minLines, minSimilarity) {
+				pair.Assignment = assignment.Name
+				report.Pairs = append(report.Pairs, pair)
+			}
+		}
+	}
+	if assignmentName != "" && !found {
+		writeAPIError(w, 404, errCodeNotFound, "no such assignment")
+		return
+	}
+
+	sort.SliceStable(report.Pairs, func(i, j int) bool {
+		a, b := report.Pairs[i], report.Pairs[j]
+		if a.ExactMatch != b.ExactMatch {
+			return a.ExactMatch
+		}
+		if a.SharedErrorLines != b.SharedErrorLines {
+			return a.SharedErrorLines > b.SharedErrorLines
+		}
+		return a.Similarity > b.Similarity
+	})
+	if len(report.Pairs) > limit {
+		report.Pairs = report.Pairs[:limit]
+	}
+	writeAPIJSON(w, 200, report)
+}
+
+// a proof of a student of the section, or an error written
+func (env *Env) sectionStudentProof(w http.ResponseWriter, sectionName string, id string) *datastore.Proof {
+	proof, err := env.ds.GetProof(id)
+	if errors.Is(err, datastore.ErrNotExists) {
+		writeAPIError(w, 404, errCodeNotFound, "no such proof")
+		return nil
+	}
+	if err != nil {
+		writeDatastoreError(w, err)
+		return nil
+	}
+	role, err := env.ds.GetRole(sectionName, proof.UserSubmitted)
+	if err != nil && !errors.Is(err, datastore.ErrNotExists) {
+		writeDatastoreError(w, err)
+		return nil
+	}
+	if role != "student" || proof.EntryType != "proof" {
+		writeAPIError(w, 404, errCodeNotFound, "no such proof")
+		return nil
+	}
+	return proof
+}
+
+func (env *Env) apiCompareProofs(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], true) {
+		return
+	}
+	proofA := env.sectionStudentProof(w, params["section"], req.URL.Query().Get("a"))
+	if proofA == nil {
+		return
+	}
+	proofB := env.sectionStudentProof(w, params["section"], req.URL.Query().Get("b"))
+	if proofB == nil {
+		return
+	}
+	if proofA.ProofName != proofB.ProofName {
+		writeAPIError(w, 400, errCodeBadRequest, "the proofs are of different problems")
+		return
+	}
+	a, b := prepareProof(*proofA), prepareProof(*proofB)
+	if a == nil || b == nil {
+		writeAPIError(w, 400, errCodeBadRequest, "a proof has no lines to compare")
+		return
+	}
+
+	result := sideBySide{Problem: proofA.ProofName, StudentA: proofA.UserSubmitted, StudentB: proofB.UserSubmitted, Rows: []sideBySideRow{}}
+	side := func(p *comparedProof, i int) *comparedLine {
+		if i < 0 {
+			return nil
+		}
+		return &comparedLine{Line: i + 1, NormalizedLine: p.lines[i], Issues: p.issues[i+1]}
+	}
+	_, steps := alignLines(a.keys, b.keys)
+	for _, step := range steps {
+		row := sideBySideRow{A: side(a, step[0]), B: side(b, step[1])}
+		row.Same = step[0] >= 0 && step[1] >= 0 && a.keys[step[0]] == b.keys[step[1]]
+		result.Rows = append(result.Rows, row)
+	}
+	writeAPIJSON(w, 200, result)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"datastore"
+)
+
+func TestAlignLines(t *testing.T) {
+	distance, steps := alignLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "x", "d", "e"})
+	if distance != 3 || fmt.Sprint(steps) != "[[0 0] [1 1] [2 2] [3 3] [-1 4]]" {
+		t.Errorf("got %d %v", distance, steps)
+	}
+}
+
+func TestAPISectionSimilarity(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor := "instructor@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster",
+		`{"studentEmails":["a@csumb.edu","b@csumb.edu","c@csumb.edu","d@csumb.edu"]}`), 200, "")
+	problem := datastore.Proof{EntryType: "argument", UserSubmitted: instructor, ProofName: "Repository - HS", ProofType: "prop",
+		Premise: []string{"P → Q", "Q → R"}, Logic: []string{}, Rules: []string{}, ProofCompleted: "false", Conclusion: "P → R", RepoProblem: "true"}
+	if err := env.ds.Store(problem); err != nil {
+		t.Fatal(err)
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW","proofIds":[1],"visibility":"true"}`), 201, "")
+	save := func(student string, completed string, logic string) {
+		t.Helper()
+		attempt := problem
+		attempt.EntryType, attempt.UserSubmitted, attempt.ProofCompleted, attempt.Logic = "proof", student, completed, []string{logic}
+		if err := env.ds.Store(attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	premises := `{"wffstr":"P → Q","jstr":"Pr"},{"wffstr":"Q → R","jstr":"Pr"}`
+	save("a@csumb.edu", "true", "["+premises+`,[{"wffstr":"P","jstr":"Hyp"},{"wffstr":"Q","jstr":"1, 3 →E"},{"wffstr":"R","jstr":"2, 4 →E"}],{"wffstr":"P → R","jstr":"3–5 →I"}]`)
+	save("b@csumb.edu", "true", "["+premises+`,[{"wffstr":"(P)","jstr":"Hyp"},{"wffstr":"Q","jstr":"1 3 Modus Ponens"},{"wffstr":"R","jstr":"2,4 →E"}],{"wffstr":"P→R","jstr":"3-5 →I"}]`)
+	save("c@csumb.edu", "error", "["+premises+`,[{"wffstr":"P","jstr":"Hyp"},{"wffstr":"Q","jstr":"1, 3 →E"},{"wffstr":"R","jstr":"2, 3 →E"}],{"wffstr":"P → R","jstr":"3–5 →I"}]`)
+	save("d@csumb.edu", "error", "["+premises+`,[{"wffstr":"P","jstr":"Hyp"},{"wffstr":"Q","jstr":"1, 3 →E"},{"wffstr":"R","jstr":"2, 3 →E"},{"wffstr":"R","jstr":"5 Rep"}],{"wffstr":"P → R","jstr":"3–6 →I"}]`)
+
+	expectAPIStatus(t, apiRequest(t, api, "a@csumb.edu", "GET", "/sections/Logic/similarity", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity?minSimilarity=2", ""), 400, errCodeBadRequest)
+	rr := apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity?minSimilarity=0.9", "")
+	expectAPIStatus(t, rr, 200, "")
+	var report similarityReport
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	var got []string
+	for _, pair := range report.Pairs {
+		got = append(got, fmt.Sprintf("%s %s %v %d %d", pair.StudentA, pair.StudentB, pair.ExactMatch, pair.SharedErrorLines, pair.EditDistance))
+	}
+	if want := "[a@csumb.edu b@csumb.edu true 0 0 c@csumb.edu d@csumb.edu false 1 2]"; fmt.Sprint(got) != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+
+	// short proofs are left out
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity?minLines=5", "")
+	expectAPIStatus(t, rr, 200, "")
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if len(report.Pairs) != 0 {
+		t.Errorf("short proofs compared: %s", rr.Body.String())
+	}
+
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity?minSimilarity=0.9", "")
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	pair := report.Pairs[1]
+	expectAPIStatus(t, apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity/compare?a="+pair.ProofA+"&b=1", ""), 404, errCodeNotFound)
+	rr = apiRequest(t, api, instructor, "GET", "/sections/Logic/similarity/compare?a="+pair.ProofA+"&b="+pair.ProofB, "")
+	expectAPIStatus(t, rr, 200, "")
+	var view sideBySide
+	json.Unmarshal(rr.Body.Bytes(), &view)
+	var same []bool
+	for _, row := range view.Rows {
+		same = append(same, row.Same)
+	}
+	if len(view.Rows) != 7 || view.Rows[4].A.Issues == nil || view.Rows[4].A.Formula != "R" {
+		t.Errorf("side by side: %s", rr.Body.String())
+	}
+	if fmt.Sprint(same) != "[true true true true true false false]" || view.Rows[5].A != nil {
+		t.Errorf("alignment: %v", same)
+	}
+}
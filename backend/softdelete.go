@@ -0,0 +1,136 @@
+package main
+
+// Undoing deletions
+//
+// Deleting a section, an assignment or a roster entry only marks it deleted
+// (see datastore/softdelete.go). GET /deleted lists what the caller has
+// deleted in their sections, and the restore routes bring it back, a
+// section with the roster and assignments it was deleted with; what happens
+// to dropped students' proofs is up to -proof-retention (see
+// datastore/retention.go). The server purges what has been deleted for
+// longer than -purge-after, recording each purged item in the audit log.
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"datastore"
+)
+
+// how often the server looks for deletions to purge, and who the audit log
+// says purged them
+const (
+	purgeInterval = time.Hour
+	purgeActor    = "purge"
+)
+
+// the caller's deleted sections, and the deleted assignments and roster
+// entries of the sections they instruct
+func (env *Env) apiListDeleted(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	deleted, err := env.ds.GetDeleted(user.GetEmail())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	writeAPIJSON(w, 200, deleted)
+}
+
+// restore a deleted section: its instructor only
+func (env *Env) apiRestoreSection(w http.ResponseWriter, req *http.Request, params apiParams) {
+	user := req.Context().Value("tok").(userWithEmail)
+
+	deleted, err := env.ds.GetDeleted(user.GetEmail())
+	if err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	var restored *datastore.Section
+	for _, section := range deleted.Sections {
+		if section.Name == params["section"] {
+			restored = &section.Section
+		}
+	}
+	if restored == nil {
+		writeAPIError(w, 404, errCodeNotFound, "no deleted section of yours has this name")
+		return
+	}
+
+	if err := env.ds.RestoreSection(params["section"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	env.audit(req, "section.restore", params["section"], params["section"], nil, env.currentSection(params["section"]))
+	writeAPIJSON(w, 200, restored)
+}
+
+func (env *Env) apiRestoreAssignment(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	if err := env.ds.RestoreAssignment(params["section"], params["assignment"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	after := env.currentAssignment(params["section"], params["assignment"])
+	env.audit(req, "assignment.restore", params["section"], params["assignment"], nil, after)
+	writeAPIJSON(w, 200, after)
+}
+
+func (env *Env) apiRestoreRosterEntry(w http.ResponseWriter, req *http.Request, params apiParams) {
+	if !env.apiAuthorize(w, req, params["section"], false) {
+		return
+	}
+
+	if err := env.ds.RestoreRosterEntry(params["section"], params["email"]); err != nil {
+		writeDatastoreError(w, err)
+		return
+	}
+	after := env.currentRosterEntry(params["section"], params["email"])
+	env.audit(req, "roster.restore", params["section"], params["email"], nil, after)
+	writeAPIJSON(w, 200, after)
+}
+
+// purge what was deleted longer than retention ago, recording each purged
+// section, assignment and roster entry in the audit log
+func purgeDeleted(ctx context.Context, ds datastore.IProofStore, retention time.Duration) error {
+	purged, err := ds.PurgeDeleted(time.Now().Add(-retention).UTC().Format(datastore.TimeFormat))
+	if err != nil {
+		return err
+	}
+	for _, section := range purged.Sections {
+		recordAudit(ctx, ds, newAuditEntry(purgeActor, "section.purge", section.Name, section.Name, section, nil))
+	}
+	for _, assignment := range purged.Assignments {
+		recordAudit(ctx, ds, newAuditEntry(purgeActor, "assignment.purge", assignment.SectionName, assignment.Name, assignment, nil))
+	}
+	for _, rosterRow := range purged.Roster {
+		recordAudit(ctx, ds, newAuditEntry(purgeActor, "roster.purge", rosterRow.SectionName, rosterRow.UserEmail, rosterRow, nil))
+	}
+	if len(purged.Sections)+len(purged.Assignments)+len(purged.Roster) != 0 {
+		logger.Info("Deleted items purged", "sections", len(purged.Sections), "assignments", len(purged.Assignments),
+			"roster", len(purged.Roster))
+	}
+	return nil
+}
+
+// purge deletions older than retention now and every purgeInterval until
+// ctx is done, then close done
+func schedulePurge(ctx context.Context, ds datastore.IProofStore, retention time.Duration, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := purgeDeleted(ctx, ds, retention); err != nil {
+			logger.Error("schedulePurge: purge failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"datastore"
+)
+
+func TestAPIRestoreDeleted(t *testing.T) {
+	env := newTestEnv(t)
+	api := env.apiV1()
+	instructor, student, other := "instructor@csumb.edu", "student@csumb.edu", "other@csumb.edu"
+	env.ds.InsertUser(datastore.User{Email: instructor})
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 201, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster", `{"studentEmails":["student@csumb.edu"]}`), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments", `{"name":"HW 1","proofIds":[],"visibility":"true"}`), 201, "")
+
+	// a removed student and a deleted assignment come back
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic/roster/student@csumb.edu", ""), 204, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic/assignments/HW%201", ""), 204, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic/assignments/HW%201", ""), 404, errCodeNotFound)
+	rr := apiRequest(t, api, instructor, "GET", "/deleted", "")
+	expectAPIStatus(t, rr, 200, "")
+	var deleted datastore.DeletedItems
+	json.Unmarshal(rr.Body.Bytes(), &deleted)
+	if len(deleted.Roster) != 1 || deleted.Roster[0].UserEmail != student || len(deleted.Assignments) != 1 {
+		t.Errorf("deleted items: %s", rr.Body.String())
+	}
+	expectAPIStatus(t, apiRequest(t, api, other, "POST", "/sections/Logic/roster/student@csumb.edu/restore", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster/student@csumb.edu/restore", ""), 200, "")
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/roster/student@csumb.edu/restore", ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/assignments/HW%201/restore", ""), 200, "")
+	if assignments, _ := env.ds.GetAssignmentsBySection("Logic"); len(assignments) != 1 {
+		t.Errorf("assignments after restoring: %+v", assignments)
+	}
+
+	// a deleted section is gone until its instructor restores it
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic", ""), 204, "")
+	expectAPIStatus(t, apiRequest(t, api, student, "GET", "/sections/Logic", ""), 403, errCodeForbidden)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections", `{"name":"Logic"}`), 409, errCodeConflict)
+	expectAPIStatus(t, apiRequest(t, api, other, "POST", "/sections/Logic/restore", ""), 404, errCodeNotFound)
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/restore", ""), 200, "")
+	if role, err := env.ds.GetRole("Logic", student); err != nil || role != "student" {
+		t.Errorf("student of a restored section: %q %v", role, err)
+	}
+
+	// purged deletions cannot be restored, and are audited
+	expectAPIStatus(t, apiRequest(t, api, instructor, "DELETE", "/sections/Logic", ""), 204, "")
+	if err := purgeDeleted(context.Background(), env.ds, -time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expectAPIStatus(t, apiRequest(t, api, instructor, "POST", "/sections/Logic/restore", ""), 404, errCodeNotFound)
+	page, err := env.ds.QueryAudit(datastore.AuditQuery{Section: "Logic", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, entry := range page.Entries {
+		actions = append(actions, entry.Action)
+	}
+	if len(actions) != 3 || actions[0] != "section.purge" || actions[1] != "section.delete" || actions[2] != "section.restore" ||
+		page.Entries[0].Actor != purgeActor {
+		t.Errorf("audited actions: %v", actions)
+	}
+}
@@ -0,0 +1,9 @@
+// Package frontend embeds the static site so the backend binary can serve
+// it without Apache or nginx; see -frontend in the backend. The PHP files
+// are left out, as are composer files and backups.
+package frontend
+
+import "embed"
+
+//go:embed *.html *.css *.js assets
+var Files embed.FS
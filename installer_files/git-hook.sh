@@ -43,7 +43,7 @@ function updateBackend {
     [[ -f backend/backend ]] && rm backend/backend
     cd backend
     go get github.com/mattn/go-sqlite3
-    go build backend.go
+    go build -o backend .
     if [[ -x ./backend ]]; then
         sudo systemctl stop $1
         sleep 1